@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NewAdminHandler returns an http.Handler exposing the state of c to operators.
+// Mount it with http.StripPrefix to serve it under a path prefix.
+//
+//	GET /stats		the statistics of the cache including the estimated size, as JSON
+//	GET /topkeys?n=10	the statistics of the most hit keys, as JSON
+//	GET /healthz		200 if the cache is healthy, or 503 with the problems
+func NewAdminHandler(c Cache) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.Stats())
+	})
+	mux.HandleFunc("/topkeys", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		writeJSON(w, c.TopKeys(n))
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AdminServer serves the admin endpoints of caches over HTTP, for services
+// without a mux to mount NewAdminHandler into. Caches are selected by their
+// name, see AdminOptions.Caches, with the cache query parameter, which
+// defaults to the first cache.
+//
+//	GET /metrics		the statistics of all caches labeled by name, in the Prometheus text format
+//	GET /keys		the sorted keys, as JSON
+//	GET /dump		the values by key, as JSON
+//	POST /refresh?key=k	refreshes the key
+//	POST /delete?key=k	deletes the key
+//
+// The endpoints of NewAdminHandler are served as well.
+type AdminServer struct {
+	opt   AdminOptions
+	names []string
+}
+
+// AdminOptions controls the behavior of AdminServer.
+type AdminOptions struct {
+	// Caches are named by their Options.Name, or by their index if it is
+	// empty or taken by a previous cache.
+	Caches []Cache
+	// Auth authorizes each request if it is set, unauthorized requests are
+	// responded with 403. The endpoints expose keys and values, and change
+	// the caches, so Auth should be set unless addr is private.
+	Auth func(r *http.Request) bool
+}
+
+// NewAdminServer creates an AdminServer.
+func NewAdminServer(opt AdminOptions) *AdminServer {
+	s := &AdminServer{opt: opt, names: make([]string, len(opt.Caches))}
+	taken := make(map[string]bool, len(opt.Caches))
+	for i, c := range opt.Caches {
+		name := ""
+		if n, ok := c.(interface{ name() string }); ok {
+			name = n.name()
+		}
+		if name == "" || taken[name] {
+			name = strconv.Itoa(i)
+		}
+		taken[name] = true
+		s.names[i] = name
+	}
+	return s
+}
+
+// ServeAdmin serves the admin endpoints of caches on addr, see AdminServer.
+// It blocks as http.ListenAndServe does.
+func ServeAdmin(addr string, opt AdminOptions) error {
+	return http.ListenAndServe(addr, NewAdminServer(opt))
+}
+
+// ServeHTTP implements http.Handler.
+func (s *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opt.Auth != nil && !s.opt.Auth(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/metrics" {
+		s.writeMetrics(w)
+		return
+	}
+	c := s.cache(r.URL.Query().Get("cache"))
+	if c == nil {
+		http.Error(w, "unknown cache", http.StatusNotFound)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	switch r.URL.Path {
+	case "/keys":
+		var keys []string
+		c.RangeEntries(func(key string, val interface{}, meta EntryInfo) bool {
+			keys = append(keys, key)
+			return true
+		})
+		sort.Strings(keys)
+		writeJSON(w, keys)
+	case "/dump":
+		writeJSON(w, c.Dump())
+	case "/refresh", "/delete":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/delete" {
+			c.Delete(key)
+		} else if err := c.Refresh(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	default:
+		NewAdminHandler(c).ServeHTTP(w, r)
+	}
+}
+
+// cache returns the cache named name, or the first cache if name is empty.
+func (s *AdminServer) cache(name string) Cache {
+	for i, n := range s.names {
+		if n == name || name == "" {
+			return s.opt.Caches[i]
+		}
+	}
+	return nil
+}
+
+// labelEscaper escapes label values in the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// name is the Options.Name of the cache.
+func (c *cache) name() string {
+	return c.opt.Name
+}
+
+// writeMetrics writes the statistics of the caches in the Prometheus text format.
+func (s *AdminServer) writeMetrics(w http.ResponseWriter) {
+	metrics := []struct {
+		name, typ, help string
+		value           func(c Cache, st Stats) float64
+	}{
+		{"asynccache_hits_total", "counter", "Hits of the cache.",
+			func(c Cache, st Stats) float64 { return float64(st.Hits) }},
+		{"asynccache_misses_total", "counter", "Misses of the cache.",
+			func(c Cache, st Stats) float64 { return float64(st.Misses) }},
+		{"asynccache_refresh_skipped_total", "counter", "Refresh cycles skipped as the previous one was running.",
+			func(c Cache, st Stats) float64 { return float64(st.RefreshSkipped) }},
+		{"asynccache_last_refresh_cycle_seconds", "gauge", "Time taken by the last refresh cycle.",
+			func(c Cache, st Stats) float64 { return st.LastRefreshCycle.Seconds() }},
+		{"asynccache_dropped_events_total", "counter", "Handler calls dropped as the queue was full.",
+			func(c Cache, st Stats) float64 { return float64(st.DroppedEvents) }},
+		{"asynccache_estimated_size_bytes", "gauge", "Estimated memory used by the entries.",
+			func(c Cache, st Stats) float64 { return float64(st.EstimatedSize) }},
+		{"asynccache_entries", "gauge", "Number of cached entries.",
+			func(c Cache, st Stats) float64 { return float64(st.Entries) }},
+		{"asynccache_healthy", "gauge", "1 if the cache is healthy, else 0.",
+			func(c Cache, st Stats) float64 {
+				if c.Healthy() != nil {
+					return 0
+				}
+				return 1
+			}},
+	}
+	stats := make([]Stats, len(s.opt.Caches))
+	for i, c := range s.opt.Caches {
+		stats[i] = c.Stats()
+	}
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for i, c := range s.opt.Caches {
+			fmt.Fprintf(&b, "%s{cache=\"%s\"} %g\n", m.name, labelEscaper.Replace(s.names[i]), m.value(c, stats[i]))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminServer(t *testing.T) {
+	c := NewCache(Options{
+		Name:        "users",
+		EnableStats: true,
+		Fetcher: func(key string) (interface{}, error) {
+			return "v" + key, nil
+		},
+	})
+	defer c.Close()
+	c2 := NewCache(Options{})
+	defer c2.Close()
+	c.Get("b")
+	c.Get("a")
+	c.Get("a")
+	s := NewAdminServer(AdminOptions{
+		Caches: []Cache{c, c2},
+		Auth: func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "secret"
+		},
+	})
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set("Authorization", "secret")
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/keys", nil))
+	Assert(t, w.Code == http.StatusForbidden)
+
+	var keys []string
+	Assert(t, json.Unmarshal(do("GET", "/keys").Body.Bytes(), &keys) == nil)
+	DeepEqual(t, keys, []string{"a", "b"})
+	Assert(t, do("GET", "/keys?cache=users").Body.String() == do("GET", "/keys").Body.String())
+	Assert(t, do("GET", "/keys?cache=1").Body.String() == "null\n")
+	Assert(t, do("GET", "/keys?cache=0").Code == http.StatusNotFound)
+
+	body := do("GET", "/metrics").Body.String()
+	Assertf(t, strings.Contains(body, "asynccache_hits_total{cache=\"users\"} 1\n"), "metrics %s", body)
+	Assertf(t, strings.Contains(body, "asynccache_entries{cache=\"users\"} 2\n"), "metrics %s", body)
+	Assertf(t, strings.Contains(body, "asynccache_entries{cache=\"1\"} 0\n"), "metrics %s", body)
+
+	Assert(t, do("GET", "/delete?key=a").Code == http.StatusMethodNotAllowed)
+	Assert(t, do("POST", "/delete?key=a").Code == http.StatusOK)
+	Assert(t, do("POST", "/refresh?key=b").Code == http.StatusOK)
+	var dump map[string]string
+	Assert(t, json.Unmarshal(do("GET", "/dump").Body.Bytes(), &dump) == nil)
+	DeepEqual(t, dump, map[string]string{"b": "vb"})
+	Assert(t, do("GET", "/healthz").Body.String() == "ok\n")
+}
@@ -0,0 +1,51 @@
+// Package blobstore saves snapshots of a Cache to an object store, such as
+// an S3 bucket, so that ephemeral containers restore a warm cache at boot
+// from a shared bucket.
+//
+// The package does not depend on any SDK. Stores implement the small
+// BlobStore interface; S3 implements it for S3 compatible services with the
+// standard library.
+//
+// A snapshot is a dump in the format of package handoff.
+package blobstore
+
+import (
+	"bytes"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+	"github.com/MinoGump/go-asynccache/handoff"
+)
+
+// BlobStore stores blobs by key.
+type BlobStore interface {
+	// Put stores data as the blob of key, replacing the existing one.
+	Put(key string, data []byte) error
+	// Get returns the blob of key, or an error wrapping
+	// asynccache.ErrNotFound if there is none.
+	Get(key string) ([]byte, error)
+}
+
+// Save stores a snapshot of c as the blob of key. The entries caching
+// errors, nil values and values the codec fails to encode are skipped.
+func Save(c asynccache.Cache, codec asynccache.Codec, store BlobStore, key string) error {
+	var buf bytes.Buffer
+	if err := handoff.WriteDump(&buf, c, codec); err != nil {
+		return err
+	}
+	return store.Put(key, buf.Bytes())
+}
+
+// Restore sets the entries of the snapshot stored as the blob of key to c
+// by handoff.Restore, so that they keep their Lifetime and values set
+// meanwhile are kept. It returns the number of new keys.
+func Restore(c asynccache.Cache, codec asynccache.Codec, store BlobStore, key string) (int, error) {
+	data, err := store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := handoff.ReadEntries(bytes.NewReader(data), codec)
+	if err != nil {
+		return 0, err
+	}
+	return handoff.Restore(c, entries), nil
+}
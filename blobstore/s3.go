@@ -0,0 +1,150 @@
+package blobstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// S3 is a BlobStore of the objects in an S3 bucket, signing requests with
+// AWS Signature Version 4. Objects are addressed in path style, so S3
+// compatible services such as MinIO work as well.
+type S3 struct {
+	// Endpoint is the URL of the service, it defaults to
+	// https://s3.<Region>.amazonaws.com.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to the keys.
+	Prefix string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the token of temporary credentials.
+	SessionToken string
+
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Put implements BlobStore.
+func (s *S3) Put(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.error("put", key, resp)
+	}
+	return nil
+}
+
+// Get implements BlobStore.
+func (s *S3) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.error("get", key, resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s *S3) error(op, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("blobstore: %s s3://%s/%s%s: %s: %s", op, s.Bucket, s.Prefix, key, resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %v", asynccache.ErrNotFound, err)
+	}
+	return err
+}
+
+func (s *S3) do(method, key string, body []byte) (*http.Response, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	path := "/" + escape(s.Bucket) + "/" + strings.ReplaceAll(escape(s.Prefix+key), "%2F", "/")
+	req, err := http.NewRequest(method, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, path, body, time.Now().UTC())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// sign signs req by AWS Signature Version 4.
+func (s *S3) sign(req *http.Request, path string, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + path + "\n\n")
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + payload)
+
+	scope := amzDate[:8] + "/" + s.Region + "/s3/aws4_request"
+	sum = sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	k := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), amzDate[:8])
+	for _, part := range []string{s.Region, "s3", "aws4_request", toSign} {
+		k = hmacSHA256(k, part)
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+hex.EncodeToString(k))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escape escapes all bytes but the unreserved characters of RFC 3986, as
+// Signature Version 4 requires.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,247 @@
+// Package boltstore persists cached values in a bbolt database with a TTL
+// per entry, so single-node services keep their cache across restarts
+// without running Redis.
+//
+// The package does not depend on bbolt. Callers adapt a bucket of their
+// database to the small DB interface, e.g.
+//
+//	type boltDB struct {
+//		db     *bbolt.DB
+//		bucket []byte
+//	}
+//
+//	func (b boltDB) View(fn func(boltstore.Bucket) error) error {
+//		return b.db.View(func(tx *bbolt.Tx) error { return fn(tx.Bucket(b.bucket)) })
+//	}
+//
+//	func (b boltDB) Update(fn func(boltstore.Bucket) error) error {
+//		return b.db.Update(func(tx *bbolt.Tx) error { return fn(tx.Bucket(b.bucket)) })
+//	}
+//
+// The bucket MUST be created beforehand. A stored value is the unix nano
+// deadline as 8 big-endian bytes, 0 if it never expires, with the highest
+// bit set, and the unix nano time it was stored as 8 big-endian bytes,
+// followed by the value encoded by the Codec. Values without the bit set
+// have no stored time.
+package boltstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Bucket is the subset of *bbolt.Bucket used by Store.
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error
+}
+
+// DB runs read-only and read-write transactions on the bucket of Store,
+// as View and Update of *bbolt.DB do.
+type DB interface {
+	View(fn func(b Bucket) error) error
+	Update(fn func(b Bucket) error) error
+}
+
+// Store stores cached values in DB.
+type Store struct {
+	db    DB
+	codec asynccache.Codec
+	ttl   time.Duration
+}
+
+// New creates a Store of the values encoded by codec, which expire after
+// ttl, or never if ttl is not greater than 0.
+func New(db DB, codec asynccache.Codec, ttl time.Duration) *Store {
+	return &Store{db: db, codec: codec, ttl: ttl}
+}
+
+// Get returns the stored value of key, or asynccache.ErrNotFound if it is
+// not stored or expired.
+func (s *Store) Get(key string) (interface{}, error) {
+	var data []byte
+	err := s.db.View(func(b Bucket) error {
+		v := b.Get([]byte(key))
+		if v == nil || expired(v, time.Now()) {
+			return asynccache.ErrNotFound
+		}
+		// v is only valid in the transaction
+		data = append([]byte(nil), payload(v)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.codec.Unmarshal(data)
+}
+
+// Put stores the value of key with the TTL of the Store, it can be used as
+// Options.Writer.
+func (s *Store) Put(key string, val interface{}) error {
+	return s.PutTTL(key, val, s.ttl)
+}
+
+// PutTTL stores the value of key expiring after ttl, or never if ttl is
+// not greater than 0.
+func (s *Store) PutTTL(key string, val interface{}, ttl time.Duration) error {
+	v, err := s.encode(val, ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(b Bucket) error {
+		return b.Put([]byte(key), v)
+	})
+}
+
+// PutBatch stores the values in one transaction, it can be used as
+// Options.BatchWriter.
+func (s *Store) PutBatch(vals map[string]interface{}) error {
+	now := time.Now()
+	encoded := make(map[string][]byte, len(vals))
+	for k, val := range vals {
+		v, err := s.encode(val, s.ttl, now)
+		if err != nil {
+			return err
+		}
+		encoded[k] = v
+	}
+	return s.db.Update(func(b Bucket) error {
+		for k, v := range encoded {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete deletes the stored value of key.
+func (s *Store) Delete(key string) error {
+	return s.db.Update(func(b Bucket) error {
+		return b.Delete([]byte(key))
+	})
+}
+
+// Fetcher returns a Fetcher reading through the Store: keys not stored are
+// fetched by origin and then stored. Refreshes of a cache using it are
+// served by the Store until the values expire.
+func (s *Store) Fetcher(origin func(key string) (interface{}, error)) func(key string) (interface{}, error) {
+	return func(key string) (interface{}, error) {
+		val, err := s.Get(key)
+		if !errors.Is(err, asynccache.ErrNotFound) {
+			return val, err
+		}
+		if val, err = origin(key); err != nil {
+			return nil, err
+		}
+		return val, s.Put(key, val)
+	}
+}
+
+// Load sets the values stored and not expired to c by SetDefault, and
+// returns the number of new keys. The SoftTTL and HardTTL of c count from
+// the time the values were stored, see asynccache.WithLifetime.
+func (s *Store) Load(c asynccache.Cache) (int, error) {
+	now := time.Now()
+	data := make(map[string][]byte)
+	err := s.db.View(func(b Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			if !expired(v, now) {
+				data[string(k)] = append([]byte(nil), v...)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for k, v := range data {
+		val, err := s.codec.Unmarshal(payload(v))
+		if err != nil {
+			return n, err
+		}
+		if !c.SetDefault(k, asynccache.WithLifetime(val, asynccache.Lifetime{Stored: stored(v)})) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Purge deletes the expired values, and returns the number of them.
+func (s *Store) Purge() (int, error) {
+	now := time.Now()
+	var keys [][]byte
+	err := s.db.Update(func(b Bucket) error {
+		err := b.ForEach(func(k, v []byte) error {
+			if expired(v, now) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// bbolt forbids modifying the bucket within ForEach
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+func (s *Store) encode(val interface{}, ttl time.Duration, now time.Time) ([]byte, error) {
+	data, err := s.codec.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]byte, 16+len(data))
+	var deadline uint64
+	if ttl > 0 {
+		deadline = uint64(now.Add(ttl).UnixNano())
+	}
+	binary.BigEndian.PutUint64(v, deadline|timed)
+	binary.BigEndian.PutUint64(v[8:], uint64(now.UnixNano()))
+	copy(v[16:], data)
+	return v, nil
+}
+
+// timed is the bit of the deadline set if the stored time follows.
+const timed = 1 << 63
+
+// expired reports whether the stored value v is expired or malformed.
+func expired(v []byte, now time.Time) bool {
+	if len(v) < 8 || binary.BigEndian.Uint64(v)&timed != 0 && len(v) < 16 {
+		return true
+	}
+	deadline := binary.BigEndian.Uint64(v) &^ timed
+	return deadline != 0 && int64(deadline) <= now.UnixNano()
+}
+
+// payload returns the encoded value of the stored value v, which is not
+// malformed.
+func payload(v []byte) []byte {
+	if binary.BigEndian.Uint64(v)&timed != 0 {
+		return v[16:]
+	}
+	return v[8:]
+}
+
+// stored returns the time the value v was stored, zero if unknown.
+func stored(v []byte) time.Time {
+	if binary.BigEndian.Uint64(v)&timed == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v[8:])))
+}
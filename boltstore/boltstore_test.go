@@ -0,0 +1,122 @@
+package boltstore
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+	"github.com/MinoGump/go-asynccache/cachetest"
+)
+
+// memBucket is a Bucket in memory, and its own DB.
+type memBucket map[string][]byte
+
+func (m memBucket) Get(key []byte) []byte { return m[string(key)] }
+
+func (m memBucket) Put(key, value []byte) error {
+	m[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m memBucket) Delete(key []byte) error {
+	delete(m, string(key))
+	return nil
+}
+
+func (m memBucket) ForEach(fn func(k, v []byte) error) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m memBucket) View(fn func(b Bucket) error) error   { return fn(m) }
+func (m memBucket) Update(fn func(b Bucket) error) error { return fn(m) }
+
+func TestStore(t *testing.T) {
+	db := memBucket{}
+	s := New(db, asynccache.StringCodec{}, time.Hour)
+	if err := s.Put("a", "va"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutTTL("short", "vs", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutTTL("forever", "vf", 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	if v, err := s.Get("a"); err != nil || v != "va" {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+	if _, err := s.Get("short"); !errors.Is(err, asynccache.ErrNotFound) {
+		t.Fatalf("Get of expired = %v", err)
+	}
+	if n, err := s.Purge(); err != nil || n != 1 || len(db) != 2 {
+		t.Fatalf("Purge = %v, %v", n, err)
+	}
+
+	now := time.Now()
+	c := asynccache.NewCache(asynccache.Options{})
+	defer c.Close()
+	c.Set("a", "new")
+	if n, err := s.Load(c); err != nil || n != 1 {
+		t.Fatalf("Load = %v, %v", n, err)
+	}
+	if data := c.Dump(); len(data) != 2 || data["a"] != "new" || data["forever"] != "vf" {
+		t.Fatalf("Dump = %v", data)
+	}
+	if lt := c.Snapshot().Lifetime("forever"); !lt.Stored.Before(now) {
+		t.Fatalf("Lifetime = %+v", lt)
+	}
+
+	s.Delete("a")
+	if _, err := s.Get("a"); !errors.Is(err, asynccache.ErrNotFound) {
+		t.Fatalf("Get of deleted = %v", err)
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	s := New(memBucket{}, asynccache.StringCodec{}, 0)
+	calls := 0
+	fetch := s.Fetcher(func(key string) (interface{}, error) {
+		calls++
+		if key == "bad" {
+			return nil, errors.New("bad")
+		}
+		return "v" + key, nil
+	})
+	for i := 0; i < 2; i++ {
+		if v, err := fetch("a"); err != nil || v != "va" {
+			t.Fatalf("fetch = %v, %v", v, err)
+		}
+	}
+	if _, err := fetch("bad"); err == nil {
+		t.Fatal("fetch of bad succeeds")
+	}
+	if calls != 2 {
+		t.Fatalf("origin called %d times", calls)
+	}
+	if err := s.PutBatch(map[string]interface{}{"b": "vb", "c": "vc"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := fetch("c"); v != "vc" {
+		t.Fatalf("fetch = %v", v)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	cachetest.TestStore(t, func() cachetest.Store {
+		return New(memBucket{}, asynccache.StringCodec{}, time.Hour)
+	})
+}
@@ -0,0 +1,95 @@
+package cache
+
+import "time"
+
+// BytesOptions controls the behavior of BytesCache.
+type BytesOptions struct {
+	// Fetcher MUST be set. If RefreshDuration is greater than 0, cached keys
+	// are refreshed by Fetcher periodically.
+	Fetcher         func(key string) ([]byte, error)
+	RefreshDuration time.Duration
+
+	// If ExpireDuration is greater than 0, keys not accessed during it are deleted.
+	ExpireDuration time.Duration
+
+	// ErrorHandler is called one at a time in order, and Close waits for
+	// the queued calls.
+	ErrorHandler func(key string, err error)
+
+	// Cache is the options of the cache wrapped, for the features without
+	// options above, such as SoftTTL, HardTTL, CompressThreshold and
+	// Interceptors. Its Fetcher and ErrorHandler are replaced.
+	Cache Options
+}
+
+// BytesCache is a cache specialized for []byte values, such as serialized
+// payloads of proxies. It wraps a cache created by NewCache, whose hits do
+// not allocate, and AppendGet copies values into buffers of the caller,
+// which may be pooled.
+//
+// Values returned by Get are shared and MUST NOT be modified.
+type BytesCache struct {
+	c *cache
+}
+
+// NewBytesCache creates a BytesCache.
+func NewBytesCache(opt BytesOptions) *BytesCache {
+	if opt.Fetcher == nil {
+		panic("asynccache: Fetcher MUST be set")
+	}
+	copt := opt.Cache
+	if opt.RefreshDuration > 0 {
+		copt.EnableRefresh = true
+		copt.RefreshDuration = opt.RefreshDuration
+	}
+	if opt.ExpireDuration > 0 {
+		copt.EnableExpire = true
+		copt.ExpireDuration = opt.ExpireDuration
+	}
+	copt.Fetcher = func(key string) (interface{}, error) {
+		val, err := opt.Fetcher(key)
+		if err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+	copt.ErrorHandler = opt.ErrorHandler
+	return &BytesCache{c: NewCache(copt).(*cache)}
+}
+
+// Get returns the value of given key, fetching it on miss. As Cache does,
+// errors of the first fetching are cached until a refresh succeeds.
+func (c *BytesCache) Get(key string) ([]byte, error) {
+	val, err := c.c.Get(key)
+	b, _ := val.([]byte)
+	return b, err
+}
+
+// AppendGet appends the value of given key to dst and returns the extended buffer.
+func (c *BytesCache) AppendGet(dst []byte, key string) ([]byte, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, val...), nil
+}
+
+// Set sets the value of given key, val MUST NOT be modified afterwards.
+func (c *BytesCache) Set(key string, val []byte) {
+	c.c.Set(key, val)
+}
+
+// Delete deletes the given key.
+func (c *BytesCache) Delete(key string) {
+	c.c.Delete(key)
+}
+
+// Close stops the background goroutines, cached values are kept read-only.
+func (c *BytesCache) Close() {
+	c.c.Close()
+}
+
+// IsClosed reports whether the cache is closed.
+func (c *BytesCache) IsClosed() bool {
+	return c.c.IsClosed()
+}
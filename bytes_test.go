@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBytesCache(t *testing.T) {
+	var fail int32
+	c := NewBytesCache(BytesOptions{
+		Fetcher: func(key string) ([]byte, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return nil, errors.New("fail")
+			}
+			return []byte(key + "-value"), nil
+		},
+		RefreshDuration: 50 * time.Millisecond,
+	})
+	defer c.Close()
+
+	val, err := c.Get("a")
+	Assert(t, err == nil && string(val) == "a-value")
+	buf, err := c.AppendGet([]byte("x:"), "a")
+	Assert(t, err == nil && string(buf) == "x:a-value")
+
+	c.Set("b", []byte("set"))
+	val, _ = c.Get("b")
+	Assert(t, string(val) == "set")
+	time.Sleep(100 * time.Millisecond)
+	val, _ = c.Get("b")
+	Assert(t, string(val) == "b-value")
+
+	atomic.StoreInt32(&fail, 1)
+	_, err = c.Get("c")
+	Assert(t, err != nil && err.Error() == `asynccache: fetch "c": fail`)
+	atomic.StoreInt32(&fail, 0)
+	time.Sleep(100 * time.Millisecond)
+	val, err = c.Get("c")
+	Assert(t, err == nil && string(val) == "c-value")
+
+	c.Delete("c")
+	c.Close()
+	_, err = c.Get("c")
+	Assert(t, err == ErrClosed)
+}
+
+func TestBytesCacheErrorHandler(t *testing.T) {
+	var errs []error
+	c := NewBytesCache(BytesOptions{
+		Fetcher: func(key string) ([]byte, error) {
+			return nil, errors.New("fail")
+		},
+		RefreshDuration: 10 * time.Millisecond,
+		ErrorHandler: func(key string, err error) {
+			errs = append(errs, err)
+		},
+	})
+	c.Set("a", []byte("set"))
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	Assert(t, len(errs) > 0 && errs[0].Error() == `asynccache: refresh "a": fail`)
+}
+
+func TestBytesCacheGetNoAlloc(t *testing.T) {
+	c := NewBytesCache(BytesOptions{
+		Fetcher: func(key string) ([]byte, error) {
+			return []byte(key), nil
+		},
+	})
+	c.Get("key")
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Get("key")
+	})
+	Assert(t, allocs == 0)
+}
+
+func TestBytesCacheOptions(t *testing.T) {
+	var fetches int32
+	c := NewBytesCache(BytesOptions{
+		Fetcher: func(key string) ([]byte, error) {
+			atomic.AddInt32(&fetches, 1)
+			return []byte(strings.Repeat(key, 100)), nil
+		},
+		Cache: Options{HardTTL: 20 * time.Millisecond, CompressThreshold: 10},
+	})
+	defer c.Close()
+
+	val, err := c.Get("a")
+	Assert(t, err == nil && string(val) == strings.Repeat("a", 100))
+	time.Sleep(30 * time.Millisecond)
+	val, err = c.Get("a")
+	Assert(t, err == nil && string(val) == strings.Repeat("a", 100))
+	Assert(t, atomic.LoadInt32(&fetches) == 2)
+}
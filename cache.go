@@ -1,7 +1,7 @@
 package cache
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -10,321 +10,1483 @@ import (
 
 // Options controls the behavior of AsyncCache.
 type Options struct {
-	// if EnableRefresh is true, Fetcher and RefreshDuration MUST be set.
+	// Name labels the background goroutines of the cache in profiles, see
+	// runtime/pprof.Labels.
+	Name string
+
+	// if EnableRefresh is true, Fetcher (or Loader) and RefreshDuration MUST be set.
 	EnableRefresh   bool
 	RefreshDuration time.Duration
 	Fetcher         func(key string) (interface{}, error)
+	// Loader is used as Fetcher if Fetcher is nil.
+	Loader Loader
+	// BatchFetcher fetches many keys at once for GetOrSetMulti, the keys
+	// absent in its result are failures. Get and the refresh still use Fetcher.
+	BatchFetcher func(keys []string) (map[string]interface{}, error)
+	// Transformers are applied in order to the values fetched by Fetcher,
+	// BatchFetcher and DataFetcher before they are stored, e.g. to parse or
+	// index them once per fetch rather than on every Get. An error of them
+	// is a fetch failure.
+	Transformers []func(key string, val interface{}) (interface{}, error)
+	// Validator checks the values fetched by Fetcher, BatchFetcher and
+	// DataFetcher, after Transformers. A value it rejects is a fetch failure with a
+	// ValidationError, so that a refresh keeps the cached value, e.g. when
+	// the upstream returns an empty routing table.
+	Validator func(key string, val interface{}) error
+	// KeyLister lists the keys of the upstream keyspace. If it is set, each
+	// refresh cycle only refreshes the listed keys, and fetches the listed
+	// keys not cached yet, so that the cache mirrors the upstream keyspace.
+	// Cached keys no longer listed are not refreshed any more.
+	KeyLister func() ([]string, error)
+	// If MirrorKeys is true, cached keys no longer listed by KeyLister are
+	// deleted each refresh cycle, and misses of keys not in the last listing
+	// are not fetched: Get returns ErrNotFound, and GetOrSet the default value.
+	MirrorKeys bool
+	// PriorityFunc returns the refresh priority of a key, keys of higher
+	// priorities are refreshed first in each cycle.
+	PriorityFunc func(key string) int
+	// If RefreshCycleTimeout is greater than 0, a refresh cycle stops once it
+	// takes longer, skipping the keys of the lowest priorities. The skipped
+	// keys are refreshed first among the keys of the same priority next cycle.
+	RefreshCycleTimeout time.Duration
+	// If RefreshLock is set, each refresh cycle first acquires it for
+	// RefreshDuration, and is skipped unless the lock is acquired, so that a
+	// single instance of a fleet refreshes per interval. The instance should
+	// publish its changes to the others, e.g. by redislock.Publisher. The
+	// instances MUST share one key set, listed by KeyLister or fetched by
+	// SnapshotFetcher: the instance holding the lock refreshes and fetches
+	// all the keys, also the ones cached by the others only.
+	RefreshLock DistributedLock
+	// RefreshShard returns the index of the instance among count instances,
+	// as an alternative to RefreshLock: each refresh cycle only refreshes the
+	// keys of its shard by ShardOf, and the instance should publish its
+	// changes to the others, e.g. by redislock.Publisher. It is called every
+	// cycle to follow the membership, see discovery.Discovery.Shard; an
+	// index out of range refreshes no keys. It is ignored by SnapshotFetcher.
+	RefreshShard func() (index, count int)
+	// SnapshotFetcher fetches the whole dataset with its version, as an
+	// alternative to Fetcher. It is called by NewCache and each refresh
+	// cycle, and a new version is diffed against the cached entries: added
+	// and changed keys are stored and reported to ChangeHandler (with a nil
+	// old value for added keys), missing keys are deleted and reported to
+	// DeleteHandler. Misses are not fetched unless Fetcher is set too.
+	SnapshotFetcher func() (data map[string]interface{}, version string, err error)
 
 	// if EnableRefresh is false, DataFetcher MUST be set. DataFetcher is used for GetOrReset function
 	DataFetcher func(val interface{}) (interface{}, error)
+	// If RefreshResets is true, entries created by GetOrReset keep their reset
+	// values, and are refreshed by DataFetcher every RefreshDuration, even if
+	// EnableRefresh is false.
+	RefreshResets bool
+	// If StoreResetVals is true, the last non-nil reset value passed to
+	// GetOrReset is stored per key, also after the entry expires, and
+	// GetOrReset with a nil reset value uses the stored one. Delete removes it.
+	StoreResetVals bool
+	// If FixedResetExpiry is true, entries created by GetOrReset expire
+	// ExpireDuration after they are created however often they are read,
+	// as if created by GetOrResetWithTTL with ExpireDuration, e.g. for rate
+	// limit windows. Otherwise reads keep them alive as other entries.
+	FixedResetExpiry bool
 
 	// If EnableExpire is true, ExpireDuration MUST be set.
 	EnableExpire   bool
 	ExpireDuration time.Duration
+	// If ExpireDeadlines is true, entries are deleted once their HardTTL
+	// elapses, also the TTL of WithTTL, WithLifetime and GetOrResetWithTTL,
+	// by a timer on a min-heap of the deadlines, which only touches the
+	// entries due. Otherwise they are deleted by the first access past it,
+	// or by expire cycles. It does not need EnableExpire, and does not index
+	// the idle expiry of EnableExpire, whose cycles still visit every entry.
+	ExpireDeadlines bool
+	// If ExpireChunks is greater than 1, each expire cycle is spread over
+	// ExpireDuration: every ExpireDuration/ExpireChunks, the next chunk of
+	// 1/ExpireChunks of the keys is swept, in the order they were stored,
+	// which smooths the CPU of sweeping very large caches. Keys not accessed
+	// are still deleted after about one to two ExpireDuration.
+	ExpireChunks int
+
+	// If SoftTTL is greater than 0, values stored longer ago are still
+	// served, but Get and GetOrSet refresh them in background. If HardTTL is
+	// greater than 0, values stored longer ago are not served: the entry is
+	// deleted and fetched again as a miss. Fetcher may override both for a
+	// value by returning WithTTL.
+	SoftTTL time.Duration
+	HardTTL time.Duration
+
+	// Writer writes the value to the backing store, it MUST be set to use Put.
+	Writer func(key string, val interface{}) error
+
+	// If EnableWriteBehind is true, Writer or BatchWriter MUST be set to use PutAsync.
+	// Values put by PutAsync are written every WriteBehindInterval (default 1s) or
+	// once WriteBehindBatchSize (default 100) keys are pending. Failed writes are
+	// retried WriteBehindRetries times after WriteBehindRetryBackoff, and then
+	// reported to ErrorHandler.
+	EnableWriteBehind       bool
+	WriteBehindInterval     time.Duration
+	WriteBehindBatchSize    int
+	WriteBehindRetries      int
+	WriteBehindRetryBackoff time.Duration
+	// BatchWriter writes a batch of values at once, it takes precedence over Writer for PutAsync.
+	BatchWriter func(vals map[string]interface{}) error
 
 	// Handlers (just like middleware)
 	ErrorHandler  func(key string, err error)
 	ChangeHandler func(key string, oldData, newData interface{})
-	DeleteHandler func(key string, oldData interface{})
+	// DeleteHandler is called with the value of a deleted entry, and why it is deleted.
+	DeleteHandler func(key string, oldData interface{}, reason DeleteReason)
+	// Finalizer is called with the values replaced or deleted from the cache,
+	// once DeleteHandler and ChangeHandler calls with them return. If it is
+	// nil, such values implementing io.Closer are closed.
+	Finalizer func(val interface{})
+	// OnFetchError decides how a refresh failure is handled, see ErrorVerdict.
+	// It is called synchronously before ErrorHandler.
+	OnFetchError func(key string, err error) ErrorVerdict
+	// RefreshReportHandler is called with the report of each refresh cycle
+	// of Fetcher or DataFetcher, e.g. to alert on the ratio of failed keys.
+	// Keys newly listed by KeyLister and fetched by the cycle are not counted.
+	RefreshReportHandler func(report RefreshReport)
+	// The handlers are called one at a time in order by a queue of
+	// HandlerQueueSize (default 1024) calls, which are dropped and counted by
+	// Stats.DroppedEvents once the queue is full. Close waits for the queued
+	// calls, so handlers MUST not call Close.
+	HandlerQueueSize int
 
 	IsSame     func(key string, oldData, newData interface{}) bool
 	ErrLogFunc func(str string)
+
+	// If MinChangeInterval is greater than 0, a refresh changing a value
+	// changed by a refresh less than MinChangeInterval ago is held back until
+	// the interval passes. Then the last value refreshed meanwhile is stored
+	// and reported to ChangeHandler, unless it equals the cached value by
+	// IsSame (reflect.DeepEqual if IsSame is nil), so that upstream values
+	// flapping back and forth cause no churn.
+	MinChangeInterval time.Duration
+
+	// ShadowFetcher is called alongside Fetcher on refresh to validate a new
+	// data source. Its results are never stored, but compared with those of
+	// Fetcher by IsSame (reflect.DeepEqual if IsSame is nil), and mismatches
+	// are reported to ShadowMismatchHandler.
+	ShadowFetcher         func(key string) (interface{}, error)
+	ShadowMismatchHandler func(key string, val, shadowVal interface{}, err, shadowErr error)
+
+	// Fetchers are redundant upstreams of the same data, used as Fetcher by
+	// FetchStrategy if Fetcher is nil, e.g. to cross-check critical data by
+	// Quorum. FetchMismatchHandler is called with the results of each Quorum
+	// fetch in which some fetcher fails or disagrees.
+	Fetchers             []func(key string) (interface{}, error)
+	FetchStrategy        FetchStrategy
+	FetchMismatchHandler func(key string, vals []interface{}, errs []error)
+
+	// If EnableStats is true, hits and misses are counted for Stats.
+	EnableStats bool
+	// If EnableKeyStats is true, hits and last access time of each key are
+	// tracked for TopKeys, at the cost of memory per entry.
+	EnableKeyStats bool
+	// If StatsSampleRate is greater than 1, only 1 in StatsSampleRate accesses
+	// is recorded and counts are scaled, to keep statistics cheap for very
+	// large caches. Statistics become estimations then.
+	StatsSampleRate int
+
+	// Weigher estimates the memory of a key and its value in bytes for
+	// EstimatedSize, it defaults to DefaultWeigher.
+	Weigher func(key string, val interface{}) int64
+
+	// If MemoryHighWatermark is greater than 0, the estimated size is checked
+	// every MemoryCheckInterval (default 10s). Once it exceeds the high
+	// watermark, entries are evicted by MemoryEvictPolicy until it is below
+	// MemoryLowWatermark (default 80% of the high watermark).
+	MemoryHighWatermark int64
+	MemoryLowWatermark  int64
+	MemoryCheckInterval time.Duration
+	MemoryEvictPolicy   EvictPolicy
+
+	// EventHandler receives the events of the cache.
+	EventHandler func(ev Event)
+
+	// If CompressThreshold is greater than 0, []byte and string values longer
+	// than it are stored compressed by Compressor (default GzipCompressor),
+	// and decompressed on reads transparently. The DecompressedCacheSize
+	// (default 64) most recently read values are kept decompressed.
+	CompressThreshold     int
+	Compressor            Compressor
+	DecompressedCacheSize int
+
+	// If BackgroundFetch is true, misses never wait for Fetcher: Get returns
+	// ErrNotReady and GetOrSet returns the default value at once, while the
+	// key is fetched in background. Keys warmed up by SetDefault are hits.
+	BackgroundFetch bool
+
+	// ErrorPolicy controls how GetOrSet treats errors, see ReplaceWithDefault,
+	// KeepErrorAndReturnDefault and RetryFetch.
+	ErrorPolicy ErrorPolicy
+
+	// NilPolicy controls how nil values fetched by Fetcher and BatchFetcher
+	// are treated, see TreatNilAsValue, TreatNilAsDelete and TreatNilAsError.
+	NilPolicy NilPolicy
+
+	// If FirstFetchTimeout is greater than 0, GetOrSet returns the default
+	// value once the first fetch of a key takes longer than it, see GetOrSetWithTimeout.
+	FirstFetchTimeout time.Duration
+
+	// If MaxConcurrentFetches is greater than 0, at most MaxConcurrentFetches
+	// Fetcher calls of distinct keys run at once on misses, and the excess ones
+	// wait for a free slot, or fail with ErrTooManyFetches if FailFastFetches is true.
+	MaxConcurrentFetches int
+	FailFastFetches      bool
+
+	// TenantFunc returns the tenant of a key, such as TenantPrefix, to track
+	// TenantStats and enforce TenantQuota. Keys of the empty tenant are not tracked.
+	TenantFunc func(key string) string
+	// If TenantQuota is greater than 0, at most TenantQuota entries of each
+	// tenant are cached, the values of more keys are returned without caching.
+	TenantQuota int
+
+	// If ChangeLogSize is greater than 0, the last ChangeLogSize changes of
+	// the entries are logged with sequence numbers for Changes.
+	ChangeLogSize int
+	// WAL appends every change of the entries in order, see package wal.
+	// The changes are appended by a goroutine rather than by the writes,
+	// which only wait once HandlerQueueSize changes are queued. Flush waits
+	// for the changes queued, and Close appends them.
+	WAL ChangeAppender
+
+	// If Leader is set, the cache follows it as a read replica: the Changes
+	// of Leader, which MUST set ChangeLogSize, are applied every FollowInterval
+	// (default 1s), with the Lifetime they have on Leader. Fetcher defaults
+	// to Leader.Get.
+	Leader         Cache
+	FollowInterval time.Duration
+
+	// If HealthMaxRefreshFailures is greater than 0, Healthy reports the
+	// cache unhealthy when the last refresh cycle failed for more keys.
+	HealthMaxRefreshFailures int
+	// If HealthMaxRefreshAge is greater than 0, Healthy reports the cache
+	// unhealthy when no refresh cycle has completed for longer, e.g. because
+	// the refresher is stuck.
+	HealthMaxRefreshAge time.Duration
+
+	// If EnableWatchdog is true, panics of the refresher and expirer goroutines
+	// are recovered, and the goroutines are restarted every WatchdogInterval
+	// (default 10s) with EventLoopRestarted emitted.
+	EnableWatchdog   bool
+	WatchdogInterval time.Duration
+
+	// KeyFunc normalizes keys passed to the cache, such as lowercasing or
+	// trimming them, before they are stored or fetched. It should be idempotent.
+	KeyFunc func(key string) string
+	// KeyEncoder encodes the keys passed to Fetcher, Loader, BatchFetcher,
+	// Writer and BatchWriter, which talk to remote tiers and persistence,
+	// such as adding an environment prefix or hashing long keys. KeyDecoder
+	// decodes the keys listed by KeyLister and SnapshotFetcher, skipping the
+	// keys it does not decode. See PrefixKeys and HashLongKeys.
+	KeyEncoder KeyEncoder
+	KeyDecoder KeyDecoder
+
+	// Interceptors intercept the operations in order, the first one is the outermost.
+	Interceptors []Interceptor
+
+	// ClosedBehavior controls how a closed cache serves reads, see ClosedReadOnly and ClosedReject.
+	ClosedBehavior ClosedBehavior
 }
 
-// Cache .
+// ClosedBehavior is the behavior of a closed cache.
+//
+// Whatever the behavior is, a closed cache never fetches or stores values:
+// misses of Get and Refresh return ErrClosed, misses of GetOrSet return the
+// default value, misses of GetOrReset return nil, SetDefault and Set are
+// ignored, and Put and PutAsync return ErrClosed.
+type ClosedBehavior int
+
+const (
+	// ClosedReadOnly keeps serving the cached data read-only.
+	ClosedReadOnly ClosedBehavior = iota
+	// ClosedReject treats all reads as misses.
+	ClosedReject
+)
+
+// ErrorPolicy is the policy of GetOrSet for errors of fetching.
+type ErrorPolicy int
+
+const (
+	// ReplaceWithDefault caches the default value in place of the error,
+	// until the next successful refresh.
+	ReplaceWithDefault ErrorPolicy = iota
+	// KeepErrorAndReturnDefault returns the default value, but keeps the error
+	// cached, so the default value is transient.
+	KeepErrorAndReturnDefault
+	// RetryFetch is like KeepErrorAndReturnDefault, but fetches again first
+	// if an error is cached.
+	RetryFetch
+)
+
+// NilPolicy is the policy for nil values fetched without error.
+type NilPolicy int
+
+const (
+	// TreatNilAsValue caches nil as the value of the key.
+	TreatNilAsValue NilPolicy = iota
+	// TreatNilAsDelete treats the key as absent: a miss is not cached, Get
+	// returns ErrNotFound and GetOrSet the default value, and a refresh
+	// deletes the entry.
+	TreatNilAsDelete
+	// TreatNilAsError treats nil as the fetch failure ErrNilValue, which is
+	// handled as other errors of Fetcher.
+	TreatNilAsError
+)
+
+// Cache is the interface of caches, composed of Reader, Writer, Refresher
+// and Closer, so that consumers and their mocks may depend on the parts
+// they use only.
 type Cache interface {
-	// SetDefault sets the default value of given key if it is new to the cache.
-	// It is useful for cache warming up.
-	// Param val should not be nil.
-	SetDefault(key string, val interface{}) (exist bool)
+	Reader
+	Writer
+	Refresher
+	Closer
+
+	// Changes returns the changes after the sequence number sinceSeq, in the
+	// order of sequence numbers. Pass the Seq of the last record to get the
+	// following changes. If the changes since sinceSeq are no longer logged,
+	// or sinceSeq is ahead of the cache as it was restarted since, a
+	// ChangeReset record is returned, followed by the whole cache.
+	Changes(sinceSeq uint64) []ChangeRecord
+
+	// TopKeys returns the statistics of the n most hit keys, or all keys if n <= 0.
+	// It returns nil unless EnableKeyStats is true.
+	TopKeys(n int) []KeyStat
+
+	// TenantStats returns the statistics of the tenant.
+	TenantStats(id string) TenantStats
 
+	// PurgeTenant deletes the entries of the tenant, and returns the number of deleted entries.
+	PurgeTenant(id string) int
+
+	// Healthy returns the problems of the cache, or nil if it is healthy.
+	Healthy() error
+
+	// Stats returns the statistics of the cache.
+	Stats() Stats
+
+	// EstimatedSize returns the estimated memory used by the entries in bytes.
+	EstimatedSize() int64
+}
+
+// Reader is the reading part of Cache. The reads of missing keys fetch them.
+type Reader interface {
 	// Get tries to fetch a value corresponding to the given key from the cache.
 	// If error occurs during the first time fetching, it will be cached until the
 	// sequential fetching triggered by the refresh goroutine succeed.
 	Get(key string) (val interface{}, err error)
 
+	// GetWithTimeout is like Get, but returns ErrFetchTimeout if the first
+	// fetch of the key takes longer than timeout. The fetch goes on in
+	// background, and populates the cache when done.
+	GetWithTimeout(key string, timeout time.Duration) (val interface{}, err error)
+
+	// Acquire gets the value of given key as Get does, and returns a Handle
+	// holding it: the value is not finalized (see Finalizer) before the
+	// Handle is released, which allows sharing large values safely.
+	Acquire(key string) (Handle, error)
+
 	// GetOrSet tries to fetch a value corresponding to the given key from the cache.
 	// If the key is not yet cached or error occurs, the default value will be set.
 	GetOrSet(key string, defaultVal interface{}) (val interface{})
 
+	// GetOrSetWithTimeout is like GetOrSet, but returns the default value if
+	// the first fetch of the key takes longer than timeout, and reports
+	// ErrFetchTimeout to ErrorHandler. The fetch goes on in background, and
+	// populates the cache when done.
+	GetOrSetWithTimeout(key string, def interface{}, timeout time.Duration) (val interface{})
+
+	// GetOrSetMulti is like GetOrSet for the keys of defaults at once, and
+	// returns their values. The keys not cached are fetched by one call of
+	// BatchFetcher if it is set, unless a concurrent miss is fetching them
+	// already, and failures get their defaults. BackgroundFetch and
+	// FirstFetchTimeout apply to the call as they do to GetOrSet.
+	GetOrSetMulti(defaults map[string]interface{}) map[string]interface{}
+
+	// GetAll gets the values of keys as Get does, which are consistent: no
+	// write happened while they were read. It also returns a sequence number
+	// of the writes, which changes once any key is written. Errors of keys are
+	// joined, and their values are absent.
+	GetAll(keys ...string) (map[string]interface{}, uint64, error)
+
 	// GetOrReset tries to fetch a value corresponding to the given key from the cache.
 	// If the key is not yet cached or error occurs, cache will generate a new value by resetVal and DataFetcher
 	GetOrReset(key string, resetVal interface{}) (val interface{})
 
+	// GetOrResetWithTTL is like GetOrReset, but the value generated expires
+	// after ttl instead of HardTTL, also if refreshed with RefreshResets.
+	GetOrResetWithTTL(key string, resetVal interface{}, ttl time.Duration) (val interface{})
+
 	// Dump dumps all cache entries.
 	// This will not cause expire to refresh.
 	Dump() map[string]interface{}
 
+	// Snapshot returns an immutable point-in-time view of all cached entries.
+	Snapshot() *Snapshot
+
+	// RangeEntries calls fn for each cached entry with its metadata, including
+	// the entries holding errors, until fn returns false. Unlike Dump, it does
+	// not copy the entries.
+	RangeEntries(fn func(key string, val interface{}, meta EntryInfo) bool)
+
+	// Errors returns the keys currently caching an error, with the errors.
+	Errors() map[string]error
+}
+
+// Writer is the writing part of Cache.
+type Writer interface {
+	// SetDefault sets the default value of given key if it is new to the cache.
+	// It is useful for cache warming up.
+	// Param val should not be nil, and may be wrapped by WithLifetime.
+	SetDefault(key string, val interface{}) (exist bool)
+
+	// Set sets the value of given key, replacing the cached one.
+	// ChangeHandler is called as the refresh does if the value is changed.
+	// Param val may be wrapped by WithTTL or WithLifetime.
+	Set(key string, val interface{})
+
+	// Lease grants the right to set the key by SetWithLease within ttl.
+	// Meanwhile refreshes of the key do not store fetched values, so that a
+	// read-modify-write spanning the cache and the origin is not overwritten
+	// by a refresh racing with it. It returns ErrLeased if the key is leased.
+	Lease(key string, ttl time.Duration) (LeaseToken, error)
+
+	// SetWithLease sets the value of the key as Set does and releases the
+	// lease. It returns ErrLeaseExpired unless token is the live lease of the key.
+	SetWithLease(key string, val interface{}, token LeaseToken) error
+
+	// Put writes the value of given key to the backing store by Writer,
+	// and sets it to the cache if the writing succeeds.
+	Put(key string, val interface{}) error
+
+	// PutAsync sets the value of given key to the cache, and enqueues it to be
+	// written to the backing store in background.
+	PutAsync(key string, val interface{}) error
+
+	// Flush writes all values enqueued by PutAsync, and the changes queued
+	// for WAL. It should be called before Close.
+	Flush(ctx context.Context) error
+
+	// ReplaceAll replaces all cached entries with data atomically, readers see
+	// either the old entries or the new ones. DeleteHandler is called for the
+	// keys not in data.
+	ReplaceAll(data map[string]interface{})
+
 	// DeleteIf deletes cached entries that match the `shouldDelete` predicate.
 	DeleteIf(shouldDelete func(key string) bool)
 
+	// DeleteIfValue deletes cached entries whose keys and values match the
+	// `shouldDelete` predicate, and returns the number of deleted entries.
+	DeleteIfValue(shouldDelete func(key string, val interface{}) bool) int
+
+	// Delete deletes the entry of the given key.
+	Delete(key string)
+
+	// DeleteErrored deletes the entries currently caching an error,
+	// so that they are fetched again by the next access.
+	DeleteErrored()
+}
+
+// Refresher is the refreshing part of Cache.
+type Refresher interface {
+	// Refresh fetches the value of the given key immediately if it is cached.
+	// It is useful when the data source notifies the change of a key.
+	Refresh(key string) error
+}
+
+// Closer is the closing part of Cache.
+type Closer interface {
 	// Close closes the async cache.
 	// This should be called when the cache is no longer needed, or may lead to resource leak.
+	// It is safe to call Close more than once.
 	Close()
+
+	// IsClosed reports whether the cache is closed.
+	IsClosed() bool
 }
 
 // cache .
 type cache struct {
-	sfg           Group
-	opt           Options
-	data          sync.Map
-	refreshTicker *time.Ticker
-	expireTicker  *time.Ticker
+	sfg            ShardedGroup
+	opt            Options
+	entries        atomic.Pointer[sync.Map] // swapped by ReplaceAll
+	index          keyIndex                 // the entries to refresh
+	deadlines      deadlineIndex            // if ExpireDeadlines is true
+	writes         sync.RWMutex             // read locked by writes, locked by Snapshot
+	writeSeq       uint64                   // incremented by each write, see GetAll
+	inflight       int64                    // the number of writes in progress
+	changes        changeLog
+	tenants        sync.Map // tenant -> *tenantStats, if TenantFunc is set
+	resetVals      sync.Map // key -> reset value, if StoreResetVals is true
+	leases         sync.Map // key -> *lease
+	leaseSeq       uint64
+	refreshTicker  *time.Ticker
+	expireTicker   *time.Ticker
+	expireTick     uint64 // the number of expire ticks, see ExpireChunks
+	wb             *writeBehind
+	wal            *walQueue // nil unless WAL is set
+	closed         int32
+	done           chan struct{}
+	ctx            context.Context // canceled by Close
+	cancel         context.CancelFunc
+	handlers       *dispatcher
+	fetchSem       chan struct{}   // nil unless MaxConcurrentFetches is set
+	refreshCarry   map[string]bool // keys skipped by the last refresh cycle
+	refreshing     int32           // 1 while a refresh cycle is running
+	refreshEnd     int64           // unix nano when the last refresh cycle ended
+	refreshCycle   int64           // the duration of the last refresh cycle
+	refreshFailed  int64           // the number of keys failed in the last refresh cycle
+	created        time.Time
+	loops          []*loop
+	listed         atomic.Pointer[map[string]bool] // the last listing of KeyLister
+	version        string                          // the last version of SnapshotFetcher
+	cz             *compression
+	hits           uint64
+	misses         uint64
+	refreshSkipped uint64
 }
 
 type entry struct {
-	val    atomic.Value
-	expire int32 // 0 means useful, 1 will expire
-	err    error
+	mu     sync.Mutex   // serializes updates of the entry
+	res    atomic.Value // *result
+	state  int32        // EntryState, with expiringBit set while expiring
+	stats  *keyStats    // nil unless EnableKeyStats is true
+	c      *cache
+	reset  atomic.Pointer[resetSeed]
+	tenant *tenantStats // nil unless TenantFunc is set
+	dead   int32        // 1 once the entry is deleted
+	key    string       // the key of the entry, if stored is true
+	stored bool         // set with key before the entry is stored
+
+	// changedAt is the unix nano time the value was last changed by a
+	// refresh, and pending is the value held back since, with
+	// MinChangeInterval set. They are guarded by mu.
+	changedAt int64
+	pending   *pendingChange
+
+	// dlAt is the deadline of the entry in deadlines, and dlIndex its index
+	// in the heap plus one, 0 if absent. They are guarded by deadlines.mu.
+	dlAt    int64
+	dlIndex int
+}
+
+// seed returns the reset value of key to use for resetVal passed to
+// GetOrReset, and stores it if StoreResetVals is true.
+func (c *cache) seed(key string, resetVal interface{}) interface{} {
+	if !c.opt.StoreResetVals {
+		return resetVal
+	}
+	if resetVal != nil {
+		c.resetVals.Store(key, resetVal)
+		return resetVal
+	}
+	resetVal, _ = c.resetVals.Load(key)
+	return resetVal
+}
+
+// resetSeed is the reset value of an entry created by GetOrReset.
+type resetSeed struct {
+	val    interface{}
+	expiry int64 // unix nano, set by GetOrResetWithTTL
+}
+
+// ttl returns the ttl of the value generated from the seed, after setting
+// the expiry d from now if d is greater than 0. It is nil without expiry.
+func (s *resetSeed) ttl(c *cache, d time.Duration) *ttl {
+	now := time.Now().UnixNano()
+	if d > 0 {
+		s.expiry = now + int64(d)
+	}
+	if s.expiry == 0 {
+		return nil
+	}
+	return &ttl{soft: c.opt.SoftTTL, hard: time.Duration(max(s.expiry-now, 1)), at: now}
+}
+
+type result struct {
+	val        interface{}
+	err        error
+	stored     int64        // unix nano time the value was stored
+	soft       int64        // unix nano deadline of SoftTTL, 0 if none
+	hard       int64        // unix nano deadline of HardTTL, 0 if none
+	refreshing int32        // 1 once the refresh for SoftTTL is started
+	refs       int32        // references to val, see acquire and release
+	owned      int32        // 1 while val is referenced by the cache
+	decoded    atomic.Value // *jsonMemo set by GetJSON
 }
 
 func (e *entry) Value() interface{} {
-	if e.err != nil {
-		return e.err
+	val, err := e.Load()
+	if err != nil {
+		return err
+	}
+	return val
+}
+
+// Load returns the cached value and error.
+func (e *entry) Load() (interface{}, error) {
+	val, err := e.loadRaw()
+	if cv, ok := val.(*compressed); ok {
+		return e.c.cz.decompress(cv)
 	}
-	return e.val.Load()
+	return val, err
 }
 
+// loadRaw returns the cached value without decompression.
+func (e *entry) loadRaw() (interface{}, error) {
+	res, _ := e.res.Load().(*result)
+	if res == nil {
+		return nil, nil
+	}
+	return res.val, res.err
+}
+
+// Store stores the value and clears the error.
 func (e *entry) Store(x interface{}) {
-	if x != nil {
-		e.val.Store(x)
+	e.StoreErr(x, nil)
+}
+
+// StoreErr stores the value with the error.
+func (e *entry) StoreErr(x interface{}, err error) {
+	e.storeTTL(x, err, nil)
+}
+
+// storeTTL stores the value with the error, which expire by t, or by SoftTTL
+// and HardTTL if t is nil.
+func (e *entry) storeTTL(x interface{}, err error, t *ttl) {
+	if e.c.cz != nil {
+		x = e.c.cz.compress(x)
+	}
+	if t == nil {
+		t = &ttl{soft: e.c.opt.SoftTTL, hard: e.c.opt.HardTTL}
+	}
+	if old := e.result(); old != nil && err == nil && old.err == nil && t.soft <= 0 && t.hard <= 0 && t.at == 0 &&
+		old.soft == 0 && old.hard == 0 && sameValue(old.val, x) {
+		// the value is in place already, e.g. refreshed to an equal value.
+		e.transit(StateFresh)
+		return
+	}
+	res := &result{val: x, err: err, refs: 1, owned: 1}
+	t.deadlines(res)
+	e.c.beginWrite()
+	old, _ := e.res.Swap(res).(*result)
+	e.c.endWrite()
+	if old != nil && !sameValue(old.val, x) {
+		e.c.disown(old)
+	}
+	if atomic.LoadInt32(&e.dead) == 1 {
+		e.c.disown(res)
+	} else {
+		e.c.scheduleExpiry(e)
+	}
+	if err != nil {
+		e.transit(StateErrored)
 	} else {
-		e.val = atomic.Value{}
+		e.transit(StateFresh)
 	}
 }
 
+// Err returns the cached error.
+func (e *entry) Err() error {
+	_, err := e.Load()
+	return err
+}
+
 func (e *entry) Touch() {
-	atomic.StoreInt32(&e.expire, 0)
+	e.unmarkExpiring()
 }
 
 // NewAsyncCache creates an AsyncCache.
 func NewCache(opt Options) Cache {
 	c := &cache{
-		sfg: Group{},
-		opt: opt,
+		opt:     opt,
+		done:    make(chan struct{}),
+		created: time.Now(),
+	}
+	c.entries.Store(&sync.Map{})
+	if c.opt.MaxConcurrentFetches > 0 {
+		c.fetchSem = make(chan struct{}, c.opt.MaxConcurrentFetches)
+	}
+	if c.opt.CompressThreshold > 0 {
+		c.cz = newCompression(c.opt)
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.handlers = newDispatcher(c.opt.HandlerQueueSize)
+	c.goLabeled("dispatcher", c.handlers.run)
+	if c.opt.WAL != nil {
+		c.wal = newWALQueue(c.opt.HandlerQueueSize)
+		c.goLabeled("wal", c.appendChanges)
+	}
+	if len(c.opt.Fetchers) > 0 && c.opt.Fetcher == nil {
+		c.opt.Fetcher = c.multiFetch
+	}
+	if c.opt.Loader != nil && c.opt.Fetcher == nil {
+		c.opt.Fetcher = c.load
+	}
+	c.encodeKeys()
+	if c.opt.Leader != nil && c.opt.Fetcher == nil {
+		c.opt.Fetcher = c.opt.Leader.Get
 	}
 	if c.opt.ErrLogFunc == nil {
 		c.opt.ErrLogFunc = func(str string) {
 			log.Println(str)
 		}
 	}
+	if c.opt.RefreshLock != nil && c.opt.KeyLister == nil && c.opt.SnapshotFetcher == nil {
+		panic("asynccache: RefreshLock needs KeyLister or SnapshotFetcher")
+	}
 	if c.opt.EnableExpire {
 		if c.opt.ExpireDuration == 0 {
 			panic("asynccache: invalid ExpireDuration")
 		}
-		go c.expirer()
+		period := c.opt.ExpireDuration
+		if c.opt.ExpireChunks > 1 {
+			period /= time.Duration(c.opt.ExpireChunks)
+		}
+		c.expireTicker = time.NewTicker(period)
+		c.startLoop("expirer", c.expirer)
 	}
-	if c.opt.EnableRefresh {
-		go c.refresher()
+	if c.opt.SnapshotFetcher != nil {
+		c.refreshDataset()
+	}
+	if c.opt.EnableRefresh || c.opt.RefreshResets {
+		c.refreshTicker = time.NewTicker(c.opt.RefreshDuration)
+		c.startLoop("refresher", c.refresher)
+	}
+	if c.opt.EnableWriteBehind {
+		c.wb = newWriteBehind(c)
+		c.goLabeled("flusher", c.wb.flusher)
+	}
+	if c.opt.Leader != nil {
+		if c.opt.FollowInterval == 0 {
+			c.opt.FollowInterval = time.Second
+		}
+		c.goLabeled("follower", c.follower)
+	}
+	if c.opt.EnableWatchdog {
+		if c.opt.WatchdogInterval == 0 {
+			c.opt.WatchdogInterval = 10 * time.Second
+		}
+		c.goLabeled("watchdog", c.watchdog)
+	}
+	if c.opt.MemoryHighWatermark > 0 {
+		if c.opt.MemoryLowWatermark <= 0 || c.opt.MemoryLowWatermark > c.opt.MemoryHighWatermark {
+			c.opt.MemoryLowWatermark = c.opt.MemoryHighWatermark / 10 * 8
+		}
+		if c.opt.MemoryCheckInterval == 0 {
+			c.opt.MemoryCheckInterval = 10 * time.Second
+		}
+		c.goLabeled("memory watcher", c.memoryWatcher)
 	}
 	return c
 }
 
 // SetDefault sets the default value of given key if it is new to the cache.
 func (c *cache) SetDefault(key string, val interface{}) bool {
-	ety := &entry{}
-	ety.Store(val)
-	actual, exist := c.data.LoadOrStore(key, ety)
+	key = c.key(key)
+	if c.IsClosed() {
+		_, exist := c.data().Load(key)
+		return exist
+	}
+	if v, ok := c.data().Load(key); ok {
+		v.(*entry).Touch()
+		return true
+	}
+	val, t := c.unwrapTTL(val)
+	ety := c.newEntry()
+	ety.storeTTL(val, nil, t)
+	actual, exist, _ := c.loadOrStore(key, ety)
 	if exist {
-		actual.(*entry).Touch()
+		c.freeEntry(ety)
+		actual.Touch()
 	}
 	return exist
 }
 
+// Set sets the value of given key, replacing the cached one.
+func (c *cache) Set(key string, val interface{}) {
+	key = c.key(key)
+	if c.IsClosed() {
+		return
+	}
+	c.set(key, val)
+}
+
+// set sets the value of the normalized key.
+func (c *cache) set(key string, val interface{}) {
+	val, t := c.unwrapTTL(val)
+	e, ok := c.loadEntry(key)
+	if !ok {
+		ety := c.newEntry()
+		ety.storeTTL(val, nil, t)
+		if e, ok, _ = c.loadOrStore(key, ety); ok {
+			c.freeEntry(ety)
+		}
+	}
+	if ok {
+		e.mu.Lock()
+		c.update(key, e, val, t)
+		e.mu.Unlock()
+		e.Touch()
+	}
+}
+
+// Put writes the value of given key through Writer and then sets it to the cache.
+func (c *cache) Put(key string, val interface{}) error {
+	key = c.key(key)
+	if c.IsClosed() {
+		return ErrClosed
+	}
+	if c.opt.Writer == nil {
+		return ErrNoWriter
+	}
+	if err := c.opt.Writer(key, val); err != nil {
+		return wrapErr("write", key, err)
+	}
+	c.Set(key, val)
+	return nil
+}
+
 // Get tries to fetch a value corresponding to the given key from the cache.
 // If error occurs during in the first time fetching, it will be cached until the
 // sequential fetchings triggered by the refresh goroutine succeed.
 func (c *cache) Get(key string) (val interface{}, err error) {
+	key = c.key(key)
+	if len(c.opt.Interceptors) == 0 {
+		return c.get(key)
+	}
+	return c.intercept(OpGet, key, c.get)
+}
+
+// GetWithTimeout is like Get, but returns ErrFetchTimeout if the first
+// fetch takes longer than timeout, which is unlimited if not positive.
+func (c *cache) GetWithTimeout(key string, timeout time.Duration) (val interface{}, err error) {
+	key = c.key(key)
+	get := func(key string) (interface{}, error) {
+		return c.getWithTimeout(key, timeout)
+	}
+	if len(c.opt.Interceptors) == 0 {
+		return get(key)
+	}
+	return c.intercept(OpGet, key, get)
+}
+
+func (c *cache) get(key string) (val interface{}, err error) {
+	return c.getWithTimeout(key, 0)
+}
+
+func (c *cache) getWithTimeout(key string, timeout time.Duration) (val interface{}, err error) {
+	return c.getBy(key, timeout, c.opt.Fetcher)
+}
+
+// getBy is getWithTimeout fetching a miss by fetcher instead of Fetcher.
+func (c *cache) getBy(key string, timeout time.Duration, fetcher Invoker) (val interface{}, err error) {
 	var ok bool
-	val, ok = c.data.Load(key)
-	if ok {
+	val, ok = c.data().Load(key)
+	if ok && !c.rejectClosed() && c.fresh(key, val.(*entry)) {
 		e := val.(*entry)
-		e.Touch()
-		return e.val.Load(), e.err
+		c.access(e)
+		return e.Load()
+	}
+	c.miss(key)
+	if c.IsClosed() {
+		return nil, ErrClosed
+	}
+	if c.unlisted(key) {
+		return nil, ErrNotFound
+	}
+	if c.opt.Fetcher == nil {
+		return nil, ErrNoFetcher
 	}
 
-	val, err, _ = c.sfg.Do(key, func() (v interface{}, e error) {
-		v, e = c.opt.Fetcher(key)
-		ety := &entry{}
-		ety.Store(v)
-		ety.err = e
-		c.data.Store(key, ety)
-		return
-	})
-	return
+	if c.opt.BackgroundFetch {
+		c.sfg.DoChan(key, c.fetchMissing(key, fetcher))
+		return nil, ErrNotReady
+	}
+	res, ok := c.awaitFetch(key, c.fetchMissing(key, fetcher), timeout)
+	if !ok {
+		return nil, wrapErr("fetch", key, ErrFetchTimeout)
+	}
+	return loadShared(res.Val, res.Err, res.Shared)
+}
+
+// awaitFetch calls fetch of the missing key once for the concurrent misses,
+// and waits for it at most timeout if positive. It reports false once the
+// timeout elapses, and the fetch goes on in background.
+func (c *cache) awaitFetch(key string, fetch func() (interface{}, error), timeout time.Duration) (res Result, ok bool) {
+	if timeout <= 0 {
+		res.Val, res.Err, res.Shared = c.sfg.Do(key, fetch)
+		return res, true
+	}
+	ch, _ := c.sfg.DoChan(key, fetch)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res = <-ch:
+		return res, true
+	case <-timer.C:
+		return res, false
+	}
+}
+
+// fetchMissing returns the function fetching and storing the missing key by
+// fetcher, which is Fetcher but for typed wrappers. The misses of Get, GetOrSet and GetOrReset share the singleflight
+// key-space, so that concurrent misses of a key fetch it once whichever of
+// them comes first. The functions return the stored entry, or the value and
+// error of a failure not stored, see loadShared.
+func (c *cache) fetchMissing(key string, fetcher Invoker) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if err := c.acquireFetch(); err != nil {
+			return nil, err
+		}
+		defer c.releaseFetch()
+		v, t, err := c.fetchBy(OpFetch, key, fetcher)
+		if c.nilDeleted(err) {
+			return nil, wrapErr("fetch", key, ErrNotFound)
+		}
+		ety := c.newEntry()
+		ety.storeTTL(v, wrapErr("fetch", key, err), t)
+		return c.storeNew(key, ety), nil
+	}
+}
+
+// loadShared returns the value and error of the singleflight call of a miss.
+func loadShared(v interface{}, err error, _ bool) (interface{}, error) {
+	if e, ok := v.(*entry); ok {
+		return e.Load()
+	}
+	return v, err
 }
 
 // GetOrSet tries to fetch a value corresponding to the given key from the cache.
 // If the key is not yet cached or fetching failed, the default value will be set.
 func (c *cache) GetOrSet(key string, def interface{}) (val interface{}) {
-	if v, ok := c.data.Load(key); ok {
+	return c.GetOrSetWithTimeout(key, def, c.opt.FirstFetchTimeout)
+}
+
+// GetOrSetWithTimeout is like GetOrSet, but returns the default value if
+// the first fetch takes longer than timeout, which is unlimited if not positive.
+func (c *cache) GetOrSetWithTimeout(key string, def interface{}, timeout time.Duration) (val interface{}) {
+	key = c.key(key)
+	if len(c.opt.Interceptors) == 0 {
+		return c.getOrSet(key, def, timeout)
+	}
+	val, err := c.intercept(OpGetOrSet, key, func(key string) (interface{}, error) {
+		return c.getOrSet(key, def, timeout), nil
+	})
+	if err != nil {
+		return def
+	}
+	return
+}
+
+func (c *cache) getOrSet(key string, def interface{}, timeout time.Duration) (val interface{}) {
+	return c.getOrSetBy(key, def, timeout, c.opt.Fetcher)
+}
+
+// getOrSetBy is getOrSet fetching a miss by fetcher instead of Fetcher.
+func (c *cache) getOrSetBy(key string, def interface{}, timeout time.Duration, fetcher Invoker) (val interface{}) {
+	if c.rejectClosed() {
+		return def
+	}
+	if v, ok := c.data().Load(key); ok && c.fresh(key, v.(*entry)) {
 		e := v.(*entry)
-		if e.err != nil {
-			ety := &entry{}
-			ety.Store(def)
-			c.data.Store(key, ety)
-			return def
+		if c.opt.ErrorPolicy == RetryFetch && e.Err() != nil && !c.IsClosed() && c.opt.Fetcher != nil {
+			c.refreshEntry(key, e)
 		}
-		e.Touch()
-		return e.val.Load()
+		c.access(e)
+		return c.orDefault(key, e, def)
 	}
+	c.miss(key)
 
-	val, _, _ = c.sfg.Do(key, func() (interface{}, error) {
-		v, e := c.opt.Fetcher(key)
-		if e != nil {
-			v = def
+	if c.IsClosed() || c.opt.Fetcher == nil || c.unlisted(key) {
+		return def
+	}
+
+	fetch := c.fetchMissing(key, fetcher)
+	if c.opt.BackgroundFetch {
+		c.sfg.DoChan(key, fetch)
+		return def
+	}
+	res, ok := c.awaitFetch(key, fetch, timeout)
+	if !ok {
+		c.ReportError(key, wrapErr("fetch", key, ErrFetchTimeout))
+		return def
+	}
+	if e, ok := res.Val.(*entry); ok {
+		return c.orDefault(key, e, def)
+	}
+	if res.Err != nil {
+		return def
+	}
+	return res.Val
+}
+
+// orDefault returns the value of e, or def if an error is cached, which is
+// replaced by def with ReplaceWithDefault.
+func (c *cache) orDefault(key string, e *entry, def interface{}) interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	val, err := e.Load()
+	if err != nil {
+		val = def
+		if c.opt.ErrorPolicy == ReplaceWithDefault && !c.IsClosed() {
+			e.Store(def)
+			c.logChange(key)
 		}
-		ety := &entry{}
-		ety.Store(v)
-		c.data.Store(key, ety)
-		return v, nil
-	})
-	return
+	}
+	return val
 }
 
 // GetOrReset tries to fetch a value corresponding to the given key from the cache.
 // If the key is not yet cached or error occurs, cache will generate a new value by resetVal and DataFetcher
 func (c *cache) GetOrReset(key string, resetVal interface{}) (val interface{}) {
-	if v, ok := c.data.Load(key); ok {
+	return c.GetOrResetWithTTL(key, resetVal, 0)
+}
+
+// GetOrResetWithTTL is like GetOrReset, but the value generated expires after
+// ttl if it is greater than 0.
+func (c *cache) GetOrResetWithTTL(key string, resetVal interface{}, ttl time.Duration) (val interface{}) {
+	key = c.key(key)
+	if len(c.opt.Interceptors) == 0 {
+		return c.getOrReset(key, resetVal, ttl)
+	}
+	val, _ = c.intercept(OpGetOrReset, key, func(key string) (interface{}, error) {
+		return c.getOrReset(key, resetVal, ttl), nil
+	})
+	return
+}
+
+func (c *cache) getOrReset(key string, resetVal interface{}, ttl time.Duration) (val interface{}) {
+	if ttl <= 0 && c.opt.FixedResetExpiry {
+		ttl = c.opt.ExpireDuration
+	}
+	if c.rejectClosed() {
+		return nil
+	}
+	resetVal = c.seed(key, resetVal)
+	if v, ok := c.data().Load(key); ok && c.fresh(key, v.(*entry)) {
 		e := v.(*entry)
-		if e.err != nil {
-			ety := &entry{}
-			newVal, err := c.opt.DataFetcher(resetVal)
-			if err != nil {
-				ety.err = err
-			}
-			ety.Store(newVal)
-			c.data.Store(key, ety)
-			return newVal
+		e.mu.Lock()
+		val, err := e.Load()
+		if err != nil && c.IsClosed() {
+			val = nil
+		} else if err != nil {
+			seed := resetSeed{val: resetVal}
+			val, err = c.reset(key, resetVal)
+			e.storeTTL(val, wrapErr("reset", key, err), seed.ttl(c, ttl))
+			c.logChange(key)
 		}
-		e.Touch()
-		return e.val.Load()
+		e.mu.Unlock()
+		c.access(e)
+		return val
+	}
+	c.miss(key)
+	if c.IsClosed() {
+		return nil
 	}
 
-	val, _, _ = c.sfg.Do(key, func() (interface{}, error) {
-		v, e := c.opt.DataFetcher(resetVal)
+	val, _ = loadShared(c.sfg.Do(key, func() (interface{}, error) {
+		v, e := c.reset(key, resetVal)
 		if e != nil {
-			return v, e
+			return v, wrapErr("reset", key, e)
 		}
-		ety := &entry{}
-		ety.Store(v)
-		c.data.Store(key, ety)
-		return v, nil
-	})
+		seed := &resetSeed{val: resetVal}
+		ety := c.newEntry()
+		ety.storeTTL(v, nil, seed.ttl(c, ttl))
+		if c.opt.RefreshResets {
+			ety.reset.Store(seed)
+		}
+		return c.storeNew(key, ety), nil
+	}))
 	return
 }
 
+// loadEntry returns the cached entry of key.
+func (c *cache) loadEntry(key string) (*entry, bool) {
+	v, ok := c.data().Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*entry), true
+}
+
+// storeNew stores the newly fetched entry unless the key has been set meanwhile,
+// and returns the entry of the key.
+func (c *cache) storeNew(key string, ety *entry) *entry {
+	actual, loaded, _ := c.loadOrStore(key, ety)
+	if loaded {
+		c.freeEntry(ety)
+	}
+	return actual
+}
+
 // Dump dumps all cached entries.
 func (c *cache) Dump() map[string]interface{} {
 	data := make(map[string]interface{})
-	c.data.Range(func(key, val interface{}) bool {
-		k, ok := key.(string)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not string", k, k))
-			c.data.Delete(key)
-			return true
-		}
-		data[k] = val.(*entry).val.Load()
+	c.rangeEntries(func(k string, e *entry) bool {
+		data[k], _ = e.Load()
 		return true
 	})
 	return data
 }
 
+// EntryInfo is the metadata of an entry.
+type EntryInfo struct {
+	// Err is the cached error of the entry.
+	Err error
+	// Expiring reports whether the entry has not been accessed since the last
+	// expire cycle, and will be deleted by the next one.
+	Expiring bool
+	// State is the lifecycle state of the entry.
+	State EntryState
+	// Hits and LastAccess are tracked if EnableKeyStats is true.
+	Hits       uint64
+	LastAccess time.Time
+	// Lifetime is when the value was stored and expires.
+	Lifetime Lifetime
+}
+
+// RangeEntries calls fn for each cached entry with its metadata until fn returns false.
+func (c *cache) RangeEntries(fn func(key string, val interface{}, meta EntryInfo) bool) {
+	c.rangeEntries(func(key string, e *entry) bool {
+		val, err := e.Load()
+		meta := EntryInfo{
+			Err:      err,
+			Expiring: atomic.LoadInt32(&e.state)&expiringBit != 0,
+			State:    e.loadState(),
+			Lifetime: e.result().lifetime(),
+		}
+		if e.stats != nil {
+			meta.Hits = atomic.LoadUint64(&e.stats.hits)
+			if last := atomic.LoadInt64(&e.stats.lastAccess); last > 0 {
+				meta.LastAccess = time.Unix(0, last)
+			}
+		}
+		return fn(key, val, meta)
+	})
+}
+
 // DeleteIf deletes cached entries that match the `shouldDelete` predicate.
 func (c *cache) DeleteIf(shouldDelete func(key string) bool) {
-	c.data.Range(func(key, value interface{}) bool {
-		s := key.(string)
-		if shouldDelete(s) {
-			if c.opt.DeleteHandler != nil {
-				go c.opt.DeleteHandler(s, value)
-			}
-			c.data.Delete(key)
+	c.rangeEntries(func(key string, e *entry) bool {
+		if shouldDelete(key) {
+			c.remove(key, e, ReasonDeleted)
 		}
 		return true
 	})
 }
 
-// Close stops the background refresh goroutine.
+// DeleteIfValue deletes cached entries whose keys and values match the `shouldDelete` predicate.
+func (c *cache) DeleteIfValue(shouldDelete func(key string, val interface{}) bool) int {
+	n := 0
+	c.rangeEntries(func(k string, e *entry) bool {
+		val, _ := e.Load()
+		if shouldDelete(k, val) && c.remove(k, e, ReasonDeleted) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Delete deletes the entry of the given key.
+func (c *cache) Delete(key string) {
+	key = c.key(key)
+	if c.opt.StoreResetVals {
+		c.resetVals.Delete(key)
+	}
+	c.beginWrite()
+	value, ok := c.data().LoadAndDelete(key)
+	c.endWrite()
+	if ok {
+		c.logChange(key)
+		c.removed(key, value.(*entry), ReasonDeleted)
+	}
+}
+
+// Errors returns the keys currently caching an error, with the errors.
+func (c *cache) Errors() map[string]error {
+	errs := make(map[string]error)
+	c.rangeEntries(func(key string, e *entry) bool {
+		if err := e.Err(); err != nil {
+			errs[key] = err
+		}
+		return true
+	})
+	return errs
+}
+
+// DeleteErrored deletes the entries currently caching an error.
+func (c *cache) DeleteErrored() {
+	c.rangeEntries(func(key string, e *entry) bool {
+		if e.Err() != nil {
+			c.remove(key, e, ReasonDeleted)
+		}
+		return true
+	})
+}
+
+// Refresh fetches the value of the given key immediately if it is cached.
+func (c *cache) Refresh(key string) error {
+	key = c.key(key)
+	if c.IsClosed() {
+		return ErrClosed
+	}
+	if c.opt.Fetcher == nil && !c.opt.RefreshResets {
+		return ErrNoFetcher
+	}
+	value, ok := c.data().Load(key)
+	if !ok {
+		return nil
+	}
+	e := value.(*entry)
+	if c.opt.Fetcher == nil && e.reset.Load() == nil {
+		return ErrNoFetcher
+	}
+	return c.refreshEntry(key, e)
+}
+
+// Close stops the background goroutines.
 func (c *cache) Close() {
-	c.refreshTicker.Stop()
-	if c.opt.EnableExpire {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return
+	}
+	close(c.done)
+	c.cancel()
+	if c.wb != nil {
+		close(c.wb.stop)
+	}
+	if c.refreshTicker != nil {
+		c.refreshTicker.Stop()
+	}
+	if c.expireTicker != nil {
 		c.expireTicker.Stop()
 	}
+	c.stopDeadlines()
+	if c.wal != nil {
+		c.wal.close()
+	}
+	c.handlers.close()
+}
+
+// IsClosed reports whether the cache is closed.
+func (c *cache) IsClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+// rejectClosed reports whether reads should be treated as misses.
+func (c *cache) rejectClosed() bool {
+	return c.opt.ClosedBehavior == ClosedReject && c.IsClosed()
 }
 
 func (c *cache) refresher() {
-	c.refreshTicker = time.NewTicker(c.opt.RefreshDuration)
-	for range c.refreshTicker.C {
-		c.refresh()
+	for {
+		select {
+		case t := <-c.refreshTicker.C:
+			if t.UnixNano() < atomic.LoadInt64(&c.refreshEnd) {
+				// ticked while the last cycle was running
+				atomic.AddUint64(&c.refreshSkipped, 1)
+				continue
+			}
+			c.refresh()
+		case <-c.done:
+			return
+		}
 	}
 }
 
 func (c *cache) expirer() {
-	c.expireTicker = time.NewTicker(c.opt.ExpireDuration)
-	for range c.expireTicker.C {
-		c.expire()
+	for {
+		select {
+		case <-c.expireTicker.C:
+			c.expire()
+		case <-c.done:
+			return
+		}
 	}
 }
 
 func (c *cache) expire() {
-	c.data.Range(func(key, value interface{}) bool {
-		k, ok := key.(string)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not string", k, k))
-			c.data.Delete(key)
-			return true
-		}
-		e, ok := value.(*entry)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not entry", k, value))
-			c.data.Delete(key)
-			return true
-		}
-		if !atomic.CompareAndSwapInt32(&e.expire, 0, 1) {
-			if c.opt.DeleteHandler != nil {
-				go c.opt.DeleteHandler(k, value)
+	if n := c.opt.ExpireChunks; n > 1 {
+		i := (atomic.AddUint64(&c.expireTick, 1) - 1) % uint64(n)
+		for _, it := range c.index.chunk(int(i), n) {
+			if atomic.LoadInt32(&it.e.dead) == 0 {
+				c.expireEntry(it.key, it.e)
 			}
-			c.data.Delete(key)
 		}
-
+		return
+	}
+	c.rangeEntries(func(k string, e *entry) bool {
+		c.expireEntry(k, e)
 		return true
 	})
 }
 
+// expireEntry marks the entry expiring, or deletes it if it is marked already.
+func (c *cache) expireEntry(k string, e *entry) {
+	if from := e.loadState(); e.markExpiring() {
+		c.stateChanged(k, from, StateExpiring)
+	} else {
+		c.remove(k, e, ReasonExpired)
+	}
+}
+
 func (c *cache) refresh() {
-	c.data.Range(func(key, value interface{}) bool {
-		k, ok := key.(string)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not string", k, k))
-			c.data.Delete(key)
-			return true
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		atomic.AddUint64(&c.refreshSkipped, 1)
+		return
+	}
+	start := time.Now()
+	defer func() {
+		end := time.Now()
+		atomic.StoreInt64(&c.refreshCycle, int64(end.Sub(start)))
+		atomic.StoreInt64(&c.refreshEnd, end.UnixNano())
+		atomic.StoreInt32(&c.refreshing, 0)
+	}()
+	c.purgeLeases()
+	if c.opt.RefreshLock != nil && !c.lockRefresh() {
+		return
+	}
+	if c.opt.SnapshotFetcher != nil {
+		c.refreshDataset()
+		return
+	}
+
+	items := c.index.live()
+	if !c.opt.EnableRefresh {
+		// only the entries of GetOrReset are refreshed
+		resets := items[:0]
+		for _, it := range items {
+			if it.e.reset.Load() != nil {
+				resets = append(resets, it)
+			}
+		}
+		items = resets
+	}
+	inShard := c.shardFilter()
+	if c.opt.KeyLister == nil {
+		c.report(c.refreshItems(shardItems(items, inShard)))
+		return
+	}
+	items, dropped, keys, err := c.listKeys(items)
+	if c.opt.MirrorKeys {
+		for _, it := range dropped {
+			c.remove(it.key, it.e, ReasonDeleted)
 		}
-		e, ok := value.(*entry)
-		if !ok {
-			c.opt.ErrLogFunc(fmt.Sprintf("invalid key: %v, type: %T is not entry", k, value))
-			c.data.Delete(key)
-			return true
+	}
+	if inShard != nil {
+		items = shardItems(items, inShard)
+		owned := keys[:0]
+		for _, k := range keys {
+			if inShard(k) {
+				owned = append(owned, k)
+			}
 		}
+		keys = owned
+	}
+	report := c.refreshItems(items)
+	if err == nil {
+		c.populate(keys)
+	}
+	c.report(report)
+}
 
-		newVal, err := c.opt.Fetcher(k)
+// report calls RefreshReportHandler with the report of a cycle.
+func (c *cache) report(report RefreshReport) {
+	if c.opt.RefreshReportHandler != nil {
+		c.dispatch(func() { c.opt.RefreshReportHandler(report) })
+	}
+}
+
+// refreshEntry fetches and stores the value of e. It shares the singleflight
+// key-space with the Get path, and holds the lock of e so that the refreshed
+// value can not overwrite a value set meanwhile.
+func (c *cache) refreshEntry(k string, e *entry) error {
+	_, err, _ := c.sfg.Do(k, func() (interface{}, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		// an expiring entry stays expiring while refreshed
+		from := e.loadState()
+		e.transit(StateFetching)
+		if from != StateExpiring {
+			c.stateChanged(k, from, StateFetching)
+			defer func() { c.stateChanged(k, StateFetching, e.loadState()) }()
+		}
+
+		var newVal interface{}
+		var t *ttl
+		var err error
+		verdict := VerdictDefault
+		for retries := 0; ; retries++ {
+			if newVal, t, err = c.refreshFetch(k, e); err == nil {
+				break
+			}
+			if c.nilDeleted(err) {
+				c.remove(k, e, ReasonDeleted)
+				return nil, nil
+			}
+			err = wrapErr("refresh", k, err)
+			if verdict = c.verdict(k, err, retries); verdict != VerdictRetryNow {
+				break
+			}
+		}
 		if err != nil {
 			if c.opt.ErrorHandler != nil {
-				go c.opt.ErrorHandler(k, err)
+				c.dispatch(func() { c.opt.ErrorHandler(k, err) })
 			}
-			if e.err != nil {
-				e.err = err
+			oldVal, oldErr := e.Load()
+			switch {
+			case verdict == VerdictDelete:
+				c.remove(k, e, ReasonDeleted)
+			case verdict == VerdictRetryNextCycle, verdict == VerdictDefault && oldErr != nil:
+				e.StoreErr(oldVal, err)
+				c.logChange(k)
+			default:
+				// the old value is served on
+				e.transit(StateStale)
 			}
-			return true
+			return nil, err
 		}
 
-		if c.opt.IsSame != nil && !c.opt.IsSame(k, e.val.Load(), newVal) {
-			if c.opt.ChangeHandler != nil {
-				go c.opt.ChangeHandler(k, e.val.Load(), newVal)
-			}
+		if c.leased(k) {
+			// the external writer holding the lease sets the value
+			e.transit(e.settled())
+			return newVal, nil
 		}
-
-		e.Store(newVal)
-		e.err = nil
-		return true
+		c.damp(k, e, newVal, t)
+		return newVal, nil
 	})
+	return err
+}
+
+// refreshFetch fetches the value of e by DataFetcher if it has a reset
+// seed, or else by Fetcher.
+func (c *cache) refreshFetch(k string, e *entry) (interface{}, *ttl, error) {
+	if seed := e.reset.Load(); seed != nil {
+		newVal, err := c.reset(k, seed.val)
+		return newVal, seed.ttl(c, 0), err
+	}
+	var compare func(val interface{}, err error)
+	if c.opt.ShadowFetcher != nil {
+		compare = c.shadowFetch(k)
+	}
+	newVal, t, err := c.fetch(OpRefresh, k)
+	if compare != nil {
+		compare(newVal, err)
+	}
+	return newVal, t, err
+}
+
+// update stores newVal expiring by t to e and clears its error, e.mu must be held.
+func (c *cache) update(k string, e *entry, newVal interface{}, t *ttl) {
+	oldVal, _ := e.Load()
+	if c.opt.IsSame != nil && !c.opt.IsSame(k, oldVal, newVal) {
+		c.changed(k, e, oldVal, newVal)
+	}
+
+	e.storeTTL(newVal, nil, t)
+	e.pending = nil
+	c.logChange(k)
 }
@@ -2,20 +2,27 @@ package cache
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestGetOK(t *testing.T) {
-	var key, ret = "key", "ret"
+	var key = "key"
+	var ret atomic.Value
+	ret.Store("ret")
 	op := Options{
 		RefreshDuration: time.Second,
 		IsSame: func(key string, oldData, newData interface{}) bool {
 			return false
 		},
 		Fetcher: func(key string) (interface{}, error) {
-			return ret, nil
+			return ret.Load(), nil
 		},
 		EnableRefresh: true,
 	}
@@ -23,31 +30,30 @@ func TestGetOK(t *testing.T) {
 
 	v, err := c.Get(key)
 	Assert(t, err == nil)
-	Assert(t, v.(string) == ret)
+	Assert(t, v.(string) == ret.Load())
 
 	time.Sleep(time.Second / 2)
-	ret = "change"
+	ret.Store("change")
 	v, err = c.Get(key)
 	Assert(t, err == nil)
-	Assert(t, v.(string) != ret)
+	Assert(t, v.(string) != ret.Load())
 
 	time.Sleep(time.Second)
 	v, err = c.Get(key)
 	Assert(t, err == nil)
-	Assert(t, v.(string) == ret)
+	Assert(t, v.(string) == ret.Load())
 }
 
 func TestGetErr(t *testing.T) {
 	var key, ret = "key", "ret"
-	var first = true
+	var first = int32(1)
 	op := Options{
 		RefreshDuration: time.Second,
 		IsSame: func(key string, oldData, newData interface{}) bool {
 			return false
 		},
 		Fetcher: func(key string) (interface{}, error) {
-			if first {
-				first = false
+			if atomic.CompareAndSwapInt32(&first, 1, 0) {
 				return nil, errors.New("error")
 			}
 			return ret, nil
@@ -71,43 +77,44 @@ func TestGetErr(t *testing.T) {
 }
 
 func TestGetOrSetOK(t *testing.T) {
-	var key, ret, def = "key", "ret", "def"
+	var key, def = "key", "def"
+	var ret atomic.Value
+	ret.Store("ret")
 	op := Options{
 		RefreshDuration: time.Second,
 		IsSame: func(key string, oldData, newData interface{}) bool {
 			return false
 		},
 		Fetcher: func(key string) (interface{}, error) {
-			return ret, nil
+			return ret.Load(), nil
 		},
 		EnableRefresh: true,
 	}
 	c := NewCache(op)
 
 	v := c.GetOrSet(key, def)
-	Assert(t, v.(string) == ret)
+	Assert(t, v.(string) == ret.Load())
 
 	time.Sleep(time.Second / 2)
-	ret = "change"
+	ret.Store("change")
 	v = c.GetOrSet(key, def)
-	Assert(t, v.(string) != ret)
+	Assert(t, v.(string) != ret.Load())
 
 	time.Sleep(time.Second)
 	v = c.GetOrSet(key, def)
-	Assert(t, v.(string) == ret)
+	Assert(t, v.(string) == ret.Load())
 }
 
 func TestGetOrSetErr(t *testing.T) {
 	var key, ret, def = "key", "ret", "def"
-	var first = true
+	var first = int32(1)
 	op := Options{
 		RefreshDuration: time.Second,
 		IsSame: func(key string, oldData, newData interface{}) bool {
 			return false
 		},
 		Fetcher: func(key string) (interface{}, error) {
-			if first {
-				first = false
+			if atomic.CompareAndSwapInt32(&first, 1, 0) {
 				return nil, errors.New("error")
 			}
 			return ret, nil
@@ -157,6 +164,54 @@ func TestGetOrResetOK(t *testing.T) {
 	Assert(t, v.(string) == ret)
 }
 
+func TestGetOrResetWithTTL(t *testing.T) {
+	var mu sync.Mutex
+	resets := make(map[interface{}]int)
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		DataFetcher: func(req interface{}) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			resets[req]++
+			return fmt.Sprint(req, resets[req]), nil
+		},
+		RefreshResets: true,
+	}).(*cache)
+	defer c.Close()
+
+	Assert(t, c.GetOrResetWithTTL("a", "a", 50*time.Millisecond) == "a1")
+	Assert(t, c.GetOrReset("b", "b") == "b1")
+	Assert(t, c.GetOrResetWithTTL("a", "a", 50*time.Millisecond) == "a1")
+	// refreshes keep the expiry
+	time.Sleep(30 * time.Millisecond)
+	c.refresh()
+	Assert(t, c.GetOrResetWithTTL("a", "a", 50*time.Millisecond) == "a2")
+	time.Sleep(30 * time.Millisecond)
+	Assert(t, c.GetOrResetWithTTL("a", "a", 50*time.Millisecond) == "a3")
+	Assert(t, c.GetOrReset("b", "b") == "b2")
+}
+
+func TestFixedResetExpiry(t *testing.T) {
+	var n int32
+	c := NewCache(Options{
+		DataFetcher: func(req interface{}) (interface{}, error) {
+			return atomic.AddInt32(&n, 1), nil
+		},
+		EnableExpire:     true,
+		ExpireDuration:   50 * time.Millisecond,
+		FixedResetExpiry: true,
+	})
+	defer c.Close()
+
+	Assert(t, c.GetOrReset("window", nil) == int32(1))
+	for i := 0; i < 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+		c.GetOrReset("window", nil)
+	}
+	// reads do not extend the window
+	Assert(t, c.GetOrReset("window", nil) == int32(2))
+}
+
 func TestSetDefault(t *testing.T) {
 	op := Options{
 		RefreshDuration: time.Second,
@@ -208,17 +263,144 @@ func TestDeleteIf(t *testing.T) {
 	Assert(t, v.(string) == "def")
 }
 
+func TestDeleteIfValue(t *testing.T) {
+	type tenantVal struct {
+		Tenant string
+	}
+	c := NewCache(Options{})
+	c.SetDefault("a", tenantVal{Tenant: "x"})
+	c.SetDefault("b", tenantVal{Tenant: "y"})
+	c.SetDefault("c", tenantVal{Tenant: "x"})
+	c.SetDefault("d", "other")
+
+	n := c.DeleteIfValue(func(key string, val interface{}) bool {
+		v, ok := val.(tenantVal)
+		return ok && v.Tenant == "x"
+	})
+	Assert(t, n == 2)
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b": tenantVal{Tenant: "y"}, "d": "other"})
+}
+
+func TestDeleteReason(t *testing.T) {
+	type deletion struct {
+		key    string
+		val    interface{}
+		reason DeleteReason
+	}
+	deleted := make(chan deletion, 2)
+	c := NewCache(Options{
+		EnableExpire:   true,
+		ExpireDuration: time.Hour,
+		DeleteHandler: func(key string, oldData interface{}, reason DeleteReason) {
+			deleted <- deletion{key, oldData, reason}
+		},
+	}).(*cache)
+	defer c.Close()
+	c.SetDefault("a", 1)
+	c.SetDefault("b", 2)
+
+	c.Delete("a")
+	DeepEqual(t, <-deleted, deletion{"a", 1, ReasonDeleted})
+	c.expire()
+	c.expire()
+	DeepEqual(t, <-deleted, deletion{"b", 2, ReasonExpired})
+	Assert(t, ReasonExpired.String() == "Expired")
+}
+
+func TestRangeEntries(t *testing.T) {
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return nil, errors.New("error")
+		},
+		EnableKeyStats: true,
+	})
+	defer c.Close()
+	c.SetDefault("a", 1)
+	c.Get("a")
+	c.Get("bad")
+
+	got := make(map[string]EntryInfo)
+	c.RangeEntries(func(key string, val interface{}, meta EntryInfo) bool {
+		got[key] = meta
+		return true
+	})
+	Assert(t, len(got) == 2)
+	Assert(t, got["a"].Err == nil && got["a"].Hits == 1 && !got["a"].LastAccess.IsZero())
+	Assert(t, got["bad"].Err != nil)
+
+	n := 0
+	c.RangeEntries(func(key string, val interface{}, meta EntryInfo) bool {
+		n++
+		return false
+	})
+	Assert(t, n == 1)
+}
+
+func TestErrors(t *testing.T) {
+	op := Options{
+		RefreshDuration: time.Second,
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("error")
+			}
+			return key, nil
+		},
+		EnableRefresh: true,
+	}
+	c := NewCache(op)
+
+	c.Get("good")
+	_, err := c.Get("bad")
+	errs := c.Errors()
+	Assert(t, len(errs) == 1)
+	Assert(t, errs["bad"] == err)
+
+	c.DeleteErrored()
+	Assert(t, len(c.Errors()) == 0)
+	DeepEqual(t, c.Dump(), map[string]interface{}{"good": "good"})
+}
+
+func TestWrappedErrors(t *testing.T) {
+	errFetch := errors.New("error")
+	op := Options{
+		RefreshDuration: time.Second,
+		Fetcher: func(key string) (interface{}, error) {
+			return nil, errFetch
+		},
+		DataFetcher: func(val interface{}) (interface{}, error) {
+			return nil, errFetch
+		},
+		EnableRefresh: true,
+	}
+	c := NewCache(op)
+
+	_, err := c.Get("key")
+	Assert(t, errors.Is(err, errFetch))
+	Assert(t, err.Error() == `asynccache: fetch "key": error`)
+	err = c.Refresh("key")
+	Assert(t, errors.Is(err, errFetch))
+	Assert(t, err.Error() == `asynccache: refresh "key": error`)
+
+	c = NewCache(Options{})
+	_, err = c.Get("key")
+	Assert(t, err == ErrNoFetcher)
+	Assert(t, c.Refresh("key") == ErrNoFetcher)
+	Assert(t, c.GetOrSet("key", "def").(string) == "def")
+	Assert(t, c.Put("key", "val") == ErrNoWriter)
+	Assert(t, c.PutAsync("key", "val") == ErrNoWriteBehind)
+}
+
 func TestClose(t *testing.T) {
 	var dur = time.Second / 10
-	var cnt int
+	var cnt int32
 	op := Options{
 		RefreshDuration: dur - time.Millisecond,
 		IsSame: func(key string, oldData, newData interface{}) bool {
 			return false
 		},
 		Fetcher: func(key string) (interface{}, error) {
-			cnt++
-			return cnt, nil
+			return int(atomic.AddInt32(&cnt, 1)), nil
 		},
 		EnableRefresh: true,
 	}
@@ -243,6 +425,44 @@ func TestClose(t *testing.T) {
 	Assert(t, v.(int) == 3)
 }
 
+func TestClosedBehavior(t *testing.T) {
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return "fetched", nil
+		},
+		DataFetcher: func(val interface{}) (interface{}, error) {
+			return val, nil
+		},
+	}
+	c := NewCache(op)
+	c.SetDefault("key", "val")
+	Assert(t, !c.IsClosed())
+	c.Close()
+	c.Close()
+	Assert(t, c.IsClosed())
+
+	v, err := c.Get("key")
+	Assert(t, err == nil && v.(string) == "val")
+	_, err = c.Get("miss")
+	Assert(t, err == ErrClosed)
+	Assert(t, c.GetOrSet("miss", "def").(string) == "def")
+	Assert(t, c.GetOrReset("miss", "reset") == nil)
+	Assert(t, !c.SetDefault("miss", "def"))
+	Assert(t, c.SetDefault("key", "def"))
+	c.Set("key", "new")
+	Assert(t, c.Refresh("key") == ErrClosed)
+	DeepEqual(t, c.Dump(), map[string]interface{}{"key": "val"})
+
+	op.ClosedBehavior = ClosedReject
+	c = NewCache(op)
+	c.SetDefault("key", "val")
+	c.Close()
+	_, err = c.Get("key")
+	Assert(t, err == ErrClosed)
+	Assert(t, c.GetOrSet("key", "def").(string) == "def")
+	Assert(t, c.Put("key", "val") == ErrClosed)
+}
+
 func TestExpire(t *testing.T) {
 	// trigger is used to mark whether fetcher is called
 	trigger := false
@@ -291,6 +511,220 @@ func TestExpire(t *testing.T) {
 	Assert(t, trigger == true)
 }
 
+func TestExpireChunks(t *testing.T) {
+	c := NewCache(Options{
+		EnableExpire:   true,
+		ExpireDuration: time.Hour,
+		ExpireChunks:   4,
+	}).(*cache)
+	defer c.Close()
+	for i := 0; i < 8; i++ {
+		c.SetDefault(strconv.Itoa(i), i)
+	}
+
+	// a round of chunks marks every key once
+	for i := 0; i < 4; i++ {
+		c.expire()
+	}
+	Assert(t, len(c.Dump()) == 8)
+	c.Get("0")
+	c.Get("7")
+
+	// the chunks of the next round delete the keys not accessed, chunk by chunk
+	c.expire()
+	DeepEqual(t, len(c.Dump()), 7)
+	for i := 0; i < 3; i++ {
+		c.expire()
+	}
+	dump := c.Dump()
+	DeepEqual(t, dump, map[string]interface{}{"0": 0, "7": 7})
+}
+
+func TestExpireChunksDeleteMidRound(t *testing.T) {
+	c := NewCache(Options{
+		EnableExpire:   true,
+		ExpireDuration: time.Hour,
+		ExpireChunks:   4,
+	}).(*cache)
+	defer c.Close()
+	for i := 0; i < 8; i++ {
+		c.SetDefault(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 4; i++ {
+		c.expire()
+	}
+	c.Get("0")
+	c.Get("7")
+
+	// deletes and refresh cycles amid the round do not shift keys into the
+	// chunks already swept
+	c.expire()
+	c.Delete("2")
+	c.Delete("3")
+	c.index.live()
+	for i := 0; i < 3; i++ {
+		c.expire()
+	}
+	DeepEqual(t, c.Dump(), map[string]interface{}{"0": 0, "7": 7})
+}
+
+func TestSet(t *testing.T) {
+	var changed int32
+	op := Options{
+		RefreshDuration: time.Second,
+		IsSame: func(key string, oldData, newData interface{}) bool {
+			return oldData == newData
+		},
+		ChangeHandler: func(key string, oldData, newData interface{}) {
+			atomic.AddInt32(&changed, 1)
+		},
+		Fetcher: func(key string) (interface{}, error) {
+			return nil, errors.New("error")
+		},
+		EnableRefresh: true,
+	}
+	c := NewCache(op)
+
+	c.Set("key", "val")
+	v, err := c.Get("key")
+	Assert(t, err == nil)
+	Assert(t, v.(string) == "val")
+
+	_, err = c.Get("key-err")
+	Assert(t, err != nil)
+	c.Set("key-err", "val")
+	v, err = c.Get("key-err")
+	Assert(t, err == nil)
+	Assert(t, v.(string) == "val")
+
+	c.Set("key", "val")
+	c.Set("key", "val2")
+	v, _ = c.Get("key")
+	Assert(t, v.(string) == "val2")
+	time.Sleep(10 * time.Millisecond)
+	Assert(t, atomic.LoadInt32(&changed) == 2)
+}
+
+func TestPut(t *testing.T) {
+	store := map[string]interface{}{}
+	op := Options{
+		RefreshDuration: time.Second,
+		Fetcher: func(key string) (interface{}, error) {
+			return store[key], nil
+		},
+		Writer: func(key string, val interface{}) error {
+			if key == "bad" {
+				return errors.New("error")
+			}
+			store[key] = val
+			return nil
+		},
+		EnableRefresh: true,
+	}
+	c := NewCache(op)
+
+	err := c.Put("key", "val")
+	Assert(t, err == nil)
+	Assert(t, store["key"] == "val")
+	v, _ := c.Get("key")
+	Assert(t, v.(string) == "val")
+
+	err = c.Put("bad", "val")
+	Assert(t, err != nil)
+	_, ok := c.Dump()["bad"]
+	Assert(t, !ok)
+
+	c = NewCache(Options{})
+	Assert(t, c.Put("key", "val") != nil)
+}
+
+func TestRefreshNotClobberSet(t *testing.T) {
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	var blocking int32
+	op := Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if atomic.LoadInt32(&blocking) == 1 {
+				fetching <- struct{}{}
+				<-release
+			}
+			return "stale", nil
+		},
+		EnableRefresh: true,
+	}
+	c := NewCache(op)
+	c.Get("key")
+
+	atomic.StoreInt32(&blocking, 1)
+	done := make(chan struct{})
+	go func() {
+		c.Refresh("key")
+		close(done)
+	}()
+	<-fetching
+
+	set := make(chan struct{})
+	go func() {
+		c.Set("key", "new")
+		close(set)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-done
+	<-set
+
+	v, _ := c.Get("key")
+	Assert(t, v.(string) == "new")
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	var cnt int32
+	op := Options{
+		RefreshDuration: time.Millisecond,
+		Fetcher: func(key string) (interface{}, error) {
+			if atomic.AddInt32(&cnt, 1)%3 == 0 {
+				return nil, errors.New("error")
+			}
+			return key, nil
+		},
+		DataFetcher: func(val interface{}) (interface{}, error) {
+			return val, nil
+		},
+		EnableRefresh:  true,
+		EnableExpire:   true,
+		ExpireDuration: time.Millisecond,
+	}
+	c := NewCache(op)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := strconv.Itoa(j % 5)
+				switch (i + j) % 6 {
+				case 0:
+					c.Get(key)
+				case 1:
+					c.GetOrSet(key, "def")
+				case 2:
+					c.GetOrReset(key, "reset")
+				case 3:
+					c.Set(key, "set")
+				case 4:
+					c.Refresh(key)
+				case 5:
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	c.Dump()
+}
+
 func BenchmarkGet(b *testing.B) {
 	var key = "key"
 	op := Options{
@@ -455,3 +889,478 @@ func DeepEqual(t testingTB, a, b interface{}) {
 		t.Fatal("assertion failed")
 	}
 }
+
+func TestMaxConcurrentFetches(t *testing.T) {
+	var running, peak int32
+	release := make(chan struct{})
+	fetcher := func(key string) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return key, nil
+	}
+	c := NewCache(Options{
+		RefreshDuration:      time.Hour,
+		Fetcher:              fetcher,
+		MaxConcurrentFetches: 2,
+	})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, err := c.Get(strconv.Itoa(i))
+			Assert(t, err == nil && val == strconv.Itoa(i))
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	Assert(t, atomic.LoadInt32(&peak) == 2)
+
+	release = make(chan struct{})
+	c = NewCache(Options{
+		RefreshDuration:      time.Hour,
+		Fetcher:              fetcher,
+		MaxConcurrentFetches: 1,
+		FailFastFetches:      true,
+	})
+	defer c.Close()
+	go c.Get("a")
+	time.Sleep(50 * time.Millisecond)
+	_, err := c.Get("b")
+	Assert(t, err == ErrTooManyFetches)
+	Assert(t, c.GetOrSet("b", "def") == "def")
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	_, err = c.Get("b")
+	Assert(t, err == nil)
+}
+
+func TestGetOrSetWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var timeouts []error
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			<-release
+			return "fetched", nil
+		},
+		FirstFetchTimeout: 20 * time.Millisecond,
+		ErrorHandler: func(key string, err error) {
+			timeouts = append(timeouts, err)
+		},
+	})
+
+	Assert(t, c.GetOrSetWithTimeout("a", "def", 10*time.Millisecond) == "def")
+	Assert(t, c.GetOrSet("a", "def") == "def")
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	Assert(t, c.GetOrSetWithTimeout("a", "def", 10*time.Millisecond) == "fetched")
+	Assert(t, c.GetOrSetWithTimeout("b", "def", time.Second) == "fetched")
+	c.Close()
+	Assert(t, len(timeouts) == 2 && errors.Is(timeouts[0], ErrFetchTimeout))
+}
+
+func TestGetWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			<-release
+			return "fetched", nil
+		},
+	})
+	defer c.Close()
+
+	_, err := c.GetWithTimeout("a", 10*time.Millisecond)
+	Assert(t, errors.Is(err, ErrFetchTimeout))
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	val, err := c.GetWithTimeout("a", 10*time.Millisecond)
+	Assert(t, err == nil && val == "fetched")
+	val, err = c.GetWithTimeout("b", 0)
+	Assert(t, err == nil && val == "fetched")
+}
+
+func TestBackgroundFetch(t *testing.T) {
+	release := make(chan struct{})
+	var cnt int32
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			<-release
+			atomic.AddInt32(&cnt, 1)
+			return "fetched", nil
+		},
+		BackgroundFetch: true,
+	})
+	defer c.Close()
+
+	c.SetDefault("warm", "default")
+	val, err := c.Get("warm")
+	Assert(t, err == nil && val == "default")
+
+	_, err = c.Get("a")
+	Assert(t, err == ErrNotReady)
+	_, err = c.Get("a")
+	Assert(t, err == ErrNotReady)
+	Assert(t, c.GetOrSet("b", "def") == "def")
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	val, err = c.Get("a")
+	Assert(t, err == nil && val == "fetched")
+	Assert(t, c.GetOrSet("b", "def") == "fetched")
+	Assert(t, atomic.LoadInt32(&cnt) == 2)
+}
+
+func TestGetOrSetErrorPolicy(t *testing.T) {
+	var fail, cnt int32
+	fetcher := func(key string) (interface{}, error) {
+		atomic.AddInt32(&cnt, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			return nil, errors.New("error")
+		}
+		return "fetched", nil
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	c := NewCache(Options{RefreshDuration: time.Hour, Fetcher: fetcher})
+	Assert(t, c.GetOrSet("a", "def") == "def")
+	val, err := c.Get("a")
+	Assert(t, err == nil && val == "def")
+	c.Close()
+
+	c = NewCache(Options{RefreshDuration: time.Hour, Fetcher: fetcher, ErrorPolicy: KeepErrorAndReturnDefault})
+	Assert(t, c.GetOrSet("a", "def") == "def")
+	_, err = c.Get("a")
+	Assert(t, err != nil)
+	Assert(t, c.GetOrSet("a", "def2") == "def2")
+	c.Close()
+
+	atomic.StoreInt32(&cnt, 0)
+	c = NewCache(Options{RefreshDuration: time.Hour, Fetcher: fetcher, ErrorPolicy: RetryFetch})
+	defer c.Close()
+	Assert(t, c.GetOrSet("a", "def") == "def")
+	Assert(t, c.GetOrSet("a", "def") == "def")
+	Assert(t, atomic.LoadInt32(&cnt) == 2)
+	atomic.StoreInt32(&fail, 0)
+	Assert(t, c.GetOrSet("a", "def") == "fetched")
+	Assert(t, c.GetOrSet("a", "def") == "fetched")
+	Assert(t, atomic.LoadInt32(&cnt) == 3)
+}
+
+func TestNilPolicy(t *testing.T) {
+	var none int32
+	fetcher := func(key string) (interface{}, error) {
+		if atomic.LoadInt32(&none) == 1 {
+			return nil, nil
+		}
+		return "fetched", nil
+	}
+
+	atomic.StoreInt32(&none, 1)
+	c := NewCache(Options{RefreshDuration: time.Hour, Fetcher: fetcher}).(*cache)
+	val, err := c.Get("a")
+	Assert(t, err == nil && val == nil)
+	_, ok := c.data().Load("a")
+	Assert(t, ok)
+	c.Close()
+
+	c = NewCache(Options{EnableRefresh: true, RefreshDuration: time.Hour, Fetcher: fetcher, NilPolicy: TreatNilAsDelete}).(*cache)
+	_, err = c.Get("a")
+	Assert(t, errors.Is(err, ErrNotFound))
+	Assert(t, c.GetOrSet("a", "def") == "def")
+	_, ok = c.data().Load("a")
+	Assert(t, !ok)
+	atomic.StoreInt32(&none, 0)
+	val, _ = c.Get("a")
+	Assert(t, val == "fetched")
+	atomic.StoreInt32(&none, 1)
+	c.refresh()
+	_, ok = c.data().Load("a")
+	Assert(t, !ok)
+	c.Close()
+
+	c = NewCache(Options{EnableRefresh: true, RefreshDuration: time.Hour, Fetcher: fetcher, NilPolicy: TreatNilAsError}).(*cache)
+	defer c.Close()
+	_, err = c.Get("a")
+	Assert(t, errors.Is(err, ErrNilValue))
+	atomic.StoreInt32(&none, 0)
+	c.refresh()
+	val, _ = c.Get("a")
+	Assert(t, val == "fetched")
+	// the fetched value is kept like on other refresh failures
+	atomic.StoreInt32(&none, 1)
+	c.refresh()
+	val, err = c.Get("a")
+	Assert(t, err == nil && val == "fetched")
+}
+
+func TestValidator(t *testing.T) {
+	var ret atomic.Value
+	ret.Store([]string{"a"})
+	var handled int32
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return ret.Load(), nil
+		},
+		Validator: func(key string, val interface{}) error {
+			if len(val.([]string)) == 0 {
+				return errors.New("empty")
+			}
+			return nil
+		},
+		ErrorHandler: func(key string, err error) {
+			if errors.Is(err, ErrInvalidValue) {
+				atomic.AddInt32(&handled, 1)
+			}
+		},
+	}).(*cache)
+	defer c.Close()
+	val, err := c.Get("k")
+	Assert(t, err == nil && len(val.([]string)) == 1)
+
+	// the stale value is kept
+	ret.Store([]string{})
+	c.refresh()
+	val, err = c.Get("k")
+	Assert(t, err == nil && len(val.([]string)) == 1)
+	c.Close()
+	Assert(t, atomic.LoadInt32(&handled) == 1)
+
+	c = NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return ret.Load(), nil
+		},
+		Validator: func(key string, val interface{}) error {
+			return errors.New("empty")
+		},
+	}).(*cache)
+	defer c.Close()
+	_, err = c.Get("k")
+	var verr *ValidationError
+	Assert(t, errors.As(err, &verr) && verr.Key == "k" && verr.Err.Error() == "empty")
+}
+
+func TestTransformers(t *testing.T) {
+	var fetches int32
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			atomic.AddInt32(&fetches, 1)
+			if key == "bad" {
+				return "x", nil
+			}
+			return "1,2,3", nil
+		},
+		Transformers: []func(key string, val interface{}) (interface{}, error){
+			func(key string, val interface{}) (interface{}, error) {
+				return strings.Split(val.(string), ","), nil
+			},
+			func(key string, val interface{}) (interface{}, error) {
+				var sum int
+				for _, s := range val.([]string) {
+					n, err := strconv.Atoi(s)
+					if err != nil {
+						return nil, err
+					}
+					sum += n
+				}
+				return sum, nil
+			},
+		},
+		Validator: func(key string, val interface{}) error {
+			if val.(int) <= 0 {
+				return errors.New("not positive")
+			}
+			return nil
+		},
+	}).(*cache)
+	defer c.Close()
+	val, err := c.Get("a")
+	Assert(t, err == nil && val == 6)
+	c.refresh()
+	val, err = c.Get("a")
+	Assert(t, err == nil && val == 6 && atomic.LoadInt32(&fetches) == 2)
+
+	_, err = c.Get("bad")
+	var nerr *strconv.NumError
+	Assert(t, errors.As(err, &nerr))
+}
+
+func TestMixedMissesFetchOnce(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		var fetches int32
+		release := make(chan struct{})
+		fetch := func() (interface{}, error) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			if fail {
+				return nil, errors.New("fail")
+			}
+			return "fetched", nil
+		}
+		c := NewCache(Options{
+			RefreshDuration: time.Hour,
+			Fetcher: func(key string) (interface{}, error) {
+				return fetch()
+			},
+			DataFetcher: func(val interface{}) (interface{}, error) {
+				return fetch()
+			},
+			ErrorPolicy: KeepErrorAndReturnDefault,
+		})
+
+		var wg sync.WaitGroup
+		vals := make([]interface{}, 30)
+		for i := range vals {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				switch i % 3 {
+				case 0:
+					vals[i], _ = c.Get("k")
+				case 1:
+					vals[i] = c.GetOrSet("k", "def")
+				case 2:
+					vals[i] = c.GetOrReset("k", "seed")
+				}
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		c.Close()
+
+		Assertf(t, atomic.LoadInt32(&fetches) == 1, "fetched %d times", fetches)
+		for i, val := range vals {
+			switch {
+			case !fail:
+				Assert(t, val == "fetched")
+			case i%3 == 1:
+				Assert(t, val == "def")
+			}
+		}
+	}
+}
+
+func TestRefreshResets(t *testing.T) {
+	var cnt int32
+	c := NewCache(Options{
+		RefreshDuration: 20 * time.Millisecond,
+		DataFetcher: func(val interface{}) (interface{}, error) {
+			return fmt.Sprintf("%v-%d", val, atomic.AddInt32(&cnt, 1)), nil
+		},
+		RefreshResets: true,
+	})
+	defer c.Close()
+
+	Assert(t, c.GetOrReset("a", "seed") == "seed-1")
+	c.SetDefault("b", "default")
+	time.Sleep(50 * time.Millisecond)
+	Assert(t, c.GetOrReset("a", "other") != "seed-1")
+	Assert(t, strings.HasPrefix(c.GetOrReset("a", "other").(string), "seed-"))
+	Assert(t, c.GetOrReset("b", "other") == "default")
+	Assert(t, c.Refresh("b") == ErrNoFetcher)
+}
+
+func TestStoreResetVals(t *testing.T) {
+	var cnt int32
+	c := NewCache(Options{
+		EnableExpire:   true,
+		ExpireDuration: 20 * time.Millisecond,
+		DataFetcher: func(val interface{}) (interface{}, error) {
+			if val == nil {
+				return nil, errors.New("no seed")
+			}
+			return fmt.Sprintf("%v-%d", val, atomic.AddInt32(&cnt, 1)), nil
+		},
+		StoreResetVals: true,
+	})
+	defer c.Close()
+
+	Assert(t, c.GetOrReset("a", "seed") == "seed-1")
+	time.Sleep(60 * time.Millisecond)
+	Assert(t, len(c.Dump()) == 0)
+	Assert(t, c.GetOrReset("a", nil) == "seed-2")
+
+	c.Delete("a")
+	Assert(t, c.GetOrReset("a", nil) == nil)
+}
+
+func BenchmarkRefreshManyKeys(b *testing.B) {
+	for _, n := range []int{1000, 100000, 500000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			c := NewCache(Options{
+				RefreshDuration: time.Hour,
+				Fetcher: func(key string) (interface{}, error) {
+					return key, nil
+				},
+				EnableRefresh: true,
+			}).(*cache)
+			defer c.Close()
+			for i := 0; i < n; i++ {
+				c.Get(strconv.Itoa(i))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.refresh()
+			}
+		})
+	}
+}
+
+// BenchmarkRefreshChurn refreshes 100k keys, a tenth of which are replaced
+// by new keys between the cycles.
+func BenchmarkRefreshChurn(b *testing.B) {
+	const n = 100000
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		EnableRefresh: true,
+	}).(*cache)
+	defer c.Close()
+	for i := 0; i < n; i++ {
+		c.Get(strconv.Itoa(i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < n/10; j++ {
+			c.Delete(strconv.Itoa(i*n/10 + j))
+			c.Get(strconv.Itoa(n + i*n/10 + j))
+		}
+		b.StartTimer()
+		c.refresh()
+	}
+}
+
+func BenchmarkSetExisting(b *testing.B) {
+	c := NewCache(Options{})
+	defer c.Close()
+	c.SetDefault("key", 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set("key", "val")
+	}
+}
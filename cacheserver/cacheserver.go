@@ -0,0 +1,1162 @@
+// Package cacheserver serves a Cache to processes that cannot embed the
+// fetcher logic, such as sidecars and scripts, and provides a client
+// implementing the Cache interface.
+//
+// The service is the gRPC service AsyncCache defined in cacheserver.proto,
+// served over HTTP/2 without TLS, so that clients generated from it in any
+// language can call it. The package implements the gRPC protocol with the
+// standard library only, which serves HTTP/2 without TLS since Go 1.24.
+// Values are encoded by the Codec given to both sides, JSONCodec by default.
+//
+// The service writes to the cache, so a server reachable by untrusted
+// clients should set Options.Authorize, and the clients send their
+// credentials by ClientOptions.Header.
+package cacheserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+const serviceName = "asynccache.AsyncCache"
+
+// maxMessageSize limits the size of the requests read by the server.
+const maxMessageSize = 64 << 20
+
+// The gRPC status codes used by the package.
+const (
+	codeOK              = 0
+	codeInvalidArgument = 3
+	codeInternal        = 13
+	codeUnimplemented   = 12
+	codeUnauthenticated = 16
+)
+
+// errorCodes are the errors of the cache sent as the ErrorCode of replies by
+// their index, so that the client returns errors matching them by errors.Is.
+var errorCodes = []error{
+	nil, // UNKNOWN
+	asynccache.ErrNotFound,
+	asynccache.ErrClosed,
+	asynccache.ErrLeased,
+	asynccache.ErrLeaseExpired,
+	asynccache.ErrFetchTimeout,
+	asynccache.ErrNotReady,
+	asynccache.ErrTooManyFetches,
+	asynccache.ErrNoFetcher,
+	asynccache.ErrNoWriter,
+	asynccache.ErrNoWriteBehind,
+}
+
+// Args is the request of all methods.
+type Args struct {
+	Key      string
+	Value    []byte
+	Nil      bool
+	Timeout  time.Duration
+	Data     map[string][]byte
+	Keys     []string
+	Token    asynccache.LeaseToken
+	TTL      time.Duration
+	Limit    int
+	SinceSeq uint64
+	Tenant   string
+	NilKeys  []string
+}
+
+// Reply is the response of all methods.
+type Reply struct {
+	Value   []byte
+	Nil     bool
+	Err     string
+	Exist   bool
+	Data    map[string][]byte
+	Keys    []string
+	Errs    map[string]string
+	Stats   []asynccache.KeyStat
+	Total   asynccache.Stats
+	Tenant  asynccache.TenantStats
+	Count   int
+	Changes []Change
+	Seq     uint64
+	Token   asynccache.LeaseToken
+	Code    int32 // the index of Err in errorCodes
+	NilKeys []string
+}
+
+// Change is a ChangeRecord with the value encoded.
+type Change struct {
+	Seq   uint64
+	Op    asynccache.ChangeOp
+	Key   string
+	Value []byte
+	Nil   bool
+	Err   string
+}
+
+// Options configures a Service.
+type Options struct {
+	// Codec encodes the values, JSONCodec by default.
+	Codec asynccache.Codec
+	// Authorize is called with each call and the name of its method, such
+	// as "Set", before it is served, e.g. to check its Authorization header.
+	// The call fails with the status Unauthenticated if it returns an error.
+	Authorize func(r *http.Request, method string) error
+}
+
+// Service serves the methods of a cache, it is the http.Handler of the
+// gRPC service.
+type Service struct {
+	c     asynccache.Cache
+	codec asynccache.Codec
+	opt   Options
+}
+
+// methods are the methods of the service by name.
+var methods = map[string]func(s *Service, args *Args, reply *Reply) error{
+	"Get":                 (*Service).Get,
+	"GetWithTimeout":      (*Service).GetWithTimeout,
+	"GetOrSet":            (*Service).GetOrSet,
+	"GetOrSetWithTimeout": (*Service).GetOrSetWithTimeout,
+	"GetOrSetMulti":       (*Service).GetOrSetMulti,
+	"GetAll":              (*Service).GetAll,
+	"GetOrReset":          (*Service).GetOrReset,
+	"GetOrResetWithTTL":   (*Service).GetOrResetWithTTL,
+	"SetDefault":          (*Service).SetDefault,
+	"Set":                 (*Service).Set,
+	"Lease":               (*Service).Lease,
+	"SetWithLease":        (*Service).SetWithLease,
+	"Put":                 (*Service).Put,
+	"PutAsync":            (*Service).PutAsync,
+	"Flush":               (*Service).Flush,
+	"Delete":              (*Service).Delete,
+	"Refresh":             (*Service).Refresh,
+	"Errors":              (*Service).Errors,
+	"DeleteErrored":       (*Service).DeleteErrored,
+	"TopKeys":             (*Service).TopKeys,
+	"Stats":               (*Service).Stats,
+	"ReplaceAll":          (*Service).ReplaceAll,
+	"Healthy":             (*Service).Healthy,
+	"Changes":             (*Service).Changes,
+	"TenantStats":         (*Service).TenantStats,
+	"PurgeTenant":         (*Service).PurgeTenant,
+	"Dump":                (*Service).Dump,
+	"Keys":                (*Service).Keys,
+}
+
+// NewService creates the Service of c, which is served by Serve, or by an
+// http.Server of TLS as an http.Handler.
+func NewService(c asynccache.Cache, opt Options) *Service {
+	if opt.Codec == nil {
+		opt.Codec = asynccache.JSONCodec{}
+	}
+	return &Service{c: c, codec: opt.Codec, opt: opt}
+}
+
+// Serve serves c on lis until lis is closed, values are encoded as JSON and
+// calls are not authorized.
+func Serve(c asynccache.Cache, lis net.Listener) error {
+	return NewService(c, Options{}).Serve(lis)
+}
+
+// Serve serves the service on lis over HTTP/2 without TLS until lis is closed.
+func (s *Service) Serve(lis net.Listener) error {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{Handler: s, Protocols: &protocols}
+	return srv.Serve(lis)
+}
+
+// ServeHTTP serves a gRPC call.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "cacheserver: gRPC calls only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	name, _ := strings.CutPrefix(r.URL.Path, "/"+serviceName+"/")
+	method, ok := methods[name]
+	if !ok {
+		setStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	if s.opt.Authorize != nil {
+		if err := s.opt.Authorize(r, name); err != nil {
+			setStatus(w, codeUnauthenticated, err.Error())
+			return
+		}
+	}
+	msg, err := readFrame(r.Body, maxMessageSize)
+	if err != nil {
+		setStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+	args := &Args{}
+	if err = args.unmarshal(msg); err != nil {
+		setStatus(w, codeInvalidArgument, err.Error())
+		return
+	}
+	reply := &Reply{}
+	if err = method(s, args, reply); err != nil {
+		setStatus(w, codeInternal, err.Error())
+		return
+	}
+	if _, err = w.Write(frame(reply.marshal())); err != nil {
+		return
+	}
+	setStatus(w, codeOK, "")
+}
+
+// setStatus sets the gRPC status to the trailers.
+func setStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(msg))
+	}
+}
+
+// frame prefixes msg with the gRPC message header: an uncompressed flag
+// and the length.
+func frame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readFrame reads a message of at most max bytes framed by frame.
+func readFrame(r io.Reader, max int) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("cacheserver: compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if uint64(n) > uint64(max) {
+		return nil, fmt.Errorf("cacheserver: message of %d bytes exceeds %d", n, max)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// setErr sets the error of the cache to reply.
+func setErr(reply *Reply, err error) {
+	reply.Err = err.Error()
+	for i, target := range errorCodes {
+		if target != nil && errors.Is(err, target) {
+			reply.Code = int32(i)
+			return
+		}
+	}
+}
+
+// err returns the error of the cache in reply, which matches the error of
+// its Code by errors.Is.
+func (r *Reply) err() error {
+	if r.Err == "" {
+		return nil
+	}
+	err := &remoteError{msg: r.Err}
+	if r.Code > 0 && int(r.Code) < len(errorCodes) {
+		err.target = errorCodes[r.Code]
+	}
+	return err
+}
+
+// remoteError is an error returned by the cache of the server.
+type remoteError struct {
+	msg    string
+	target error
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error of the cache the error matches.
+func (e *remoteError) Unwrap() error {
+	return e.target
+}
+
+func (s *Service) decode(args *Args) (interface{}, error) {
+	if args.Nil {
+		return nil, nil
+	}
+	return s.codec.Unmarshal(args.Value)
+}
+
+func (s *Service) encode(val interface{}, reply *Reply) error {
+	if val == nil {
+		reply.Nil = true
+		return nil
+	}
+	data, err := s.codec.Marshal(val)
+	if data == nil {
+		data = []byte{}
+	}
+	reply.Value = data
+	return err
+}
+
+// Get serves Cache.Get.
+func (s *Service) Get(args *Args, reply *Reply) error {
+	val, err := s.c.Get(args.Key)
+	if err != nil {
+		setErr(reply, err)
+	}
+	return s.encode(val, reply)
+}
+
+// GetWithTimeout serves Cache.GetWithTimeout.
+func (s *Service) GetWithTimeout(args *Args, reply *Reply) error {
+	val, err := s.c.GetWithTimeout(args.Key, args.Timeout)
+	if err != nil {
+		setErr(reply, err)
+	}
+	return s.encode(val, reply)
+}
+
+// GetOrSet serves Cache.GetOrSet.
+func (s *Service) GetOrSet(args *Args, reply *Reply) error {
+	def, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	return s.encode(s.c.GetOrSet(args.Key, def), reply)
+}
+
+// GetOrSetWithTimeout serves Cache.GetOrSetWithTimeout.
+func (s *Service) GetOrSetWithTimeout(args *Args, reply *Reply) error {
+	def, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	return s.encode(s.c.GetOrSetWithTimeout(args.Key, def, args.Timeout), reply)
+}
+
+// GetOrReset serves Cache.GetOrReset.
+func (s *Service) GetOrReset(args *Args, reply *Reply) error {
+	resetVal, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	return s.encode(s.c.GetOrReset(args.Key, resetVal), reply)
+}
+
+// GetOrResetWithTTL serves Cache.GetOrResetWithTTL.
+func (s *Service) GetOrResetWithTTL(args *Args, reply *Reply) error {
+	resetVal, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	return s.encode(s.c.GetOrResetWithTTL(args.Key, resetVal, args.TTL), reply)
+}
+
+// SetDefault serves Cache.SetDefault.
+func (s *Service) SetDefault(args *Args, reply *Reply) error {
+	val, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	reply.Exist = s.c.SetDefault(args.Key, val)
+	return nil
+}
+
+// Set serves Cache.Set.
+func (s *Service) Set(args *Args, reply *Reply) error {
+	val, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	s.c.Set(args.Key, val)
+	return nil
+}
+
+// Lease serves Cache.Lease.
+func (s *Service) Lease(args *Args, reply *Reply) error {
+	token, err := s.c.Lease(args.Key, args.TTL)
+	if err != nil {
+		setErr(reply, err)
+	}
+	reply.Token = token
+	return nil
+}
+
+// SetWithLease serves Cache.SetWithLease.
+func (s *Service) SetWithLease(args *Args, reply *Reply) error {
+	val, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	if err = s.c.SetWithLease(args.Key, val, args.Token); err != nil {
+		setErr(reply, err)
+	}
+	return nil
+}
+
+// Put serves Cache.Put.
+func (s *Service) Put(args *Args, reply *Reply) error {
+	val, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	if err = s.c.Put(args.Key, val); err != nil {
+		setErr(reply, err)
+	}
+	return nil
+}
+
+// PutAsync serves Cache.PutAsync.
+func (s *Service) PutAsync(args *Args, reply *Reply) error {
+	val, err := s.decode(args)
+	if err != nil {
+		return err
+	}
+	if err = s.c.PutAsync(args.Key, val); err != nil {
+		setErr(reply, err)
+	}
+	return nil
+}
+
+// Flush serves Cache.Flush.
+func (s *Service) Flush(args *Args, reply *Reply) error {
+	if err := s.c.Flush(context.Background()); err != nil {
+		setErr(reply, err)
+	}
+	return nil
+}
+
+// Delete serves Cache.Delete.
+func (s *Service) Delete(args *Args, reply *Reply) error {
+	s.c.Delete(args.Key)
+	return nil
+}
+
+// Errors serves Cache.Errors.
+func (s *Service) Errors(args *Args, reply *Reply) error {
+	errs := s.c.Errors()
+	reply.Errs = make(map[string]string, len(errs))
+	for k, err := range errs {
+		reply.Errs[k] = err.Error()
+	}
+	return nil
+}
+
+// DeleteErrored serves Cache.DeleteErrored.
+func (s *Service) DeleteErrored(args *Args, reply *Reply) error {
+	s.c.DeleteErrored()
+	return nil
+}
+
+// TopKeys serves Cache.TopKeys.
+func (s *Service) TopKeys(args *Args, reply *Reply) error {
+	reply.Stats = s.c.TopKeys(args.Limit)
+	return nil
+}
+
+// Changes serves Cache.Changes.
+func (s *Service) Changes(args *Args, reply *Reply) error {
+	for _, rec := range s.c.Changes(args.SinceSeq) {
+		ch := Change{Seq: rec.Seq, Op: rec.Op, Key: rec.Key, Nil: rec.Value == nil}
+		if rec.Err != nil {
+			ch.Err = rec.Err.Error()
+		}
+		if rec.Value != nil {
+			data, err := s.codec.Marshal(rec.Value)
+			if err != nil {
+				return err
+			}
+			if data == nil {
+				data = []byte{}
+			}
+			ch.Value = data
+		}
+		reply.Changes = append(reply.Changes, ch)
+	}
+	return nil
+}
+
+// Healthy serves Cache.Healthy.
+func (s *Service) Healthy(args *Args, reply *Reply) error {
+	if err := s.c.Healthy(); err != nil {
+		setErr(reply, err)
+	}
+	return nil
+}
+
+// GetOrSetMulti serves Cache.GetOrSetMulti, the keys of nil defaults and
+// values are passed in NilKeys.
+func (s *Service) GetOrSetMulti(args *Args, reply *Reply) error {
+	defaults := make(map[string]interface{}, len(args.Data)+len(args.Keys))
+	for k, b := range args.Data {
+		v, err := s.codec.Unmarshal(b)
+		if err != nil {
+			return err
+		}
+		defaults[k] = v
+	}
+	for _, k := range args.NilKeys {
+		defaults[k] = nil
+	}
+	reply.Data = make(map[string][]byte, len(defaults))
+	for k, v := range s.c.GetOrSetMulti(defaults) {
+		if v == nil {
+			reply.NilKeys = append(reply.NilKeys, k)
+			continue
+		}
+		b, err := s.codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		reply.Data[k] = b
+	}
+	return nil
+}
+
+// GetAll serves Cache.GetAll, the keys of nil values are returned in NilKeys.
+func (s *Service) GetAll(args *Args, reply *Reply) error {
+	vals, seq, err := s.c.GetAll(args.Keys...)
+	reply.Seq = seq
+	if err != nil {
+		setErr(reply, err)
+	}
+	reply.Data = make(map[string][]byte, len(vals))
+	for k, v := range vals {
+		if v == nil {
+			reply.NilKeys = append(reply.NilKeys, k)
+			continue
+		}
+		b, err := s.codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		reply.Data[k] = b
+	}
+	return nil
+}
+
+// ReplaceAll serves Cache.ReplaceAll.
+func (s *Service) ReplaceAll(args *Args, reply *Reply) error {
+	data := make(map[string]interface{}, len(args.Data))
+	for k, b := range args.Data {
+		v, err := s.codec.Unmarshal(b)
+		if err != nil {
+			return err
+		}
+		data[k] = v
+	}
+	s.c.ReplaceAll(data)
+	return nil
+}
+
+// Stats serves Cache.Stats.
+func (s *Service) Stats(args *Args, reply *Reply) error {
+	reply.Total = s.c.Stats()
+	return nil
+}
+
+// TenantStats serves Cache.TenantStats.
+func (s *Service) TenantStats(args *Args, reply *Reply) error {
+	reply.Tenant = s.c.TenantStats(args.Tenant)
+	return nil
+}
+
+// PurgeTenant serves Cache.PurgeTenant.
+func (s *Service) PurgeTenant(args *Args, reply *Reply) error {
+	reply.Count = s.c.PurgeTenant(args.Tenant)
+	return nil
+}
+
+// Refresh serves Cache.Refresh.
+func (s *Service) Refresh(args *Args, reply *Reply) error {
+	if err := s.c.Refresh(args.Key); err != nil {
+		setErr(reply, err)
+	}
+	return nil
+}
+
+// Dump serves Cache.Dump.
+func (s *Service) Dump(args *Args, reply *Reply) error {
+	data := s.c.Dump()
+	reply.Data = make(map[string][]byte, len(data))
+	for k, v := range data {
+		if v == nil {
+			// errored entries have no value
+			continue
+		}
+		b, err := s.codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		reply.Data[k] = b
+	}
+	return nil
+}
+
+// Keys lists the cached keys.
+func (s *Service) Keys(args *Args, reply *Reply) error {
+	for k := range s.c.Dump() {
+		reply.Keys = append(reply.Keys, k)
+	}
+	return nil
+}
+
+// Client is a Cache served by a remote process.
+// Methods without an error result ignore transport errors, returning the
+// default value or zero value; they are reported to ErrorHandler if it is set.
+type Client struct {
+	hc           *http.Client
+	closed       int32
+	codec        asynccache.Codec
+	header       http.Header
+	ErrorHandler func(err error)
+}
+
+// ClientOptions configures a Client.
+type ClientOptions struct {
+	// Codec encodes the values, JSONCodec by default.
+	Codec asynccache.Codec
+	// Header is sent with every call, e.g. the Authorization header checked
+	// by Options.Authorize of the server.
+	Header http.Header
+}
+
+var _ asynccache.Cache = (*Client)(nil)
+
+// Dial connects to the server at the address, values are encoded as JSON.
+func Dial(network, address string) (*Client, error) {
+	return DialWithOptions(network, address, ClientOptions{})
+}
+
+// DialWithOptions connects to the server at the address with opt.
+func DialWithOptions(network, address string, opt ClientOptions) (*Client, error) {
+	if opt.Codec == nil {
+		opt.Codec = asynccache.JSONCodec{}
+	}
+	var d net.Dialer
+	conn, err := d.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	// the first connection is the one dialed, the transport redials the
+	// address once it is lost.
+	var mu sync.Mutex
+	first := conn
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	tr := &http.Transport{
+		Protocols: &protocols,
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			mu.Lock()
+			conn := first
+			first = nil
+			mu.Unlock()
+			if conn != nil {
+				return conn, nil
+			}
+			return d.DialContext(ctx, network, address)
+		},
+	}
+	return &Client{hc: &http.Client{Transport: tr}, codec: opt.Codec, header: opt.Header}, nil
+}
+
+func (c *Client) call(method string, key string, val interface{}, hasVal bool) (*Reply, error) {
+	return c.callArgs(method, &Args{Key: key}, val, hasVal)
+}
+
+func (c *Client) callArgs(method string, args *Args, val interface{}, hasVal bool) (*Reply, error) {
+	return c.callContext(context.Background(), method, args, val, hasVal)
+}
+
+func (c *Client) callContext(ctx context.Context, method string, args *Args, val interface{}, hasVal bool) (*Reply, error) {
+	if hasVal {
+		if val == nil {
+			args.Nil = true
+		} else {
+			data, err := c.codec.Marshal(val)
+			if err != nil {
+				return nil, err
+			}
+			if data == nil {
+				data = []byte{}
+			}
+			args.Value = data
+		}
+	}
+	reply, err := c.invoke(ctx, method, args)
+	if err != nil {
+		c.handleError(err)
+		return nil, err
+	}
+	return reply, nil
+}
+
+// invoke makes the gRPC call of method.
+func (c *Client) invoke(ctx context.Context, method string, args *Args) (*Reply, error) {
+	// the host is not used by DialContext.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://cacheserver/"+serviceName+"/"+method, bytes.NewReader(frame(args.marshal())))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cacheserver: %s: unexpected HTTP status %d", method, resp.StatusCode)
+	}
+	msg, readErr := readFrame(resp.Body, 1<<32-1)
+	if readErr == nil {
+		_, readErr = io.Copy(io.Discard, resp.Body)
+	}
+	// the status is in the headers of trailers-only responses.
+	status, desc := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, desc = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != strconv.Itoa(codeOK) {
+		if d, err := url.PathUnescape(desc); err == nil {
+			desc = d
+		}
+		return nil, fmt.Errorf("cacheserver: %s: code %s: %s", method, status, desc)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	reply := &Reply{}
+	if err = reply.unmarshal(msg); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (c *Client) value(reply *Reply) (interface{}, error) {
+	if reply.Nil {
+		return nil, nil
+	}
+	return c.codec.Unmarshal(reply.Value)
+}
+
+func (c *Client) handleError(err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
+
+// SetDefault implements Cache.
+func (c *Client) SetDefault(key string, val interface{}) bool {
+	reply, err := c.call("SetDefault", key, val, true)
+	return err == nil && reply.Exist
+}
+
+// Set implements Cache.
+func (c *Client) Set(key string, val interface{}) {
+	c.call("Set", key, val, true)
+}
+
+// Lease implements Cache.
+func (c *Client) Lease(key string, ttl time.Duration) (asynccache.LeaseToken, error) {
+	reply, err := c.callArgs("Lease", &Args{Key: key, TTL: ttl}, nil, false)
+	if err != nil {
+		return 0, err
+	}
+	return reply.Token, reply.err()
+}
+
+// SetWithLease implements Cache.
+func (c *Client) SetWithLease(key string, val interface{}, token asynccache.LeaseToken) error {
+	reply, err := c.callArgs("SetWithLease", &Args{Key: key, Token: token}, val, true)
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
+
+// Put implements Cache.
+func (c *Client) Put(key string, val interface{}) error {
+	reply, err := c.call("Put", key, val, true)
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
+
+// PutAsync implements Cache.
+func (c *Client) PutAsync(key string, val interface{}) error {
+	reply, err := c.call("PutAsync", key, val, true)
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
+
+// Flush implements Cache, the remote flush goes on if ctx is done.
+func (c *Client) Flush(ctx context.Context) error {
+	reply, err := c.callContext(ctx, "Flush", &Args{}, nil, false)
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
+
+// Get implements Cache.
+func (c *Client) Get(key string) (interface{}, error) {
+	reply, err := c.call("Get", key, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	val, err := c.value(reply)
+	if err != nil {
+		return nil, err
+	}
+	return val, reply.err()
+}
+
+// GetWithTimeout implements Cache, the timeout applies to the remote fetch.
+func (c *Client) GetWithTimeout(key string, timeout time.Duration) (interface{}, error) {
+	reply, err := c.callArgs("GetWithTimeout", &Args{Key: key, Timeout: timeout}, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	val, err := c.value(reply)
+	if err != nil {
+		return nil, err
+	}
+	return val, reply.err()
+}
+
+// Acquire implements Cache, the values of the server are copies, so
+// Release of the returned Handle does nothing.
+func (c *Client) Acquire(key string) (asynccache.Handle, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return asynccache.NewHandle(val), nil
+}
+
+// GetAll implements Cache.
+func (c *Client) GetAll(keys ...string) (map[string]interface{}, uint64, error) {
+	reply, err := c.callArgs("GetAll", &Args{Keys: keys}, nil, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	vals := make(map[string]interface{}, len(reply.Data)+len(reply.NilKeys))
+	for k, b := range reply.Data {
+		v, err := c.codec.Unmarshal(b)
+		if err != nil {
+			return nil, 0, err
+		}
+		vals[k] = v
+	}
+	for _, k := range reply.NilKeys {
+		vals[k] = nil
+	}
+	return vals, reply.Seq, reply.err()
+}
+
+// GetOrSetMulti implements Cache, it returns defaults if the call fails.
+func (c *Client) GetOrSetMulti(defaults map[string]interface{}) map[string]interface{} {
+	args := &Args{Data: make(map[string][]byte, len(defaults))}
+	for k, def := range defaults {
+		if def == nil {
+			args.NilKeys = append(args.NilKeys, k)
+			continue
+		}
+		b, err := c.codec.Marshal(def)
+		if err != nil {
+			c.handleError(err)
+			return defaults
+		}
+		args.Data[k] = b
+	}
+	reply, err := c.callArgs("GetOrSetMulti", args, nil, false)
+	if err != nil {
+		return defaults
+	}
+	vals := make(map[string]interface{}, len(defaults))
+	for k, b := range reply.Data {
+		v, err := c.codec.Unmarshal(b)
+		if err != nil {
+			c.handleError(err)
+			v = defaults[k]
+		}
+		vals[k] = v
+	}
+	for _, k := range reply.NilKeys {
+		vals[k] = nil
+	}
+	return vals
+}
+
+// GetOrSet implements Cache.
+func (c *Client) GetOrSet(key string, defaultVal interface{}) interface{} {
+	reply, err := c.call("GetOrSet", key, defaultVal, true)
+	if err != nil {
+		return defaultVal
+	}
+	val, err := c.value(reply)
+	if err != nil {
+		c.handleError(err)
+		return defaultVal
+	}
+	return val
+}
+
+// GetOrSetWithTimeout implements Cache, the timeout applies to the remote fetch.
+func (c *Client) GetOrSetWithTimeout(key string, defaultVal interface{}, timeout time.Duration) interface{} {
+	reply, err := c.callArgs("GetOrSetWithTimeout", &Args{Key: key, Timeout: timeout}, defaultVal, true)
+	if err != nil {
+		return defaultVal
+	}
+	val, err := c.value(reply)
+	if err != nil {
+		c.handleError(err)
+		return defaultVal
+	}
+	return val
+}
+
+// GetOrReset implements Cache.
+func (c *Client) GetOrReset(key string, resetVal interface{}) interface{} {
+	reply, err := c.call("GetOrReset", key, resetVal, true)
+	if err != nil {
+		return nil
+	}
+	val, err := c.value(reply)
+	if err != nil {
+		c.handleError(err)
+	}
+	return val
+}
+
+// GetOrResetWithTTL implements Cache.
+func (c *Client) GetOrResetWithTTL(key string, resetVal interface{}, ttl time.Duration) interface{} {
+	reply, err := c.callArgs("GetOrResetWithTTL", &Args{Key: key, TTL: ttl}, resetVal, true)
+	if err != nil {
+		return nil
+	}
+	val, err := c.value(reply)
+	if err != nil {
+		c.handleError(err)
+	}
+	return val
+}
+
+// Dump implements Cache.
+func (c *Client) Dump() map[string]interface{} {
+	data := make(map[string]interface{})
+	reply, err := c.call("Dump", "", nil, false)
+	if err != nil {
+		return data
+	}
+	for k, b := range reply.Data {
+		v, err := c.codec.Unmarshal(b)
+		if err != nil {
+			c.handleError(err)
+			continue
+		}
+		data[k] = v
+	}
+	return data
+}
+
+// Changes implements Cache.
+func (c *Client) Changes(sinceSeq uint64) []asynccache.ChangeRecord {
+	reply, err := c.callArgs("Changes", &Args{SinceSeq: sinceSeq}, nil, false)
+	if err != nil {
+		return nil
+	}
+	recs := make([]asynccache.ChangeRecord, 0, len(reply.Changes))
+	for _, ch := range reply.Changes {
+		rec := asynccache.ChangeRecord{Seq: ch.Seq, Op: ch.Op, Key: ch.Key}
+		if ch.Err != "" {
+			rec.Err = errors.New(ch.Err)
+		}
+		if !ch.Nil {
+			if rec.Value, err = c.codec.Unmarshal(ch.Value); err != nil {
+				c.handleError(err)
+				return recs
+			}
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// ReplaceAll implements Cache.
+func (c *Client) ReplaceAll(data map[string]interface{}) {
+	args := &Args{Data: make(map[string][]byte, len(data))}
+	for k, v := range data {
+		b, err := c.codec.Marshal(v)
+		if err != nil {
+			c.handleError(err)
+			return
+		}
+		args.Data[k] = b
+	}
+	c.callArgs("ReplaceAll", args, nil, false)
+}
+
+// Snapshot implements Cache with the entries dumped by the server, the
+// values and errors are dumped separately, and may not be consistent.
+func (c *Client) Snapshot() *asynccache.Snapshot {
+	return asynccache.NewSnapshot(c.Dump(), c.Errors())
+}
+
+// RangeEntries implements Cache with the entries dumped by the server, only
+// the errors of the metadata are provided.
+func (c *Client) RangeEntries(fn func(key string, val interface{}, meta asynccache.EntryInfo) bool) {
+	errs := c.Errors()
+	for k, v := range c.Dump() {
+		if !fn(k, v, asynccache.EntryInfo{Err: errs[k]}) {
+			return
+		}
+	}
+}
+
+// DeleteIf implements Cache, the predicate is evaluated by the client.
+func (c *Client) DeleteIf(shouldDelete func(key string) bool) {
+	reply, err := c.call("Keys", "", nil, false)
+	if err != nil {
+		return
+	}
+	for _, k := range reply.Keys {
+		if shouldDelete(k) {
+			c.Delete(k)
+		}
+	}
+}
+
+// DeleteIfValue implements Cache, the predicate is evaluated by the client.
+func (c *Client) DeleteIfValue(shouldDelete func(key string, val interface{}) bool) int {
+	n := 0
+	for k, v := range c.Dump() {
+		if shouldDelete(k, v) {
+			c.Delete(k)
+			n++
+		}
+	}
+	return n
+}
+
+// Delete implements Cache.
+func (c *Client) Delete(key string) {
+	c.call("Delete", key, nil, false)
+}
+
+// Errors implements Cache.
+func (c *Client) Errors() map[string]error {
+	errs := make(map[string]error)
+	reply, err := c.call("Errors", "", nil, false)
+	if err != nil {
+		return errs
+	}
+	for k, msg := range reply.Errs {
+		errs[k] = errors.New(msg)
+	}
+	return errs
+}
+
+// DeleteErrored implements Cache.
+func (c *Client) DeleteErrored() {
+	c.call("DeleteErrored", "", nil, false)
+}
+
+// TopKeys implements Cache.
+func (c *Client) TopKeys(n int) []asynccache.KeyStat {
+	reply, err := c.callArgs("TopKeys", &Args{Limit: n}, nil, false)
+	if err != nil {
+		return nil
+	}
+	return reply.Stats
+}
+
+// Stats implements Cache.
+func (c *Client) Stats() asynccache.Stats {
+	reply, err := c.call("Stats", "", nil, false)
+	if err != nil {
+		return asynccache.Stats{}
+	}
+	return reply.Total
+}
+
+// TenantStats implements Cache.
+func (c *Client) TenantStats(id string) asynccache.TenantStats {
+	reply, err := c.callArgs("TenantStats", &Args{Tenant: id}, nil, false)
+	if err != nil {
+		return asynccache.TenantStats{}
+	}
+	return reply.Tenant
+}
+
+// PurgeTenant implements Cache.
+func (c *Client) PurgeTenant(id string) int {
+	reply, err := c.callArgs("PurgeTenant", &Args{Tenant: id}, nil, false)
+	if err != nil {
+		return 0
+	}
+	return reply.Count
+}
+
+// Healthy implements Cache, the client is unhealthy if the server is unreachable.
+func (c *Client) Healthy() error {
+	reply, err := c.call("Healthy", "", nil, false)
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
+
+// EstimatedSize implements Cache.
+func (c *Client) EstimatedSize() int64 {
+	return c.Stats().EstimatedSize
+}
+
+// Refresh implements Cache.
+func (c *Client) Refresh(key string) error {
+	reply, err := c.call("Refresh", key, nil, false)
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
+
+// Close closes the connections, the remote cache is not closed.
+func (c *Client) Close() {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.hc.CloseIdleConnections()
+	}
+}
+
+// IsClosed reports whether the connection is closed.
+func (c *Client) IsClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
@@ -0,0 +1,218 @@
+package cacheserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestClient(t *testing.T) {
+	c := asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("bad key")
+			}
+			return "val-" + key, nil
+		},
+		ChangeLogSize: 100,
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go NewService(c, Options{Codec: asynccache.StringCodec{}}).Serve(lis)
+
+	client, err := DialWithOptions("tcp", lis.Addr().String(), ClientOptions{Codec: asynccache.StringCodec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	v, err := client.Get("a")
+	if err != nil || v.(string) != "val-a" {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+	if _, err = client.Get("bad"); err == nil || err.Error() != `asynccache: fetch "bad": bad key` {
+		t.Fatalf("Get error = %v", err)
+	}
+	if client.SetDefault("b", "def") {
+		t.Fatal("SetDefault of new key reports exist")
+	}
+	client.Set("c", "set")
+	if v = client.GetOrSet("c", "def"); v.(string) != "set" {
+		t.Fatalf("GetOrSet = %v", v)
+	}
+	if v = client.GetOrSetWithTimeout("c", "def", time.Second); v.(string) != "set" {
+		t.Fatalf("GetOrSetWithTimeout = %v", v)
+	}
+	vals := client.GetOrSetMulti(map[string]interface{}{"c": "def", "d": "def"})
+	if len(vals) != 2 || vals["c"] != "set" || vals["d"] != "val-d" {
+		t.Fatalf("GetOrSetMulti = %v", vals)
+	}
+	all, _, err := client.GetAll("c", "d")
+	if err != nil || len(all) != 2 || all["d"] != "val-d" {
+		t.Fatalf("GetAll = %v, %v", all, err)
+	}
+	client.Delete("d")
+
+	client.DeleteIf(func(key string) bool { return key == "a" })
+	data := client.Dump()
+	if len(data) != 2 || data["b"] != "def" || data["c"] != "set" {
+		t.Fatalf("Dump = %v", data)
+	}
+
+	recs := client.Changes(0)
+	last := recs[len(recs)-1]
+	if last.Op != asynccache.ChangeDelete || last.Key != "a" {
+		t.Fatalf("Changes = %v", recs)
+	}
+	if recs[0].Op != asynccache.ChangeSet || recs[0].Key != "a" || recs[0].Value != "val-a" {
+		t.Fatalf("Changes = %v", recs)
+	}
+}
+
+func TestServe(t *testing.T) {
+	c := asynccache.NewCache(asynccache.Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return "val-" + key, nil
+		},
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go Serve(c, lis)
+
+	client, err := Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	v, err := client.GetWithTimeout("a", time.Second)
+	if err != nil || v.(string) != "val-a" {
+		t.Fatalf("GetWithTimeout = %v, %v", v, err)
+	}
+	_, err = client.invoke(context.Background(), "Nope", &Args{})
+	if err == nil || !strings.Contains(err.Error(), "code 12") {
+		t.Fatalf("unknown method error = %v", err)
+	}
+
+	// the errors of the cache match by errors.Is
+	if _, err = client.Lease("a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Lease("a", time.Minute); !errors.Is(err, asynccache.ErrLeased) {
+		t.Fatalf("Lease error = %v", err)
+	}
+	if err = client.SetWithLease("b", "v", 1); !errors.Is(err, asynccache.ErrLeaseExpired) {
+		t.Fatalf("SetWithLease error = %v", err)
+	}
+	if err = client.Put("b", "v"); !errors.Is(err, asynccache.ErrNoWriter) || errors.Is(err, asynccache.ErrClosed) {
+		t.Fatalf("Put error = %v", err)
+	}
+	c.Close()
+	if _, err = client.Get("b"); !errors.Is(err, asynccache.ErrClosed) {
+		t.Fatalf("Get error = %v", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	c := asynccache.NewCache(asynccache.Options{})
+	defer c.Close()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	var methods []string
+	go NewService(c, Options{
+		Authorize: func(r *http.Request, method string) error {
+			if method == "Set" && r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("not allowed")
+			}
+			methods = append(methods, method)
+			return nil
+		},
+	}).Serve(lis)
+
+	anonymous, err := Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anonymous.Close()
+	var errs []error
+	anonymous.ErrorHandler = func(err error) { errs = append(errs, err) }
+	anonymous.Set("a", "v")
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "code 16: not allowed") {
+		t.Fatalf("errors = %v", errs)
+	}
+	if _, ok := c.Dump()["a"]; ok {
+		t.Fatal("unauthorized Set is served")
+	}
+
+	client, err := DialWithOptions("tcp", lis.Addr().String(), ClientOptions{
+		Header: http.Header{"Authorization": {"Bearer secret"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Set("a", "v")
+	if v := client.GetOrSet("a", "def"); v != "v" {
+		t.Fatalf("GetOrSet = %v", v)
+	}
+	if !reflect.DeepEqual(methods, []string{"Set", "GetOrSet"}) {
+		t.Fatalf("authorized %v", methods)
+	}
+}
+
+func TestReplyWire(t *testing.T) {
+	want := &Reply{
+		Value:  []byte{},
+		Err:    "err",
+		Exist:  true,
+		Data:   map[string][]byte{"a": []byte("1"), "b": {}},
+		Keys:   []string{"c"},
+		Errs:   map[string]string{"d": "bad"},
+		Stats:  []asynccache.KeyStat{{Key: "a", Hits: 3, LastAccess: time.Unix(0, 42)}},
+		Total:  asynccache.Stats{Hits: 1, Misses: 2, LastRefreshCycle: time.Second},
+		Tenant: asynccache.TenantStats{Entries: 4},
+		Count:  -1,
+		Changes: []Change{
+			{Seq: 1, Op: asynccache.ChangeSet, Key: "a", Value: []byte("1")},
+			{Seq: 2, Op: asynccache.ChangeDelete, Key: "a", Nil: true},
+		},
+		Seq:     2,
+		Token:   7,
+		Code:    3,
+		NilKeys: []string{"e"},
+	}
+	got := &Reply{}
+	if err := got.unmarshal(want.marshal()); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("unmarshal = %+v, %v", got, err)
+	}
+	got = &Reply{}
+	if err := got.unmarshal((&Reply{Nil: true}).marshal()); err != nil || !got.Nil {
+		t.Fatalf("unmarshal of nil value = %+v, %v", got, err)
+	}
+
+	args := &Args{Key: "a", Value: []byte("1"), Timeout: 1, Data: map[string][]byte{"b": {}}, Keys: []string{"c"},
+		Token: 2, TTL: 3, Limit: 4, SinceSeq: 5, Tenant: "t", NilKeys: []string{"d"}}
+	gotArgs := &Args{}
+	if err := gotArgs.unmarshal(args.marshal()); err != nil || !reflect.DeepEqual(gotArgs, args) {
+		t.Fatalf("unmarshal = %+v, %v", gotArgs, err)
+	}
+}
@@ -0,0 +1,366 @@
+package cacheserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// The messages of cacheserver.proto are encoded in the protobuf wire format
+// by hand, so that the package stays free of third-party dependencies.
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+var errMalformed = errors.New("cacheserver: malformed message")
+
+func appendTag(b []byte, num, typ int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// appendUint appends a varint field, zero values are omitted as proto3 does.
+func appendUint(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendTag(b, num, wireVarint), v)
+}
+
+// appendBytes appends a length-delimited field, even if it is empty.
+func appendBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(appendTag(b, num, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendString appends a string field, empty strings are omitted.
+func appendString(b []byte, num int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = binary.AppendUvarint(appendTag(b, num, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendMessage appends a message field encoded by enc.
+func appendMessage(b []byte, num int, enc func([]byte) []byte) []byte {
+	return appendBytes(b, num, enc(nil))
+}
+
+// appendEntry appends an entry of a map field.
+func appendEntry(b []byte, num int, key string, val []byte) []byte {
+	return appendMessage(b, num, func(e []byte) []byte {
+		return appendBytes(appendString(e, 1, key), 2, val)
+	})
+}
+
+// consume calls fn with the fields of the message b, v is the value of
+// varint fields and data the one of length-delimited fields. Fields of
+// other wire types are skipped.
+func consume(b []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		num, typ := int(tag>>3), int(tag&7)
+		var v uint64
+		var data []byte
+		switch typ {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errMalformed
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errMalformed
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		case wire64:
+			if len(b) < 8 {
+				return errMalformed
+			}
+			b = b[8:]
+			continue
+		case wire32:
+			if len(b) < 4 {
+				return errMalformed
+			}
+			b = b[4:]
+			continue
+		default:
+			return errMalformed
+		}
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeEntry returns the key and value of a map entry.
+func consumeEntry(b []byte) (key string, val []byte, err error) {
+	val = []byte{}
+	err = consume(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			key = string(data)
+		case 2:
+			val = data
+		}
+		return nil
+	})
+	return key, val, err
+}
+
+func (a *Args) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, a.Key)
+	if !a.Nil && a.Value != nil {
+		b = appendBytes(b, 2, a.Value)
+	}
+	b = appendUint(b, 3, uint64(a.Timeout))
+	for k, v := range a.Data {
+		b = appendEntry(b, 4, k, v)
+	}
+	for _, k := range a.Keys {
+		b = appendBytes(b, 5, []byte(k))
+	}
+	b = appendUint(b, 6, uint64(a.Token))
+	b = appendUint(b, 7, uint64(a.TTL))
+	b = appendUint(b, 8, uint64(a.Limit))
+	b = appendUint(b, 9, a.SinceSeq)
+	b = appendString(b, 10, a.Tenant)
+	for _, k := range a.NilKeys {
+		b = appendBytes(b, 11, []byte(k))
+	}
+	return b
+}
+
+func (a *Args) unmarshal(b []byte) error {
+	a.Nil = true
+	return consume(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			a.Key = string(data)
+		case 2:
+			a.Value, a.Nil = data, false
+		case 3:
+			a.Timeout = time.Duration(v)
+		case 4:
+			k, val, err := consumeEntry(data)
+			if err != nil {
+				return err
+			}
+			if a.Data == nil {
+				a.Data = make(map[string][]byte)
+			}
+			a.Data[k] = val
+		case 5:
+			a.Keys = append(a.Keys, string(data))
+		case 6:
+			a.Token = asynccache.LeaseToken(v)
+		case 7:
+			a.TTL = time.Duration(v)
+		case 8:
+			a.Limit = int(int64(v))
+		case 9:
+			a.SinceSeq = v
+		case 10:
+			a.Tenant = string(data)
+		case 11:
+			a.NilKeys = append(a.NilKeys, string(data))
+		}
+		return nil
+	})
+}
+
+func (r *Reply) marshal() []byte {
+	var b []byte
+	if !r.Nil && r.Value != nil {
+		b = appendBytes(b, 1, r.Value)
+	}
+	b = appendString(b, 2, r.Err)
+	if r.Exist {
+		b = appendUint(b, 3, 1)
+	}
+	for k, v := range r.Data {
+		b = appendEntry(b, 4, k, v)
+	}
+	for _, k := range r.Keys {
+		b = appendBytes(b, 5, []byte(k))
+	}
+	for k, v := range r.Errs {
+		b = appendEntry(b, 6, k, []byte(v))
+	}
+	for _, s := range r.Stats {
+		b = appendMessage(b, 7, func(e []byte) []byte {
+			e = appendString(e, 1, s.Key)
+			e = appendUint(e, 2, s.Hits)
+			if !s.LastAccess.IsZero() {
+				e = appendUint(e, 3, uint64(s.LastAccess.UnixNano()))
+			}
+			return e
+		})
+	}
+	if r.Total != (asynccache.Stats{}) {
+		b = appendMessage(b, 8, func(e []byte) []byte {
+			e = appendUint(e, 1, r.Total.Hits)
+			e = appendUint(e, 2, r.Total.Misses)
+			e = appendUint(e, 3, uint64(r.Total.EstimatedSize))
+			e = appendUint(e, 4, r.Total.RefreshSkipped)
+			e = appendUint(e, 5, r.Total.DroppedEvents)
+			e = appendUint(e, 6, uint64(r.Total.LastRefreshCycle))
+			return appendUint(e, 7, uint64(r.Total.Entries))
+		})
+	}
+	if r.Tenant != (asynccache.TenantStats{}) {
+		b = appendMessage(b, 9, func(e []byte) []byte {
+			e = appendUint(e, 1, uint64(r.Tenant.Entries))
+			e = appendUint(e, 2, r.Tenant.Hits)
+			return appendUint(e, 3, r.Tenant.Misses)
+		})
+	}
+	b = appendUint(b, 10, uint64(r.Count))
+	for _, ch := range r.Changes {
+		b = appendMessage(b, 11, func(e []byte) []byte {
+			e = appendUint(e, 1, ch.Seq)
+			e = appendUint(e, 2, uint64(ch.Op))
+			e = appendString(e, 3, ch.Key)
+			if !ch.Nil && ch.Value != nil {
+				e = appendBytes(e, 4, ch.Value)
+			}
+			return appendString(e, 5, ch.Err)
+		})
+	}
+	b = appendUint(b, 12, r.Seq)
+	b = appendUint(b, 13, uint64(r.Token))
+	b = appendUint(b, 14, uint64(r.Code))
+	for _, k := range r.NilKeys {
+		b = appendBytes(b, 15, []byte(k))
+	}
+	return b
+}
+
+func (r *Reply) unmarshal(b []byte) error {
+	r.Nil = true
+	return consume(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			r.Value, r.Nil = data, false
+		case 2:
+			r.Err = string(data)
+		case 3:
+			r.Exist = v != 0
+		case 4:
+			k, val, err := consumeEntry(data)
+			if err != nil {
+				return err
+			}
+			if r.Data == nil {
+				r.Data = make(map[string][]byte)
+			}
+			r.Data[k] = val
+		case 5:
+			r.Keys = append(r.Keys, string(data))
+		case 6:
+			k, val, err := consumeEntry(data)
+			if err != nil {
+				return err
+			}
+			if r.Errs == nil {
+				r.Errs = make(map[string]string)
+			}
+			r.Errs[k] = string(val)
+		case 7:
+			var s asynccache.KeyStat
+			err := consume(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					s.Key = string(data)
+				case 2:
+					s.Hits = v
+				case 3:
+					s.LastAccess = time.Unix(0, int64(v))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Stats = append(r.Stats, s)
+		case 8:
+			return consume(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					r.Total.Hits = v
+				case 2:
+					r.Total.Misses = v
+				case 3:
+					r.Total.EstimatedSize = int64(v)
+				case 4:
+					r.Total.RefreshSkipped = v
+				case 5:
+					r.Total.DroppedEvents = v
+				case 6:
+					r.Total.LastRefreshCycle = time.Duration(v)
+				case 7:
+					r.Total.Entries = int64(v)
+				}
+				return nil
+			})
+		case 9:
+			return consume(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					r.Tenant.Entries = int64(v)
+				case 2:
+					r.Tenant.Hits = v
+				case 3:
+					r.Tenant.Misses = v
+				}
+				return nil
+			})
+		case 10:
+			r.Count = int(int64(v))
+		case 11:
+			ch := Change{Nil: true}
+			err := consume(data, func(num int, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					ch.Seq = v
+				case 2:
+					ch.Op = asynccache.ChangeOp(v)
+				case 3:
+					ch.Key = string(data)
+				case 4:
+					ch.Value, ch.Nil = data, false
+				case 5:
+					ch.Err = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.Changes = append(r.Changes, ch)
+		case 12:
+			r.Seq = v
+		case 13:
+			r.Token = asynccache.LeaseToken(v)
+		case 14:
+			r.Code = int32(v)
+		case 15:
+			r.NilKeys = append(r.NilKeys, string(data))
+		}
+		return nil
+	})
+}
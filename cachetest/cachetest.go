@@ -0,0 +1,229 @@
+// Package cachetest provides test harnesses for code built on asynccache:
+// a conformance suite for custom Cache implementations, such as decorators
+// and remote clients, and for the stores backing caches, operation
+// sequences to drive from fuzz targets and interleave under -race, a
+// manual Clock for the time dependent code of callers, and Fake, a
+// programmable Cache for the tests of code depending on a Cache.
+//
+// Caches created by asynccache.NewCache run on the wall clock, Clock does
+// not drive their refreshes and expiry: drive those of Fake by TickRefresh
+// and TickExpire instead.
+//
+//	func TestMyCache(t *testing.T) {
+//		cachetest.TestCache(t, func(opt asynccache.Options) asynccache.Cache {
+//			return mycache.Wrap(asynccache.NewCache(opt))
+//		})
+//	}
+package cachetest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// NewCacheFunc creates the Cache under test, which MUST fetch values by
+// the Fetcher of opt.
+type NewCacheFunc func(opt asynccache.Options) asynccache.Cache
+
+// Store is the interface of stores backing caches, such as boltstore.Store.
+type Store interface {
+	// Get returns the stored value of key, or an error wrapping
+	// asynccache.ErrNotFound if it is not stored.
+	Get(key string) (interface{}, error)
+	Put(key string, val interface{}) error
+	Delete(key string) error
+}
+
+// source is a Fetcher returning "key@version" for each key, and errors for
+// the keys prefixed by "err".
+type source struct {
+	version int32
+	fetches sync.Map // key -> *int32
+}
+
+var errSource = errors.New("cachetest: source error")
+
+func (s *source) fetch(key string) (interface{}, error) {
+	n, _ := s.fetches.LoadOrStore(key, new(int32))
+	atomic.AddInt32(n.(*int32), 1)
+	if strings.HasPrefix(key, "err") {
+		return nil, errSource
+	}
+	return fmt.Sprintf("%s@%d", key, atomic.LoadInt32(&s.version)), nil
+}
+
+func (s *source) count(key string) int32 {
+	if n, ok := s.fetches.Load(key); ok {
+		return atomic.LoadInt32(n.(*int32))
+	}
+	return 0
+}
+
+func (s *source) options() asynccache.Options {
+	return asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher:         s.fetch,
+		ErrLogFunc:      func(string) {},
+	}
+}
+
+// TestCache runs the conformance suite of the Cache interface against the
+// caches created by newCache.
+func TestCache(t *testing.T, newCache NewCacheFunc) {
+	run := func(name string, fn func(t *testing.T, c asynccache.Cache, s *source)) {
+		t.Run(name, func(t *testing.T) {
+			s := &source{}
+			c := newCache(s.options())
+			defer c.Close()
+			fn(t, c, s)
+		})
+	}
+	run("GetFetchesOnce", func(t *testing.T, c asynccache.Cache, s *source) {
+		for i := 0; i < 3; i++ {
+			if val, err := c.Get("a"); val != "a@0" || err != nil {
+				t.Fatalf("Get = %v, %v", val, err)
+			}
+		}
+		if n := s.count("a"); n != 1 {
+			t.Fatalf("fetched %d times", n)
+		}
+	})
+	run("GetCachesErrors", func(t *testing.T, c asynccache.Cache, s *source) {
+		for i := 0; i < 2; i++ {
+			if _, err := c.Get("err"); !errors.Is(err, errSource) {
+				t.Fatalf("error = %v", err)
+			}
+		}
+		if n := s.count("err"); n != 1 {
+			t.Fatalf("fetched %d times", n)
+		}
+		if errs := c.Errors(); !errors.Is(errs["err"], errSource) {
+			t.Fatalf("Errors = %v", errs)
+		}
+		c.DeleteErrored()
+		c.Get("err")
+		if n := s.count("err"); n != 2 {
+			t.Fatalf("fetched %d times after DeleteErrored", n)
+		}
+	})
+	run("Set", func(t *testing.T, c asynccache.Cache, s *source) {
+		c.Set("a", "x")
+		if val, err := c.Get("a"); val != "x" || err != nil {
+			t.Fatalf("Get = %v, %v", val, err)
+		}
+		c.Set("a", "y")
+		if dump := c.Dump(); len(dump) != 1 || dump["a"] != "y" {
+			t.Fatalf("Dump = %v", dump)
+		}
+		if n := s.count("a"); n != 0 {
+			t.Fatalf("fetched %d times", n)
+		}
+	})
+	run("SetDefault", func(t *testing.T, c asynccache.Cache, s *source) {
+		if c.SetDefault("a", "x") {
+			t.Fatal("new key exists")
+		}
+		if !c.SetDefault("a", "y") {
+			t.Fatal("cached key does not exist")
+		}
+		if val, _ := c.Get("a"); val != "x" {
+			t.Fatalf("Get = %v", val)
+		}
+	})
+	run("GetOrSet", func(t *testing.T, c asynccache.Cache, s *source) {
+		if val := c.GetOrSet("a", "def"); val != "a@0" {
+			t.Fatalf("GetOrSet = %v", val)
+		}
+		if val := c.GetOrSet("err", "def"); val != "def" {
+			t.Fatalf("GetOrSet = %v", val)
+		}
+	})
+	run("Delete", func(t *testing.T, c asynccache.Cache, s *source) {
+		for _, key := range []string{"a", "b", "c", "d"} {
+			c.Get(key)
+		}
+		c.Delete("a")
+		c.DeleteIf(func(key string) bool { return key == "b" })
+		if n := c.DeleteIfValue(func(key string, val interface{}) bool { return val == "c@0" }); n != 1 {
+			t.Fatalf("DeleteIfValue = %d", n)
+		}
+		if dump := c.Dump(); len(dump) != 1 || dump["d"] != "d@0" {
+			t.Fatalf("Dump = %v", dump)
+		}
+		c.Get("a")
+		if n := s.count("a"); n != 2 {
+			t.Fatalf("fetched %d times after Delete", n)
+		}
+	})
+	run("Refresh", func(t *testing.T, c asynccache.Cache, s *source) {
+		c.Get("a")
+		atomic.StoreInt32(&s.version, 1)
+		if err := c.Refresh("a"); err != nil {
+			t.Fatal(err)
+		}
+		if val, _ := c.Get("a"); val != "a@1" {
+			t.Fatalf("Get = %v", val)
+		}
+		// keys not cached are not refreshed
+		if err := c.Refresh("b"); err != nil {
+			t.Fatal(err)
+		}
+		if n := s.count("b"); n != 0 {
+			t.Fatalf("fetched %d times", n)
+		}
+	})
+	run("Close", func(t *testing.T, c asynccache.Cache, s *source) {
+		c.Get("a")
+		c.Close()
+		c.Close()
+		if !c.IsClosed() {
+			t.Fatal("not closed")
+		}
+		if val, err := c.Get("a"); val != "a@0" || err != nil {
+			t.Fatalf("Get = %v, %v", val, err)
+		}
+	})
+}
+
+// TestStore runs the conformance suite of Store against the empty stores
+// created by newStore, with string values.
+func TestStore(t *testing.T, newStore func() Store) {
+	s := newStore()
+	if _, err := s.Get("a"); !errors.Is(err, asynccache.ErrNotFound) {
+		t.Fatalf("Get of missing key: %v", err)
+	}
+	for _, val := range []string{"x", "y"} {
+		if err := s.Put("a", val); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Get("a"); got != val || err != nil {
+			t.Fatalf("Get = %v, %v", got, err)
+		}
+	}
+	if err := s.Put("b", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("b"); got != "" || err != nil {
+		t.Fatalf("Get of empty value = %v, %v", got, err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("a"); !errors.Is(err, asynccache.ErrNotFound) {
+		t.Fatalf("Get of deleted key: %v", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete of missing key: %v", err)
+	}
+	if got, err := s.Get("b"); got != "" || err != nil {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,102 @@
+package cachetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func newCache(opt asynccache.Options) asynccache.Cache {
+	return asynccache.NewCache(opt)
+}
+
+func TestNewCache(t *testing.T) {
+	TestCache(t, newCache)
+}
+
+func TestDecorated(t *testing.T) {
+	TestCache(t, func(opt asynccache.Options) asynccache.Cache {
+		return asynccache.Decorate(asynccache.NewCache(opt),
+			func(op asynccache.Operation, key string, invoker asynccache.Invoker) (interface{}, error) {
+				return invoker(key)
+			})
+	})
+}
+
+func TestNewCacheInterleaving(t *testing.T) {
+	TestInterleaving(t, newCache, 8, 100*time.Millisecond)
+}
+
+func FuzzNewCache(f *testing.F) {
+	f.Add(Seeds())
+	f.Add([]byte{0, 7, 6, 8, 1, 6, 4, 0, 2, 8})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		RunOps(t, newCache, ops)
+	})
+}
+
+// mapStore is a Store in memory.
+type mapStore struct {
+	mu sync.Mutex
+	m  map[string]interface{}
+}
+
+func (s *mapStore) Get(key string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.m[key]
+	if !ok {
+		return nil, asynccache.ErrNotFound
+	}
+	return val, nil
+}
+
+func (s *mapStore) Put(key string, val interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = val
+	return nil
+}
+
+func (s *mapStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+func TestMapStore(t *testing.T) {
+	TestStore(t, func() Store { return &mapStore{m: make(map[string]interface{})} })
+}
+
+func TestClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewClock(start)
+	var fired []string
+	c.AfterFunc(3*time.Second, func() {
+		fired = append(fired, "after@"+c.Since(start).String())
+	})
+	stopTick := c.Every(2*time.Second, func() {
+		fired = append(fired, "tick@"+c.Since(start).String())
+	})
+	stop := c.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	stop()
+
+	c.Advance(5 * time.Second)
+	if c.Since(start) != 5*time.Second {
+		t.Fatalf("now %v", c.Now())
+	}
+	stopTick()
+	c.Advance(time.Minute)
+	want := []string{"tick@2s", "after@3s", "tick@4s"}
+	if len(fired) != len(want) {
+		t.Fatalf("fired %v", fired)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Fatalf("fired %v", fired)
+		}
+	}
+}
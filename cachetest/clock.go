@@ -0,0 +1,108 @@
+package cachetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a manual clock for deterministic tests of time dependent code
+// taking it instead of the time package, it is not used by asynccache: its
+// time only moves by Advance, which runs the functions scheduled by
+// AfterFunc and Every that are due, in the order of their times.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers []*timer
+}
+
+type timer struct {
+	at     time.Time
+	period time.Duration // 0 unless scheduled by Every
+	seq    int           // orders timers due at the same time
+	fn     func()
+}
+
+// NewClock creates a Clock at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the time elapsed since t by the clock.
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// AfterFunc schedules fn to run once the clock is advanced by d, and returns
+// a function canceling it.
+func (c *Clock) AfterFunc(d time.Duration, fn func()) (stop func()) {
+	return c.schedule(d, 0, fn)
+}
+
+// Every schedules fn to run each time the clock is advanced by d, as
+// time.Ticker does, and returns a function canceling it. d MUST be greater
+// than 0.
+func (c *Clock) Every(d time.Duration, fn func()) (stop func()) {
+	if d <= 0 {
+		panic("cachetest: non-positive period for Every")
+	}
+	return c.schedule(d, d, fn)
+}
+
+func (c *Clock) schedule(d, period time.Duration, fn func()) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &timer{at: c.now.Add(d), period: period, seq: c.seq, fn: fn}
+	c.timers = append(c.timers, t)
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, other := range c.timers {
+			if other == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Advance moves the clock forward by d, running the scheduled functions as
+// they fall due, with the clock at their times.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool {
+			a, b := c.timers[i], c.timers[j]
+			if !a.at.Equal(b.at) {
+				return a.at.Before(b.at)
+			}
+			return a.seq < b.seq
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.now = t.at
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			c.timers = c.timers[1:]
+		}
+		// fn may use the clock
+		c.mu.Unlock()
+		t.fn()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
@@ -0,0 +1,689 @@
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Call is a call of a Fake method, recorded with its arguments.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Key returns the key argument of the call, or "" if it has none.
+func (c Call) Key() string {
+	if len(c.Args) > 0 {
+		if key, ok := c.Args[0].(string); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// Fake is a Cache in memory for the tests of code depending on a Cache. It
+// has no background goroutines or timers: values are fetched by the
+// responses programmed by Respond and SetFetcher, refresh and expire cycles
+// run on TickRefresh and TickExpire, and every call is recorded.
+//
+// Fake behaves as a cache created by NewCache does in the common paths, it
+// does not call handlers, and Lease ignores ttl: leases never expire.
+type Fake struct {
+	mu        sync.Mutex
+	entries   map[string]*fakeEntry
+	responses map[string]fakeResult
+	fetcher   func(key string) (interface{}, error)
+	calls     []Call
+	changes   []asynccache.ChangeRecord
+	leases    map[string]asynccache.LeaseToken
+	leaseSeq  asynccache.LeaseToken
+	health    error
+	hits      uint64
+	misses    uint64
+	closed    bool
+}
+
+type fakeResult struct {
+	val interface{}
+	err error
+}
+
+type fakeEntry struct {
+	fakeResult
+	expiring bool
+}
+
+var _ asynccache.Cache = (*Fake)(nil)
+
+// NewFake creates an empty Fake, whose fetches fail with
+// asynccache.ErrNotFound until responses are programmed.
+func NewFake() *Fake {
+	return &Fake{
+		entries:   make(map[string]*fakeEntry),
+		responses: make(map[string]fakeResult),
+		leases:    make(map[string]asynccache.LeaseToken),
+	}
+}
+
+// Respond programs the fetches of key to return val and err, overriding
+// the fetcher set by SetFetcher.
+func (f *Fake) Respond(key string, val interface{}, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[key] = fakeResult{val: val, err: err}
+}
+
+// SetFetcher programs the fetches of the keys without responses to call fn.
+func (f *Fake) SetFetcher(fn func(key string) (interface{}, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetcher = fn
+}
+
+// SetHealth programs the result of Healthy.
+func (f *Fake) SetHealth(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.health = err
+}
+
+// Calls returns the recorded calls of method, or of all methods if method
+// is empty, in the order they were made.
+func (f *Fake) Calls(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []Call
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Fetches returns the keys fetched so far, in the order they were fetched.
+func (f *Fake) Fetches() []string {
+	return keys(f.Calls("fetch"))
+}
+
+// ResetCalls clears the recorded calls.
+func (f *Fake) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// TickRefresh runs a refresh cycle: the cached keys are fetched again in
+// the order of keys, failures keep the old values.
+func (f *Fake) TickRefresh() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range f.sortedKeys() {
+		f.refresh(k)
+	}
+}
+
+// TickExpire runs an expire cycle: the keys not accessed since the last
+// cycle are deleted.
+func (f *Fake) TickExpire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range f.sortedKeys() {
+		if e := f.entries[k]; e.expiring {
+			f.delete(k)
+		} else {
+			e.expiring = true
+		}
+	}
+}
+
+func keys(calls []Call) []string {
+	ks := make([]string, len(calls))
+	for i, c := range calls {
+		ks[i] = c.Key()
+	}
+	return ks
+}
+
+// record records the call, f.mu must be held.
+func (f *Fake) record(method string, args ...interface{}) {
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+}
+
+// fetch fetches the value of key, f.mu must be held. The fetcher is called
+// with f.mu held, so it MUST NOT call f.
+func (f *Fake) fetch(key string) fakeResult {
+	f.record("fetch", key)
+	if res, ok := f.responses[key]; ok {
+		return res
+	}
+	if f.fetcher == nil {
+		return fakeResult{err: asynccache.ErrNotFound}
+	}
+	val, err := f.fetcher(key)
+	return fakeResult{val: val, err: err}
+}
+
+// load returns the entry of key, fetching it on miss, f.mu must be held.
+func (f *Fake) load(key string) (*fakeEntry, error) {
+	if e, ok := f.entries[key]; ok {
+		e.expiring = false
+		f.hits++
+		return e, nil
+	}
+	f.misses++
+	if f.closed {
+		return nil, asynccache.ErrClosed
+	}
+	e := &fakeEntry{fakeResult: f.fetch(key)}
+	f.entries[key] = e
+	f.logChange(key)
+	return e, nil
+}
+
+// store stores val to key, f.mu must be held.
+func (f *Fake) store(key string, val interface{}) {
+	if f.closed {
+		return
+	}
+	f.entries[key] = &fakeEntry{fakeResult: fakeResult{val: val}}
+	f.logChange(key)
+}
+
+// refresh fetches key again if it is cached and not leased, f.mu must be held.
+func (f *Fake) refresh(key string) {
+	e, ok := f.entries[key]
+	if !ok || f.closed {
+		return
+	}
+	if _, leased := f.leases[key]; leased {
+		return
+	}
+	res := f.fetch(key)
+	if res.err != nil && e.err == nil {
+		return
+	}
+	e.fakeResult = res
+	f.logChange(key)
+}
+
+// delete deletes key, f.mu must be held.
+func (f *Fake) delete(key string) bool {
+	if _, ok := f.entries[key]; !ok {
+		return false
+	}
+	delete(f.entries, key)
+	f.logChange(key)
+	return true
+}
+
+// logChange logs the change of key, f.mu must be held.
+func (f *Fake) logChange(key string) {
+	rec := asynccache.ChangeRecord{Seq: uint64(len(f.changes)) + 1, Op: asynccache.ChangeDelete, Key: key}
+	if e, ok := f.entries[key]; ok {
+		rec.Op, rec.Value, rec.Err = asynccache.ChangeSet, e.val, e.err
+	}
+	f.changes = append(f.changes, rec)
+}
+
+func (f *Fake) sortedKeys() []string {
+	ks := make([]string, 0, len(f.entries))
+	for k := range f.entries {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// SetDefault implements Cache.
+func (f *Fake) SetDefault(key string, val interface{}) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetDefault", key, val)
+	if e, ok := f.entries[key]; ok {
+		e.expiring = false
+		return true
+	}
+	f.store(key, val)
+	return false
+}
+
+// Set implements Cache.
+func (f *Fake) Set(key string, val interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Set", key, val)
+	f.store(key, val)
+}
+
+// Lease implements Cache, the lease never expires.
+func (f *Fake) Lease(key string, ttl time.Duration) (asynccache.LeaseToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Lease", key, ttl)
+	if _, ok := f.leases[key]; ok {
+		return 0, asynccache.ErrLeased
+	}
+	f.leaseSeq++
+	f.leases[key] = f.leaseSeq
+	return f.leaseSeq, nil
+}
+
+// SetWithLease implements Cache.
+func (f *Fake) SetWithLease(key string, val interface{}, token asynccache.LeaseToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("SetWithLease", key, val, token)
+	if f.leases[key] != token || token == 0 {
+		return asynccache.ErrLeaseExpired
+	}
+	delete(f.leases, key)
+	f.store(key, val)
+	return nil
+}
+
+// Put implements Cache, there is no backing store to write.
+func (f *Fake) Put(key string, val interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Put", key, val)
+	if f.closed {
+		return asynccache.ErrClosed
+	}
+	f.store(key, val)
+	return nil
+}
+
+// PutAsync implements Cache as Put does.
+func (f *Fake) PutAsync(key string, val interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("PutAsync", key, val)
+	if f.closed {
+		return asynccache.ErrClosed
+	}
+	f.store(key, val)
+	return nil
+}
+
+// Flush implements Cache.
+func (f *Fake) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Flush")
+	return nil
+}
+
+// Get implements Cache.
+func (f *Fake) Get(key string) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Get", key)
+	e, err := f.load(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.val, e.err
+}
+
+// GetWithTimeout implements Cache, fetches never time out.
+func (f *Fake) GetWithTimeout(key string, timeout time.Duration) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetWithTimeout", key, timeout)
+	e, err := f.load(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.val, e.err
+}
+
+// Acquire implements Cache.
+func (f *Fake) Acquire(key string) (asynccache.Handle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Acquire", key)
+	e, err := f.load(key)
+	if err == nil {
+		err = e.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asynccache.NewHandle(e.val), nil
+}
+
+// getOrSet returns the value of key, or sets def if it fails, f.mu must be held.
+func (f *Fake) getOrSet(key string, def interface{}) interface{} {
+	e, err := f.load(key)
+	if err != nil {
+		return def
+	}
+	if e.err != nil {
+		f.store(key, def)
+		return def
+	}
+	return e.val
+}
+
+// GetOrSet implements Cache.
+func (f *Fake) GetOrSet(key string, def interface{}) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrSet", key, def)
+	return f.getOrSet(key, def)
+}
+
+// GetOrSetWithTimeout implements Cache, fetches never time out.
+func (f *Fake) GetOrSetWithTimeout(key string, def interface{}, timeout time.Duration) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrSetWithTimeout", key, def, timeout)
+	return f.getOrSet(key, def)
+}
+
+// GetOrSetMulti implements Cache.
+func (f *Fake) GetOrSetMulti(defaults map[string]interface{}) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrSetMulti", defaults)
+	vals := make(map[string]interface{}, len(defaults))
+	for k, def := range defaults {
+		vals[k] = f.getOrSet(k, def)
+	}
+	return vals
+}
+
+// GetAll implements Cache.
+func (f *Fake) GetAll(keys ...string) (map[string]interface{}, uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetAll", keys)
+	vals := make(map[string]interface{}, len(keys))
+	var errs []error
+	for _, k := range keys {
+		e, err := f.load(k)
+		if err == nil {
+			err = e.err
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		vals[k] = e.val
+	}
+	return vals, uint64(len(f.changes)), errors.Join(errs...)
+}
+
+// getOrReset returns the value of key, or sets resetVal if it fails, f.mu
+// must be held. The value generated by DataFetcher is resetVal itself.
+func (f *Fake) getOrReset(key string, resetVal interface{}) interface{} {
+	if e, ok := f.entries[key]; ok && e.err == nil {
+		e.expiring = false
+		f.hits++
+		return e.val
+	}
+	f.misses++
+	if f.closed {
+		return nil
+	}
+	f.store(key, resetVal)
+	return resetVal
+}
+
+// GetOrReset implements Cache.
+func (f *Fake) GetOrReset(key string, resetVal interface{}) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrReset", key, resetVal)
+	return f.getOrReset(key, resetVal)
+}
+
+// GetOrResetWithTTL implements Cache, the value never expires.
+func (f *Fake) GetOrResetWithTTL(key string, resetVal interface{}, ttl time.Duration) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("GetOrResetWithTTL", key, resetVal, ttl)
+	return f.getOrReset(key, resetVal)
+}
+
+// Dump implements Cache.
+func (f *Fake) Dump() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Dump")
+	data := make(map[string]interface{}, len(f.entries))
+	for k, e := range f.entries {
+		data[k] = e.val
+	}
+	return data
+}
+
+// Changes implements Cache, all changes are logged.
+func (f *Fake) Changes(sinceSeq uint64) []asynccache.ChangeRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Changes", sinceSeq)
+	if sinceSeq >= uint64(len(f.changes)) {
+		return nil
+	}
+	return append([]asynccache.ChangeRecord(nil), f.changes[sinceSeq:]...)
+}
+
+// ReplaceAll implements Cache.
+func (f *Fake) ReplaceAll(data map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("ReplaceAll", data)
+	if f.closed {
+		return
+	}
+	for _, k := range f.sortedKeys() {
+		if _, ok := data[k]; !ok {
+			f.delete(k)
+		}
+	}
+	for k, v := range data {
+		f.store(k, v)
+	}
+}
+
+// Snapshot implements Cache.
+func (f *Fake) Snapshot() *asynccache.Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Snapshot")
+	data := make(map[string]interface{}, len(f.entries))
+	errs := make(map[string]error)
+	for k, e := range f.entries {
+		data[k] = e.val
+		if e.err != nil {
+			errs[k] = e.err
+		}
+	}
+	return asynccache.NewSnapshot(data, errs)
+}
+
+// RangeEntries implements Cache, in the order of keys. fn is called
+// without f locked, so it may call f.
+func (f *Fake) RangeEntries(fn func(key string, val interface{}, meta asynccache.EntryInfo) bool) {
+	f.rangeEntries("RangeEntries", fn)
+}
+
+// rangeEntries is RangeEntries recorded as method.
+func (f *Fake) rangeEntries(method string, fn func(key string, val interface{}, meta asynccache.EntryInfo) bool) {
+	f.mu.Lock()
+	f.record(method)
+	type item struct {
+		key  string
+		e    fakeEntry
+		info asynccache.EntryInfo
+	}
+	items := make([]item, 0, len(f.entries))
+	for _, k := range f.sortedKeys() {
+		e := f.entries[k]
+		items = append(items, item{key: k, e: *e, info: asynccache.EntryInfo{Err: e.err, Expiring: e.expiring}})
+	}
+	f.mu.Unlock()
+	for _, it := range items {
+		if !fn(it.key, it.e.val, it.info) {
+			return
+		}
+	}
+}
+
+// DeleteIf implements Cache.
+func (f *Fake) DeleteIf(shouldDelete func(key string) bool) {
+	f.deleteIf("DeleteIf", func(key string, _ interface{}) bool { return shouldDelete(key) })
+}
+
+// DeleteIfValue implements Cache.
+func (f *Fake) DeleteIfValue(shouldDelete func(key string, val interface{}) bool) int {
+	return f.deleteIf("DeleteIfValue", shouldDelete)
+}
+
+func (f *Fake) deleteIf(method string, shouldDelete func(key string, val interface{}) bool) int {
+	n := 0
+	f.rangeEntries(method, func(key string, val interface{}, _ asynccache.EntryInfo) bool {
+		if shouldDelete(key, val) {
+			f.mu.Lock()
+			if f.delete(key) {
+				n++
+			}
+			f.mu.Unlock()
+		}
+		return true
+	})
+	return n
+}
+
+// Delete implements Cache.
+func (f *Fake) Delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Delete", key)
+	f.delete(key)
+}
+
+// Errors implements Cache.
+func (f *Fake) Errors() map[string]error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Errors")
+	errs := make(map[string]error)
+	for k, e := range f.entries {
+		if e.err != nil {
+			errs[k] = e.err
+		}
+	}
+	return errs
+}
+
+// DeleteErrored implements Cache.
+func (f *Fake) DeleteErrored() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("DeleteErrored")
+	for _, k := range f.sortedKeys() {
+		if f.entries[k].err != nil {
+			f.delete(k)
+		}
+	}
+}
+
+// Refresh implements Cache.
+func (f *Fake) Refresh(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Refresh", key)
+	if f.closed {
+		return asynccache.ErrClosed
+	}
+	f.refresh(key)
+	return nil
+}
+
+// Close implements Cache.
+func (f *Fake) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Close")
+	f.closed = true
+}
+
+// IsClosed implements Cache.
+func (f *Fake) IsClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// TopKeys implements Cache, keys are not tracked.
+func (f *Fake) TopKeys(n int) []asynccache.KeyStat {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("TopKeys", n)
+	return nil
+}
+
+// tenantKeys returns the keys of the tenant by TenantPrefix, f.mu must be held.
+func (f *Fake) tenantKeys(id string) []string {
+	var ks []string
+	for _, k := range f.sortedKeys() {
+		if asynccache.TenantPrefix(k) == id {
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
+// TenantStats implements Cache, the entries of tenants are counted by
+// TenantPrefix.
+func (f *Fake) TenantStats(id string) asynccache.TenantStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("TenantStats", id)
+	return asynccache.TenantStats{Entries: int64(len(f.tenantKeys(id)))}
+}
+
+// PurgeTenant implements Cache, the entries of tenants are found by
+// TenantPrefix.
+func (f *Fake) PurgeTenant(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("PurgeTenant", id)
+	ks := f.tenantKeys(id)
+	for _, k := range ks {
+		f.delete(k)
+	}
+	return len(ks)
+}
+
+// Healthy implements Cache, it returns the error set by SetHealth.
+func (f *Fake) Healthy() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Healthy")
+	return f.health
+}
+
+// Stats implements Cache, hits and misses are always counted.
+func (f *Fake) Stats() asynccache.Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Stats")
+	return asynccache.Stats{Hits: f.hits, Misses: f.misses, Entries: int64(len(f.entries))}
+}
+
+// EstimatedSize implements Cache, it is always 0.
+func (f *Fake) EstimatedSize() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("EstimatedSize")
+	return 0
+}
@@ -0,0 +1,87 @@
+package cachetest
+
+import (
+	"errors"
+	"testing"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func newFake(opt asynccache.Options) asynccache.Cache {
+	f := NewFake()
+	f.SetFetcher(opt.Fetcher)
+	return f
+}
+
+func TestFakeConformance(t *testing.T) {
+	TestCache(t, newFake)
+	RunOps(t, newFake, Seeds())
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	errDown := errors.New("down")
+	f.Respond("a", "va", nil)
+	f.Respond("b", nil, errDown)
+
+	if val, err := f.Get("a"); val != "va" || err != nil {
+		t.Fatalf("Get = %v, %v", val, err)
+	}
+	if _, err := f.Get("b"); err != errDown {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := f.Get("c"); !errors.Is(err, asynccache.ErrNotFound) {
+		t.Fatalf("error = %v", err)
+	}
+	f.Get("a")
+	if got := f.Fetches(); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("Fetches = %v", got)
+	}
+	if calls := f.Calls("Get"); len(calls) != 4 || calls[3].Key() != "a" {
+		t.Fatalf("Calls = %v", calls)
+	}
+	if st := f.Stats(); st.Hits != 1 || st.Misses != 3 {
+		t.Fatalf("Stats = %+v", st)
+	}
+
+	// refreshes keep values on failures, and replace errors
+	f.Respond("a", nil, errDown)
+	f.Respond("b", "vb", nil)
+	f.TickRefresh()
+	if dump := f.Dump(); dump["a"] != "va" || dump["b"] != "vb" {
+		t.Fatalf("Dump = %v", dump)
+	}
+
+	// keys not accessed during an expire cycle are deleted by the next one
+	f.ResetCalls()
+	f.TickExpire()
+	f.Get("a")
+	f.TickExpire()
+	if dump := f.Dump(); len(dump) != 1 || dump["a"] != "va" {
+		t.Fatalf("Dump = %v", dump)
+	}
+	if calls := f.Calls(""); len(calls) != 2 || calls[0].Method != "Get" {
+		t.Fatalf("Calls = %v", calls)
+	}
+
+	token, err := f.Lease("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Respond("a", "new", nil)
+	f.TickRefresh()
+	if val, _ := f.Get("a"); val != "va" {
+		t.Fatalf("leased key refreshed to %v", val)
+	}
+	if err = f.SetWithLease("a", "leased", token); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SetWithLease("a", "leased", token); err != asynccache.ErrLeaseExpired {
+		t.Fatalf("error = %v", err)
+	}
+
+	f.SetHealth(errDown)
+	if f.Healthy() != errDown {
+		t.Fatal("healthy")
+	}
+}
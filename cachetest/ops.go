@@ -0,0 +1,191 @@
+package cachetest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Operations decoded from the bytes of RunOps.
+const (
+	opGet = iota
+	opSet
+	opSetDefault
+	opGetOrSet
+	opDelete
+	opDeleteIf
+	opRefresh
+	opChangeSource
+	opDump
+	numOps
+)
+
+const numKeys = 4
+
+func decodeOp(b byte) (op int, key string) {
+	return int(b) % numOps, fmt.Sprintf("k%d", int(b)/numOps%numKeys)
+}
+
+// RunOps runs the sequence of operations decoded from ops, one per byte, on
+// a cache created by newCache, and checks the results against a model of
+// the cache. It is meant to be called by fuzz targets:
+//
+//	func FuzzMyCache(f *testing.F) {
+//		f.Add(cachetest.Seeds())
+//		f.Fuzz(func(t *testing.T, ops []byte) {
+//			cachetest.RunOps(t, newMyCache, ops)
+//		})
+//	}
+func RunOps(t testing.TB, newCache NewCacheFunc, ops []byte) {
+	s := &source{}
+	c := newCache(s.options())
+	defer c.Close()
+	model := make(map[string]interface{})
+	fetched := func(key string) string {
+		return fmt.Sprintf("%s@%d", key, atomic.LoadInt32(&s.version))
+	}
+	for i, b := range ops {
+		op, key := decodeOp(b)
+		val := fmt.Sprintf("v%d", i)
+		switch op {
+		case opGet:
+			want, ok := model[key]
+			if !ok {
+				want = fetched(key)
+				model[key] = want
+			}
+			if got, err := c.Get(key); got != want || err != nil {
+				t.Fatalf("op %d: Get(%q) = %v, %v, want %v", i, key, got, err, want)
+			}
+		case opSet:
+			c.Set(key, val)
+			model[key] = val
+		case opSetDefault:
+			_, want := model[key]
+			if exist := c.SetDefault(key, val); exist != want {
+				t.Fatalf("op %d: SetDefault(%q) = %v", i, key, exist)
+			}
+			if !want {
+				model[key] = val
+			}
+		case opGetOrSet:
+			want, ok := model[key]
+			if !ok {
+				want = fetched(key)
+				model[key] = want
+			}
+			if got := c.GetOrSet(key, val); got != want {
+				t.Fatalf("op %d: GetOrSet(%q) = %v, want %v", i, key, got, want)
+			}
+		case opDelete:
+			c.Delete(key)
+			delete(model, key)
+		case opDeleteIf:
+			c.DeleteIf(func(k string) bool { return k == key })
+			delete(model, key)
+		case opRefresh:
+			if err := c.Refresh(key); err != nil {
+				t.Fatalf("op %d: Refresh(%q) = %v", i, key, err)
+			}
+			if _, ok := model[key]; ok {
+				model[key] = fetched(key)
+			}
+		case opChangeSource:
+			atomic.AddInt32(&s.version, 1)
+		case opDump:
+			dump := c.Dump()
+			if len(dump) != len(model) {
+				t.Fatalf("op %d: Dump = %v, want %v", i, dump, model)
+			}
+			for k, want := range model {
+				if dump[k] != want {
+					t.Fatalf("op %d: Dump = %v, want %v", i, dump, model)
+				}
+			}
+		}
+	}
+}
+
+// TestInterleaving runs random operations on a cache created by newCache
+// from goroutines concurrently for d, while the cache refreshes and expires
+// entries every millisecond. Run it with -race. It checks that every value
+// read was fetched or set, and that the cache works once it is over.
+func TestInterleaving(t *testing.T, newCache NewCacheFunc, goroutines int, d time.Duration) {
+	s := &source{}
+	opt := s.options()
+	opt.RefreshDuration = time.Millisecond
+	opt.ExpireDuration = 2 * time.Millisecond
+	c := newCache(opt)
+	defer c.Close()
+
+	valid := func(key string, val interface{}) bool {
+		v, ok := val.(string)
+		return ok && (strings.HasPrefix(v, key+"@") || strings.HasPrefix(v, "v"))
+	}
+	deadline := time.Now().Add(d)
+	var wg sync.WaitGroup
+	var failure atomic.Value
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) && failure.Load() == nil {
+				op, key := decodeOp(byte(rnd.Intn(256)))
+				val := fmt.Sprintf("v%d", rnd.Intn(100))
+				var got interface{}
+				var err error
+				switch op {
+				case opGet:
+					got, err = c.Get(key)
+				case opSet:
+					c.Set(key, val)
+				case opSetDefault:
+					c.SetDefault(key, val)
+				case opGetOrSet:
+					got = c.GetOrSet(key, val)
+				case opDelete:
+					c.Delete(key)
+				case opDeleteIf:
+					c.DeleteIf(func(k string) bool { return k == key })
+				case opRefresh:
+					err = c.Refresh(key)
+				case opChangeSource:
+					atomic.AddInt32(&s.version, 1)
+				case opDump:
+					for k, v := range c.Dump() {
+						if !valid(k, v) {
+							failure.Store(fmt.Sprintf("Dump has %q = %v", k, v))
+						}
+					}
+				}
+				if err != nil {
+					failure.Store(fmt.Sprintf("op %d of %q: %v", op, key, err))
+				} else if got != nil && !valid(key, got) {
+					failure.Store(fmt.Sprintf("op %d of %q = %v", op, key, got))
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	if f := failure.Load(); f != nil {
+		t.Fatal(f)
+	}
+	c.Set("k0", "v")
+	if val, err := c.Get("k0"); val != "v" || err != nil {
+		t.Fatalf("Get = %v, %v", val, err)
+	}
+}
+
+// Seeds returns the operations of RunOps on each key, to seed fuzz targets.
+func Seeds() []byte {
+	ops := make([]byte, 0, numOps*numKeys)
+	for b := 0; b < numOps*numKeys; b++ {
+		ops = append(ops, byte(b))
+	}
+	return ops
+}
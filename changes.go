@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ChangeOp is the operation of a ChangeRecord.
+type ChangeOp int
+
+const (
+	// ChangeSet sets the value and error of the key.
+	ChangeSet ChangeOp = iota + 1
+	// ChangeDelete deletes the key.
+	ChangeDelete
+	// ChangeReset clears all keys, it is followed by the ChangeSet records
+	// of the whole cache.
+	ChangeReset
+)
+
+// ChangeRecord is a change of an entry.
+type ChangeRecord struct {
+	Seq   uint64
+	Op    ChangeOp
+	Key   string
+	Value interface{}
+	Err   error
+	// Lifetime is the Lifetime of Value for ChangeSet.
+	Lifetime Lifetime
+}
+
+// ChangeAppender appends changes to durable storage, such as wal.Log.
+type ChangeAppender interface {
+	Append(rec ChangeRecord) error
+}
+
+// changeLog is a ring of the last changes.
+type changeLog struct {
+	mu      sync.Mutex
+	seq     uint64
+	records []ChangeRecord // records[head] is the oldest once full
+	head    int
+}
+
+// logChange logs the current state of key as a change, and appends it to WAL.
+func (c *cache) logChange(key string) {
+	if c.opt.ChangeLogSize <= 0 && c.opt.WAL == nil {
+		return
+	}
+	l := &c.changes
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the state is read with the lock held, so the last record of a key
+	// always reflects its latest state
+	rec := ChangeRecord{Op: ChangeDelete, Key: key}
+	if v, ok := c.data().Load(key); ok {
+		e := v.(*entry)
+		rec.Op = ChangeSet
+		rec.Value, rec.Err = e.Load()
+		rec.Lifetime = e.result().lifetime()
+	}
+	l.seq++
+	rec.Seq = l.seq
+	if c.wal != nil && !c.wal.push(walOp{rec: rec}) {
+		// the queue is closed and drained, so the order is kept
+		c.appendWAL(rec)
+	}
+	if c.opt.ChangeLogSize <= 0 {
+		return
+	}
+	if len(l.records) < c.opt.ChangeLogSize {
+		l.records = append(l.records, rec)
+		return
+	}
+	l.records[l.head] = rec
+	l.head = (l.head + 1) % len(l.records)
+}
+
+// Changes returns the changes after sinceSeq.
+func (c *cache) Changes(sinceSeq uint64) []ChangeRecord {
+	if c.opt.ChangeLogSize <= 0 {
+		return nil
+	}
+	l := &c.changes
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sinceSeq == l.seq {
+		return nil
+	}
+	oldest := l.seq - uint64(len(l.records)) + 1
+	if sinceSeq+1 < oldest || sinceSeq > l.seq {
+		// the changes are no longer logged, or sinceSeq is of a previous
+		// run of the cache restarted since, reset with the whole cache
+		recs := []ChangeRecord{{Seq: l.seq, Op: ChangeReset}}
+		c.rangeEntries(func(key string, e *entry) bool {
+			val, err := e.Load()
+			recs = append(recs, ChangeRecord{Seq: l.seq, Op: ChangeSet, Key: key, Value: val, Err: err,
+				Lifetime: e.result().lifetime()})
+			return true
+		})
+		return recs
+	}
+	n := int(l.seq - sinceSeq)
+	recs := make([]ChangeRecord, 0, n)
+	for i := len(l.records) - n; i < len(l.records); i++ {
+		recs = append(recs, l.records[(l.head+i)%len(l.records)])
+	}
+	return recs
+}
+
+// appendWAL appends rec to WAL, and logs the failure.
+func (c *cache) appendWAL(rec ChangeRecord) {
+	if err := c.opt.WAL.Append(rec); err != nil {
+		c.opt.ErrLogFunc(fmt.Sprintf("asynccache: append %q to WAL: %v", rec.Key, err))
+	}
+}
+
+// walQueue hands the changes over to a goroutine appending them to WAL in
+// order, so that writes do not wait for its I/O with the change log locked.
+// Pushes wait while the queue is full.
+type walQueue struct {
+	mu      sync.RWMutex // read locked by push, locked by close
+	closed  bool
+	queue   chan walOp
+	drained chan struct{} // closed once the queue is drained by close
+}
+
+// walOp is a change to append, or a flush waiting for the changes before it.
+type walOp struct {
+	rec     ChangeRecord
+	flushed chan struct{}
+}
+
+func newWALQueue(size int) *walQueue {
+	if size <= 0 {
+		size = defaultHandlerQueueSize
+	}
+	return &walQueue{queue: make(chan walOp, size), drained: make(chan struct{})}
+}
+
+// push enqueues op, and reports false once the queue is closed and drained.
+func (q *walQueue) push(op walOp) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		<-q.drained
+		return false
+	}
+	q.queue <- op
+	return true
+}
+
+// close rejects further pushes and waits for the queued changes.
+func (q *walQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+	<-q.drained
+}
+
+// appendChanges appends the queued changes until the queue is closed and drained.
+func (c *cache) appendChanges() {
+	defer close(c.wal.drained)
+	for op := range c.wal.queue {
+		if op.flushed != nil {
+			close(op.flushed)
+			continue
+		}
+		c.appendWAL(op.rec)
+	}
+}
+
+// flushWAL waits until the changes logged before are appended to WAL.
+func (c *cache) flushWAL(ctx context.Context) error {
+	if c.wal == nil {
+		return nil
+	}
+	op := walOp{flushed: make(chan struct{})}
+	if !c.wal.push(op) {
+		return nil
+	}
+	select {
+	case <-op.flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
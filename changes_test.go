@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	c := NewCache(Options{ChangeLogSize: 3})
+	defer c.Close()
+	Assert(t, c.Changes(0) == nil)
+
+	c.SetDefault("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	recs := c.Changes(0)
+	Assert(t, !recs[0].Lifetime.Stored.IsZero())
+	DeepEqual(t, stripLifetimes(recs), []ChangeRecord{
+		{Seq: 1, Op: ChangeSet, Key: "a", Value: 1},
+		{Seq: 2, Op: ChangeSet, Key: "a", Value: 2},
+		{Seq: 3, Op: ChangeDelete, Key: "a"},
+	})
+	DeepEqual(t, c.Changes(2), []ChangeRecord{{Seq: 3, Op: ChangeDelete, Key: "a"}})
+	Assert(t, c.Changes(3) == nil)
+
+	c.Set("b", 1)
+	c.Set("c", 1)
+	DeepEqual(t, stripLifetimes(c.Changes(2)), []ChangeRecord{
+		{Seq: 3, Op: ChangeDelete, Key: "a"},
+		{Seq: 4, Op: ChangeSet, Key: "b", Value: 1},
+		{Seq: 5, Op: ChangeSet, Key: "c", Value: 1},
+	})
+	recs = c.Changes(1)
+	Assert(t, len(recs) == 3)
+	DeepEqual(t, recs[0], ChangeRecord{Seq: 5, Op: ChangeReset})
+
+	Assert(t, NewCache(Options{}).Changes(0) == nil)
+}
+
+// stripLifetimes clears the Lifetime of recs, which depends on the time.
+func stripLifetimes(recs []ChangeRecord) []ChangeRecord {
+	for i := range recs {
+		recs[i].Lifetime = Lifetime{}
+	}
+	return recs
+}
+
+// blockingAppender appends the records once release is closed.
+type blockingAppender struct {
+	release chan struct{}
+	mu      sync.Mutex
+	recs    []ChangeRecord
+}
+
+func (a *blockingAppender) Append(rec ChangeRecord) error {
+	<-a.release
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recs = append(a.recs, rec)
+	return nil
+}
+
+func TestWALInBackground(t *testing.T) {
+	wal := &blockingAppender{release: make(chan struct{})}
+	c := NewCache(Options{WAL: wal, ChangeLogSize: 10})
+	defer c.Close()
+
+	// the writes do not wait for the appends
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Delete("a")
+	Assert(t, len(c.Changes(0)) == 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	Assert(t, c.Flush(ctx) == context.DeadlineExceeded)
+
+	close(wal.release)
+	Assert(t, c.Flush(context.Background()) == nil)
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+	Assert(t, len(wal.recs) == 3)
+	for i, rec := range wal.recs {
+		Assert(t, rec.Seq == uint64(i+1))
+	}
+	Assert(t, wal.recs[2].Op == ChangeDelete && wal.recs[2].Key == "a")
+}
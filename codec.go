@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec encodes and decodes cached values, it is used when values leave the
+// process, e.g. served to peers or written to storages.
+type Codec interface {
+	Marshal(val interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// BytesCodec is the Codec of []byte values.
+type BytesCodec struct{}
+
+// Marshal implements Codec.
+func (BytesCodec) Marshal(val interface{}) ([]byte, error) {
+	b, ok := val.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("asynccache: invalid value type %T, want []byte", val)
+	}
+	return b, nil
+}
+
+// Unmarshal implements Codec.
+func (BytesCodec) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// StringCodec is the Codec of string values.
+type StringCodec struct{}
+
+// Marshal implements Codec.
+func (StringCodec) Marshal(val interface{}) ([]byte, error) {
+	s, ok := val.(string)
+	if !ok {
+		return nil, fmt.Errorf("asynccache: invalid value type %T, want string", val)
+	}
+	return []byte(s), nil
+}
+
+// Unmarshal implements Codec.
+func (StringCodec) Unmarshal(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// JSONCodec is the Codec of values encoded as JSON.
+type JSONCodec struct {
+	// New returns a pointer to unmarshal into,
+	// if it is nil, values are unmarshalled as generic JSON values.
+	New func() interface{}
+}
+
+// Marshal implements Codec.
+func (JSONCodec) Marshal(val interface{}) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+// Unmarshal implements Codec.
+func (c JSONCodec) Unmarshal(data []byte) (interface{}, error) {
+	if c.New == nil {
+		var v interface{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	}
+	v := c.New()
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
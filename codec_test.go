@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	type obj struct{ N int }
+	codecs := []struct {
+		codec Codec
+		val   interface{}
+	}{
+		{BytesCodec{}, []byte("val")},
+		{StringCodec{}, "val"},
+		{JSONCodec{New: func() interface{} { return &obj{} }}, &obj{N: 1}},
+		{JSONCodec{}, map[string]interface{}{"n": 1.0}},
+	}
+	for _, c := range codecs {
+		data, err := c.codec.Marshal(c.val)
+		Assert(t, err == nil)
+		v, err := c.codec.Unmarshal(data)
+		Assert(t, err == nil)
+		DeepEqual(t, v, c.val)
+	}
+
+	_, err := StringCodec{}.Marshal(1)
+	Assert(t, err != nil)
+	_, err = BytesCodec{}.Marshal("val")
+	Assert(t, err != nil)
+}
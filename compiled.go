@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CompiledOptions controls the behavior of CompiledCache.
+type CompiledOptions[V any] struct {
+	// Compile MUST be set, it compiles the source of key, such as a template,
+	// a regexp or an expression.
+	Compile func(key, source string) (V, error)
+
+	// If ExpireDuration is greater than 0, keys not accessed during it are deleted.
+	ExpireDuration time.Duration
+
+	// DeleteHandler is called with the compiled values replaced by the ones
+	// of new sources, or deleted. It is called one at a time in order, and
+	// Close waits for the queued calls.
+	DeleteHandler func(key string, oldData V)
+}
+
+// CompiledCache caches values compiled from sources, so that each source is
+// compiled once and reused by every call with it, until the source of the
+// key changes.
+type CompiledCache[V any] struct {
+	sfg          keyedGroup[compiledKey, *compiled[V]]
+	opt          CompiledOptions[V]
+	data         sync.Map // key -> *compiled[V]
+	expireTicker *time.Ticker
+	handlers     *dispatcher
+	closed       int32
+	done         chan struct{}
+}
+
+type compiledKey struct {
+	key  string
+	hash [sha256.Size]byte
+}
+
+type compiled[V any] struct {
+	hash   [sha256.Size]byte
+	val    V
+	err    error
+	expire int32 // 0 means useful, 1 will expire
+}
+
+// NewCompiledCache creates a CompiledCache.
+func NewCompiledCache[V any](opt CompiledOptions[V]) *CompiledCache[V] {
+	if opt.Compile == nil {
+		panic("asynccache: Compile MUST be set")
+	}
+	c := &CompiledCache[V]{
+		opt:      opt,
+		handlers: newDispatcher(0),
+		done:     make(chan struct{}),
+	}
+	go c.handlers.run()
+	if c.opt.ExpireDuration > 0 {
+		c.expireTicker = time.NewTicker(c.opt.ExpireDuration)
+		go c.loop()
+	}
+	return c
+}
+
+// GetCompiled returns the value compiled from source for key, compiling it
+// if the key is new or its source has changed since the last compilation,
+// which is detected by the SHA-256 of source. Errors of compilation are
+// cached as the values are, since compiling the same source fails again.
+func (c *CompiledCache[V]) GetCompiled(key, source string) (V, error) {
+	hash := sha256.Sum256([]byte(source))
+	if v, ok := c.data.Load(key); ok {
+		if cv := v.(*compiled[V]); cv.hash == hash {
+			atomic.StoreInt32(&cv.expire, 0)
+			return cv.val, cv.err
+		}
+	}
+	if c.IsClosed() {
+		var zero V
+		return zero, ErrClosed
+	}
+	cv, err := c.sfg.Do(compiledKey{key: key, hash: hash}, func() (*compiled[V], error) {
+		val, err := c.opt.Compile(key, source)
+		cv := &compiled[V]{hash: hash, val: val, err: keyedWrapErr("compile", key, err)}
+		if old, ok := c.data.Swap(key, cv); ok {
+			c.deleted(key, old.(*compiled[V]))
+		}
+		return cv, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, keyedWrapErr("compile", key, err)
+	}
+	return cv.val, cv.err
+}
+
+// Delete deletes the compiled value of the given key.
+func (c *CompiledCache[V]) Delete(key string) {
+	if old, ok := c.data.LoadAndDelete(key); ok {
+		c.deleted(key, old.(*compiled[V]))
+	}
+}
+
+// Close stops the background goroutine, compiled values are kept read-only.
+func (c *CompiledCache[V]) Close() {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return
+	}
+	close(c.done)
+	if c.expireTicker != nil {
+		c.expireTicker.Stop()
+	}
+	c.handlers.close()
+}
+
+// IsClosed reports whether the cache is closed.
+func (c *CompiledCache[V]) IsClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func (c *CompiledCache[V]) deleted(key string, cv *compiled[V]) {
+	if c.opt.DeleteHandler != nil && cv.err == nil {
+		c.handlers.dispatch(func() { c.opt.DeleteHandler(key, cv.val) })
+	}
+}
+
+func (c *CompiledCache[V]) loop() {
+	for {
+		select {
+		case <-c.expireTicker.C:
+			c.expire()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *CompiledCache[V]) expire() {
+	c.data.Range(func(key, value interface{}) bool {
+		cv := value.(*compiled[V])
+		if !atomic.CompareAndSwapInt32(&cv.expire, 0, 1) && c.data.CompareAndDelete(key, value) {
+			c.deleted(key.(string), cv)
+		}
+		return true
+	})
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompiledCache(t *testing.T) {
+	var compiles int32
+	deleted := make(chan string, 10)
+	c := NewCompiledCache(CompiledOptions[*regexp.Regexp]{
+		Compile: func(key, source string) (*regexp.Regexp, error) {
+			atomic.AddInt32(&compiles, 1)
+			return regexp.Compile(source)
+		},
+		DeleteHandler: func(key string, old *regexp.Regexp) {
+			deleted <- key + ":" + old.String()
+		},
+	})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			re, err := c.GetCompiled("digits", `\d+`)
+			Assert(t, err == nil && re.MatchString("42"))
+		}()
+	}
+	wg.Wait()
+	Assert(t, atomic.LoadInt32(&compiles) == 1)
+
+	re, err := c.GetCompiled("digits", `^\d+$`)
+	Assert(t, err == nil && !re.MatchString("a42"))
+	Assert(t, atomic.LoadInt32(&compiles) == 2)
+	Assert(t, <-deleted == `digits:\d+`)
+
+	_, err = c.GetCompiled("bad", `(`)
+	var syntaxErr *syntax.Error
+	Assert(t, errors.As(err, &syntaxErr))
+	_, err = c.GetCompiled("bad", `(`)
+	Assert(t, err != nil && atomic.LoadInt32(&compiles) == 3)
+
+	c.Delete("digits")
+	Assert(t, <-deleted == `digits:^\d+$`)
+	c.GetCompiled("digits", `^\d+$`)
+	Assert(t, atomic.LoadInt32(&compiles) == 4)
+}
+
+func TestCompiledCachePanic(t *testing.T) {
+	c := NewCompiledCache(CompiledOptions[string]{
+		Compile: func(key, source string) (string, error) {
+			panic("boom")
+		},
+	})
+	defer c.Close()
+
+	_, err := c.GetCompiled("a", "src")
+	Assert(t, errors.Is(err, errPanicked))
+}
+
+func TestCompiledCacheExpire(t *testing.T) {
+	var compiles int32
+	c := NewCompiledCache(CompiledOptions[string]{
+		Compile: func(key, source string) (string, error) {
+			atomic.AddInt32(&compiles, 1)
+			return source, nil
+		},
+		ExpireDuration: 10 * time.Millisecond,
+	})
+	defer c.Close()
+
+	c.GetCompiled("a", "x")
+	time.Sleep(50 * time.Millisecond)
+	c.GetCompiled("a", "x")
+	Assert(t, atomic.LoadInt32(&compiles) == 2)
+
+	c.Close()
+	_, err := c.GetCompiled("b", "x")
+	Assert(t, err == ErrClosed)
+}
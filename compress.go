@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"io"
+	"sync"
+)
+
+// Compressor compresses values stored in the cache.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor is the Compressor of gzip.
+type GzipCompressor struct {
+	// Level defaults to gzip.DefaultCompression.
+	Level int
+}
+
+// Compress implements Compressor.
+func (g GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress implements Compressor.
+func (g GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressed is a value stored compressed.
+type compressed struct {
+	data []byte
+	str  bool // the value is a string
+}
+
+// compression compresses values of entries, and keeps an LRU of the
+// decompressed values by their compressed ones.
+type compression struct {
+	threshold  int
+	compressor Compressor
+
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // of *decompressed, the front is the most recent
+	items map[*compressed]*list.Element
+}
+
+type decompressed struct {
+	key *compressed
+	val interface{}
+}
+
+func newCompression(opt Options) *compression {
+	cz := &compression{
+		threshold:  opt.CompressThreshold,
+		compressor: opt.Compressor,
+		size:       opt.DecompressedCacheSize,
+		lru:        list.New(),
+		items:      make(map[*compressed]*list.Element),
+	}
+	if cz.compressor == nil {
+		cz.compressor = GzipCompressor{}
+	}
+	if cz.size <= 0 {
+		cz.size = 64
+	}
+	return cz
+}
+
+// compress returns the compressed value if x is large enough, or x itself.
+func (cz *compression) compress(x interface{}) interface{} {
+	var data []byte
+	var str bool
+	switch v := x.(type) {
+	case []byte:
+		data = v
+	case string:
+		data, str = []byte(v), true
+	default:
+		return x
+	}
+	if len(data) <= cz.threshold {
+		return x
+	}
+	b, err := cz.compressor.Compress(data)
+	if err != nil || len(b) >= len(data) {
+		return x
+	}
+	return &compressed{data: b, str: str}
+}
+
+func (cz *compression) decompress(cv *compressed) (interface{}, error) {
+	cz.mu.Lock()
+	if el, ok := cz.items[cv]; ok {
+		cz.lru.MoveToFront(el)
+		cz.mu.Unlock()
+		return el.Value.(*decompressed).val, nil
+	}
+	cz.mu.Unlock()
+
+	data, err := cz.compressor.Decompress(cv.data)
+	if err != nil {
+		return nil, err
+	}
+	var val interface{} = data
+	if cv.str {
+		val = string(data)
+	}
+
+	cz.mu.Lock()
+	defer cz.mu.Unlock()
+	if _, ok := cz.items[cv]; !ok {
+		cz.items[cv] = cz.lru.PushFront(&decompressed{key: cv, val: val})
+		if cz.lru.Len() > cz.size {
+			oldest := cz.lru.Remove(cz.lru.Back()).(*decompressed)
+			delete(cz.items, oldest.key)
+		}
+	}
+	return val, nil
+}
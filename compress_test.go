@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat("value", 100)
+	op := Options{
+		CompressThreshold:     64,
+		DecompressedCacheSize: 1,
+	}
+	c := NewCache(op).(*cache)
+	c.SetDefault("small", "value")
+	c.SetDefault("str", large)
+	c.SetDefault("bytes", []byte(large))
+	c.SetDefault("int", 1)
+
+	v, _ := c.data().Load("str")
+	raw, _ := v.(*entry).loadRaw()
+	cv, ok := raw.(*compressed)
+	Assert(t, ok && len(cv.data) < len(large))
+	v, _ = c.data().Load("small")
+	raw, _ = v.(*entry).loadRaw()
+	Assert(t, raw.(string) == "value")
+
+	for i := 0; i < 2; i++ {
+		val, err := c.Get("str")
+		Assert(t, err == nil && val.(string) == large)
+		val, err = c.Get("bytes")
+		Assert(t, err == nil && bytes.Equal(val.([]byte), []byte(large)))
+	}
+	Assert(t, c.cz.lru.Len() == 1)
+	DeepEqual(t, c.Dump(), map[string]interface{}{"small": "value", "str": large, "bytes": []byte(large), "int": 1})
+
+	// compressed values are weighed by the compressed size
+	Assert(t, c.EstimatedSize() < 4*entryOverhead+int64(len(large)))
+}
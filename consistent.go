@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// getAllAttempts is the number of optimistic reads of GetAll before it
+// blocks the writes.
+const getAllAttempts = 3
+
+// beginWrite MUST be called before a write of the entries, and endWrite after.
+func (c *cache) beginWrite() {
+	c.writes.RLock()
+	atomic.AddInt64(&c.inflight, 1)
+}
+
+func (c *cache) endWrite() {
+	atomic.AddUint64(&c.writeSeq, 1)
+	atomic.AddInt64(&c.inflight, -1)
+	c.writes.RUnlock()
+}
+
+// GetAll gets the values of keys consistently. The keys are read again if
+// any write happens meanwhile, and once the reads keep racing with writes,
+// the writes are blocked while the cached values are read, as Snapshot does.
+func (c *cache) GetAll(keys ...string) (map[string]interface{}, uint64, error) {
+	for i := 0; i < getAllAttempts; i++ {
+		seq := atomic.LoadUint64(&c.writeSeq)
+		vals, err := c.getAll(keys, c.Get)
+		if atomic.LoadInt64(&c.inflight) == 0 && atomic.LoadUint64(&c.writeSeq) == seq {
+			return vals, seq, err
+		}
+	}
+	c.writes.Lock()
+	defer c.writes.Unlock()
+	vals, err := c.getAll(keys, c.peek)
+	return vals, atomic.LoadUint64(&c.writeSeq), err
+}
+
+func (c *cache) getAll(keys []string, get func(key string) (interface{}, error)) (map[string]interface{}, error) {
+	vals := make(map[string]interface{}, len(keys))
+	var errs []error
+	for _, k := range keys {
+		val, err := get(k)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		vals[k] = val
+	}
+	return vals, errors.Join(errs...)
+}
+
+// peek returns the cached value of key without fetching or writing.
+func (c *cache) peek(key string) (interface{}, error) {
+	e, ok := c.loadEntry(c.key(key))
+	if !ok {
+		return nil, wrapErr("get", key, ErrNotFound)
+	}
+	return e.Load()
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetAll(t *testing.T) {
+	c := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("bad")
+			}
+			return "val-" + key, nil
+		},
+	})
+	defer c.Close()
+
+	vals, seq, err := c.GetAll("a", "b")
+	Assert(t, err == nil)
+	DeepEqual(t, vals, map[string]interface{}{"a": "val-a", "b": "val-b"})
+	_, seq2, _ := c.GetAll("a", "b")
+	Assert(t, seq2 == seq)
+	c.Set("a", "x")
+	vals, seq2, _ = c.GetAll("a", "b", "bad")
+	Assert(t, seq2 != seq)
+	DeepEqual(t, vals, map[string]interface{}{"a": "x", "b": "val-b"})
+
+	_, _, err = c.GetAll("bad")
+	Assert(t, err != nil)
+}
+
+func TestGetAllConsistent(t *testing.T) {
+	c := NewCache(Options{})
+	defer c.Close()
+	c.Set("a", 0)
+	c.Set("b", 0)
+
+	var stop int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; atomic.LoadInt32(&stop) == 0; i++ {
+			// a and b are written together under the snapshot lock
+			c.ReplaceAll(map[string]interface{}{"a": i, "b": i})
+			c.Set("c", strconv.Itoa(i))
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		vals, _, err := c.GetAll("a", "b")
+		Assert(t, err == nil)
+		Assert(t, vals["a"] == vals["b"])
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// pendingChange is a refreshed value held back by MinChangeInterval.
+type pendingChange struct {
+	val interface{}
+	t   *ttl
+}
+
+// damp stores the refreshed newVal of e as update does, unless the value of
+// e changed less than MinChangeInterval ago. Then newVal is held back, and
+// the last value refreshed in the window is stored at its end if it still
+// differs, so that values flapping back and forth are not swapped and
+// reported. e.mu must be held.
+func (c *cache) damp(k string, e *entry, newVal interface{}, t *ttl) {
+	if c.opt.MinChangeInterval <= 0 {
+		c.update(k, e, newVal, t)
+		return
+	}
+	if e.pending != nil {
+		e.pending = &pendingChange{val: newVal, t: t}
+		return
+	}
+	oldVal, err := e.Load()
+	if err == nil && c.same(k, oldVal, newVal) {
+		c.update(k, e, newVal, t)
+		return
+	}
+	now := time.Now().UnixNano()
+	if wait := e.changedAt + int64(c.opt.MinChangeInterval) - now; wait > 0 {
+		e.pending = &pendingChange{val: newVal, t: t}
+		time.AfterFunc(time.Duration(wait), func() { c.reconcile(k, e) })
+		return
+	}
+	c.update(k, e, newVal, t)
+	e.changedAt = now
+}
+
+// reconcile stores the value held back by damp if it differs from the cached one.
+func (c *cache) reconcile(k string, e *entry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := e.pending
+	e.pending = nil
+	if p == nil || c.IsClosed() || atomic.LoadInt32(&e.dead) == 1 {
+		return
+	}
+	if oldVal, err := e.Load(); err == nil && c.same(k, oldVal, p.val) {
+		// flapped back
+		return
+	}
+	c.update(k, e, p.val, p.t)
+	e.changedAt = time.Now().UnixNano()
+}
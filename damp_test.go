@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMinChangeInterval(t *testing.T) {
+	var ret atomic.Value
+	ret.Store("a")
+	var mu sync.Mutex
+	var changes []string
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return ret.Load(), nil
+		},
+		IsSame: func(key string, oldData, newData interface{}) bool {
+			return oldData == newData
+		},
+		ChangeHandler: func(key string, oldData, newData interface{}) {
+			mu.Lock()
+			changes = append(changes, oldData.(string)+newData.(string))
+			mu.Unlock()
+		},
+		MinChangeInterval: 50 * time.Millisecond,
+	}).(*cache)
+	defer c.Close()
+	c.Get("k")
+
+	refresh := func(val string) {
+		ret.Store(val)
+		c.refresh()
+	}
+	value := func() string {
+		v, _ := c.Get("k")
+		return v.(string)
+	}
+	refresh("b")
+	Assert(t, value() == "b")
+	// flapping back within the interval
+	refresh("a")
+	Assert(t, value() == "b")
+	refresh("b")
+	time.Sleep(100 * time.Millisecond)
+	Assert(t, value() == "b")
+
+	// the last value is reconciled at the end of the interval
+	refresh("c")
+	Assert(t, value() == "c")
+	refresh("d")
+	refresh("e")
+	Assert(t, value() == "c")
+	time.Sleep(100 * time.Millisecond)
+	Assert(t, value() == "e")
+
+	mu.Lock()
+	defer mu.Unlock()
+	DeepEqual(t, changes, []string{"ab", "bc", "ce"})
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// refreshDataset fetches the dataset by SnapshotFetcher, and applies it to
+// the cached entries if its version is new.
+func (c *cache) refreshDataset() {
+	data, version, err := c.opt.SnapshotFetcher()
+	if err != nil {
+		err = fmt.Errorf("asynccache: fetch snapshot: %w", err)
+		if c.opt.ErrorHandler != nil {
+			c.dispatch(func() { c.opt.ErrorHandler("", err) })
+		}
+		atomic.StoreInt64(&c.refreshFailed, 1)
+		return
+	}
+	atomic.StoreInt64(&c.refreshFailed, 0)
+	if version == c.version && version != "" {
+		return
+	}
+	c.version = version
+	c.applyDataset(data)
+}
+
+// applyDataset stores the added and changed values of data, and deletes the
+// cached keys missing in data.
+func (c *cache) applyDataset(data map[string]interface{}) {
+	keys := make(map[string]bool, len(data))
+	for k, v := range data {
+		if c.IsClosed() {
+			return
+		}
+		k = c.key(k)
+		keys[k] = true
+		ety := c.newEntry()
+		ety.Store(v)
+		e, exist, stored := c.loadOrStore(k, ety)
+		if !exist {
+			if stored {
+				c.changed(k, ety, nil, v)
+			}
+			continue
+		}
+		e.mu.Lock()
+		oldVal, oldErr := e.Load()
+		if (oldErr != nil || !c.same(k, oldVal, v)) && !c.leased(k) {
+			c.changed(k, e, oldVal, v)
+			e.Store(v)
+			c.logChange(k)
+		}
+		e.mu.Unlock()
+	}
+	c.rangeEntries(func(k string, e *entry) bool {
+		if !keys[k] {
+			c.remove(k, e, ReasonDeleted)
+		}
+		return true
+	})
+}
+
+// same reports whether the values of key are the same by IsSame, or
+// reflect.DeepEqual if IsSame is nil.
+func (c *cache) same(key string, oldVal, newVal interface{}) bool {
+	if c.opt.IsSame != nil {
+		return c.opt.IsSame(key, oldVal, newVal)
+	}
+	return reflect.DeepEqual(oldVal, newVal)
+}
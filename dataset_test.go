@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotFetcher(t *testing.T) {
+	var mu sync.Mutex
+	version := "v1"
+	data := map[string]interface{}{"a": 1, "b": 1}
+	var fetches int
+	var changes, deletes []string
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		SnapshotFetcher: func() (map[string]interface{}, string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetches++
+			if version == "" {
+				return nil, "", errors.New("unavailable")
+			}
+			m := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				m[k] = v
+			}
+			return m, version, nil
+		},
+		ChangeHandler: func(key string, oldData, newData interface{}) {
+			mu.Lock()
+			changes = append(changes, key)
+			mu.Unlock()
+		},
+		DeleteHandler: func(key string, oldData interface{}, reason DeleteReason) {
+			mu.Lock()
+			deletes = append(deletes, key)
+			mu.Unlock()
+		},
+	})
+	defer c.Close()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": 1, "b": 1})
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	sort.Strings(changes)
+	DeepEqual(t, changes, []string{"a", "b"})
+	mu.Unlock()
+	_, err := c.Get("c")
+	Assert(t, errors.Is(err, ErrNotFound))
+	Assert(t, c.GetOrSet("c", 0) == 0)
+
+	mu.Lock()
+	data = map[string]interface{}{"b": 2, "c": 1}
+	mu.Unlock()
+	c.(*cache).refresh()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": 1, "b": 1})
+
+	mu.Lock()
+	version = "v2"
+	changes = nil
+	mu.Unlock()
+	c.(*cache).refresh()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b": 2, "c": 1})
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	sort.Strings(changes)
+	DeepEqual(t, changes, []string{"b", "c"})
+	DeepEqual(t, deletes, []string{"a"})
+	version = ""
+	mu.Unlock()
+
+	c.(*cache).refresh()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b": 2, "c": 1})
+	mu.Lock()
+	Assert(t, fetches == 4)
+	mu.Unlock()
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// deadlineIndex is a min-heap of the entries by the HardTTL deadlines of
+// their results, with a timer deleting the entries once the earliest is due,
+// see ExpireDeadlines. An entry is in the heap at most once: its deadline is
+// updated when its result is replaced, and it is removed when deleted.
+type deadlineIndex struct {
+	mu    sync.Mutex
+	h     deadlineHeap
+	timer *time.Timer
+	next  int64 // unix nano the timer fires at, 0 if stopped
+}
+
+// deadlineHeap orders entries by dlAt, and keeps their dlIndex.
+type deadlineHeap []*entry
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].dlAt < h[j].dlAt }
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].dlIndex, h[j].dlIndex = i+1, j+1
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	e := x.(*entry)
+	*h = append(*h, e)
+	e.dlIndex = len(*h)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	e.dlIndex = 0
+	return e
+}
+
+// scheduleExpiry indexes the HardTTL deadline of the result of e, which is
+// stored as e.key, if ExpireDeadlines is true, replacing its former one.
+func (c *cache) scheduleExpiry(e *entry) {
+	if !c.opt.ExpireDeadlines || !e.stored {
+		return
+	}
+	var at int64
+	if res := e.result(); res != nil {
+		at = res.hard
+	}
+	x := &c.deadlines
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	switch {
+	case at <= 0 || atomic.LoadInt32(&e.dead) == 1:
+		if e.dlIndex > 0 {
+			heap.Remove(&x.h, e.dlIndex-1)
+		}
+		return
+	case e.dlIndex > 0:
+		e.dlAt = at
+		heap.Fix(&x.h, e.dlIndex-1)
+	default:
+		e.dlAt = at
+		heap.Push(&x.h, e)
+	}
+	if x.next == 0 || at < x.next {
+		x.arm(c, at)
+	}
+}
+
+// unscheduleExpiry removes the deleted entry e from the deadlines.
+func (c *cache) unscheduleExpiry(e *entry) {
+	if !c.opt.ExpireDeadlines {
+		return
+	}
+	x := &c.deadlines
+	x.mu.Lock()
+	if e.dlIndex > 0 {
+		heap.Remove(&x.h, e.dlIndex-1)
+	}
+	x.mu.Unlock()
+}
+
+// arm sets the timer to fire at, x.mu MUST be held.
+func (x *deadlineIndex) arm(c *cache, at int64) {
+	x.next = at
+	d := time.Duration(at - time.Now().UnixNano())
+	if x.timer == nil {
+		x.timer = time.AfterFunc(d, c.expireDue)
+	} else {
+		x.timer.Reset(d)
+	}
+}
+
+// expireDue deletes the entries whose deadlines are due, and arms the timer
+// for the next deadline.
+func (c *cache) expireDue() {
+	x := &c.deadlines
+	now := time.Now().UnixNano()
+	var due []*entry
+	x.mu.Lock()
+	for len(x.h) > 0 && x.h[0].dlAt <= now {
+		due = append(due, heap.Pop(&x.h).(*entry))
+	}
+	x.next = 0
+	if len(x.h) > 0 && !c.IsClosed() {
+		x.arm(c, x.h[0].dlAt)
+	}
+	x.mu.Unlock()
+	for _, e := range due {
+		// a result stored since is scheduled by its own deadline.
+		if res := e.result(); res != nil && res.hard > 0 && res.hard <= now && atomic.LoadInt32(&e.dead) == 0 {
+			c.remove(e.key, e, ReasonExpired)
+		}
+	}
+}
+
+// stopDeadlines stops the timer of the deadlines.
+func (c *cache) stopDeadlines() {
+	x := &c.deadlines
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.timer != nil {
+		x.timer.Stop()
+	}
+	x.next = 0
+	for _, e := range x.h {
+		e.dlIndex = 0
+	}
+	x.h = nil
+}
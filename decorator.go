@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// OpSet is the Set call of a decorated cache.
+	OpSet Operation = "set"
+	// OpPut is the Put call of a decorated cache.
+	OpPut Operation = "put"
+	// OpDelete is the Delete call of a decorated cache.
+	OpDelete Operation = "delete"
+	// OpAcquire is the Acquire call of a decorated cache.
+	OpAcquire Operation = "acquire"
+	// OpGetAll is the GetAll call of a decorated cache.
+	OpGetAll Operation = "getAll"
+	// OpGetOrSetMulti is the GetOrSetMulti call of a decorated cache.
+	OpGetOrSetMulti Operation = "getOrSetMulti"
+	// OpDump is the Dump call of a decorated cache.
+	OpDump Operation = "dump"
+	// OpSnapshot is the Snapshot call of a decorated cache.
+	OpSnapshot Operation = "snapshot"
+	// OpRangeEntries is the RangeEntries call of a decorated cache.
+	OpRangeEntries Operation = "rangeEntries"
+	// OpErrors is the Errors call of a decorated cache.
+	OpErrors Operation = "errors"
+	// OpSetDefault is the SetDefault call of a decorated cache.
+	OpSetDefault Operation = "setDefault"
+	// OpLease is the Lease call of a decorated cache.
+	OpLease Operation = "lease"
+	// OpSetWithLease is the SetWithLease call of a decorated cache.
+	OpSetWithLease Operation = "setWithLease"
+	// OpPutAsync is the PutAsync call of a decorated cache.
+	OpPutAsync Operation = "putAsync"
+	// OpFlush is the Flush call of a decorated cache.
+	OpFlush Operation = "flush"
+	// OpReplaceAll is the ReplaceAll call of a decorated cache.
+	OpReplaceAll Operation = "replaceAll"
+	// OpDeleteIf is the DeleteIf call of a decorated cache.
+	OpDeleteIf Operation = "deleteIf"
+	// OpDeleteIfValue is the DeleteIfValue call of a decorated cache.
+	OpDeleteIfValue Operation = "deleteIfValue"
+	// OpDeleteErrored is the DeleteErrored call of a decorated cache.
+	OpDeleteErrored Operation = "deleteErrored"
+	// OpPurgeTenant is the PurgeTenant call of a decorated cache, the key is
+	// the tenant.
+	OpPurgeTenant Operation = "purgeTenant"
+)
+
+// Decorate wraps c so that its reads, writes and refreshes go through the
+// interceptor: every method of Reader, Writer and Refresher, and
+// PurgeTenant. The Refresh call is intercepted as OpRefresh, and the calls
+// on no single key, such as GetAll or DeleteIf, with an empty key. The
+// other methods, such as Stats and Close, are delegated. Unlike
+// Options.Interceptors, it works on any Cache implementation without
+// touching its Options.
+func Decorate(c Cache, ic Interceptor) Cache {
+	return &decorated{c: c, ic: ic}
+}
+
+// decorated implements every method of Cache rather than embedding it, so
+// that methods added to Cache are not delegated without interception.
+type decorated struct {
+	c  Cache
+	ic Interceptor
+}
+
+func (d *decorated) Get(key string) (interface{}, error) {
+	return d.ic(OpGet, key, d.c.Get)
+}
+
+func (d *decorated) GetWithTimeout(key string, timeout time.Duration) (interface{}, error) {
+	return d.ic(OpGet, key, func(key string) (interface{}, error) {
+		return d.c.GetWithTimeout(key, timeout)
+	})
+}
+
+func (d *decorated) Acquire(key string) (Handle, error) {
+	val, err := d.ic(OpAcquire, key, func(key string) (interface{}, error) {
+		return d.c.Acquire(key)
+	})
+	h, _ := val.(Handle)
+	return h, err
+}
+
+func (d *decorated) GetOrSet(key string, def interface{}) interface{} {
+	val, err := d.ic(OpGetOrSet, key, func(key string) (interface{}, error) {
+		return d.c.GetOrSet(key, def), nil
+	})
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+func (d *decorated) GetOrSetWithTimeout(key string, def interface{}, timeout time.Duration) interface{} {
+	val, err := d.ic(OpGetOrSet, key, func(key string) (interface{}, error) {
+		return d.c.GetOrSetWithTimeout(key, def, timeout), nil
+	})
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+func (d *decorated) GetOrSetMulti(defaults map[string]interface{}) map[string]interface{} {
+	val, err := d.ic(OpGetOrSetMulti, "", func(string) (interface{}, error) {
+		return d.c.GetOrSetMulti(defaults), nil
+	})
+	vals, ok := val.(map[string]interface{})
+	if err != nil || !ok {
+		return defaults
+	}
+	return vals
+}
+
+func (d *decorated) GetAll(keys ...string) (map[string]interface{}, uint64, error) {
+	var seq uint64
+	val, err := d.ic(OpGetAll, "", func(string) (interface{}, error) {
+		vals, s, err := d.c.GetAll(keys...)
+		seq = s
+		return vals, err
+	})
+	vals, _ := val.(map[string]interface{})
+	return vals, seq, err
+}
+
+func (d *decorated) GetOrReset(key string, resetVal interface{}) interface{} {
+	val, _ := d.ic(OpGetOrReset, key, func(key string) (interface{}, error) {
+		return d.c.GetOrReset(key, resetVal), nil
+	})
+	return val
+}
+
+func (d *decorated) GetOrResetWithTTL(key string, resetVal interface{}, ttl time.Duration) interface{} {
+	val, _ := d.ic(OpGetOrReset, key, func(key string) (interface{}, error) {
+		return d.c.GetOrResetWithTTL(key, resetVal, ttl), nil
+	})
+	return val
+}
+
+func (d *decorated) Dump() map[string]interface{} {
+	val, _ := d.ic(OpDump, "", func(string) (interface{}, error) {
+		return d.c.Dump(), nil
+	})
+	data, _ := val.(map[string]interface{})
+	return data
+}
+
+func (d *decorated) Snapshot() *Snapshot {
+	val, _ := d.ic(OpSnapshot, "", func(string) (interface{}, error) {
+		return d.c.Snapshot(), nil
+	})
+	snap, _ := val.(*Snapshot)
+	return snap
+}
+
+func (d *decorated) RangeEntries(fn func(key string, val interface{}, meta EntryInfo) bool) {
+	d.ic(OpRangeEntries, "", func(string) (interface{}, error) {
+		d.c.RangeEntries(fn)
+		return nil, nil
+	})
+}
+
+func (d *decorated) Errors() map[string]error {
+	val, _ := d.ic(OpErrors, "", func(string) (interface{}, error) {
+		return d.c.Errors(), nil
+	})
+	errs, _ := val.(map[string]error)
+	return errs
+}
+
+func (d *decorated) SetDefault(key string, val interface{}) bool {
+	exist, _ := d.ic(OpSetDefault, key, func(key string) (interface{}, error) {
+		return d.c.SetDefault(key, val), nil
+	})
+	ok, _ := exist.(bool)
+	return ok
+}
+
+func (d *decorated) Set(key string, val interface{}) {
+	d.ic(OpSet, key, func(key string) (interface{}, error) {
+		d.c.Set(key, val)
+		return nil, nil
+	})
+}
+
+func (d *decorated) Lease(key string, ttl time.Duration) (LeaseToken, error) {
+	val, err := d.ic(OpLease, key, func(key string) (interface{}, error) {
+		return d.c.Lease(key, ttl)
+	})
+	token, _ := val.(LeaseToken)
+	return token, err
+}
+
+func (d *decorated) SetWithLease(key string, val interface{}, token LeaseToken) error {
+	_, err := d.ic(OpSetWithLease, key, func(key string) (interface{}, error) {
+		return nil, d.c.SetWithLease(key, val, token)
+	})
+	return err
+}
+
+func (d *decorated) Put(key string, val interface{}) error {
+	_, err := d.ic(OpPut, key, func(key string) (interface{}, error) {
+		return nil, d.c.Put(key, val)
+	})
+	return err
+}
+
+func (d *decorated) PutAsync(key string, val interface{}) error {
+	_, err := d.ic(OpPutAsync, key, func(key string) (interface{}, error) {
+		return nil, d.c.PutAsync(key, val)
+	})
+	return err
+}
+
+func (d *decorated) Flush(ctx context.Context) error {
+	_, err := d.ic(OpFlush, "", func(string) (interface{}, error) {
+		return nil, d.c.Flush(ctx)
+	})
+	return err
+}
+
+func (d *decorated) ReplaceAll(data map[string]interface{}) {
+	d.ic(OpReplaceAll, "", func(string) (interface{}, error) {
+		d.c.ReplaceAll(data)
+		return nil, nil
+	})
+}
+
+func (d *decorated) DeleteIf(shouldDelete func(key string) bool) {
+	d.ic(OpDeleteIf, "", func(string) (interface{}, error) {
+		d.c.DeleteIf(shouldDelete)
+		return nil, nil
+	})
+}
+
+func (d *decorated) DeleteIfValue(shouldDelete func(key string, val interface{}) bool) int {
+	val, _ := d.ic(OpDeleteIfValue, "", func(string) (interface{}, error) {
+		return d.c.DeleteIfValue(shouldDelete), nil
+	})
+	n, _ := val.(int)
+	return n
+}
+
+func (d *decorated) Delete(key string) {
+	d.ic(OpDelete, key, func(key string) (interface{}, error) {
+		d.c.Delete(key)
+		return nil, nil
+	})
+}
+
+func (d *decorated) DeleteErrored() {
+	d.ic(OpDeleteErrored, "", func(string) (interface{}, error) {
+		d.c.DeleteErrored()
+		return nil, nil
+	})
+}
+
+func (d *decorated) PurgeTenant(id string) int {
+	val, _ := d.ic(OpPurgeTenant, id, func(id string) (interface{}, error) {
+		return d.c.PurgeTenant(id), nil
+	})
+	n, _ := val.(int)
+	return n
+}
+
+func (d *decorated) Refresh(key string) error {
+	_, err := d.ic(OpRefresh, key, func(key string) (interface{}, error) {
+		return nil, d.c.Refresh(key)
+	})
+	return err
+}
+
+func (d *decorated) Changes(sinceSeq uint64) []ChangeRecord { return d.c.Changes(sinceSeq) }
+func (d *decorated) TopKeys(n int) []KeyStat                { return d.c.TopKeys(n) }
+func (d *decorated) TenantStats(id string) TenantStats      { return d.c.TenantStats(id) }
+func (d *decorated) Healthy() error                         { return d.c.Healthy() }
+func (d *decorated) Stats() Stats                           { return d.c.Stats() }
+func (d *decorated) EstimatedSize() int64                   { return d.c.EstimatedSize() }
+func (d *decorated) Close()                                 { d.c.Close() }
+func (d *decorated) IsClosed() bool                         { return d.c.IsClosed() }
+
+// name is the Options.Name of the decorated cache, for AdminServer.
+func (d *decorated) name() string {
+	if n, ok := d.c.(interface{ name() string }); ok {
+		return n.name()
+	}
+	return ""
+}
+
+// Metrics receives the measurements of operations.
+type Metrics interface {
+	Observe(op Operation, d time.Duration, err error)
+}
+
+// MetricsInterceptor returns an Interceptor measuring operations into m.
+func MetricsInterceptor(m Metrics) Interceptor {
+	return func(op Operation, key string, invoker Invoker) (interface{}, error) {
+		start := time.Now()
+		val, err := invoker(key)
+		m.Observe(op, time.Since(start), err)
+		return val, err
+	}
+}
+
+// WithMetrics decorates c with MetricsInterceptor.
+func WithMetrics(c Cache, m Metrics) Cache {
+	return Decorate(c, MetricsInterceptor(m))
+}
+
+// LoggingInterceptor returns an Interceptor logging operations to logger,
+// successful ones at debug level and failed ones at warn level.
+func LoggingInterceptor(logger *slog.Logger) Interceptor {
+	return func(op Operation, key string, invoker Invoker) (interface{}, error) {
+		start := time.Now()
+		val, err := invoker(key)
+		if err != nil {
+			logger.Warn("asynccache operation failed", "op", op, "key", key, "duration", time.Since(start), "error", err)
+		} else {
+			logger.Debug("asynccache operation", "op", op, "key", key, "duration", time.Since(start))
+		}
+		return val, err
+	}
+}
+
+// WithLogging decorates c with LoggingInterceptor.
+func WithLogging(c Cache, logger *slog.Logger) Cache {
+	return Decorate(c, LoggingInterceptor(logger))
+}
+
+// Tracer starts spans of operations, the returned function ends the span.
+type Tracer interface {
+	Start(ctx context.Context, op Operation, key string) (end func(err error))
+}
+
+// TracingInterceptor returns an Interceptor tracing operations by t.
+// Operations have no context, so spans are started from context.Background.
+func TracingInterceptor(t Tracer) Interceptor {
+	return func(op Operation, key string, invoker Invoker) (interface{}, error) {
+		end := t.Start(context.Background(), op, key)
+		val, err := invoker(key)
+		end(err)
+		return val, err
+	}
+}
+
+// WithTracing decorates c with TracingInterceptor.
+func WithTracing(c Cache, t Tracer) Cache {
+	return Decorate(c, TracingInterceptor(t))
+}
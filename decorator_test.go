@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordMetrics struct {
+	mu   sync.Mutex
+	ops  []Operation
+	errs int
+}
+
+func (m *recordMetrics) Observe(op Operation, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops = append(m.ops, op)
+	if err != nil {
+		m.errs++
+	}
+}
+
+type recordTracer struct {
+	spans []string
+}
+
+func (t *recordTracer) Start(ctx context.Context, op Operation, key string) func(err error) {
+	return func(err error) {
+		t.spans = append(t.spans, string(op)+":"+key)
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("error")
+			}
+			return key, nil
+		},
+	}
+	m := &recordMetrics{}
+	tr := &recordTracer{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := WithTracing(WithLogging(WithMetrics(NewCache(op), m), logger), tr)
+
+	v, err := c.Get("key")
+	Assert(t, err == nil && v.(string) == "key")
+	_, err = c.Get("bad")
+	Assert(t, err != nil)
+	Assert(t, c.GetOrSet("bad", "def").(string) == "def")
+	c.Set("key", "val")
+	c.Delete("key")
+	Assert(t, c.Put("key", "val") == ErrNoWriter)
+
+	DeepEqual(t, m.ops, []Operation{OpGet, OpGet, OpGetOrSet, OpSet, OpDelete, OpPut})
+	Assert(t, m.errs == 2)
+	DeepEqual(t, tr.spans, []string{"get:key", "get:bad", "getOrSet:bad", "set:key", "delete:key", "put:key"})
+	Assert(t, strings.Count(buf.String(), "level=WARN") == 2)
+	Assert(t, strings.Count(buf.String(), "level=DEBUG") == 4)
+
+	// methods not intercepted are delegated
+	DeepEqual(t, c.Dump(), map[string]interface{}{"bad": "def"})
+}
+
+func TestDecorateInterceptsAll(t *testing.T) {
+	// the methods of Cache delegated without interception
+	delegated := map[string]bool{
+		"Changes": true, "TopKeys": true, "TenantStats": true, "Healthy": true,
+		"Stats": true, "EstimatedSize": true, "Close": true, "IsClosed": true,
+	}
+	var ops []Operation
+	c := Decorate(NewCache(Options{}), func(op Operation, key string, invoker Invoker) (interface{}, error) {
+		ops = append(ops, op)
+		return nil, nil
+	})
+	defer c.Close()
+
+	v := reflect.ValueOf(c)
+	typ := reflect.TypeOf((*Cache)(nil)).Elem()
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		if delegated[m.Name] {
+			continue
+		}
+		fn := v.MethodByName(m.Name)
+		args := make([]reflect.Value, fn.Type().NumIn())
+		for j := range args {
+			args[j] = reflect.Zero(fn.Type().In(j))
+		}
+		if fn.Type().IsVariadic() {
+			fn.CallSlice(args)
+		} else {
+			fn.Call(args)
+		}
+		Assertf(t, len(ops) == 1, "%s is not intercepted", m.Name)
+		ops = ops[:0]
+	}
+}
@@ -0,0 +1,128 @@
+// Package discovery provides a cache of service instances built on asynccache.
+//
+// Instances are resolved per service name and refreshed in background, and
+// a watch channel of a registry, such as etcd or Consul, can trigger the
+// refresh of a service immediately.
+package discovery
+
+import (
+	"sort"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Options controls the behavior of Discovery.
+type Options struct {
+	// Resolver returns the instance addresses of the service, it MUST be set.
+	Resolver func(service string) ([]string, error)
+	// RefreshDuration defaults to 30 seconds.
+	RefreshDuration time.Duration
+
+	// ChangeHandler is called with the instances added to and removed from the service.
+	ChangeHandler func(service string, added, removed []string)
+	ErrorHandler  func(service string, err error)
+}
+
+// Discovery caches instances by service name.
+type Discovery struct {
+	c asynccache.Cache
+}
+
+// New creates a Discovery.
+func New(opt Options) *Discovery {
+	if opt.Resolver == nil {
+		panic("discovery: invalid Resolver")
+	}
+	if opt.RefreshDuration == 0 {
+		opt.RefreshDuration = 30 * time.Second
+	}
+	aopt := asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: opt.RefreshDuration,
+		Fetcher: func(service string) (interface{}, error) {
+			ins, err := opt.Resolver(service)
+			if err != nil {
+				return nil, err
+			}
+			ins = append([]string(nil), ins...)
+			sort.Strings(ins)
+			return ins, nil
+		},
+		ErrorHandler: opt.ErrorHandler,
+		IsSame: func(service string, oldData, newData interface{}) bool {
+			added, removed := diff(oldData, newData)
+			return len(added) == 0 && len(removed) == 0
+		},
+	}
+	if opt.ChangeHandler != nil {
+		aopt.ChangeHandler = func(service string, oldData, newData interface{}) {
+			added, removed := diff(oldData, newData)
+			opt.ChangeHandler(service, added, removed)
+		}
+	}
+	return &Discovery{c: asynccache.NewCache(aopt)}
+}
+
+// Instances returns the sorted instance addresses of the service.
+// The returned slice should not be modified.
+func (d *Discovery) Instances(service string) ([]string, error) {
+	v, err := d.c.Get(service)
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// Shard returns the RefreshShard of the instance self among the instances
+// of the service, for asynccache.Options. The instance refreshes all keys
+// while the service fails to resolve, and none while it is not listed.
+func (d *Discovery) Shard(service, self string) func() (index, count int) {
+	return func() (int, int) {
+		ins, err := d.Instances(service)
+		if err != nil {
+			return 0, 1
+		}
+		i := sort.SearchStrings(ins, self)
+		if i == len(ins) || ins[i] != self {
+			return -1, len(ins)
+		}
+		return i, len(ins)
+	}
+}
+
+// Watch refreshes the services received from updates until it is closed.
+// It is typically fed by an etcd watch or Consul blocking query.
+func (d *Discovery) Watch(updates <-chan string) {
+	for service := range updates {
+		d.c.Refresh(service)
+	}
+}
+
+// Close closes the underlying cache.
+func (d *Discovery) Close() {
+	d.c.Close()
+}
+
+// diff returns the instances of newData absent in oldData, and vice versa.
+func diff(oldData, newData interface{}) (added, removed []string) {
+	olds, _ := oldData.([]string)
+	news, _ := newData.([]string)
+	i, j := 0, 0
+	for i < len(olds) && j < len(news) {
+		switch {
+		case olds[i] == news[j]:
+			i++
+			j++
+		case olds[i] < news[j]:
+			removed = append(removed, olds[i])
+			i++
+		default:
+			added = append(added, news[j])
+			j++
+		}
+	}
+	removed = append(removed, olds[i:]...)
+	added = append(added, news[j:]...)
+	return
+}
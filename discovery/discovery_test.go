@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	instances := []string{"10.0.0.2:80", "10.0.0.1:80"}
+	changes := make(chan [2][]string, 1)
+	d := New(Options{
+		Resolver: func(service string) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return instances, nil
+		},
+		RefreshDuration: time.Hour,
+		ChangeHandler: func(service string, added, removed []string) {
+			changes <- [2][]string{added, removed}
+		},
+	})
+
+	ins, err := d.Instances("svc")
+	if err != nil || !reflect.DeepEqual(ins, []string{"10.0.0.1:80", "10.0.0.2:80"}) {
+		t.Fatalf("Instances = %v, %v", ins, err)
+	}
+
+	mu.Lock()
+	instances = []string{"10.0.0.3:80", "10.0.0.1:80"}
+	mu.Unlock()
+	updates := make(chan string, 1)
+	updates <- "svc"
+	close(updates)
+	d.Watch(updates)
+
+	ins, _ = d.Instances("svc")
+	if !reflect.DeepEqual(ins, []string{"10.0.0.1:80", "10.0.0.3:80"}) {
+		t.Fatalf("Instances = %v", ins)
+	}
+	select {
+	case c := <-changes:
+		if !reflect.DeepEqual(c, [2][]string{{"10.0.0.3:80"}, {"10.0.0.2:80"}}) {
+			t.Fatalf("change = %v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ChangeHandler not called")
+	}
+}
+
+func TestShard(t *testing.T) {
+	d := New(Options{
+		Resolver: func(service string) ([]string, error) {
+			return []string{"b:80", "a:80", "c:80"}, nil
+		},
+	})
+	defer d.Close()
+	if i, n := d.Shard("svc", "b:80")(); i != 1 || n != 3 {
+		t.Fatalf("Shard = %d, %d", i, n)
+	}
+	if i, _ := d.Shard("svc", "d:80")(); i != -1 {
+		t.Fatalf("Shard of unlisted instance = %d", i)
+	}
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// defaultHandlerQueueSize is the default of Options.HandlerQueueSize.
+const defaultHandlerQueueSize = 1024
+
+// dispatcher calls the handlers one at a time in the order of dispatch.
+type dispatcher struct {
+	mu      sync.RWMutex // read locked by dispatch, locked by close
+	closed  bool
+	queue   chan func()
+	drained chan struct{} // closed once the queue is drained by close
+	dropped uint64
+}
+
+func newDispatcher(size int) *dispatcher {
+	if size <= 0 {
+		size = defaultHandlerQueueSize
+	}
+	return &dispatcher{
+		queue:   make(chan func(), size),
+		drained: make(chan struct{}),
+	}
+}
+
+// dispatch enqueues the call of a handler, and reports whether it is
+// enqueued: calls are dropped and counted once the queue is full or closed.
+func (d *dispatcher) dispatch(fn func()) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		atomic.AddUint64(&d.dropped, 1)
+		return false
+	}
+	select {
+	case d.queue <- fn:
+		return true
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		return false
+	}
+}
+
+// run calls the queued handlers until the queue is closed and drained.
+func (d *dispatcher) run() {
+	defer close(d.drained)
+	for fn := range d.queue {
+		fn()
+	}
+}
+
+// close rejects further dispatches and waits for the queued calls.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+	<-d.drained
+}
+
+// droppedEvents returns the number of dropped calls.
+func (d *dispatcher) droppedEvents() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+func (c *cache) dispatch(fn func()) bool {
+	return c.handlers.dispatch(fn)
+}
+
+// ErrorReporter is implemented by the caches created by NewCache, so that
+// the packages building on them report their errors in order with the ones
+// of the cache.
+type ErrorReporter interface {
+	// ReportError calls ErrorHandler with err through the handler queue.
+	ReportError(key string, err error)
+}
+
+// ReportError calls ErrorHandler with err through the handler queue.
+func (c *cache) ReportError(key string, err error) {
+	if c.opt.ErrorHandler != nil {
+		c.dispatch(func() { c.opt.ErrorHandler(key, err) })
+	}
+}
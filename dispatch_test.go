@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandlerQueue(t *testing.T) {
+	block := make(chan struct{})
+	var changes []string
+	c := NewCache(Options{
+		HandlerQueueSize: 3,
+		IsSame: func(key string, oldData, newData interface{}) bool {
+			return false
+		},
+		ChangeHandler: func(key string, oldData, newData interface{}) {
+			if newData == "block" {
+				<-block
+				return
+			}
+			changes = append(changes, newData.(string))
+		},
+	})
+	c.SetDefault("a", "")
+	c.Set("a", "block")
+	for len(c.(*cache).handlers.queue) > 0 {
+		// wait for the dispatcher to block
+	}
+	for i := 0; i < 5; i++ {
+		c.Set("a", strconv.Itoa(i))
+	}
+	Assert(t, c.Stats().DroppedEvents == 2)
+
+	close(block)
+	c.Close()
+	DeepEqual(t, changes, []string{"0", "1", "2"})
+	c.Set("a", "closed")
+	Assert(t, c.Stats().DroppedEvents == 2)
+}
+
+func TestDispatchClose(t *testing.T) {
+	d := newDispatcher(16)
+	go d.run()
+	var called uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				d.dispatch(func() { atomic.AddUint64(&called, 1) })
+			}
+		}()
+	}
+	d.close()
+	wg.Wait()
+	Assert(t, atomic.LoadUint64(&called)+d.droppedEvents() == 800)
+}
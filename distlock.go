@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// DistributedLock is a lock shared by a fleet of instances, such as
+// redislock.Lock, electing the instance refreshing the cache. The instances
+// share the key set of KeyLister or SnapshotFetcher, so that the keys cached
+// by the instances losing the lock are refreshed by the one holding it.
+type DistributedLock interface {
+	// TryLock acquires the lock for ttl, or extends it if it is held by
+	// the instance already. It returns false if another instance holds it.
+	TryLock(ttl time.Duration) (bool, error)
+}
+
+// lockRefresh reports whether the instance refreshes this cycle by
+// RefreshLock. If the lock fails, the cycle runs as if there were no lock,
+// so that the cache keeps refreshing without the lock service.
+func (c *cache) lockRefresh() bool {
+	ok, err := c.opt.RefreshLock.TryLock(c.opt.RefreshDuration)
+	if err != nil {
+		err = fmt.Errorf("asynccache: lock refresh: %w", err)
+		if c.opt.ErrorHandler != nil {
+			c.dispatch(func() { c.opt.ErrorHandler("", err) })
+		}
+		return true
+	}
+	return ok
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeLock struct {
+	ok  bool
+	err error
+}
+
+func (l *fakeLock) TryLock(ttl time.Duration) (bool, error) {
+	return l.ok, l.err
+}
+
+func TestRefreshLock(t *testing.T) {
+	var n int32
+	lock := &fakeLock{}
+	errs := make(chan error, 1)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&n, 1), nil
+		},
+		ErrorHandler: func(key string, err error) {
+			errs <- err
+		},
+		KeyLister: func() ([]string, error) {
+			return []string{"a"}, nil
+		},
+		RefreshLock: lock,
+	}).(*cache)
+	defer c.Close()
+	c.Get("a")
+
+	// the instance holding the lock refreshes, the others skip the cycle
+	c.refresh()
+	Assert(t, atomic.LoadInt32(&n) == 1)
+	lock.ok = true
+	c.refresh()
+	Assert(t, atomic.LoadInt32(&n) == 2)
+
+	// the cache refreshes without the lock service
+	lock.ok, lock.err = false, errors.New("down")
+	c.refresh()
+	Assert(t, atomic.LoadInt32(&n) == 3)
+	Assert(t, errors.Is(<-errs, lock.err))
+}
+
+func TestRefreshLockNeedsKeySet(t *testing.T) {
+	defer func() {
+		Assert(t, recover() != nil)
+	}()
+	NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		RefreshLock: &fakeLock{},
+	})
+}
@@ -0,0 +1,214 @@
+// Package dnscache provides a DNS cache built on asynccache, with the
+// LookupHost and LookupSRV methods of net.Resolver.
+//
+// Records are refreshed in background once their TTL passes, and the last
+// known records keep serving when the DNS server is briefly unavailable.
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Resolver is the subset of *net.Resolver used by Cache.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// TTLResolver is implemented by resolvers reporting the TTLs of records,
+// e.g. adapters of DNS client libraries. The records of other resolvers
+// live for Options.TTL.
+type TTLResolver interface {
+	LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error)
+	LookupSRVTTL(ctx context.Context, service, proto, name string) (string, []*net.SRV, time.Duration, error)
+}
+
+// Options controls the behavior of Cache.
+type Options struct {
+	// Resolver defaults to net.DefaultResolver.
+	Resolver Resolver
+	// TTL is the TTL of the records of resolvers not implementing
+	// TTLResolver, it defaults to 1 minute.
+	TTL time.Duration
+	// RefreshDuration is the interval of refreshing all records, it
+	// defaults to 5 minutes.
+	RefreshDuration time.Duration
+	// Timeout limits each lookup, it defaults to 5 seconds.
+	Timeout time.Duration
+	// If IdleTimeout is greater than 0, the records of names not looked up
+	// for about one to two IdleTimeout are dropped, so that names looked up
+	// once are not refreshed forever. Otherwise they are kept until Close.
+	IdleTimeout time.Duration
+
+	// HostChangeHandler and SRVChangeHandler are called when the records
+	// of a name change, with copies of them.
+	HostChangeHandler func(host string, oldAddrs, newAddrs []string)
+	SRVChangeHandler  func(name string, oldAddrs, newAddrs []*net.SRV)
+	ErrorHandler      func(name string, err error)
+}
+
+// Cache caches DNS records.
+type Cache struct {
+	opt Options
+	c   asynccache.Cache
+}
+
+type srvRecords struct {
+	cname string
+	addrs []*net.SRV
+}
+
+const (
+	hostPrefix = "host:"
+	srvPrefix  = "srv:"
+)
+
+// New creates a Cache.
+func New(opt Options) *Cache {
+	if opt.Resolver == nil {
+		opt.Resolver = net.DefaultResolver
+	}
+	if opt.TTL <= 0 {
+		opt.TTL = time.Minute
+	}
+	if opt.RefreshDuration <= 0 {
+		opt.RefreshDuration = 5 * time.Minute
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 5 * time.Second
+	}
+	d := &Cache{opt: opt}
+	d.c = asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: opt.RefreshDuration,
+		EnableExpire:    opt.IdleTimeout > 0,
+		ExpireDuration:  opt.IdleTimeout,
+		Fetcher:         d.fetch,
+		IsSame: func(key string, oldData, newData interface{}) bool {
+			return reflect.DeepEqual(oldData, newData)
+		},
+		ChangeHandler: d.changed,
+		ErrorHandler: func(key string, err error) {
+			if opt.ErrorHandler != nil {
+				opt.ErrorHandler(name(key), err)
+			}
+		},
+	})
+	return d
+}
+
+// LookupHost is net.Resolver.LookupHost served from the cache. The
+// addresses returned are the caller's to modify.
+func (d *Cache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	val, err := d.c.Get(hostPrefix + host)
+	if err != nil {
+		return nil, d.lookupErr(hostPrefix+host, err)
+	}
+	return slices.Clone(val.([]string)), nil
+}
+
+// LookupSRV is net.Resolver.LookupSRV served from the cache. The records
+// returned are the caller's to modify.
+func (d *Cache) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	key := srvPrefix + service + "/" + proto + "/" + name
+	val, err := d.c.Get(key)
+	if err != nil {
+		return "", nil, d.lookupErr(key, err)
+	}
+	srv := val.(srvRecords)
+	return srv.cname, cloneSRV(srv.addrs), nil
+}
+
+// cloneSRV copies the cached records addrs, and the records they point to.
+func cloneSRV(addrs []*net.SRV) []*net.SRV {
+	if addrs == nil {
+		return nil
+	}
+	clone := make([]*net.SRV, len(addrs))
+	for i, addr := range addrs {
+		a := *addr
+		clone[i] = &a
+	}
+	return clone
+}
+
+// Close closes the underlying cache.
+func (d *Cache) Close() {
+	d.c.Close()
+}
+
+// lookupErr returns the error of the first lookup of key, which is not
+// cached so that the next lookup retries.
+func (d *Cache) lookupErr(key string, err error) error {
+	d.c.Delete(key)
+	if inner := errors.Unwrap(err); inner != nil {
+		return inner
+	}
+	return err
+}
+
+// fetch looks up the records of key, which are refreshed by SoftTTL after
+// their TTL, and never expire.
+func (d *Cache) fetch(key string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.opt.Timeout)
+	defer cancel()
+	var val interface{}
+	ttl := d.opt.TTL
+	var err error
+	if host, ok := strings.CutPrefix(key, hostPrefix); ok {
+		var addrs []string
+		if r, ok := d.opt.Resolver.(TTLResolver); ok {
+			addrs, ttl, err = r.LookupHostTTL(ctx, host)
+		} else {
+			addrs, err = d.opt.Resolver.LookupHost(ctx, host)
+		}
+		val = addrs
+	} else {
+		parts := strings.SplitN(strings.TrimPrefix(key, srvPrefix), "/", 3)
+		var srv srvRecords
+		if r, ok := d.opt.Resolver.(TTLResolver); ok {
+			srv.cname, srv.addrs, ttl, err = r.LookupSRVTTL(ctx, parts[0], parts[1], parts[2])
+		} else {
+			srv.cname, srv.addrs, err = d.opt.Resolver.LookupSRV(ctx, parts[0], parts[1], parts[2])
+		}
+		val = srv
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asynccache.WithTTL(val, max(ttl, time.Second), 0), nil
+}
+
+func (d *Cache) changed(key string, oldData, newData interface{}) {
+	if strings.HasPrefix(key, hostPrefix) {
+		if d.opt.HostChangeHandler != nil {
+			d.opt.HostChangeHandler(name(key), slices.Clone(oldData.([]string)), slices.Clone(newData.([]string)))
+		}
+		return
+	}
+	if d.opt.SRVChangeHandler != nil {
+		d.opt.SRVChangeHandler(name(key), cloneSRV(oldData.(srvRecords).addrs), cloneSRV(newData.(srvRecords).addrs))
+	}
+}
+
+// name returns the name looked up for key, the host or service/proto/name.
+func name(key string) string {
+	if host, ok := strings.CutPrefix(key, hostPrefix); ok {
+		return host
+	}
+	return strings.TrimPrefix(key, srvPrefix)
+}
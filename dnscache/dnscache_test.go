@@ -0,0 +1,123 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	hosts map[string][]string
+	fail  bool
+	calls int32
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.calls, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return nil, errors.New("server failure")
+	}
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "_" + service + "._" + proto + "." + name, []*net.SRV{{Target: "a." + name, Port: 80}}, nil
+}
+
+func (r *fakeResolver) set(host string, addrs []string, fail bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[host] = addrs
+	r.fail = fail
+}
+
+func TestCache(t *testing.T) {
+	r := &fakeResolver{hosts: map[string][]string{"a.example": {"10.0.0.1"}}}
+	changes := make(chan []string, 1)
+	d := New(Options{
+		Resolver: r,
+		TTL:      time.Second,
+		HostChangeHandler: func(host string, oldAddrs, newAddrs []string) {
+			changes <- newAddrs
+		},
+	})
+	defer d.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		addrs, err := d.LookupHost(ctx, "a.example")
+		if err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.1"}) {
+			t.Fatalf("LookupHost = %v, %v", addrs, err)
+		}
+	}
+	if n := atomic.LoadInt32(&r.calls); n != 1 {
+		t.Fatalf("%d lookups", n)
+	}
+	var dnsErr *net.DNSError
+	if _, err := d.LookupHost(ctx, "b.example"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("error = %v", err)
+	}
+
+	// the TTL passed, refreshed in background
+	r.set("a.example", []string{"10.0.0.2"}, false)
+	time.Sleep(1100 * time.Millisecond)
+	d.LookupHost(ctx, "a.example")
+	select {
+	case addrs := <-changes:
+		if !reflect.DeepEqual(addrs, []string{"10.0.0.2"}) {
+			t.Fatalf("changed to %v", addrs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change")
+	}
+
+	// stale on error
+	r.set("a.example", []string{"10.0.0.3"}, true)
+	time.Sleep(1100 * time.Millisecond)
+	d.LookupHost(ctx, "a.example")
+	time.Sleep(10 * time.Millisecond)
+	if addrs, err := d.LookupHost(ctx, "a.example"); err != nil || addrs[0] != "10.0.0.2" {
+		t.Fatalf("LookupHost = %v, %v", addrs, err)
+	}
+
+	cname, srvs, err := d.LookupSRV(ctx, "http", "tcp", "example")
+	if err != nil || cname != "_http._tcp.example" || srvs[0].Target != "a.example" {
+		t.Fatalf("LookupSRV = %v, %v, %v", cname, srvs, err)
+	}
+
+	// the records returned are copies
+	addrs, _ := d.LookupHost(ctx, "a.example")
+	addrs[0] = "modified"
+	srvs[0].Target = "modified"
+	if addrs, _ := d.LookupHost(ctx, "a.example"); addrs[0] != "10.0.0.2" {
+		t.Fatalf("LookupHost = %v", addrs)
+	}
+	if _, srvs, _ := d.LookupSRV(ctx, "http", "tcp", "example"); srvs[0].Target != "a.example" {
+		t.Fatalf("LookupSRV = %v", srvs)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	r := &fakeResolver{hosts: map[string][]string{"a.example": {"10.0.0.1"}}}
+	d := New(Options{Resolver: r, IdleTimeout: 20 * time.Millisecond})
+	defer d.Close()
+	ctx := context.Background()
+	d.LookupHost(ctx, "a.example")
+	time.Sleep(60 * time.Millisecond)
+	d.LookupHost(ctx, "a.example")
+	if n := atomic.LoadInt32(&r.calls); n != 2 {
+		t.Fatalf("%d lookups", n)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// Encryptor encrypts encoded values before they leave the process, e.g.
+// written to snapshots or remote tiers, so that the cached data is
+// encrypted at rest with a key managed by the user.
+type Encryptor interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// AESGCM is the Encryptor of AES-GCM, the random nonce is prepended to the ciphertext.
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM creates an AESGCM with the key of 16, 24 or 32 bytes.
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// Encrypt implements Encryptor.
+func (a *AESGCM) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(plaintext)+a.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt implements Encryptor.
+func (a *AESGCM) Decrypt(ciphertext []byte) ([]byte, error) {
+	n := a.aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, errors.New("asynccache: ciphertext too short")
+	}
+	return a.aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+}
+
+// EncryptedCodec returns a Codec encrypting the data of codec by enc.
+func EncryptedCodec(codec Codec, enc Encryptor) Codec {
+	return encryptedCodec{codec: codec, enc: enc}
+}
+
+type encryptedCodec struct {
+	codec Codec
+	enc   Encryptor
+}
+
+func (c encryptedCodec) Marshal(val interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	return c.enc.Encrypt(data)
+}
+
+func (c encryptedCodec) Unmarshal(data []byte) (interface{}, error) {
+	data, err := c.enc.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.codec.Unmarshal(data)
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptedCodec(t *testing.T) {
+	enc, err := NewAESGCM(bytes.Repeat([]byte("k"), 32))
+	Assert(t, err == nil)
+	codec := EncryptedCodec(StringCodec{}, enc)
+
+	data, err := codec.Marshal("secret")
+	Assert(t, err == nil && !bytes.Contains(data, []byte("secret")))
+	data2, _ := codec.Marshal("secret")
+	Assert(t, !bytes.Equal(data, data2))
+	val, err := codec.Unmarshal(data)
+	Assert(t, err == nil && val == "secret")
+
+	data[len(data)-1] ^= 1
+	_, err = codec.Unmarshal(data)
+	Assert(t, err != nil)
+	_, err = codec.Unmarshal([]byte("x"))
+	Assert(t, err != nil)
+
+	other, _ := NewAESGCM(bytes.Repeat([]byte("o"), 32))
+	_, err = EncryptedCodec(StringCodec{}, other).Unmarshal(data2)
+	Assert(t, err != nil)
+
+	_, err = NewAESGCM([]byte("short"))
+	Assert(t, err != nil)
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrClosed is returned by operations on a closed cache.
+	ErrClosed = errors.New("asynccache: cache is closed")
+	// ErrNoFetcher is returned when fetching without Fetcher set.
+	ErrNoFetcher = errors.New("asynccache: Fetcher is not set")
+	// ErrFetchTimeout is returned by GetWithTimeout, and reported to
+	// ErrorHandler by GetOrSetWithTimeout, when the first fetch of a key takes
+	// longer than the timeout.
+	ErrFetchTimeout = errors.New("asynccache: fetch timeout")
+	// ErrNotFound is returned by Get for keys not listed by KeyLister with MirrorKeys set.
+	ErrNotFound = errors.New("asynccache: key not found")
+	// ErrNotReady is returned by Get on misses with BackgroundFetch set.
+	ErrNotReady = errors.New("asynccache: value is not ready")
+	// ErrTooManyFetches is returned on misses when MaxConcurrentFetches fetches are running.
+	ErrTooManyFetches = errors.New("asynccache: too many concurrent fetches")
+	// ErrTypeMismatch is matched by errors.Is for TypeMismatchError.
+	ErrTypeMismatch = errors.New("asynccache: type mismatch")
+	// ErrNoWriter is returned by Put without Writer set.
+	ErrNoWriter = errors.New("asynccache: Writer is not set")
+	// ErrNoWriteBehind is returned by PutAsync without EnableWriteBehind set.
+	ErrNoWriteBehind = errors.New("asynccache: write-behind is not enabled")
+	// ErrNilValue is the fetch error of nil values with TreatNilAsError.
+	ErrNilValue = errors.New("asynccache: fetched nil value")
+	// ErrInvalidValue is matched by errors.Is for ValidationError.
+	ErrInvalidValue = errors.New("asynccache: invalid value")
+	// ErrNoQuorum is the fetch error of Quorum when no value is returned by
+	// more than half of Fetchers.
+	ErrNoQuorum = errors.New("asynccache: no quorum of fetchers")
+	// ErrInvalidEntry is the error of EventInvalidEntry.
+	ErrInvalidEntry = errors.New("asynccache: invalid entry")
+	// ErrLeased is returned by Lease when the key is leased already.
+	ErrLeased = errors.New("asynccache: key is leased")
+	// ErrLeaseExpired is returned by SetWithLease when the lease has expired
+	// or been taken over.
+	ErrLeaseExpired = errors.New("asynccache: lease expired")
+)
+
+// wrapErr annotates the error of the user function with the operation and key.
+func wrapErr(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("asynccache: %s %q: %w", op, key, err)
+}
+
+// TypeMismatchError is returned when a cached value is not of the expected type.
+type TypeMismatchError struct {
+	Key  string
+	Want reflect.Type
+	Got  reflect.Type
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("asynccache: type mismatch of %q: want %v, got %v", e.Key, e.Want, e.Got)
+}
+
+// Is reports whether target is ErrTypeMismatch.
+func (e *TypeMismatchError) Is(target error) bool {
+	return target == ErrTypeMismatch
+}
+
+// ValidationError is the fetch failure of a value rejected by Validator.
+type ValidationError struct {
+	Key string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("asynccache: invalid value of %q: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the error of Validator.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInvalidValue.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidValue
+}
@@ -0,0 +1,71 @@
+package cache
+
+import "time"
+
+// EventType is the type of Event.
+type EventType int
+
+const (
+	// EventMemoryHigh is emitted when the estimated size exceeds MemoryHighWatermark,
+	// before the emergency eviction starts.
+	EventMemoryHigh EventType = iota + 1
+	// EventEvicted is emitted for each entry evicted by the emergency eviction.
+	EventEvicted
+	// EventRefreshOverrun is emitted when a refresh cycle takes longer than
+	// RefreshDuration, or is stopped by RefreshCycleTimeout.
+	EventRefreshOverrun
+	// EventLoopRestarted is emitted when the watchdog restarts a dead
+	// background goroutine, whose name is the Key.
+	EventLoopRestarted
+	// EventStateChanged is emitted when a refresh or expire cycle changes the
+	// EntryState of the Key. Accesses and writes change states silently.
+	EventStateChanged
+	// EventInvalidEntry is emitted when an entry of a key other than string,
+	// or a value other than the internal entry, is found and deleted.
+	EventInvalidEntry
+)
+
+// String implements fmt.Stringer.
+func (t EventType) String() string {
+	switch t {
+	case EventMemoryHigh:
+		return "MemoryHigh"
+	case EventEvicted:
+		return "Evicted"
+	case EventRefreshOverrun:
+		return "RefreshOverrun"
+	case EventLoopRestarted:
+		return "LoopRestarted"
+	case EventStateChanged:
+		return "StateChanged"
+	case EventInvalidEntry:
+		return "InvalidEntry"
+	}
+	return "Unknown"
+}
+
+// Event is a notable occurrence in the cache, delivered to EventHandler.
+type Event struct {
+	Type EventType
+	// Key is empty for the events of the whole cache.
+	Key string
+	// Size is the estimated size in bytes, of the cache for EventMemoryHigh,
+	// or of the entry for EventEvicted.
+	Size int64
+	// Duration is the time taken by the refresh cycle for EventRefreshOverrun.
+	Duration time.Duration
+	// Count is the number of keys carried to the next cycle for EventRefreshOverrun.
+	Count int
+	// From and State are the previous and new states for EventStateChanged.
+	From  EntryState
+	State EntryState
+	// Err describes the entry for EventInvalidEntry.
+	Err error
+}
+
+// emit delivers the event to EventHandler.
+func (c *cache) emit(ev Event) {
+	if c.opt.EventHandler != nil {
+		c.dispatch(func() { c.opt.EventHandler(ev) })
+	}
+}
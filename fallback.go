@@ -0,0 +1,71 @@
+package cache
+
+import "time"
+
+// NewFallbackCache creates a Cache reading from secondary when primary fails,
+// e.g. an older snapshot-backed cache for critical configuration.
+//
+// Get and Acquire return the value of secondary if primary returns an
+// error, and the error of primary if both fail. GetOrSet returns the value of secondary
+// before falling back to the default value. Writes, deletes and other
+// methods go to primary only, and Close closes both.
+func NewFallbackCache(primary, secondary Cache) Cache {
+	return &fallbackCache{Cache: primary, secondary: secondary}
+}
+
+type fallbackCache struct {
+	Cache
+	secondary Cache
+}
+
+func (f *fallbackCache) Get(key string) (interface{}, error) {
+	val, err := f.Cache.Get(key)
+	if err == nil {
+		return val, nil
+	}
+	if v, err2 := f.secondary.Get(key); err2 == nil {
+		return v, nil
+	}
+	return val, err
+}
+
+func (f *fallbackCache) GetWithTimeout(key string, timeout time.Duration) (interface{}, error) {
+	val, err := f.Cache.GetWithTimeout(key, timeout)
+	if err == nil {
+		return val, nil
+	}
+	if v, err2 := f.secondary.Get(key); err2 == nil {
+		return v, nil
+	}
+	return val, err
+}
+
+func (f *fallbackCache) Acquire(key string) (Handle, error) {
+	h, err := f.Cache.Acquire(key)
+	if err == nil {
+		return h, nil
+	}
+	if h2, err2 := f.secondary.Acquire(key); err2 == nil {
+		return h2, nil
+	}
+	return h, err
+}
+
+func (f *fallbackCache) GetOrSet(key string, def interface{}) interface{} {
+	if val, err := f.Get(key); err == nil {
+		return val
+	}
+	return f.Cache.GetOrSet(key, def)
+}
+
+func (f *fallbackCache) GetOrSetWithTimeout(key string, def interface{}, timeout time.Duration) interface{} {
+	if val, err := f.Get(key); err == nil {
+		return val
+	}
+	return f.Cache.GetOrSetWithTimeout(key, def, timeout)
+}
+
+func (f *fallbackCache) Close() {
+	f.Cache.Close()
+	f.secondary.Close()
+}
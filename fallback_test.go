@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFallbackCache(t *testing.T) {
+	errPrimary := errors.New("primary")
+	primary := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "key" {
+				return "primary", nil
+			}
+			return nil, errPrimary
+		},
+	})
+	secondary := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "old" {
+				return "secondary", nil
+			}
+			return nil, errors.New("secondary")
+		},
+	})
+	c := NewFallbackCache(primary, secondary)
+
+	v, err := c.Get("key")
+	Assert(t, err == nil && v.(string) == "primary")
+	v, err = c.Get("old")
+	Assert(t, err == nil && v.(string) == "secondary")
+	_, err = c.Get("none")
+	Assert(t, errors.Is(err, errPrimary))
+
+	Assert(t, c.GetOrSet("old", "def").(string) == "secondary")
+	Assert(t, c.GetOrSet("none", "def").(string) == "def")
+
+	c.Close()
+	Assert(t, primary.IsClosed() && secondary.IsClosed())
+}
@@ -0,0 +1,74 @@
+// Package filesource provides helpers for caching files, such as config or
+// secret files mounted by Kubernetes, with asynccache.
+//
+// The key of the cache is the path of the file. Changes are delivered to
+// Watch, typically forwarded from an fsnotify watcher:
+//
+//	events := make(chan filesource.Event)
+//	go func() {
+//		for e := range w.Events {
+//			events <- filesource.Event{Name: e.Name}
+//		}
+//		close(events)
+//	}()
+//	go filesource.Watch(c, events)
+package filesource
+
+import (
+	"os"
+	"path/filepath"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Decoder decodes the content of a file into the cached value.
+type Decoder func(data []byte) (interface{}, error)
+
+// Fetcher returns a Fetcher reading the file named by the key.
+// If decode is nil, the content is cached as []byte.
+func Fetcher(decode Decoder) func(key string) (interface{}, error) {
+	return func(key string) (interface{}, error) {
+		data, err := os.ReadFile(key)
+		if err != nil {
+			return nil, err
+		}
+		if decode == nil {
+			return data, nil
+		}
+		return decode(data)
+	}
+}
+
+// Event is a file system notification of the file or directory Name.
+type Event struct {
+	Name string
+}
+
+// Watch refreshes cached files as events arrive until events is closed.
+//
+// Kubernetes updates mounted volumes by swapping a symlink in the mounted
+// directory, so an event refreshes every cached file in the directory of
+// Name as well as Name itself.
+func Watch(c asynccache.Cache, events <-chan Event) {
+	for e := range events {
+		Notify(c, e)
+	}
+}
+
+// Notify refreshes cached files affected by a single event.
+func Notify(c asynccache.Cache, e Event) {
+	name := filepath.Clean(e.Name)
+	dir := filepath.Dir(name)
+	// the keys are collected first, so that refreshes do not run within the range
+	var keys []string
+	c.RangeEntries(func(key string, _ interface{}, _ asynccache.EntryInfo) bool {
+		path := filepath.Clean(key)
+		if path == name || filepath.Dir(path) == dir || filepath.Dir(path) == name {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		c.Refresh(key)
+	}
+}
@@ -0,0 +1,50 @@
+package filesource
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(" v1 "), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: Fetcher(func(data []byte) (interface{}, error) {
+			return strings.TrimSpace(string(data)), nil
+		}),
+	})
+	v, err := c.Get(path)
+	if err != nil || v.(string) != "v1" {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+
+	if err = os.WriteFile(path, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan Event, 1)
+	events <- Event{Name: filepath.Join(dir, "..data")}
+	close(events)
+	Watch(c, events)
+
+	v, err = c.Get(path)
+	if err != nil || v.(string) != "v2" {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+}
+
+func TestFetcherMissing(t *testing.T) {
+	if _, err := Fetcher(nil)(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing file should fail")
+	}
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+)
+
+// result returns the current result of e, or nil if none is stored.
+func (e *entry) result() *result {
+	res, _ := e.res.Load().(*result)
+	return res
+}
+
+// acquire takes a reference to the value of res, it fails once the value is
+// finalized.
+func (c *cache) acquire(res *result) bool {
+	if res == nil {
+		return false
+	}
+	for {
+		n := atomic.LoadInt32(&res.refs)
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&res.refs, n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference to the value of res, and finalizes the value
+// once no reference is left.
+func (c *cache) release(res *result) {
+	if res != nil && atomic.AddInt32(&res.refs, -1) == 0 {
+		c.finalize(res.val)
+	}
+}
+
+// disown drops the reference of the cache to the value of res once it is
+// replaced or deleted.
+func (c *cache) disown(res *result) {
+	if res != nil && atomic.CompareAndSwapInt32(&res.owned, 1, 0) {
+		c.release(res)
+	}
+}
+
+// finalize calls Finalizer with val, or closes val if Finalizer is nil and
+// val is an io.Closer.
+func (c *cache) finalize(val interface{}) {
+	if val == nil {
+		return
+	}
+	if _, ok := val.(*compressed); ok {
+		return
+	}
+	if c.opt.Finalizer != nil {
+		c.opt.Finalizer(val)
+		return
+	}
+	if cl, ok := val.(io.Closer); ok {
+		if err := cl.Close(); err != nil {
+			c.opt.ErrLogFunc(fmt.Sprintf("asynccache: close %T: %v", val, err))
+		}
+	}
+}
+
+// sameValue reports whether a and b are the same comparable value, which is
+// finalized only once.
+func sameValue(a, b interface{}) bool {
+	ta := reflect.TypeOf(a)
+	if ta == nil || ta != reflect.TypeOf(b) || !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// removed accounts the deleted entry to its tenant, calls DeleteHandler
+// unless reason is 0, and finalizes the value once DeleteHandler returns.
+func (c *cache) removed(key string, e *entry, reason DeleteReason) {
+	atomic.StoreInt32(&e.dead, 1)
+	c.unscheduleExpiry(e)
+	c.index.deleted()
+	if e.tenant != nil {
+		atomic.AddInt64(&e.tenant.entries, -1)
+	}
+	res := e.result()
+	if reason != 0 && c.opt.DeleteHandler != nil {
+		held := c.acquire(res)
+		val, _ := e.Load()
+		if !c.dispatch(func() {
+			c.opt.DeleteHandler(key, val, reason)
+			if held {
+				c.release(res)
+			}
+		}) && held {
+			c.release(res)
+		}
+	}
+	c.disown(res)
+}
+
+// changed calls ChangeHandler, and finalizes the old value of e once it
+// returns. It must be called before the new value is stored.
+func (c *cache) changed(key string, e *entry, oldVal, newVal interface{}) {
+	if c.opt.ChangeHandler == nil {
+		return
+	}
+	res := e.result()
+	held := c.acquire(res)
+	if !c.dispatch(func() {
+		c.opt.ChangeHandler(key, oldVal, newVal)
+		if held {
+			c.release(res)
+		}
+	}) && held {
+		c.release(res)
+	}
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCloser struct {
+	closed int32
+}
+
+func (c *testCloser) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *testCloser) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func TestCloser(t *testing.T) {
+	release := make(chan struct{})
+	c := NewCache(Options{
+		DeleteHandler: func(key string, oldData interface{}, reason DeleteReason) {
+			Assert(t, !oldData.(*testCloser).isClosed())
+			<-release
+		},
+	})
+	defer c.Close()
+
+	a, b := &testCloser{}, &testCloser{}
+	c.Set("k", a)
+	c.Set("k", a)
+	Assert(t, !a.isClosed())
+	c.Set("k", b)
+	Assert(t, a.isClosed())
+
+	c.Delete("k")
+	time.Sleep(10 * time.Millisecond)
+	Assert(t, !b.isClosed())
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	Assert(t, b.isClosed())
+	Assert(t, atomic.LoadInt32(&a.closed) == 1)
+}
+
+func TestFinalizer(t *testing.T) {
+	finalized := make(chan interface{}, 3)
+	c := NewCache(Options{
+		Finalizer: func(val interface{}) {
+			finalized <- val
+		},
+	})
+	defer c.Close()
+	closer := &testCloser{}
+	c.Set("a", closer)
+	c.Set("b", 2)
+	c.ReplaceAll(map[string]interface{}{"a": 1, "b": 2})
+	Assert(t, <-finalized == closer)
+	Assert(t, !closer.isClosed())
+	c.Delete("b")
+	Assert(t, <-finalized == 2)
+	Assert(t, len(finalized) == 0)
+}
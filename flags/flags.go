@@ -0,0 +1,167 @@
+// Package flags provides a feature flag client built on asynccache.
+//
+// The flag document is fetched as a whole, refreshed in background, and
+// read by typed accessors falling back to defaults, so that flag lookups
+// never wait for the flag service after the first one.
+package flags
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// docKey is the key of the flag document in the cache.
+const docKey = "flags"
+
+// Options controls the behavior of Client.
+type Options struct {
+	// Fetcher returns the flag document, which maps flag names to values,
+	// e.g. decoded from JSON. It MUST be set.
+	Fetcher func() (map[string]interface{}, error)
+	// RefreshDuration defaults to 30 seconds.
+	RefreshDuration time.Duration
+
+	ErrorHandler func(err error)
+}
+
+// Client reads feature flags.
+type Client struct {
+	c    asynccache.Cache
+	mu   sync.Mutex
+	subs map[string][]*subscription
+}
+
+type subscription struct {
+	fn func(oldVal, newVal interface{})
+}
+
+// New creates a Client.
+func New(opt Options) *Client {
+	if opt.Fetcher == nil {
+		panic("flags: Fetcher MUST be set")
+	}
+	if opt.RefreshDuration <= 0 {
+		opt.RefreshDuration = 30 * time.Second
+	}
+	f := &Client{subs: make(map[string][]*subscription)}
+	f.c = asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: opt.RefreshDuration,
+		Fetcher: func(string) (interface{}, error) {
+			return opt.Fetcher()
+		},
+		IsSame: func(key string, oldData, newData interface{}) bool {
+			return reflect.DeepEqual(oldData, newData)
+		},
+		ChangeHandler: func(key string, oldData, newData interface{}) {
+			old, _ := oldData.(map[string]interface{})
+			f.changed(old, newData.(map[string]interface{}))
+		},
+		ErrorHandler: func(key string, err error) {
+			if opt.ErrorHandler != nil {
+				opt.ErrorHandler(err)
+			}
+		},
+	})
+	return f
+}
+
+// Value returns the value of the flag, and false if it is not set or the
+// flag document is not fetched.
+func (f *Client) Value(name string) (interface{}, bool) {
+	doc, err := f.c.Get(docKey)
+	if err != nil {
+		return nil, false
+	}
+	val, ok := doc.(map[string]interface{})[name]
+	return val, ok
+}
+
+// BoolFlag returns the flag as a bool, or def if it is not a bool.
+func (f *Client) BoolFlag(name string, def bool) bool {
+	if v, ok := f.Value(name); ok {
+		if b, ok := v.(bool); ok {
+			return b
+		}
+	}
+	return def
+}
+
+// IntFlag returns the flag as an int, or def if it is not an integer.
+func (f *Client) IntFlag(name string, def int) int {
+	v, _ := f.Value(name)
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		if n == math.Trunc(n) {
+			return int(n)
+		}
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return int(i)
+		}
+	}
+	return def
+}
+
+// StringFlag returns the flag as a string, or def if it is not a string.
+func (f *Client) StringFlag(name string, def string) string {
+	if v, ok := f.Value(name); ok {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return def
+}
+
+// Subscribe calls fn with the old and new values of the flag when a refresh
+// changes it, a nil value is unset. It returns the function unsubscribing.
+func (f *Client) Subscribe(name string, fn func(oldVal, newVal interface{})) (unsubscribe func()) {
+	s := &subscription{fn: fn}
+	f.mu.Lock()
+	f.subs[name] = append(f.subs[name], s)
+	f.mu.Unlock()
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		subs := f.subs[name]
+		for i := range subs {
+			if subs[i] == s {
+				f.subs[name] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Close closes the underlying cache.
+func (f *Client) Close() {
+	f.c.Close()
+}
+
+// changed notifies the subscribers of the flags changed between the documents.
+func (f *Client) changed(oldDoc, newDoc map[string]interface{}) {
+	f.mu.Lock()
+	var calls []func()
+	for name, subs := range f.subs {
+		oldVal, newVal := oldDoc[name], newDoc[name]
+		if reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+		for _, s := range subs {
+			calls = append(calls, func() { s.fn(oldVal, newVal) })
+		}
+	}
+	f.mu.Unlock()
+	for _, call := range calls {
+		call()
+	}
+}
@@ -0,0 +1,68 @@
+package flags
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	var doc atomic.Value
+	doc.Store(`{"dark_mode": true, "limit": 10, "banner": "hello", "ratio": 0.5}`)
+	var fail atomic.Bool
+	f := New(Options{
+		Fetcher: func() (map[string]interface{}, error) {
+			if fail.Load() {
+				return nil, errors.New("unavailable")
+			}
+			var m map[string]interface{}
+			err := json.Unmarshal([]byte(doc.Load().(string)), &m)
+			return m, err
+		},
+		RefreshDuration: 20 * time.Millisecond,
+	})
+	defer f.Close()
+
+	if !f.BoolFlag("dark_mode", false) || f.IntFlag("limit", 0) != 10 || f.StringFlag("banner", "") != "hello" {
+		t.Fatal("wrong flags")
+	}
+	if f.IntFlag("ratio", 1) != 1 || f.StringFlag("limit", "def") != "def" || f.BoolFlag("missing", true) != true {
+		t.Fatal("defaults are not used")
+	}
+
+	changes := make(chan [2]interface{}, 4)
+	unsubscribe := f.Subscribe("limit", func(oldVal, newVal interface{}) {
+		changes <- [2]interface{}{oldVal, newVal}
+	})
+	f.Subscribe("banner", func(oldVal, newVal interface{}) {
+		t.Error("banner is not changed")
+	})
+	doc.Store(`{"dark_mode": true, "limit": 20, "banner": "hello"}`)
+	select {
+	case c := <-changes:
+		if c[0] != 10.0 || c[1] != 20.0 {
+			t.Fatalf("changed %v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change")
+	}
+	if f.IntFlag("limit", 0) != 20 {
+		t.Fatal("not refreshed")
+	}
+
+	unsubscribe()
+	doc.Store(`{"dark_mode": true, "banner": "hello"}`)
+	time.Sleep(60 * time.Millisecond)
+	if len(changes) != 0 {
+		t.Fatal("notified after unsubscribed")
+	}
+
+	// the last document keeps serving
+	fail.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if !f.BoolFlag("dark_mode", false) {
+		t.Fatal("stale flags are not served")
+	}
+}
@@ -0,0 +1,69 @@
+package cache
+
+import "time"
+
+// follower applies the changes of Leader until the cache is closed.
+func (c *cache) follower() {
+	ticker := time.NewTicker(c.opt.FollowInterval)
+	defer ticker.Stop()
+	var seq uint64
+	for {
+		seq = c.follow(seq)
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// follow applies the changes of Leader since seq, and returns the last applied seq.
+func (c *cache) follow(seq uint64) uint64 {
+	recs := c.opt.Leader.Changes(seq)
+	var reset map[string]bool
+	for _, rec := range recs {
+		switch rec.Op {
+		case ChangeReset:
+			reset = make(map[string]bool)
+		case ChangeSet:
+			c.apply(rec)
+			if reset != nil {
+				reset[rec.Key] = true
+			}
+		case ChangeDelete:
+			c.Delete(rec.Key)
+		}
+		seq = rec.Seq
+	}
+	if reset != nil {
+		c.DeleteIf(func(key string) bool {
+			return !reset[key]
+		})
+	}
+	return seq
+}
+
+// apply sets the value and error of a ChangeSet replicated from Leader, to
+// expire as it does on Leader.
+func (c *cache) apply(rec ChangeRecord) {
+	key, val, err := rec.Key, rec.Value, rec.Err
+	var t *ttl
+	if rec.Lifetime != (Lifetime{}) {
+		_, t = c.unwrapTTL(WithLifetime(val, rec.Lifetime))
+	}
+	ety := c.newEntry()
+	ety.storeTTL(val, err, t)
+	e, exist, _ := c.loadOrStore(key, ety)
+	if !exist {
+		return
+	}
+	c.freeEntry(ety)
+	e.mu.Lock()
+	if err != nil {
+		e.storeTTL(val, err, t)
+		c.logChange(key)
+	} else {
+		c.update(key, e, val, t)
+	}
+	e.mu.Unlock()
+}
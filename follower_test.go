@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFollower(t *testing.T) {
+	leader := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("error")
+			}
+			return "leader-" + key, nil
+		},
+		ChangeLogSize: 3,
+	})
+	defer leader.Close()
+	leader.Set("a", 1)
+	leader.Set("b", 2)
+
+	follower := NewCache(Options{
+		Leader:         leader,
+		FollowInterval: 10 * time.Millisecond,
+	})
+	defer follower.Close()
+	time.Sleep(30 * time.Millisecond)
+	DeepEqual(t, follower.Dump(), map[string]interface{}{"a": 1, "b": 2})
+
+	leader.Set("a", 3)
+	leader.Delete("b")
+	leader.Get("bad")
+	time.Sleep(30 * time.Millisecond)
+	DeepEqual(t, follower.Errors()["bad"], leader.Errors()["bad"])
+	val, _ := follower.Get("a")
+	Assert(t, val == 3)
+
+	// misses are fetched from the leader
+	val, err := follower.Get("c")
+	Assert(t, err == nil && val == "leader-c")
+
+	// the follower falls behind the change log, and is reset
+	follower.Close()
+	f2 := NewCache(Options{Leader: leader, FollowInterval: time.Hour}).(*cache)
+	defer f2.Close()
+	seq := f2.follow(0)
+	f2.Set("stale", 1)
+	for _, key := range []string{"d", "e", "f", "g"} {
+		leader.Set(key, key)
+	}
+	f2.follow(seq)
+	_, ok := f2.Dump()["stale"]
+	Assert(t, !ok)
+	Assert(t, len(f2.Dump()) == len(leader.Dump()))
+}
+
+// restartedLeader is a Leader replaced by restart.
+type restartedLeader struct {
+	mu sync.Mutex
+	Cache
+}
+
+func (l *restartedLeader) Changes(sinceSeq uint64) []ChangeRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Cache.Changes(sinceSeq)
+}
+
+func (l *restartedLeader) restart(c Cache) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Cache.Close()
+	l.Cache = c
+}
+
+func TestFollowerLeaderRestart(t *testing.T) {
+	leader := &restartedLeader{Cache: NewCache(Options{ChangeLogSize: 8})}
+	for _, key := range []string{"a", "b", "c"} {
+		leader.Set(key, key)
+	}
+	f := NewCache(Options{Leader: leader, FollowInterval: time.Hour}).(*cache)
+	defer f.Close()
+	seq := f.follow(0)
+	Assert(t, seq == 3)
+
+	// the restarted leader logs fewer changes than the follower applied
+	restarted := NewCache(Options{ChangeLogSize: 8})
+	defer restarted.Close()
+	restarted.Set("d", "d")
+	leader.restart(restarted)
+	seq = f.follow(seq)
+	Assert(t, seq == 1)
+	DeepEqual(t, f.Dump(), map[string]interface{}{"d": "d"})
+}
+
+func TestFollowerLifetime(t *testing.T) {
+	leader := NewCache(Options{ChangeLogSize: 8, HardTTL: time.Hour})
+	defer leader.Close()
+	leader.Set("a", 1)
+	leader.Set("b", WithTTL(2, 0, 20*time.Millisecond))
+	f := NewCache(Options{Leader: leader, FollowInterval: time.Hour}).(*cache)
+	defer f.Close()
+	f.follow(0)
+	DeepEqual(t, f.Snapshot().Lifetime("a"), leader.Snapshot().Lifetime("a"))
+	DeepEqual(t, f.Snapshot().Lifetime("b"), leader.Snapshot().Lifetime("b"))
+
+	time.Sleep(30 * time.Millisecond)
+	_, err := f.Get("b")
+	Assert(t, err != nil)
+}
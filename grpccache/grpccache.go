@@ -0,0 +1,231 @@
+// Package grpccache serves the responses of idempotent unary gRPC calls from
+// an asynccache, keyed by the method and the serialized request, and
+// refreshes them in background.
+//
+// The package does not depend on gRPC. Callers adapt Interceptor.Intercept
+// to a grpc.UnaryClientInterceptor, e.g.
+//
+//	ic := grpccache.New(grpccache.Options{
+//		Methods: map[string]time.Duration{"/users.Users/Get": time.Minute},
+//		Codec:   encoding.GetCodec("proto"),
+//		Cache:   asynccache.Options{EnableRefresh: true, RefreshDuration: 10 * time.Second},
+//	})
+//	conn, err := grpc.Dial(target, grpc.WithUnaryInterceptor(func(ctx context.Context, method string,
+//		req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+//		return ic.Intercept(ctx, method, req, reply, func(ctx context.Context, req, reply any) error {
+//			return invoker(ctx, method, req, reply, cc, opts...)
+//		})
+//	}))
+//
+// The response of a key is fetched and refreshed by the Invoker of its first
+// call, with the context returned by Options.FetchContext rather than the
+// context of the call, which is not retained. Options.Timeout limits the
+// calls. The responses are shared by all callers, so only the methods whose
+// responses do not depend on the caller may be cached, unless
+// Options.Partition keys them by the caller, e.g. by an allowlisted set of
+// metadata:
+//
+//	Partition: func(ctx context.Context) string {
+//		md, _ := metadata.FromOutgoingContext(ctx)
+//		return strings.Join(md.Get("tenant"), ",")
+//	},
+//	FetchContext: func(ctx context.Context) context.Context {
+//		md, _ := metadata.FromOutgoingContext(ctx)
+//		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("tenant", strings.Join(md.Get("tenant"), ",")))
+//	},
+package grpccache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Codec serializes requests and responses, such as the "proto" codec of
+// google.golang.org/grpc/encoding.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Invoker calls the RPC intercepted with ctx and req, and stores the
+// response in reply.
+type Invoker func(ctx context.Context, req, reply interface{}) error
+
+// Options controls the behavior of Interceptor.
+type Options struct {
+	// Methods maps the full names of the methods to cache, such as
+	// "/users.Users/Get", to the TTLs of their responses, 0 for the HardTTL
+	// of Cache. Calls of other methods are passed through.
+	Methods map[string]time.Duration
+	// Codec MUST be set.
+	Codec Codec
+	// Timeout limits the calls of fetches and refreshes, it defaults to 10
+	// seconds.
+	Timeout time.Duration
+	// Partition returns the part of the key of the calls by their context,
+	// such as the values of an allowlisted set of their metadata, so that
+	// the responses are not shared by the calls of different partitions.
+	Partition func(ctx context.Context) string
+	// FetchContext returns the context the response of a key is fetched and
+	// refreshed with by the context of its first call, e.g. with the
+	// metadata of Partition. It is called once per key, and the returned
+	// context is kept with the key, so it should not hold credentials of
+	// the caller the other calls of the partition must not use. It defaults
+	// to context.Background().
+	FetchContext func(ctx context.Context) context.Context
+	// Cache is the options of the cache of responses. Its Fetcher is set by
+	// New, and its DeleteHandler is wrapped.
+	Cache asynccache.Options
+}
+
+// Interceptor caches the responses of unary calls.
+type Interceptor struct {
+	opt   Options
+	c     asynccache.Cache
+	calls sync.Map // key -> *call
+}
+
+// call is how the response of a key is fetched.
+type call struct {
+	ctx     context.Context
+	method  string
+	req     []byte
+	reqTyp  reflect.Type
+	respTyp reflect.Type
+	invoke  Invoker
+}
+
+// New creates an Interceptor.
+func New(opt Options) *Interceptor {
+	if opt.Codec == nil {
+		panic("grpccache: Codec MUST be set")
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 10 * time.Second
+	}
+	i := &Interceptor{opt: opt}
+	copt := opt.Cache
+	copt.Fetcher = i.fetch
+	onDelete := copt.DeleteHandler
+	copt.DeleteHandler = func(key string, oldData interface{}, reason asynccache.DeleteReason) {
+		i.calls.Delete(key)
+		if onDelete != nil {
+			onDelete(key, oldData, reason)
+		}
+	}
+	i.c = asynccache.NewCache(copt)
+	return i
+}
+
+// Cache returns the cache of responses.
+func (i *Interceptor) Cache() asynccache.Cache {
+	return i.c
+}
+
+// Close closes the cache of responses.
+func (i *Interceptor) Close() {
+	i.c.Close()
+}
+
+// Intercept serves the call of method with req from the cache if method is
+// cached, and otherwise by invoke. Failures are returned as they are, and
+// not cached. A call waiting for the fetch of a miss returns the error of
+// ctx once it is canceled or its deadline passes, and the fetch goes on.
+func (i *Interceptor) Intercept(ctx context.Context, method string, req, reply interface{}, invoke Invoker) error {
+	if _, ok := i.opt.Methods[method]; !ok {
+		return invoke(ctx, req, reply)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := i.opt.Codec.Marshal(req)
+	if err != nil {
+		return invoke(ctx, req, reply)
+	}
+	var partition string
+	if i.opt.Partition != nil {
+		partition = i.opt.Partition(ctx)
+	}
+	key := asynccache.K(method, partition, data)
+	if _, ok := i.calls.Load(key); !ok {
+		fetchCtx := context.Background()
+		if i.opt.FetchContext != nil {
+			fetchCtx = i.opt.FetchContext(ctx)
+		}
+		i.calls.LoadOrStore(key, &call{
+			ctx:     fetchCtx,
+			method:  method,
+			req:     data,
+			reqTyp:  reflect.TypeOf(req).Elem(),
+			respTyp: reflect.TypeOf(reply).Elem(),
+			invoke:  invoke,
+		})
+	}
+	val, err := i.get(ctx, key)
+	if err != nil {
+		if err == ctx.Err() {
+			return err
+		}
+		i.c.Delete(key)
+		if inner := errors.Unwrap(err); inner != nil {
+			return inner
+		}
+		return err
+	}
+	return i.opt.Codec.Unmarshal(val.([]byte), reply)
+}
+
+// get gets the response of key, or the error of ctx once it is done first.
+func (i *Interceptor) get(ctx context.Context, key string) (interface{}, error) {
+	if ctx.Done() == nil {
+		return i.c.Get(key)
+	}
+	type result struct {
+		val interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := i.c.Get(key)
+		done <- result{val, err}
+	}()
+	select {
+	case r := <-done:
+		return r.val, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch calls the RPC of key, and returns the serialized response.
+func (i *Interceptor) fetch(key string) (interface{}, error) {
+	v, ok := i.calls.Load(key)
+	if !ok {
+		return nil, asynccache.ErrNotFound
+	}
+	cl := v.(*call)
+	// the request is decoded again, the caller may reuse its own
+	req := reflect.New(cl.reqTyp).Interface()
+	if err := i.opt.Codec.Unmarshal(cl.req, req); err != nil {
+		return nil, err
+	}
+	reply := reflect.New(cl.respTyp).Interface()
+	ctx, cancel := context.WithTimeout(cl.ctx, i.opt.Timeout)
+	defer cancel()
+	if err := cl.invoke(ctx, req, reply); err != nil {
+		return nil, err
+	}
+	resp, err := i.opt.Codec.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	if ttl := i.opt.Methods[cl.method]; ttl > 0 {
+		return asynccache.WithTTL(resp, i.opt.Cache.SoftTTL, ttl), nil
+	}
+	return resp, nil
+}
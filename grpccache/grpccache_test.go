@@ -0,0 +1,163 @@
+package grpccache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type getReq struct{ ID int }
+
+type getResp struct{ Name string }
+
+type ctxKey struct{}
+
+func TestInterceptor(t *testing.T) {
+	var calls int32
+	var suffix atomic.Value
+	suffix.Store("")
+	server := func(ctx context.Context, req, reply interface{}) error {
+		atomic.AddInt32(&calls, 1)
+		if ctx.Value(ctxKey{}) != "md" {
+			return errors.New("no metadata")
+		}
+		id := req.(*getReq).ID
+		if id < 0 {
+			return errors.New("invalid id")
+		}
+		reply.(*getResp).Name = "user" + string(rune('0'+id)) + suffix.Load().(string)
+		return nil
+	}
+	ic := New(Options{
+		Methods: map[string]time.Duration{"/users.Users/Get": time.Hour},
+		Codec:   jsonCodec{},
+		FetchContext: func(ctx context.Context) context.Context {
+			return context.WithValue(context.Background(), ctxKey{}, ctx.Value(ctxKey{}))
+		},
+		Cache: asynccache.Options{EnableRefresh: true, RefreshDuration: 20 * time.Millisecond},
+	})
+	defer ic.Close()
+	call := func(method string, id int) (string, error) {
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "md"))
+		defer cancel()
+		var resp getResp
+		err := ic.Intercept(ctx, method, &getReq{ID: id}, &resp, server)
+		return resp.Name, err
+	}
+
+	for i := 0; i < 3; i++ {
+		name, err := call("/users.Users/Get", 1)
+		if err != nil || name != "user1" {
+			t.Fatalf("Get = %q, %v", name, err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("%d calls", n)
+	}
+	if _, err := call("/users.Users/Get", -1); err == nil || err.Error() != "invalid id" {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := call("/users.Users/Get", -1); err == nil {
+		t.Fatal("the error is cached")
+	}
+	if len(ic.Cache().Errors()) != 0 {
+		t.Fatal("the error is cached")
+	}
+
+	// not cached
+	atomic.StoreInt32(&calls, 0)
+	call("/users.Users/Update", 1)
+	call("/users.Users/Update", 1)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("%d calls", n)
+	}
+
+	// refreshed with the context of FetchContext after the call returned
+	suffix.Store("!")
+	time.Sleep(60 * time.Millisecond)
+	if name, _ := call("/users.Users/Get", 1); name != "user1!" {
+		t.Fatalf("Get = %q", name)
+	}
+}
+
+func TestInterceptorPartition(t *testing.T) {
+	server := func(ctx context.Context, req, reply interface{}) error {
+		reply.(*getResp).Name, _ = ctx.Value(ctxKey{}).(string)
+		return nil
+	}
+	ic := New(Options{
+		Methods: map[string]time.Duration{"/users.Users/Get": time.Hour},
+		Codec:   jsonCodec{},
+		Partition: func(ctx context.Context) string {
+			v, _ := ctx.Value(ctxKey{}).(string)
+			return v
+		},
+		FetchContext: func(ctx context.Context) context.Context {
+			return context.WithValue(context.Background(), ctxKey{}, ctx.Value(ctxKey{}))
+		},
+	})
+	defer ic.Close()
+	for i := 0; i < 2; i++ {
+		for _, tenant := range []string{"a", "b"} {
+			var resp getResp
+			ctx := context.WithValue(context.Background(), ctxKey{}, tenant)
+			if err := ic.Intercept(ctx, "/users.Users/Get", &getReq{ID: 1}, &resp, server); err != nil || resp.Name != tenant {
+				t.Fatalf("Get of %s = %q, %v", tenant, resp.Name, err)
+			}
+		}
+	}
+
+	// without FetchContext the context of the caller is not used
+	ic2 := New(Options{
+		Methods: map[string]time.Duration{"/users.Users/Get": time.Hour},
+		Codec:   jsonCodec{},
+	})
+	defer ic2.Close()
+	var resp getResp
+	ctx := context.WithValue(context.Background(), ctxKey{}, "secret")
+	if err := ic2.Intercept(ctx, "/users.Users/Get", &getReq{ID: 1}, &resp, server); err != nil || resp.Name != "" {
+		t.Fatalf("Get = %q, %v", resp.Name, err)
+	}
+}
+
+func TestInterceptorDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := func(ctx context.Context, req, reply interface{}) error {
+		<-release
+		reply.(*getResp).Name = "slow"
+		return nil
+	}
+	ic := New(Options{
+		Methods: map[string]time.Duration{"/users.Users/Get": time.Hour},
+		Codec:   jsonCodec{},
+	})
+	defer ic.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var resp getResp
+	if err := ic.Intercept(ctx, "/users.Users/Get", &getReq{ID: 1}, &resp, server); err != context.DeadlineExceeded {
+		t.Fatalf("error = %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := ic.Intercept(ctx, "/users.Users/Get", &getReq{ID: 1}, &resp, server); err != context.Canceled {
+		t.Fatalf("error = %v", err)
+	}
+
+	// the fetch goes on, and serves the later calls
+	close(release)
+	if err := ic.Intercept(context.Background(), "/users.Users/Get", &getReq{ID: 1}, &resp, server); err != nil || resp.Name != "slow" {
+		t.Fatalf("Get = %q, %v", resp.Name, err)
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import "sync/atomic"
+
+// Handle is a reference to a cached value returned by Acquire. The value is
+// not finalized before Release, even if it is replaced or deleted meanwhile.
+type Handle interface {
+	// Value returns the referenced value, it MUST not be used after Release.
+	Value() interface{}
+	// Release drops the reference, calls after the first do nothing.
+	Release()
+}
+
+// NewHandle returns a Handle of val whose Release does nothing, for Cache
+// implementations not finalizing values.
+func NewHandle(val interface{}) Handle {
+	return valueHandle{val: val}
+}
+
+type valueHandle struct {
+	val interface{}
+}
+
+func (h valueHandle) Value() interface{} { return h.val }
+func (h valueHandle) Release()           {}
+
+type handle struct {
+	c        *cache
+	res      *result
+	released int32
+}
+
+func (h *handle) Value() interface{} {
+	if cv, ok := h.res.val.(*compressed); ok {
+		val, _ := h.c.cz.decompress(cv)
+		return val
+	}
+	return h.res.val
+}
+
+func (h *handle) Release() {
+	if atomic.CompareAndSwapInt32(&h.released, 0, 1) {
+		h.c.release(h.res)
+	}
+}
+
+// Acquire gets the value of key as Get does, and returns a Handle holding it.
+func (c *cache) Acquire(key string) (Handle, error) {
+	for {
+		val, err := c.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := c.data().Load(c.key(key))
+		if !ok {
+			// not cached, e.g. over TenantQuota.
+			return NewHandle(val), nil
+		}
+		res := v.(*entry).result()
+		if res != nil && res.err == nil && c.acquire(res) {
+			return &handle{c: c, res: res}, nil
+		}
+	}
+}
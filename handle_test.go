@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	c := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("bad")
+			}
+			return &testCloser{}, nil
+		},
+	})
+	defer c.Close()
+
+	h, err := c.Acquire("a")
+	Assert(t, err == nil)
+	a := h.Value().(*testCloser)
+	h2, _ := c.Acquire("a")
+	Assert(t, h2.Value() == a)
+
+	c.Set("a", &testCloser{})
+	Assert(t, !a.isClosed())
+	h.Release()
+	h.Release()
+	Assert(t, !a.isClosed())
+	h2.Release()
+	Assert(t, a.isClosed())
+
+	h, _ = c.Acquire("a")
+	b := h.Value().(*testCloser)
+	c.Delete("a")
+	Assert(t, !b.isClosed())
+	h.Release()
+	Assert(t, b.isClosed())
+
+	_, err = c.Acquire("bad")
+	Assert(t, err != nil)
+}
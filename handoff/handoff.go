@@ -0,0 +1,211 @@
+// Package handoff hands the entries of a Cache over from a process to its
+// successor over a Unix domain socket, so that a restarting process starts
+// warm instead of fetching everything again.
+//
+// The predecessor serves dumps with Serve on the listener returned by
+// Listen, and the successor calls Warm with the same path before taking the
+// path over with Listen. Values are encoded by the Codec given to both sides.
+//
+// A dump is the magic "ACWH2" followed by records of the uvarint length of
+// the key plus one, the key, the varint unix nano times the value was
+// stored and expires by SoftTTL and HardTTL (0 if none), the uvarint length
+// of the value and the value, and ends with a zero uvarint. Dumps of the
+// former "ACWH1", whose records have no times, are read as well.
+//
+// Restored values keep their Lifetime, so they are refreshed and expire on
+// their original schedule instead of living another HardTTL.
+package handoff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+const (
+	magic   = "ACWH2"
+	magicV1 = "ACWH1"
+)
+
+// Listen listens on the Unix domain socket at path, removing the socket
+// file left by the predecessor.
+func Listen(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// Serve writes a dump of c to each connection accepted by lis. The entries
+// caching errors, nil values and values the codec fails to encode are skipped.
+func Serve(c asynccache.Cache, codec asynccache.Codec, lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			WriteDump(conn, c, codec)
+		}()
+	}
+}
+
+// WriteDump writes a dump of c to w.
+func WriteDump(w io.Writer, c asynccache.Cache, codec asynccache.Codec) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	var buf [binary.MaxVarintLen64]byte
+	var err error
+	s := c.Snapshot()
+	s.Range(func(key string, val interface{}, ferr error) bool {
+		if ferr != nil || val == nil {
+			return true
+		}
+		b, merr := codec.Marshal(val)
+		if merr != nil {
+			return true
+		}
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key))+1)])
+		bw.WriteString(key)
+		lt := s.Lifetime(key)
+		for _, t := range []time.Time{lt.Stored, lt.SoftExpiry, lt.HardExpiry} {
+			bw.Write(buf[:binary.PutVarint(buf[:], unixNano(t))])
+		}
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))])
+		_, err = bw.Write(b)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	bw.Write(buf[:binary.PutUvarint(buf[:], 0)])
+	return bw.Flush()
+}
+
+// Entry is a value of a dump with its Lifetime.
+type Entry struct {
+	Value    interface{}
+	Lifetime asynccache.Lifetime
+}
+
+// ReadDump reads the values of a dump written by WriteDump from r.
+func ReadDump(r io.Reader, codec asynccache.Codec) (map[string]interface{}, error) {
+	entries, err := ReadEntries(r, codec)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{}, len(entries))
+	for k, e := range entries {
+		data[k] = e.Value
+	}
+	return data, nil
+}
+
+// ReadEntries reads the entries of a dump written by WriteDump from r.
+func ReadEntries(r io.Reader, codec asynccache.Codec) (map[string]Entry, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, err
+	}
+	if string(head) != magic && string(head) != magicV1 {
+		return nil, fmt.Errorf("handoff: invalid dump header %q", head)
+	}
+	timed := string(head) == magic
+	entries := make(map[string]Entry)
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return entries, nil
+		}
+		key, err := readN(br, n-1)
+		if err != nil {
+			return nil, err
+		}
+		var e Entry
+		if timed {
+			for _, t := range []*time.Time{&e.Lifetime.Stored, &e.Lifetime.SoftExpiry, &e.Lifetime.HardExpiry} {
+				ns, err := binary.ReadVarint(br)
+				if err != nil {
+					return nil, err
+				}
+				if ns != 0 {
+					*t = time.Unix(0, ns)
+				}
+			}
+		}
+		if n, err = binary.ReadUvarint(br); err != nil {
+			return nil, err
+		}
+		b, err := readN(br, n)
+		if err != nil {
+			return nil, err
+		}
+		if e.Value, err = codec.Unmarshal(b); err != nil {
+			return nil, err
+		}
+		entries[string(key)] = e
+	}
+}
+
+// Restore sets the entries to c by SetDefault with their Lifetime, so that
+// values set meanwhile are kept, and skips the entries past HardExpiry. It
+// returns the number of new keys.
+func Restore(c asynccache.Writer, entries map[string]Entry) int {
+	now := time.Now()
+	n := 0
+	for k, e := range entries {
+		if hard := e.Lifetime.HardExpiry; !hard.IsZero() && !hard.After(now) {
+			continue
+		}
+		if !c.SetDefault(k, asynccache.WithLifetime(e.Value, e.Lifetime)) {
+			n++
+		}
+	}
+	return n
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func readN(r io.Reader, n uint64) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// Warm requests a dump from the predecessor serving at path, and sets its
+// entries to c by Restore. It returns the number of new keys.
+func Warm(c asynccache.Cache, codec asynccache.Codec, path string, timeout time.Duration) (int, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	entries, err := ReadEntries(conn, codec)
+	if err != nil {
+		return 0, err
+	}
+	return Restore(c, entries), nil
+}
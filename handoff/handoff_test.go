@@ -0,0 +1,105 @@
+package handoff
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestHandoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.sock")
+	old := asynccache.NewCache(asynccache.Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return nil, errors.New("fail")
+		},
+	})
+	defer old.Close()
+	old.Set("a", "va")
+	old.Set("b", "vb")
+	old.Get("bad")
+	lis, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Serve(old, asynccache.StringCodec{}, lis)
+
+	c := asynccache.NewCache(asynccache.Options{})
+	defer c.Close()
+	c.Set("b", "new")
+	n, err := Warm(c, asynccache.StringCodec{}, path, time.Second)
+	if err != nil || n != 1 {
+		t.Fatalf("Warm = %v, %v", n, err)
+	}
+	if data := c.Dump(); len(data) != 2 || data["a"] != "va" || data["b"] != "new" {
+		t.Fatalf("Dump = %v", data)
+	}
+
+	// the successor takes the path over
+	lis2, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis2.Close()
+	lis.Close()
+}
+
+func TestReadDump(t *testing.T) {
+	c := asynccache.NewCache(asynccache.Options{})
+	defer c.Close()
+	c.Set("", "empty key")
+	c.Set("k", "")
+	var buf bytes.Buffer
+	if err := WriteDump(&buf, c, asynccache.StringCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	data, err := ReadDump(bytes.NewReader(b), asynccache.StringCodec{})
+	if err != nil || len(data) != 2 || data[""] != "empty key" || data["k"] != "" {
+		t.Fatalf("ReadDump = %v, %v", data, err)
+	}
+	if _, err = ReadDump(bytes.NewReader(b[:len(b)-1]), asynccache.StringCodec{}); err == nil {
+		t.Fatal("truncated dump is read")
+	}
+	if _, err = ReadDump(bytes.NewReader([]byte("junk")), asynccache.StringCodec{}); err == nil {
+		t.Fatal("junk is read")
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	c := asynccache.NewCache(asynccache.Options{HardTTL: time.Hour})
+	defer c.Close()
+	stored := time.Now().Add(-30 * time.Minute)
+	c.Set("a", asynccache.WithLifetime("va", asynccache.Lifetime{Stored: stored}))
+	c.Set("gone", asynccache.WithLifetime("vg", asynccache.Lifetime{HardExpiry: time.Now().Add(time.Millisecond)}))
+	var buf bytes.Buffer
+	if err := WriteDump(&buf, c, asynccache.StringCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	entries, err := ReadEntries(&buf, asynccache.StringCodec{})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("ReadEntries = %v, %v", entries, err)
+	}
+
+	c2 := asynccache.NewCache(asynccache.Options{HardTTL: time.Hour})
+	defer c2.Close()
+	if n := Restore(c2, entries); n != 1 {
+		t.Fatalf("Restore = %v", n)
+	}
+	lt := c2.Snapshot().Lifetime("a")
+	if !lt.Stored.Equal(stored) || !lt.HardExpiry.Equal(stored.Add(time.Hour)) {
+		t.Fatalf("Lifetime = %+v", lt)
+	}
+}
+
+func TestReadDumpV1(t *testing.T) {
+	dump := []byte(magicV1 + "\x03ka\x02va\x00")
+	data, err := ReadDump(bytes.NewReader(dump), asynccache.StringCodec{})
+	if err != nil || len(data) != 1 || data["ka"] != "va" {
+		t.Fatalf("ReadDump = %v, %v", data, err)
+	}
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Healthy returns the problems of the cache joined, or nil if it is healthy.
+// It is suitable for readiness probes of services depending on fresh data.
+func (c *cache) Healthy() error {
+	if c.IsClosed() {
+		return ErrClosed
+	}
+	if !c.opt.EnableRefresh && !c.opt.RefreshResets {
+		return nil
+	}
+	var errs []error
+	if max := c.opt.HealthMaxRefreshFailures; max > 0 {
+		if n := atomic.LoadInt64(&c.refreshFailed); n > int64(max) {
+			errs = append(errs, fmt.Errorf("asynccache: last refresh cycle failed for %d keys", n))
+		}
+	}
+	if max := c.opt.HealthMaxRefreshAge; max > 0 {
+		last := c.created
+		if end := atomic.LoadInt64(&c.refreshEnd); end > 0 {
+			last = time.Unix(0, end)
+		}
+		if age := time.Since(last); age > max {
+			errs = append(errs, fmt.Errorf("asynccache: no refresh cycle completed for %v", age.Round(time.Millisecond)))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthy(t *testing.T) {
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if strings.HasPrefix(key, "bad") {
+				return nil, errors.New("error")
+			}
+			return key, nil
+		},
+		HealthMaxRefreshFailures: 1,
+		HealthMaxRefreshAge:      50 * time.Millisecond,
+	}).(*cache)
+	defer c.Close()
+	Assert(t, c.Healthy() == nil)
+
+	c.Get("a")
+	c.Get("bad1")
+	c.refresh()
+	Assert(t, c.Healthy() == nil)
+
+	c.Get("bad2")
+	c.refresh()
+	err := c.Healthy()
+	Assertf(t, err != nil && err.Error() == "asynccache: last refresh cycle failed for 2 keys", "%v", err)
+
+	time.Sleep(60 * time.Millisecond)
+	w := httptest.NewRecorder()
+	NewAdminHandler(c).ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	Assert(t, w.Code == http.StatusServiceUnavailable)
+	Assert(t, strings.Contains(w.Body.String(), "no refresh cycle completed for"))
+
+	c.Close()
+	Assert(t, c.Healthy() == ErrClosed)
+	Assert(t, NewCache(Options{}).Healthy() == nil)
+}
@@ -0,0 +1,137 @@
+package cache
+
+// Operation is the operation intercepted by Interceptor.
+type Operation string
+
+const (
+	// OpGet is the Get call.
+	OpGet Operation = "get"
+	// OpGetOrSet is the GetOrSet call, its error is always nil.
+	// If an interceptor returns an error, GetOrSet returns the default value.
+	OpGetOrSet Operation = "getOrSet"
+	// OpGetOrReset is the GetOrReset call, its error is always nil.
+	OpGetOrReset Operation = "getOrReset"
+	// OpFetch is the call of Fetcher on a miss.
+	OpFetch Operation = "fetch"
+	// OpRefresh is the call of Fetcher on a refresh.
+	OpRefresh Operation = "refresh"
+	// OpReset is the call of DataFetcher.
+	OpReset Operation = "reset"
+)
+
+// Invoker performs the intercepted operation.
+type Invoker func(key string) (interface{}, error)
+
+// Interceptor intercepts the operation on key, it calls invoker to proceed
+// and may inspect or replace the results, just like a gRPC interceptor.
+// It is useful to compose logging, metrics, tracing and authorization.
+type Interceptor func(op Operation, key string, invoker Invoker) (interface{}, error)
+
+// intercept calls invoker through the interceptors.
+func (c *cache) intercept(op Operation, key string, invoker Invoker) (interface{}, error) {
+	if len(c.opt.Interceptors) == 0 {
+		return invoker(key)
+	}
+	return c.opt.Interceptors[0](op, key, c.chain(1, op, invoker))
+}
+
+func (c *cache) chain(i int, op Operation, invoker Invoker) Invoker {
+	if i == len(c.opt.Interceptors) {
+		return invoker
+	}
+	return func(key string) (interface{}, error) {
+		return c.opt.Interceptors[i](op, key, c.chain(i+1, op, invoker))
+	}
+}
+
+// fetch calls Fetcher through the interceptors, and unwraps the TTLs of the
+// value returned by WithTTL, which are nil otherwise.
+func (c *cache) fetch(op Operation, key string) (interface{}, *ttl, error) {
+	return c.fetchBy(op, key, c.opt.Fetcher)
+}
+
+// fetchBy is fetch by fetcher instead of Fetcher.
+func (c *cache) fetchBy(op Operation, key string, fetcher Invoker) (interface{}, *ttl, error) {
+	var val interface{}
+	var err error
+	if len(c.opt.Interceptors) == 0 {
+		val, err = fetcher(key)
+	} else {
+		val, err = c.intercept(op, key, fetcher)
+	}
+	val, t := c.unwrapTTL(val)
+	if val == nil && err == nil && c.opt.NilPolicy != TreatNilAsValue {
+		err = ErrNilValue
+	}
+	if err == nil {
+		val, err = c.process(key, val)
+	}
+	return val, t, err
+}
+
+// process transforms the fetched value of key by Transformers, and checks
+// the result by Validator.
+func (c *cache) process(key string, val interface{}) (interface{}, error) {
+	for _, transform := range c.opt.Transformers {
+		var err error
+		if val, err = transform(key, val); err != nil {
+			return nil, err
+		}
+	}
+	if c.opt.Validator == nil {
+		return val, nil
+	}
+	if err := c.opt.Validator(key, val); err != nil {
+		return nil, &ValidationError{Key: key, Err: err}
+	}
+	return val, nil
+}
+
+// nilDeleted reports whether err of fetch is a nil value to be treated as
+// absent by TreatNilAsDelete.
+func (c *cache) nilDeleted(err error) bool {
+	return err == ErrNilValue && c.opt.NilPolicy == TreatNilAsDelete
+}
+
+// reset calls DataFetcher through the interceptors.
+func (c *cache) reset(key string, resetVal interface{}) (val interface{}, err error) {
+	if len(c.opt.Interceptors) == 0 {
+		val, err = c.opt.DataFetcher(resetVal)
+	} else {
+		val, err = c.intercept(OpReset, key, func(string) (interface{}, error) {
+			return c.opt.DataFetcher(resetVal)
+		})
+	}
+	if err == nil {
+		val, err = c.process(key, val)
+	}
+	return val, err
+}
+
+// acquireFetch takes a slot of MaxConcurrentFetches for fetching on misses.
+func (c *cache) acquireFetch() error {
+	if c.fetchSem == nil {
+		return nil
+	}
+	if c.opt.FailFastFetches {
+		select {
+		case c.fetchSem <- struct{}{}:
+			return nil
+		default:
+			return ErrTooManyFetches
+		}
+	}
+	select {
+	case c.fetchSem <- struct{}{}:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+// releaseFetch frees the slot taken by acquireFetch.
+func (c *cache) releaseFetch() {
+	if c.fetchSem != nil {
+		<-c.fetchSem
+	}
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+	trace := func(name string) Interceptor {
+		return func(op Operation, key string, invoker Invoker) (interface{}, error) {
+			calls = append(calls, fmt.Sprintf("%s>%s:%s", name, op, key))
+			v, err := invoker(key)
+			calls = append(calls, fmt.Sprintf("%s<%s:%s", name, op, key))
+			return v, err
+		}
+	}
+	deny := func(op Operation, key string, invoker Invoker) (interface{}, error) {
+		if key == "secret" {
+			return nil, errors.New("denied")
+		}
+		return invoker(key)
+	}
+	op := Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		DataFetcher: func(val interface{}) (interface{}, error) {
+			return val, nil
+		},
+		EnableRefresh: true,
+		Interceptors:  []Interceptor{trace("a"), trace("b"), deny},
+	}
+	c := NewCache(op)
+
+	v, err := c.Get("key")
+	Assert(t, err == nil && v.(string) == "key")
+	DeepEqual(t, calls, []string{
+		"a>get:key", "b>get:key",
+		"a>fetch:key", "b>fetch:key", "b<fetch:key", "a<fetch:key",
+		"b<get:key", "a<get:key",
+	})
+
+	calls = nil
+	Assert(t, c.Refresh("key") == nil)
+	DeepEqual(t, calls, []string{"a>refresh:key", "b>refresh:key", "b<refresh:key", "a<refresh:key"})
+
+	calls = nil
+	Assert(t, c.GetOrReset("reset", "val").(string) == "val")
+	DeepEqual(t, calls, []string{
+		"a>getOrReset:reset", "b>getOrReset:reset",
+		"a>reset:reset", "b>reset:reset", "b<reset:reset", "a<reset:reset",
+		"b<getOrReset:reset", "a<getOrReset:reset",
+	})
+
+	_, err = c.Get("secret")
+	Assert(t, err != nil && err.Error() == "denied")
+	Assert(t, c.GetOrSet("secret", "def").(string) == "def")
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// jsonMemo is the object decoded from a cached JSON value.
+type jsonMemo struct {
+	typ reflect.Type
+	val reflect.Value
+}
+
+// GetJSON gets the value of key from c, which is JSON as []byte or string,
+// and decodes it into the value pointed to by out, which MUST be a non-nil
+// pointer. Caches created by NewCache decode each cached value once per
+// type of out rather than on every call, so the maps, slices and pointers
+// in out are shared with other callers and MUST NOT be modified.
+func GetJSON(c Reader, key string, out interface{}) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("asynccache: GetJSON into non-pointer %T", out)
+	}
+	var v reflect.Value
+	var err error
+	if cc, ok := c.(*cache); ok {
+		v, err = cc.getJSON(key, ptr.Elem().Type())
+	} else {
+		var val interface{}
+		if val, err = c.Get(key); err == nil {
+			v, err = decodeJSON(key, val, ptr.Elem().Type())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	ptr.Elem().Set(v)
+	return nil
+}
+
+// getJSON returns the object of type typ decoded from the value of key,
+// which is memoized by the result of the entry.
+func (c *cache) getJSON(key string, typ reflect.Type) (reflect.Value, error) {
+	val, err := c.Get(key)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	var res *result
+	if e, ok := c.loadEntry(c.key(key)); ok {
+		res = e.result()
+	}
+	if res == nil || res.err != nil {
+		return decodeJSON(key, val, typ)
+	}
+	if m, _ := res.decoded.Load().(*jsonMemo); m != nil && m.typ == typ {
+		return m.val, nil
+	}
+	// decode the value of res rather than val, which may be replaced meanwhile
+	val = res.val
+	if cv, ok := val.(*compressed); ok {
+		if val, err = c.cz.decompress(cv); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	v, err := decodeJSON(key, val, typ)
+	if err != nil {
+		return v, err
+	}
+	res.decoded.Store(&jsonMemo{typ: typ, val: v})
+	return v, nil
+}
+
+// decodeJSON decodes the JSON value val of key into a new object of type typ.
+func decodeJSON(key string, val interface{}, typ reflect.Type) (reflect.Value, error) {
+	var data []byte
+	switch v := val.(type) {
+	case nil:
+		return reflect.Zero(typ), nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return reflect.Value{}, &TypeMismatchError{Key: key, Want: reflect.TypeOf(data), Got: reflect.TypeOf(val)}
+	}
+	ptr := reflect.New(typ)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("asynccache: decode JSON of %q: %w", key, err)
+	}
+	return ptr.Elem(), nil
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetJSON(t *testing.T) {
+	var ret atomic.Value
+	ret.Store(`{"a":[1,2]}`)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bytes" {
+				return []byte(`"b"`), nil
+			}
+			if key == "int" {
+				return 1, nil
+			}
+			return ret.Load(), nil
+		},
+	}).(*cache)
+	defer c.Close()
+
+	var m1, m2 map[string][]int
+	Assert(t, GetJSON(c, "k", &m1) == nil)
+	Assert(t, GetJSON(c, "k", &m2) == nil)
+	DeepEqual(t, m1, map[string][]int{"a": {1, 2}})
+	// decoded once
+	m1["b"] = nil
+	Assert(t, len(m2) == 2)
+
+	ret.Store(`{"a":[3]}`)
+	c.refresh()
+	Assert(t, GetJSON(c, "k", &m2) == nil)
+	DeepEqual(t, m2, map[string][]int{"a": {3}})
+
+	var s string
+	Assert(t, GetJSON(c, "bytes", &s) == nil && s == "b")
+	Assert(t, errors.Is(GetJSON(c, "int", &s), ErrTypeMismatch))
+	var n int
+	Assert(t, GetJSON(c, "k", &n) != nil)
+
+	// caches of other implementations decode on every call
+	d := Decorate(c, func(op Operation, key string, invoker Invoker) (interface{}, error) {
+		return invoker(key)
+	})
+	s = ""
+	Assert(t, GetJSON(d, "bytes", &s) == nil && s == "b")
+}
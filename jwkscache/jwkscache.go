@@ -0,0 +1,222 @@
+// Package jwkscache provides a cache of JSON Web Key Sets built on asynccache.
+//
+// The key set is refreshed in background, and the last known keys are kept
+// serving when the identity provider is briefly unavailable.
+package jwkscache
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// ErrKeyNotFound is returned when the key set has no key of the kid.
+var ErrKeyNotFound = errors.New("jwkscache: key not found")
+
+// Options controls the behavior of Cache.
+type Options struct {
+	// URL is the JWKS endpoint, it MUST be set.
+	URL string
+	// Client defaults to a client with a Timeout of 10 seconds.
+	Client *http.Client
+	// MaxBodySize limits the size of the key set read, it defaults to 1 MiB.
+	MaxBodySize int64
+	// RefreshDuration defaults to 15 minutes.
+	RefreshDuration time.Duration
+	// A lookup of unknown kid, or while the last fetch failed, refreshes the
+	// key set at most once per MinRefreshInterval, it defaults to 1 minute.
+	MinRefreshInterval time.Duration
+
+	ErrorHandler func(err error)
+}
+
+// Cache caches the public keys of a JWKS endpoint by kid.
+type Cache struct {
+	opt       Options
+	c         asynccache.Cache
+	lastFetch int64 // unix nano of the last fetch, or forced refresh
+}
+
+// New creates a Cache.
+func New(opt Options) *Cache {
+	if opt.URL == "" {
+		panic("jwkscache: invalid URL")
+	}
+	if opt.Client == nil {
+		opt.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opt.MaxBodySize <= 0 {
+		opt.MaxBodySize = 1 << 20
+	}
+	if opt.RefreshDuration == 0 {
+		opt.RefreshDuration = 15 * time.Minute
+	}
+	if opt.MinRefreshInterval == 0 {
+		opt.MinRefreshInterval = time.Minute
+	}
+	j := &Cache{opt: opt}
+	j.c = asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: opt.RefreshDuration,
+		Fetcher:         j.fetch,
+		ErrorHandler: func(key string, err error) {
+			if opt.ErrorHandler != nil {
+				opt.ErrorHandler(err)
+			}
+		},
+	})
+	return j
+}
+
+// Key returns the public key of the kid, either *rsa.PublicKey or *ecdsa.PublicKey.
+func (j *Cache) Key(kid string) (crypto.PublicKey, error) {
+	keys, err := j.c.Get(j.opt.URL)
+	if err != nil {
+		// the failed fetch is cached until the next cycle, retry in advance.
+		if !j.forceRefresh() {
+			return nil, err
+		}
+		if err = j.c.Refresh(j.opt.URL); err != nil {
+			return nil, err
+		}
+		if keys, err = j.c.Get(j.opt.URL); err != nil {
+			return nil, err
+		}
+	}
+	if key, ok := keys.(map[string]crypto.PublicKey)[kid]; ok {
+		return key, nil
+	}
+
+	// the key may be rotated, refresh in advance of the next cycle.
+	if !j.forceRefresh() {
+		return nil, ErrKeyNotFound
+	}
+	if err = j.c.Refresh(j.opt.URL); err != nil {
+		return nil, ErrKeyNotFound
+	}
+	keys, err = j.c.Get(j.opt.URL)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys.(map[string]crypto.PublicKey)[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// forceRefresh reports whether a refresh out of the cycle is allowed, at
+// most once per MinRefreshInterval since the last fetch.
+func (j *Cache) forceRefresh() bool {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&j.lastFetch)
+	return now-last >= int64(j.opt.MinRefreshInterval) && atomic.CompareAndSwapInt64(&j.lastFetch, last, now)
+}
+
+// Close closes the underlying cache.
+func (j *Cache) Close() {
+	j.c.Close()
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j *Cache) fetch(url string) (interface{}, error) {
+	atomic.StoreInt64(&j.lastFetch, time.Now().UnixNano())
+	resp, err := j.opt.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwkscache: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, j.opt.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > j.opt.MaxBodySize {
+		return nil, fmt.Errorf("jwkscache: key set larger than %d bytes", j.opt.MaxBodySize)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			// skip keys of unsupported types
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwkscache: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("jwkscache: unsupported key type %q", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,105 @@
+package jwkscache
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	var kid atomic.Value
+	kid.Store("k1")
+	var down int32
+	n := base64.RawURLEncoding.EncodeToString(big.NewInt(12345).Bytes())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":%q,"n":%q,"e":"AQAB"},{"kty":"oct","kid":"x"}]}`, kid.Load(), n)
+	}))
+	defer srv.Close()
+
+	c := New(Options{URL: srv.URL, RefreshDuration: time.Hour, MinRefreshInterval: time.Nanosecond})
+
+	key, err := c.Key("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub := key.(*rsa.PublicKey); pub.N.Int64() != 12345 || pub.E != 65537 {
+		t.Fatalf("key = %v", pub)
+	}
+	if _, err = c.Key("x"); err != ErrKeyNotFound {
+		t.Fatalf("unsupported key error = %v", err)
+	}
+
+	// stale keys are served while the endpoint is down
+	atomic.StoreInt32(&down, 1)
+	if _, err = c.Key("k2"); err != ErrKeyNotFound {
+		t.Fatalf("unknown key error = %v", err)
+	}
+	if _, err = c.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// rotated keys are fetched on demand
+	atomic.StoreInt32(&down, 0)
+	kid.Store("k2")
+	if _, err = c.Key("k2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyAfterFailedFetch(t *testing.T) {
+	var down int32 = 1
+	var requests int32
+	n := base64.RawURLEncoding.EncodeToString(big.NewInt(12345).Bytes())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":"AQAB"}]}`, n)
+	}))
+	defer srv.Close()
+
+	c := New(Options{URL: srv.URL, RefreshDuration: time.Hour, MinRefreshInterval: 50 * time.Millisecond})
+	defer c.Close()
+
+	if _, err := c.Key("k1"); err == nil {
+		t.Fatal("Key succeeded while the endpoint is down")
+	}
+	atomic.StoreInt32(&down, 0)
+	// the failure is retried at most once per MinRefreshInterval
+	if _, err := c.Key("k1"); err == nil {
+		t.Fatal("Key refetched before MinRefreshInterval")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("requests = %d; want 1", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[],"padding":%q}`, strings.Repeat("x", 100))
+	}))
+	defer srv.Close()
+
+	c := New(Options{URL: srv.URL, RefreshDuration: time.Hour, MaxBodySize: 64})
+	defer c.Close()
+	if _, err := c.Key("k1"); err == nil || !strings.Contains(err.Error(), "larger than 64 bytes") {
+		t.Fatalf("error = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package kafkainval provides a consumer applying key invalidation messages
+// of a Kafka topic to asynccache, so change data capture pipelines can keep
+// caches fresh without waiting for the next refresh.
+//
+// The package does not depend on any Kafka client library. Callers adapt
+// their reader to the small Reader interface.
+package kafkainval
+
+import (
+	"context"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Message is a record read from the topic.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Reader reads messages from the topic, committing them as the client is configured.
+type Reader interface {
+	ReadMessage(ctx context.Context) (Message, error)
+}
+
+// Action is the operation applied to the cache.
+type Action int
+
+const (
+	// Refresh refreshes the entry if it is cached.
+	Refresh Action = iota
+	// Delete deletes the entry.
+	Delete
+)
+
+// Invalidation is an Action on a key of the cache.
+type Invalidation struct {
+	Key    string
+	Action Action
+}
+
+// Decoder decodes a message into invalidations.
+type Decoder func(msg Message) ([]Invalidation, error)
+
+// KeyDecoder takes the key of the message as the cache key, and deletes it
+// on tombstones (messages without value) or refreshes it otherwise.
+func KeyDecoder(msg Message) ([]Invalidation, error) {
+	inv := Invalidation{Key: string(msg.Key), Action: Refresh}
+	if len(msg.Value) == 0 {
+		inv.Action = Delete
+	}
+	return []Invalidation{inv}, nil
+}
+
+// Consumer applies invalidations read from Reader to Cache.
+type Consumer struct {
+	Cache  asynccache.Cache
+	Reader Reader
+	// Decoder defaults to KeyDecoder.
+	Decoder Decoder
+	// ErrorHandler is called with the errors of decoding or refreshing.
+	ErrorHandler func(err error)
+}
+
+// Run consumes messages until ctx is done or Reader fails, and returns the error.
+func (c *Consumer) Run(ctx context.Context) error {
+	decode := c.Decoder
+	if decode == nil {
+		decode = KeyDecoder
+	}
+	for {
+		msg, err := c.Reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		invs, err := decode(msg)
+		if err != nil {
+			c.handleError(err)
+			continue
+		}
+		for _, inv := range invs {
+			switch inv.Action {
+			case Delete:
+				c.Cache.Delete(inv.Key)
+			case Refresh:
+				if err = c.Cache.Refresh(inv.Key); err != nil {
+					c.handleError(err)
+				}
+			}
+		}
+	}
+}
+
+func (c *Consumer) handleError(err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
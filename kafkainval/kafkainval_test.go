@@ -0,0 +1,63 @@
+package kafkainval
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+type sliceReader []Message
+
+func (r *sliceReader) ReadMessage(ctx context.Context) (Message, error) {
+	if len(*r) == 0 {
+		return Message{}, io.EOF
+	}
+	msg := (*r)[0]
+	*r = (*r)[1:]
+	return msg, nil
+}
+
+func TestRun(t *testing.T) {
+	origin := map[string]string{"a": "1", "b": "2"}
+	c := asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return origin[key], nil
+		},
+	})
+	c.Get("a")
+	c.Get("b")
+
+	origin["a"] = "3"
+	var errs []error
+	consumer := &Consumer{
+		Cache: c,
+		Reader: &sliceReader{
+			{Key: []byte("a"), Value: []byte("3")},
+			{Key: []byte("b")},
+			{Key: []byte("bad")},
+		},
+		Decoder: func(msg Message) ([]Invalidation, error) {
+			if string(msg.Key) == "bad" {
+				return nil, errors.New("bad message")
+			}
+			return KeyDecoder(msg)
+		},
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	}
+	if err := consumer.Run(context.Background()); err != io.EOF {
+		t.Fatalf("Run error = %v; want EOF", err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("errors = %v", errs)
+	}
+	data := c.Dump()
+	if len(data) != 1 || data["a"].(string) != "3" {
+		t.Fatalf("Dump = %v", data)
+	}
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// KeySeparator separates the parts of keys built by K.
+const KeySeparator = ':'
+
+// keyEscape escapes KeySeparator and itself in the parts of keys built by K.
+const keyEscape = '\\'
+
+var keyBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 64)
+		return &b
+	},
+}
+
+// K builds a composite key of the parts joined by KeySeparator, such as
+// K("user", 42, "profile") for "user:42:profile". KeySeparator and the
+// backslash are escaped by a backslash in the parts, so that distinct parts
+// never build the same key: K("a:b", "c") is `a\:b:c`. Strings, byte slices,
+// integers and booleans are formatted without fmt, and buffers are pooled,
+// so that building keys costs a single allocation of the result.
+func K(parts ...interface{}) string {
+	bp := keyBufPool.Get().(*[]byte)
+	b := (*bp)[:0]
+	for i, part := range parts {
+		if i > 0 {
+			b = append(b, KeySeparator)
+		}
+		switch v := part.(type) {
+		case string:
+			b = appendKeyPart(b, v)
+		case []byte:
+			b = appendKeyPart(b, v)
+		case int:
+			b = strconv.AppendInt(b, int64(v), 10)
+		case int32:
+			b = strconv.AppendInt(b, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(b, v, 10)
+		case uint:
+			b = strconv.AppendUint(b, uint64(v), 10)
+		case uint32:
+			b = strconv.AppendUint(b, uint64(v), 10)
+		case uint64:
+			b = strconv.AppendUint(b, v, 10)
+		case bool:
+			b = strconv.AppendBool(b, v)
+		case fmt.Stringer:
+			b = appendKeyPart(b, v.String())
+		default:
+			start := len(b)
+			b = fmt.Append(b, v)
+			b = appendKeyPart(b[:start], string(b[start:]))
+		}
+	}
+	key := string(b)
+	*bp = b
+	keyBufPool.Put(bp)
+	return key
+}
+
+// appendKeyPart appends the part with KeySeparator and keyEscape escaped.
+func appendKeyPart[T string | []byte](b []byte, part T) []byte {
+	for i := 0; i < len(part); i++ {
+		if c := part[i]; c == KeySeparator || c == keyEscape {
+			b = append(b, keyEscape)
+		}
+		b = append(b, part[i])
+	}
+	return b
+}
+
+// key normalizes the key by KeyFunc.
+func (c *cache) key(key string) string {
+	if c.opt.KeyFunc == nil {
+		return key
+	}
+	return c.opt.KeyFunc(key)
+}
+
+// cutKeyPart returns the first part of a key built by K unescaped, and the
+// rest of the key after its KeySeparator; found is false if the key has a
+// single part.
+func cutKeyPart(key string) (part, rest string, found bool) {
+	escaped := false
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case keyEscape:
+			escaped = true
+			i++
+		case KeySeparator:
+			part = key[:i]
+			if escaped {
+				part = unescapeKeyPart(part)
+			}
+			return part, key[i+1:], true
+		}
+	}
+	if escaped {
+		return unescapeKeyPart(key), "", false
+	}
+	return key, "", false
+}
+
+// unescapeKeyPart reverses appendKeyPart.
+func unescapeKeyPart(part string) string {
+	b := make([]byte, 0, len(part))
+	for i := 0; i < len(part); i++ {
+		if part[i] == keyEscape && i+1 < len(part) {
+			i++
+		}
+		b = append(b, part[i])
+	}
+	return string(b)
+}
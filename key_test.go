@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStringer struct{}
+
+func (testStringer) String() string { return "stringer" }
+
+func TestK(t *testing.T) {
+	Assert(t, K("user", 42, "profile") == "user:42:profile")
+	Assert(t, K("a", []byte("b"), int64(-1), uint32(2), true, testStringer{}, 1.5) == "a:b:-1:2:true:stringer:1.5")
+	Assert(t, K() == "")
+	Assert(t, K("a:b", "c") == `a\:b:c` && K("a", "b:c") == `a:b\:c`)
+	Assert(t, K(`a\`, "b") != K("a", `\b`))
+	Assert(t, K(1.5, []byte("x:y")) == `1.5:x\:y`)
+	allocs := testing.AllocsPerRun(100, func() {
+		K("user", int64(42), "profile")
+	})
+	Assertf(t, allocs <= 2, "allocs: %v", allocs)
+}
+
+func TestKeyFunc(t *testing.T) {
+	var fetched []string
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			fetched = append(fetched, key)
+			return key, nil
+		},
+		KeyFunc: func(key string) string {
+			return strings.ToLower(strings.TrimSpace(key))
+		},
+	})
+	defer c.Close()
+
+	val, _ := c.Get(" User ")
+	Assert(t, val == "user")
+	val, _ = c.Get("USER")
+	Assert(t, val == "user")
+	DeepEqual(t, fetched, []string{"user"})
+
+	c.Set("Other", 1)
+	Assert(t, c.GetOrSet("other", 2) == 1)
+	c.Delete("OTHER")
+	DeepEqual(t, c.Dump(), map[string]interface{}{"user": "user"})
+}
@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyedOptions controls the behavior of KeyedCache.
+type KeyedOptions[K comparable, V any] struct {
+	// Fetcher MUST be set. If RefreshDuration is greater than 0, cached keys
+	// are refreshed by Fetcher periodically.
+	Fetcher         func(key K) (V, error)
+	RefreshDuration time.Duration
+
+	// If ExpireDuration is greater than 0, keys not accessed during it are deleted.
+	ExpireDuration time.Duration
+
+	// The handlers are called one at a time in order, and Close waits for
+	// the queued calls, as those of Options are.
+	ErrorHandler  func(key K, err error)
+	ChangeHandler func(key K, oldData, newData V)
+	DeleteHandler func(key K, oldData V)
+
+	IsSame func(key K, oldData, newData V) bool
+
+	// Cache is the options of the cache wrapped, for the features without
+	// typed options above, such as SoftTTL, HardTTL, MaxConcurrentFetches
+	// and Interceptors. Its keys are encoded from K, and its values are
+	// internal, so its Fetcher, handlers and IsSame are replaced, and the
+	// other functions of keys or values should not be set.
+	Cache Options
+}
+
+// KeyedCache is a cache of any comparable key type, such as int64 IDs or
+// struct keys, with typed values. It wraps a cache created by NewCache, and
+// behaves as Cache does for its methods.
+type KeyedCache[K comparable, V any] struct {
+	opt KeyedOptions[K, V]
+	c   *cache
+}
+
+// keyedValue is the value of a KeyedCache in the cache wrapped, which keeps
+// the key for the refreshes and handlers of the encoded key. The entries of
+// failures hold one of a zero val.
+type keyedValue[K comparable, V any] struct {
+	key K
+	val V
+}
+
+// keyedError is the failure of Fetcher of a KeyedCache, annotated with its key.
+type keyedError[K comparable] struct {
+	key K
+	err error
+}
+
+func (e *keyedError[K]) Error() string { return e.err.Error() }
+func (e *keyedError[K]) Unwrap() error { return e.err }
+
+// keyString encodes key into the key of the cache wrapped, one to one.
+func keyString[T comparable](key T) string {
+	switch k := any(key).(type) {
+	case string:
+		return k
+	case int, int32, int64, uint, uint32, uint64:
+		return K(k)
+	}
+	return fmt.Sprintf("%#v", key)
+}
+
+// NewKeyedCache creates a KeyedCache.
+func NewKeyedCache[K comparable, V any](opt KeyedOptions[K, V]) *KeyedCache[K, V] {
+	if opt.Fetcher == nil {
+		panic("asynccache: Fetcher MUST be set")
+	}
+	kc := &KeyedCache[K, V]{opt: opt}
+	copt := opt.Cache
+	if opt.RefreshDuration > 0 {
+		copt.EnableRefresh = true
+		copt.RefreshDuration = opt.RefreshDuration
+	}
+	if opt.ExpireDuration > 0 {
+		copt.EnableExpire = true
+		copt.ExpireDuration = opt.ExpireDuration
+	}
+	copt.Fetcher = kc.refetch
+	copt.ErrorHandler, copt.ChangeHandler, copt.DeleteHandler, copt.IsSame = nil, nil, nil, nil
+	if opt.ErrorHandler != nil {
+		copt.ErrorHandler = kc.failed
+	}
+	if opt.ChangeHandler != nil {
+		copt.ChangeHandler = func(_ string, oldData, newData interface{}) {
+			oldKV, newKV := oldData.(*keyedValue[K, V]), newData.(*keyedValue[K, V])
+			opt.ChangeHandler(newKV.key, oldKV.val, newKV.val)
+		}
+	}
+	if opt.DeleteHandler != nil {
+		copt.DeleteHandler = func(_ string, oldData interface{}, _ DeleteReason) {
+			if kv, ok := oldData.(*keyedValue[K, V]); ok {
+				opt.DeleteHandler(kv.key, kv.val)
+			}
+		}
+	}
+	if opt.IsSame != nil {
+		copt.IsSame = func(_ string, oldData, newData interface{}) bool {
+			oldKV, newKV := oldData.(*keyedValue[K, V]), newData.(*keyedValue[K, V])
+			return opt.IsSame(newKV.key, oldKV.val, newKV.val)
+		}
+	}
+	kc.c = NewCache(copt).(*cache)
+	return kc
+}
+
+// fetcher returns the Invoker fetching key by Fetcher for op, which
+// recovers the panics of Fetcher as failures.
+func (c *KeyedCache[K, V]) fetcher(op string, key K) Invoker {
+	return func(string) (val interface{}, err error) {
+		kv := &keyedValue[K, V]{key: key}
+		defer func() {
+			if r := recover(); r != nil {
+				val, err = kv, &keyedError[K]{key: key, err: keyedWrapErr(op, key, fmt.Errorf("%w: %v", errPanicked, r))}
+			}
+		}()
+		if kv.val, err = c.opt.Fetcher(key); err != nil {
+			err = &keyedError[K]{key: key, err: keyedWrapErr(op, key, err)}
+		}
+		return kv, err
+	}
+}
+
+// refetch is the Fetcher of the cache wrapped, which refreshes the entry of
+// the encoded key by the key of its value.
+func (c *KeyedCache[K, V]) refetch(key string) (interface{}, error) {
+	kv, ok := c.load(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c.fetcher("refresh", kv.key)(key)
+}
+
+// load returns the value of the encoded key in the cache wrapped.
+func (c *KeyedCache[K, V]) load(key string) (*keyedValue[K, V], bool) {
+	v, ok := c.c.data().Load(key)
+	if !ok {
+		return nil, false
+	}
+	val, _ := v.(*entry).Load()
+	kv, ok := val.(*keyedValue[K, V])
+	return kv, ok
+}
+
+// failed reports err to ErrorHandler by the key of the failure.
+func (c *KeyedCache[K, V]) failed(key string, err error) {
+	var ke *keyedError[K]
+	if errors.As(err, &ke) {
+		c.opt.ErrorHandler(ke.key, ke.err)
+	} else if kv, ok := c.load(key); ok {
+		c.opt.ErrorHandler(kv.key, err)
+	}
+}
+
+// result returns the typed value and error of the cache wrapped.
+func (c *KeyedCache[K, V]) result(val interface{}, err error) (V, error) {
+	var ke *keyedError[K]
+	if errors.As(err, &ke) {
+		err = ke.err
+	}
+	if kv, ok := val.(*keyedValue[K, V]); ok {
+		return kv.val, err
+	}
+	var zero V
+	return zero, err
+}
+
+// SetDefault sets the value of given key if it is new to the cache.
+func (c *KeyedCache[K, V]) SetDefault(key K, val V) (exist bool) {
+	return c.c.SetDefault(keyString(key), &keyedValue[K, V]{key: key, val: val})
+}
+
+// Set sets the value of given key, replacing the cached one.
+func (c *KeyedCache[K, V]) Set(key K, val V) {
+	c.c.Set(keyString(key), &keyedValue[K, V]{key: key, val: val})
+}
+
+// Get returns the value of given key, fetching it on miss. Errors of the
+// first fetching are cached until a refresh succeeds.
+func (c *KeyedCache[K, V]) Get(key K) (val V, err error) {
+	fetch := c.fetcher("fetch", key)
+	get := func(k string) (interface{}, error) {
+		return c.c.getBy(k, 0, fetch)
+	}
+	k := c.c.key(keyString(key))
+	if len(c.c.opt.Interceptors) == 0 {
+		return c.result(get(k))
+	}
+	return c.result(c.c.intercept(OpGet, k, get))
+}
+
+// GetOrSet returns the value of given key. If the key is not yet cached or
+// fetching failed, the default value will be set.
+func (c *KeyedCache[K, V]) GetOrSet(key K, def V) V {
+	fetch := c.fetcher("fetch", key)
+	defVal := &keyedValue[K, V]{key: key, val: def}
+	getOrSet := func(k string) (interface{}, error) {
+		return c.c.getOrSetBy(k, defVal, c.c.opt.FirstFetchTimeout, fetch), nil
+	}
+	k := c.c.key(keyString(key))
+	var v interface{}
+	if len(c.c.opt.Interceptors) == 0 {
+		v, _ = getOrSet(k)
+	} else {
+		var err error
+		if v, err = c.c.intercept(OpGetOrSet, k, getOrSet); err != nil {
+			return def
+		}
+	}
+	if kv, ok := v.(*keyedValue[K, V]); ok {
+		return kv.val
+	}
+	return def
+}
+
+// forgetErr deletes the entry of key if it holds an error, without calling
+// DeleteHandler, so that the next Get fetches it again.
+func (c *KeyedCache[K, V]) forgetErr(key K) {
+	k := c.c.key(keyString(key))
+	if v, ok := c.c.data().Load(k); ok && v.(*entry).Err() != nil {
+		c.c.remove(k, v, 0)
+	}
+}
+
+// Dump dumps all cached entries.
+func (c *KeyedCache[K, V]) Dump() map[K]V {
+	data := make(map[K]V)
+	c.c.rangeEntries(func(_ string, e *entry) bool {
+		val, _ := e.Load()
+		if kv, ok := val.(*keyedValue[K, V]); ok {
+			data[kv.key] = kv.val
+		}
+		return true
+	})
+	return data
+}
+
+// DeleteIf deletes cached entries that match the `shouldDelete` predicate.
+func (c *KeyedCache[K, V]) DeleteIf(shouldDelete func(key K) bool) {
+	c.c.DeleteIfValue(func(_ string, val interface{}) bool {
+		kv, ok := val.(*keyedValue[K, V])
+		return ok && shouldDelete(kv.key)
+	})
+}
+
+// DeleteIfValue deletes cached entries whose keys and values match the
+// `shouldDelete` predicate, and returns the number of deleted entries.
+func (c *KeyedCache[K, V]) DeleteIfValue(shouldDelete func(key K, val V) bool) int {
+	return c.c.DeleteIfValue(func(_ string, val interface{}) bool {
+		kv, ok := val.(*keyedValue[K, V])
+		return ok && shouldDelete(kv.key, kv.val)
+	})
+}
+
+// Delete deletes the entry of the given key.
+func (c *KeyedCache[K, V]) Delete(key K) {
+	c.c.Delete(keyString(key))
+}
+
+// Close stops the background goroutines, cached values are kept read-only.
+func (c *KeyedCache[K, V]) Close() {
+	c.c.Close()
+}
+
+// IsClosed reports whether the cache is closed.
+func (c *KeyedCache[K, V]) IsClosed() bool {
+	return c.c.IsClosed()
+}
+
+func keyedWrapErr[K comparable](op string, key K, err error) error {
+	if err == nil {
+		return nil
+	}
+	if s, ok := any(key).(string); ok {
+		return wrapErr(op, s, err)
+	}
+	return fmt.Errorf("asynccache: %s %v: %w", op, key, err)
+}
+
+// keyedGroup is Group of typed keys and results.
+type keyedGroup[K comparable, R any] struct {
+	mu sync.Mutex
+	m  map[K]*keyedCall[R]
+}
+
+type keyedCall[R any] struct {
+	wg  sync.WaitGroup
+	val R
+	err error
+}
+
+// Do executes fn once for the in-flight calls of key, as Group.Do does. If fn
+// panics, the panic is recovered and all the calls return errPanicked.
+func (g *keyedGroup[K, R]) Do(key K, fn func() (R, error)) (R, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*keyedCall[R])
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := new(keyedCall[R])
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.err = fmt.Errorf("%w: %v", errPanicked, r)
+			}
+			g.mu.Lock()
+			delete(g.m, key)
+			g.mu.Unlock()
+			c.wg.Done()
+		}()
+		c.val, c.err = fn()
+	}()
+	return c.val, c.err
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testKey struct {
+	tenant string
+	id     int64
+}
+
+func TestKeyedCache(t *testing.T) {
+	var fail int32
+	c := NewKeyedCache(KeyedOptions[int64, string]{
+		Fetcher: func(key int64) (string, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return "", errors.New("fail")
+			}
+			if key < 0 {
+				return "", errors.New("negative")
+			}
+			return "value", nil
+		},
+		RefreshDuration: 50 * time.Millisecond,
+	})
+	defer c.Close()
+
+	val, err := c.Get(1)
+	Assert(t, err == nil && val == "value")
+	_, err = c.Get(-1)
+	Assert(t, err != nil && err.Error() == "asynccache: fetch -1: negative")
+	Assert(t, c.GetOrSet(-1, "def") == "def")
+	val, err = c.Get(-1)
+	Assert(t, err == nil && val == "def")
+
+	c.Set(2, "set")
+	Assert(t, !c.SetDefault(3, "default"))
+	Assert(t, c.SetDefault(3, "other"))
+	DeepEqual(t, c.Dump(), map[int64]string{-1: "def", 1: "value", 2: "set", 3: "default"})
+
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(100 * time.Millisecond)
+	val, err = c.Get(2)
+	Assert(t, err == nil && val == "set")
+
+	c.DeleteIf(func(key int64) bool { return key < 0 })
+	c.Delete(3)
+	DeepEqual(t, c.Dump(), map[int64]string{1: "value", 2: "set"})
+}
+
+func TestKeyedCacheStructKey(t *testing.T) {
+	var deleted int32
+	c := NewKeyedCache(KeyedOptions[testKey, int64]{
+		Fetcher: func(key testKey) (int64, error) {
+			return key.id * 2, nil
+		},
+		ExpireDuration: 50 * time.Millisecond,
+		DeleteHandler: func(key testKey, oldData int64) {
+			atomic.AddInt32(&deleted, 1)
+		},
+	})
+	defer c.Close()
+
+	val, err := c.Get(testKey{tenant: "a", id: 21})
+	Assert(t, err == nil && val == 42)
+	time.Sleep(150 * time.Millisecond)
+	Assert(t, len(c.Dump()) == 0)
+	Assert(t, atomic.LoadInt32(&deleted) == 1)
+}
+
+func TestKeyedCacheOptions(t *testing.T) {
+	var version int64
+	var ops []Operation
+	var failed []testKey
+	var mu sync.Mutex
+	c := NewKeyedCache(KeyedOptions[testKey, int64]{
+		Fetcher: func(key testKey) (int64, error) {
+			if key.id < 0 {
+				return 0, errors.New("negative")
+			}
+			return key.id + atomic.AddInt64(&version, 1), nil
+		},
+		ErrorHandler: func(key testKey, err error) {
+			failed = append(failed, key)
+		},
+		Cache: Options{
+			SoftTTL: 20 * time.Millisecond,
+			Interceptors: []Interceptor{func(op Operation, key string, invoker Invoker) (interface{}, error) {
+				mu.Lock()
+				ops = append(ops, op)
+				mu.Unlock()
+				return invoker(key)
+			}},
+		},
+	})
+
+	key := testKey{tenant: "a", id: 10}
+	val, err := c.Get(key)
+	Assert(t, err == nil && val == 11)
+	// refreshed by SoftTTL of the cache wrapped, with the typed key
+	time.Sleep(30 * time.Millisecond)
+	c.Get(key)
+	for {
+		if val, _ = c.Get(key); val == 12 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, err = c.Get(testKey{tenant: "a", id: -1})
+	Assertf(t, err != nil && err.Error() == `asynccache: fetch {a -1}: negative`, "error %v", err)
+	mu.Lock()
+	Assert(t, len(ops) > 0 && ops[0] == OpGet)
+	mu.Unlock()
+
+	// refreshes of failed entries are reported by their typed keys
+	c.Set(testKey{tenant: "b", id: -2}, 0)
+	time.Sleep(30 * time.Millisecond)
+	c.Get(testKey{tenant: "b", id: -2})
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	DeepEqual(t, failed, []testKey{{tenant: "b", id: -2}})
+}
+
+func TestKeyedCachePanic(t *testing.T) {
+	release := make(chan struct{})
+	c := NewKeyedCache(KeyedOptions[int, int]{
+		Fetcher: func(key int) (int, error) {
+			<-release
+			panic("boom")
+		},
+	})
+	defer c.Close()
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := c.Get(1)
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ {
+		Assert(t, errors.Is(<-errs, errPanicked))
+	}
+	Assert(t, c.GetOrSet(1, 7) == 7)
+}
+
+func TestKeyedCacheHandlersDrained(t *testing.T) {
+	var deleted []int
+	c := NewKeyedCache(KeyedOptions[int, int]{
+		Fetcher: func(key int) (int, error) { return key, nil },
+		DeleteHandler: func(key int, oldData int) {
+			deleted = append(deleted, key)
+		},
+	})
+	for i := 0; i < 5; i++ {
+		c.Set(i, i)
+	}
+	for i := 0; i < 5; i++ {
+		c.Delete(i)
+	}
+	c.Close()
+	DeepEqual(t, deleted, []int{0, 1, 2, 3, 4})
+}
+
+func TestMemoize(t *testing.T) {
+	var calls int32
+	square, stop := Memoize(func(n int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return n * n, nil
+	}, KeyedOptions[int, int]{})
+	defer stop()
+	for i := 0; i < 3; i++ {
+		v, err := square(3)
+		Assert(t, err == nil && v == 9)
+	}
+	Assert(t, atomic.LoadInt32(&calls) == 1)
+
+	var n int32
+	counter, stop := Memoize(func(string) (int32, error) {
+		return atomic.AddInt32(&n, 1), nil
+	}, KeyedOptions[string, int32]{RefreshDuration: 10 * time.Millisecond})
+	defer stop()
+	v, _ := counter("k")
+	Assert(t, v == 1)
+	time.Sleep(50 * time.Millisecond)
+	v, _ = counter("k")
+	Assert(t, v > 1)
+}
+
+func TestMemoizeError(t *testing.T) {
+	var fail int32 = 1
+	fetch, stop := Memoize(func(key string) (string, error) {
+		if atomic.LoadInt32(&fail) == 1 {
+			return "", errors.New("fail")
+		}
+		return key + "-value", nil
+	}, KeyedOptions[string, string]{RefreshDuration: -1})
+	defer stop()
+
+	_, err := fetch("a")
+	Assert(t, err != nil)
+	atomic.StoreInt32(&fail, 0)
+	v, err := fetch("a")
+	Assert(t, err == nil && v == "a-value")
+}
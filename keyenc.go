@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// KeyEncoder encodes a key of the cache into the key of remote tiers.
+type KeyEncoder func(key string) string
+
+// KeyDecoder decodes a key of remote tiers into the key of the cache, ok is
+// false if the key is not encoded for the cache, e.g. of another environment.
+type KeyDecoder func(key string) (string, bool)
+
+// PrefixKeys returns the KeyEncoder and KeyDecoder prepending prefix to
+// keys, such as "prod:", so that environments sharing a Redis cluster do
+// not collide.
+func PrefixKeys(prefix string) (KeyEncoder, KeyDecoder) {
+	return func(key string) string {
+			return prefix + key
+		}, func(key string) (string, bool) {
+			return strings.CutPrefix(key, prefix)
+		}
+}
+
+// HashLongKeys returns a KeyEncoder replacing the keys longer than max
+// bytes by their leading bytes followed by '#' and their hex SHA-256, max
+// bytes in total, such as 250 for memcached. Hashed keys are not decoded.
+func HashLongKeys(max int) KeyEncoder {
+	return func(key string) string {
+		if len(key) <= max {
+			return key
+		}
+		sum := sha256.Sum256([]byte(key))
+		hash := hex.EncodeToString(sum[:])
+		if n := max - len(hash) - 1; n > 0 {
+			return key[:n] + "#" + hash
+		}
+		return hash
+	}
+}
+
+// encodeKeys wraps the functions talking to remote tiers by KeyEncoder and
+// KeyDecoder.
+func (c *cache) encodeKeys() {
+	enc, dec := c.opt.KeyEncoder, c.opt.KeyDecoder
+	if enc != nil {
+		if fetch := c.opt.Fetcher; fetch != nil {
+			c.opt.Fetcher = func(key string) (interface{}, error) {
+				return fetch(enc(key))
+			}
+		}
+		if fetch := c.opt.BatchFetcher; fetch != nil {
+			c.opt.BatchFetcher = func(keys []string) (map[string]interface{}, error) {
+				encoded := make([]string, len(keys))
+				byEncoded := make(map[string]string, len(keys))
+				for i, k := range keys {
+					encoded[i] = enc(k)
+					byEncoded[encoded[i]] = k
+				}
+				vals, err := fetch(encoded)
+				data := make(map[string]interface{}, len(vals))
+				for k, v := range vals {
+					if key, ok := byEncoded[k]; ok {
+						data[key] = v
+					}
+				}
+				return data, err
+			}
+		}
+		if write := c.opt.Writer; write != nil {
+			c.opt.Writer = func(key string, val interface{}) error {
+				return write(enc(key), val)
+			}
+		}
+		if write := c.opt.BatchWriter; write != nil {
+			c.opt.BatchWriter = func(vals map[string]interface{}) error {
+				encoded := make(map[string]interface{}, len(vals))
+				for k, v := range vals {
+					encoded[enc(k)] = v
+				}
+				return write(encoded)
+			}
+		}
+	}
+	if dec != nil {
+		if list := c.opt.KeyLister; list != nil {
+			c.opt.KeyLister = func() ([]string, error) {
+				keys, err := list()
+				// the keys may be held by the lister, they are not decoded in place.
+				decoded := make([]string, 0, len(keys))
+				for _, k := range keys {
+					if key, ok := dec(k); ok {
+						decoded = append(decoded, key)
+					}
+				}
+				return decoded, err
+			}
+		}
+		if fetch := c.opt.SnapshotFetcher; fetch != nil {
+			c.opt.SnapshotFetcher = func() (map[string]interface{}, string, error) {
+				vals, version, err := fetch()
+				data := make(map[string]interface{}, len(vals))
+				for k, v := range vals {
+					if key, ok := dec(k); ok {
+						data[key] = v
+					}
+				}
+				return data, version, err
+			}
+		}
+	}
+}
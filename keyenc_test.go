@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyEncoder(t *testing.T) {
+	enc, dec := PrefixKeys("prod:")
+	var written []string
+	listed := []string{"prod:a", "dev:b", "prod:c"}
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		KeyEncoder:      enc,
+		KeyDecoder:      dec,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		BatchFetcher: func(keys []string) (map[string]interface{}, error) {
+			data := make(map[string]interface{})
+			for _, k := range keys {
+				data[k] = "batch " + k
+			}
+			return data, nil
+		},
+		Writer: func(key string, val interface{}) error {
+			written = append(written, key)
+			return nil
+		},
+		KeyLister: func() ([]string, error) {
+			return listed, nil
+		},
+		MirrorKeys: true,
+	}).(*cache)
+	defer c.Close()
+
+	v, _ := c.Get("a")
+	Assert(t, v == "prod:a")
+	DeepEqual(t, c.GetOrSetMulti(map[string]interface{}{"c": nil}), map[string]interface{}{"c": "batch prod:c"})
+	Assert(t, c.Put("d", 1) == nil)
+	DeepEqual(t, written, []string{"prod:d"})
+
+	c.refresh()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": "prod:a", "c": "prod:c"})
+	// the slice of the lister is not overwritten by the decoding
+	c.refresh()
+	DeepEqual(t, listed, []string{"prod:a", "dev:b", "prod:c"})
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": "prod:a", "c": "prod:c"})
+}
+
+func TestHashLongKeys(t *testing.T) {
+	enc := HashLongKeys(80)
+	Assert(t, enc("short") == "short")
+	long := strings.Repeat("k", 100)
+	h := enc(long)
+	Assert(t, len(h) == 80 && strings.HasPrefix(h, strings.Repeat("k", 15)+"#"))
+	Assert(t, h != enc(long+"x"))
+	Assert(t, len(HashLongKeys(10)(long)) == 64)
+}
@@ -0,0 +1,81 @@
+// Package kvwatch provides a watch-driven mode of asynccache, where entries
+// are updated by the events of a KV watch, such as an etcd watch or Consul
+// blocking queries, instead of being polled by the Fetcher.
+package kvwatch
+
+import (
+	"errors"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// ErrNotFound is cached for the keys that are missed without a Fetcher,
+// until a Put event of the key arrives.
+var ErrNotFound = errors.New("kvwatch: key not found")
+
+// EventType is the type of Event.
+type EventType int
+
+const (
+	// Put means the key is created or modified.
+	Put EventType = iota
+	// Delete means the key is deleted.
+	Delete
+)
+
+// Event is a change of a key in the KV store.
+type Event struct {
+	Type  EventType
+	Key   string
+	Value []byte
+}
+
+// Options controls the behavior of the watch-driven cache.
+type Options struct {
+	// EnableRefresh is ignored. Fetcher is optional, it is used to load the
+	// keys that are missed before any event of them arrives, and the keys
+	// expired by SoftTTL and HardTTL, which MUST NOT be set without it: the
+	// events of an expired key may never arrive again.
+	asynccache.Options
+
+	// Decode decodes the value of a Put event into the cached value.
+	// If Decode is nil, the value is cached as []byte.
+	Decode func(key string, value []byte) (interface{}, error)
+}
+
+// New creates a cache updated by events until events is closed.
+// Events failing to decode are reported to ErrorHandler and leave the entry unchanged.
+func New(opt Options, events <-chan Event) asynccache.Cache {
+	aopt := opt.Options
+	aopt.EnableRefresh = false
+	if aopt.Fetcher == nil && (aopt.SoftTTL > 0 || aopt.HardTTL > 0) {
+		panic("kvwatch: SoftTTL and HardTTL need a Fetcher")
+	}
+	if aopt.Fetcher == nil {
+		aopt.Fetcher = func(key string) (interface{}, error) {
+			return nil, ErrNotFound
+		}
+	}
+	c := asynccache.NewCache(aopt)
+	go watch(c, opt, events)
+	return c
+}
+
+func watch(c asynccache.Cache, opt Options, events <-chan Event) {
+	for e := range events {
+		switch e.Type {
+		case Put:
+			var val interface{} = e.Value
+			if opt.Decode != nil {
+				var err error
+				if val, err = opt.Decode(e.Key, e.Value); err != nil {
+					c.(asynccache.ErrorReporter).ReportError(e.Key, err)
+					continue
+				}
+			}
+			c.Set(e.Key, val)
+		case Delete:
+			c.Delete(e.Key)
+		}
+	}
+}
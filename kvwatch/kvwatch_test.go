@@ -0,0 +1,62 @@
+package kvwatch
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestWatch(t *testing.T) {
+	events := make(chan Event)
+	var failed []string
+	c := New(Options{
+		Options: asynccache.Options{
+			EnableExpire:   true,
+			ExpireDuration: time.Hour,
+			ErrorHandler: func(key string, err error) {
+				failed = append(failed, key)
+			},
+		},
+		Decode: func(key string, value []byte) (interface{}, error) {
+			return strconv.Atoi(string(value))
+		},
+	}, events)
+
+	if _, err := c.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get error = %v; want ErrNotFound", err)
+	}
+
+	events <- Event{Type: Put, Key: "a", Value: []byte("1")}
+	events <- Event{Type: Put, Key: "b", Value: []byte("2")}
+	events <- Event{Type: Put, Key: "b", Value: []byte("x")}
+	events <- Event{Type: Delete, Key: "c"}
+	events <- Event{Type: Delete, Key: "b"}
+	events <- Event{Type: Put, Key: "a", Value: []byte("3")}
+	// an unbuffered send returns after the previous event is applied
+	events <- Event{Type: Delete, Key: "c"}
+	close(events)
+
+	v, err := c.Get("a")
+	if err != nil || v.(int) != 3 {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+	if data := c.Dump(); len(data) != 1 {
+		t.Fatalf("Dump = %v", data)
+	}
+	c.Close()
+	if len(failed) != 1 || failed[0] != "b" {
+		t.Fatalf("failed = %v", failed)
+	}
+}
+
+func TestTTLNeedsFetcher(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("New did not panic")
+		}
+	}()
+	New(Options{Options: asynccache.Options{HardTTL: time.Minute}}, make(chan Event))
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LeaseToken is the right of an external writer to set a key, granted by Lease.
+type LeaseToken uint64
+
+type lease struct {
+	token    LeaseToken
+	deadline int64 // unix nano
+}
+
+// Lease grants the right to set the key by SetWithLease within ttl.
+func (c *cache) Lease(key string, ttl time.Duration) (LeaseToken, error) {
+	key = c.key(key)
+	if c.IsClosed() {
+		return 0, ErrClosed
+	}
+	now := time.Now().UnixNano()
+	l := &lease{token: LeaseToken(atomic.AddUint64(&c.leaseSeq, 1)), deadline: now + int64(ttl)}
+	for {
+		old, loaded := c.leases.LoadOrStore(key, l)
+		if !loaded {
+			return l.token, nil
+		}
+		if old.(*lease).deadline > now {
+			return 0, ErrLeased
+		}
+		if c.leases.CompareAndSwap(key, old, l) {
+			return l.token, nil
+		}
+	}
+}
+
+// SetWithLease sets the value of the key and releases the lease of token.
+func (c *cache) SetWithLease(key string, val interface{}, token LeaseToken) error {
+	key = c.key(key)
+	if c.IsClosed() {
+		return ErrClosed
+	}
+	v, ok := c.leases.Load(key)
+	if !ok || v.(*lease).token != token || v.(*lease).deadline <= time.Now().UnixNano() {
+		return ErrLeaseExpired
+	}
+	// the lease is released after the value is set, so that no refresh
+	// stores a value fetched before
+	c.set(key, val)
+	c.leases.CompareAndDelete(key, v)
+	return nil
+}
+
+// leased reports whether the key is leased, so that refreshes do not store
+// fetched values.
+func (c *cache) leased(key string) bool {
+	v, ok := c.leases.Load(key)
+	return ok && v.(*lease).deadline > time.Now().UnixNano()
+}
+
+// purgeLeases deletes the expired leases.
+func (c *cache) purgeLeases() {
+	now := time.Now().UnixNano()
+	c.leases.Range(func(key, value interface{}) bool {
+		if value.(*lease).deadline <= now {
+			c.leases.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	var n int32
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&n, 1), nil
+		},
+	}).(*cache)
+	defer c.Close()
+	v, _ := c.Get("a")
+	Assert(t, v.(int32) == 1)
+
+	token, err := c.Lease("a", time.Minute)
+	Assert(t, err == nil)
+	_, err = c.Lease("a", time.Minute)
+	Assert(t, errors.Is(err, ErrLeased))
+
+	// the refresh racing with the writer does not store its value
+	c.refresh()
+	Assert(t, atomic.LoadInt32(&n) == 2)
+	v, _ = c.Get("a")
+	Assert(t, v.(int32) == 1)
+
+	Assert(t, c.SetWithLease("a", int32(10), token) == nil)
+	v, _ = c.Get("a")
+	Assert(t, v.(int32) == 10)
+	// the lease is released
+	Assert(t, errors.Is(c.SetWithLease("a", int32(11), token), ErrLeaseExpired))
+	c.refresh()
+	v, _ = c.Get("a")
+	Assert(t, v.(int32) == 3)
+}
+
+func TestLeaseExpired(t *testing.T) {
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+	}).(*cache)
+	defer c.Close()
+
+	token, err := c.Lease("a", time.Millisecond)
+	Assert(t, err == nil)
+	time.Sleep(5 * time.Millisecond)
+	Assert(t, !c.leased("a"))
+	// an expired lease is taken over
+	token2, err := c.Lease("a", time.Minute)
+	Assert(t, err == nil && token2 != token)
+	Assert(t, errors.Is(c.SetWithLease("a", "x", token), ErrLeaseExpired))
+	Assert(t, c.SetWithLease("a", "x", token2) == nil)
+	v, _ := c.Get("a")
+	Assert(t, v == "x")
+
+	c.Lease("b", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	c.purgeLeases()
+	_, ok := c.leases.Load("b")
+	Assert(t, !ok)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import "fmt"
+
+// listKeys lists the keys by KeyLister, and returns the items of the listed
+// and unlisted keys, and the listed keys not cached. If listing fails, the
+// items are returned as listed.
+func (c *cache) listKeys(items []refreshItem) (kept, dropped []refreshItem, missing []string, err error) {
+	keys, err := c.opt.KeyLister()
+	if err != nil {
+		err = fmt.Errorf("asynccache: list keys: %w", err)
+		if c.opt.ErrorHandler != nil {
+			c.dispatch(func() { c.opt.ErrorHandler("", err) })
+		}
+		return items, nil, nil, err
+	}
+	listed := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		listed[c.key(k)] = true
+	}
+	if c.opt.MirrorKeys {
+		all := make(map[string]bool, len(listed))
+		for k := range listed {
+			all[k] = true
+		}
+		c.listed.Store(&all)
+	}
+	for _, it := range items {
+		if listed[it.key] {
+			kept = append(kept, it)
+			delete(listed, it.key)
+		} else {
+			dropped = append(dropped, it)
+		}
+	}
+	for k := range listed {
+		missing = append(missing, k)
+	}
+	return kept, dropped, missing, nil
+}
+
+// unlisted reports whether the key is not in the last listing with MirrorKeys
+// set, or not in the dataset of SnapshotFetcher without Fetcher.
+func (c *cache) unlisted(key string) bool {
+	if c.opt.SnapshotFetcher != nil && c.opt.Fetcher == nil {
+		return true
+	}
+	if !c.opt.MirrorKeys {
+		return false
+	}
+	listed := c.listed.Load()
+	return listed != nil && !(*listed)[key]
+}
+
+// populate fetches and caches the keys.
+func (c *cache) populate(keys []string) {
+	for _, key := range keys {
+		if c.IsClosed() {
+			return
+		}
+		c.sfg.Do(key, func() (interface{}, error) {
+			v, t, err := c.fetch(OpFetch, key)
+			if c.nilDeleted(err) {
+				return nil, nil
+			}
+			err = wrapErr("fetch", key, err)
+			if err != nil && c.opt.ErrorHandler != nil {
+				c.dispatch(func() { c.opt.ErrorHandler(key, err) })
+			}
+			ety := c.newEntry()
+			ety.storeTTL(v, err, t)
+			return c.storeNew(key, ety), nil
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyLister(t *testing.T) {
+	var mu sync.Mutex
+	keys := []string{"a", "b"}
+	var listErr error
+	fetched := make(map[string]int)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetched[key]++
+			return key, nil
+		},
+		KeyLister: func() ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return keys, listErr
+		},
+	}).(*cache)
+	defer c.Close()
+
+	c.refresh()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": "a", "b": "b"})
+
+	mu.Lock()
+	keys = []string{"b", "c"}
+	mu.Unlock()
+	c.refresh()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": "a", "b": "b", "c": "c"})
+	mu.Lock()
+	DeepEqual(t, fetched, map[string]int{"a": 1, "b": 2, "c": 1})
+	listErr = errors.New("error")
+	mu.Unlock()
+
+	// all cached keys are refreshed if listing fails
+	c.refresh()
+	mu.Lock()
+	defer mu.Unlock()
+	DeepEqual(t, fetched, map[string]int{"a": 2, "b": 3, "c": 2})
+}
+
+func TestMirrorKeys(t *testing.T) {
+	var mu sync.Mutex
+	keys := []string{"a", "b"}
+	deleted := make(chan string, 10)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		KeyLister: func() ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return keys, nil
+		},
+		MirrorKeys: true,
+		DeleteHandler: func(key string, oldData interface{}, reason DeleteReason) {
+			deleted <- key
+		},
+	}).(*cache)
+	defer c.Close()
+
+	val, err := c.Get("x")
+	Assert(t, err == nil && val == "x")
+	c.refresh()
+	Assert(t, <-deleted == "x")
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": "a", "b": "b"})
+
+	_, err = c.Get("y")
+	Assert(t, err == ErrNotFound)
+	Assert(t, c.GetOrSet("y", "def") == "def")
+
+	mu.Lock()
+	keys = []string{"b"}
+	mu.Unlock()
+	c.refresh()
+	Assert(t, <-deleted == "a")
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b": "b"})
+}
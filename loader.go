@@ -0,0 +1,25 @@
+package cache
+
+import "context"
+
+// Loader loads the value of a key from the source of the cache, as an
+// alternative to Options.Fetcher for sources with dependencies or state,
+// which may be decorated with retries, metrics and the like.
+type Loader interface {
+	// Load loads the value of key, ctx is canceled once the cache is closed.
+	Load(ctx context.Context, key string) (interface{}, error)
+}
+
+// LoaderFunc adapts a function to Loader.
+type LoaderFunc func(ctx context.Context, key string) (interface{}, error)
+
+// Load implements Loader.
+func (f LoaderFunc) Load(ctx context.Context, key string) (interface{}, error) {
+	return f(ctx, key)
+}
+
+// load calls Loader with the context of the cache, it is the Fetcher of
+// caches with Loader set.
+func (c *cache) load(key string) (interface{}, error) {
+	return c.opt.Loader.Load(c.ctx, key)
+}
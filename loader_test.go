@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+type testLoader struct {
+	prefix string
+}
+
+func (l *testLoader) Load(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.prefix + key, nil
+}
+
+func TestLoader(t *testing.T) {
+	c := NewCache(Options{Loader: &testLoader{prefix: "val-"}})
+	v, err := c.Get("a")
+	Assert(t, err == nil && v == "val-a")
+
+	var ctx context.Context
+	c2 := NewCache(Options{
+		Loader: LoaderFunc(func(c context.Context, key string) (interface{}, error) {
+			ctx = c
+			return key, nil
+		}),
+	})
+	c2.Get("a")
+	Assert(t, ctx.Err() == nil)
+	c2.Close()
+	Assert(t, ctx.Err() == context.Canceled)
+	c.Close()
+}
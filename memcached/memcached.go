@@ -0,0 +1,135 @@
+// Package memcached serves a Cache over the memcached text protocol, so
+// services in other languages can read the asynchronously refreshed data
+// with their existing memcached clients.
+//
+// The get, gets, set, delete, version and quit commands are supported.
+// get reads through the Cache, so missed keys are fetched by its Fetcher;
+// keys caching an error are reported as missed.
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// maxValueSize limits the size of values accepted by set.
+const maxValueSize = 1 << 20
+
+// Server serves a Cache over the memcached text protocol.
+type Server struct {
+	Cache asynccache.Cache
+	Codec asynccache.Codec
+}
+
+// Serve accepts connections on lis until it is closed.
+func (s *Server) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection until the client quits or an I/O error occurs.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if quit := s.handle(fields, r, w); quit {
+			w.Flush()
+			return
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(fields []string, r *bufio.Reader, w *bufio.Writer) (quit bool) {
+	switch fields[0] {
+	case "get", "gets":
+		for _, key := range fields[1:] {
+			val, err := s.Cache.Get(key)
+			if err != nil || val == nil {
+				continue
+			}
+			data, err := s.Codec.Marshal(val)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "VALUE %s 0 %d", key, len(data))
+			if fields[0] == "gets" {
+				w.WriteString(" 0")
+			}
+			w.WriteString("\r\n")
+			w.Write(data)
+			w.WriteString("\r\n")
+		}
+		w.WriteString("END\r\n")
+	case "set":
+		// set <key> <flags> <exptime> <bytes> [noreply]
+		if len(fields) < 5 {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return false
+		}
+		n, err := strconv.Atoi(fields[4])
+		if err != nil || n < 0 || n > maxValueSize {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return false
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return true
+		}
+		if string(data[n:]) != "\r\n" {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return false
+		}
+		reply := "STORED\r\n"
+		if val, err := s.Codec.Unmarshal(data[:n]); err != nil {
+			reply = "CLIENT_ERROR " + err.Error() + "\r\n"
+		} else {
+			s.Cache.Set(fields[1], val)
+		}
+		if !noreply(fields, 5) {
+			w.WriteString(reply)
+		}
+	case "delete":
+		if len(fields) < 2 {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return false
+		}
+		s.Cache.Delete(fields[1])
+		if !noreply(fields, 2) {
+			// the Cache does not report whether the key existed.
+			w.WriteString("DELETED\r\n")
+		}
+	case "version":
+		w.WriteString("VERSION asynccache\r\n")
+	case "quit":
+		return true
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false
+}
+
+func noreply(fields []string, i int) bool {
+	return len(fields) > i && fields[i] == "noreply"
+}
@@ -0,0 +1,59 @@
+package memcached
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestServeConn(t *testing.T) {
+	c := asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("bad key")
+			}
+			return "val-" + key, nil
+		},
+	})
+	client, server := net.Pipe()
+	go (&Server{Cache: c, Codec: asynccache.StringCodec{}}).ServeConn(server)
+	defer client.Close()
+	r := bufio.NewReader(client)
+
+	cases := []struct {
+		req, resp string
+	}{
+		{"get a bad\r\n", "VALUE a 0 5\r\nval-a\r\nEND\r\n"},
+		{"set b 0 0 3\r\nnew\r\n", "STORED\r\n"},
+		{"gets b\r\n", "VALUE b 0 3 0\r\nnew\r\nEND\r\n"},
+		{"delete b\r\n", "DELETED\r\n"},
+		{"set c 0 0 1 noreply\r\nx\r\nversion\r\n", "VERSION asynccache\r\n"},
+		{"unknown\r\n", "ERROR\r\n"},
+	}
+	for _, tc := range cases {
+		go client.Write([]byte(tc.req))
+		var resp strings.Builder
+		for resp.Len() < len(tc.resp) {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.WriteString(line)
+		}
+		if resp.String() != tc.resp {
+			t.Fatalf("%q: resp = %q; want %q", tc.req, resp.String(), tc.resp)
+		}
+	}
+
+	data := c.Dump()
+	if _, ok := data["b"]; ok || data["c"] != "x" {
+		t.Fatalf("Dump = %v", data)
+	}
+}
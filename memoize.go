@@ -0,0 +1,34 @@
+package cache
+
+import "time"
+
+// The defaults of KeyedOptions.RefreshDuration and ExpireDuration of Memoize.
+const (
+	defaultMemoizeRefresh = time.Minute
+	defaultMemoizeExpire  = 10 * time.Minute
+)
+
+// Memoize returns fn memoized by a KeyedCache created with opt and fn as
+// Fetcher, and stop closing the cache. The results are refreshed in
+// background every RefreshDuration (default 1m), so that calls seldom wait
+// for fn, and keys not called during ExpireDuration (default 10m) are
+// deleted; set either negative to disable it. Errors are not memoized: the
+// next call of the key calls fn again.
+func Memoize[K comparable, V any](fn func(K) (V, error), opt KeyedOptions[K, V]) (memo func(K) (V, error), stop func()) {
+	opt.Fetcher = fn
+	if opt.RefreshDuration == 0 {
+		opt.RefreshDuration = defaultMemoizeRefresh
+	}
+	if opt.ExpireDuration == 0 {
+		opt.ExpireDuration = defaultMemoizeExpire
+	}
+	c := NewKeyedCache(opt)
+	memo = func(key K) (V, error) {
+		val, err := c.Get(key)
+		if err != nil {
+			c.forgetErr(key)
+		}
+		return val, err
+	}
+	return memo, c.Close
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// EvictPolicy selects the entries evicted when the memory is high.
+type EvictPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entries first. The recency is
+	// known only if EnableKeyStats is true, otherwise it behaves as EvictLargest.
+	EvictLRU EvictPolicy = iota
+	// EvictLargest evicts the largest entries first.
+	EvictLargest
+)
+
+type evictCandidate struct {
+	key        string
+	value      interface{}
+	size       int64
+	lastAccess int64
+}
+
+func (c *cache) memoryWatcher() {
+	ticker := time.NewTicker(c.opt.MemoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.checkMemory()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// checkMemory evicts entries down to MemoryLowWatermark if the estimated
+// size exceeds MemoryHighWatermark.
+func (c *cache) checkMemory() {
+	weigh := c.opt.Weigher
+	if weigh == nil {
+		weigh = DefaultWeigher
+	}
+	var total int64
+	var candidates []evictCandidate
+	c.rangeEntries(func(key string, e *entry) bool {
+		val, _ := e.loadRaw()
+		cand := evictCandidate{key: key, value: e}
+		cand.size = weigh(cand.key, val) + entryOverhead
+		if e.stats != nil {
+			cand.lastAccess = atomic.LoadInt64(&e.stats.lastAccess)
+		}
+		total += cand.size
+		candidates = append(candidates, cand)
+		return true
+	})
+	if total <= c.opt.MemoryHighWatermark {
+		return
+	}
+	c.emit(Event{Type: EventMemoryHigh, Size: total})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if c.opt.MemoryEvictPolicy == EvictLRU && a.lastAccess != b.lastAccess {
+			return a.lastAccess < b.lastAccess
+		}
+		return a.size > b.size
+	})
+	for _, cand := range candidates {
+		if total <= c.opt.MemoryLowWatermark {
+			break
+		}
+		if !c.remove(cand.key, cand.value, ReasonEvicted) {
+			continue
+		}
+		total -= cand.size
+		c.emit(Event{Type: EventEvicted, Key: cand.key, Size: cand.size})
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryWatermark(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		Weigher: func(key string, val interface{}) int64 {
+			return int64(len(val.(string))) - entryOverhead
+		},
+		EnableKeyStats:      true,
+		MemoryHighWatermark: 10,
+		MemoryLowWatermark:  6,
+		MemoryCheckInterval: time.Hour,
+		EventHandler: func(ev Event) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		},
+	}
+	c := NewCache(op).(*cache)
+	for _, key := range []string{"aaa", "bbb", "ccc", "ddd"} {
+		c.Get(key)
+		time.Sleep(time.Millisecond)
+	}
+	c.Get("aaa")
+
+	c.checkMemory()
+	keys := make([]string, 0)
+	for k := range c.Dump() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	DeepEqual(t, keys, []string{"aaa", "ddd"})
+
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	Assert(t, len(events) == 3)
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+	DeepEqual(t, events, []Event{
+		{Type: EventMemoryHigh, Size: 12},
+		{Type: EventEvicted, Key: "bbb", Size: 3},
+		{Type: EventEvicted, Key: "ccc", Size: 3},
+	})
+}
+
+func TestMemoryEvictLargest(t *testing.T) {
+	op := Options{
+		Weigher: func(key string, val interface{}) int64 {
+			return int64(len(val.(string))) - entryOverhead
+		},
+		MemoryHighWatermark: 10,
+		MemoryEvictPolicy:   EvictLargest,
+	}
+	c := NewCache(op).(*cache)
+	c.SetDefault("a", "1")
+	c.SetDefault("b", "12345678")
+	c.SetDefault("c", "123")
+	c.checkMemory()
+	DeepEqual(t, c.Dump(), map[string]interface{}{"a": "1", "c": "123"})
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package mmapfile
+
+import (
+	"io"
+	"os"
+)
+
+// mmap reads the file into memory where memory mapping is not supported.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(f, data)
+	return data, err
+}
+
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package mmapfile caches large read-only datasets, such as GeoIP
+// databases, as memory-mapped files.
+//
+// A Mapping is an io.Closer, so the cache unmaps a replaced or deleted
+// mapping only once all the Handles of it returned by Acquire are released.
+// Readers holding a Handle keep reading the old mapping while a refresh
+// swaps in the new one, and the pages of both are backed by the files
+// rather than the heap, so refreshes of multi-hundred-MB datasets neither
+// double the heap nor race readers:
+//
+//	c := asynccache.NewCache(asynccache.Options{
+//		EnableRefresh:   true,
+//		RefreshDuration: time.Hour,
+//		Fetcher:         mmapfile.Fetcher(func(key string) string { return "/data/" + key + ".mmdb" }),
+//	})
+//	h, err := c.Acquire("GeoLite2-City")
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Release()
+//	data := h.Value().(*mmapfile.Mapping).Bytes()
+//
+// Files MUST be replaced by renaming new files over them rather than
+// written in place, since writes show through the mappings.
+package mmapfile
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrClosed is returned by Close of a closed Mapping.
+var ErrClosed = errors.New("mmapfile: mapping is closed")
+
+// Mapping is a read-only memory mapping of a file.
+type Mapping struct {
+	mu   sync.Mutex
+	data []byte
+	path string
+}
+
+// Open maps the file at path.
+func Open(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := mmap(f, st.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &Mapping{data: data, path: path}, nil
+}
+
+// Bytes returns the content of the file, it MUST not be modified, nor used
+// after Close.
+func (m *Mapping) Bytes() []byte {
+	return m.data
+}
+
+// Path returns the path of the file.
+func (m *Mapping) Path() string {
+	return m.path
+}
+
+// Close unmaps the file.
+func (m *Mapping) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil && m.path == "" {
+		return ErrClosed
+	}
+	data := m.data
+	m.data, m.path = nil, ""
+	return munmap(data)
+}
+
+// Fetcher returns a Fetcher mapping the file at the path of each key.
+func Fetcher(path func(key string) string) func(key string) (interface{}, error) {
+	return func(key string) (interface{}, error) {
+		return Open(path(key))
+	}
+}
@@ -0,0 +1,78 @@
+package mmapfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestSwapOnRefresh(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) {
+		tmp := filepath.Join(dir, "tmp")
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, "geo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("v1")
+	c := asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher:         Fetcher(func(key string) string { return filepath.Join(dir, key) }),
+	})
+	defer c.Close()
+
+	h, err := c.Acquire("geo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := h.Value().(*Mapping)
+	if string(old.Bytes()) != "v1" {
+		t.Fatalf("read %q", old.Bytes())
+	}
+
+	write("v2")
+	if err = c.Refresh("geo"); err != nil {
+		t.Fatal(err)
+	}
+	val, _ := c.Get("geo")
+	if string(val.(*Mapping).Bytes()) != "v2" {
+		t.Fatalf("refreshed to %q", val.(*Mapping).Bytes())
+	}
+	// the old mapping is readable until released
+	if string(old.Bytes()) != "v1" {
+		t.Fatalf("read %q", old.Bytes())
+	}
+	h.Release()
+	if old.Close() != ErrClosed {
+		t.Fatal("the old mapping is not closed")
+	}
+
+	c.Delete("geo")
+	if val.(*Mapping).Close() != ErrClosed {
+		t.Fatal("the deleted mapping is not closed")
+	}
+}
+
+func TestOpenEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Open(path)
+	if err != nil || len(m.Bytes()) != 0 || m.Path() != path {
+		t.Fatalf("Open = %v, %v", m, err)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(path + "x"); !os.IsNotExist(err) {
+		t.Fatalf("error = %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package cache
+
+import "time"
+
+// GetOrSetMulti resolves the keys of defaults at once, see Cache.GetOrSetMulti.
+func (c *cache) GetOrSetMulti(defaults map[string]interface{}) map[string]interface{} {
+	vals := make(map[string]interface{}, len(defaults))
+	if c.opt.BatchFetcher == nil {
+		for k, def := range defaults {
+			vals[k] = c.GetOrSet(k, def)
+		}
+		return vals
+	}
+	missing := make(map[string]string) // key -> the key passed
+	for k, def := range defaults {
+		key := c.key(k)
+		if _, ok := c.data().Load(key); ok || c.IsClosed() || c.unlisted(key) {
+			vals[k] = c.getOrSet(key, def, 0)
+			continue
+		}
+		c.miss(key)
+		missing[key] = k
+	}
+	if len(missing) > 0 {
+		c.batchFetch(missing, defaults, vals)
+	}
+	return vals
+}
+
+// batchCall is a BatchFetcher call of the keys missed by GetOrSetMulti.
+// Its fields are written once before done is closed.
+type batchCall struct {
+	done       chan struct{}
+	fetched    map[string]interface{}
+	err        error
+	acquireErr error // the call did not run for MaxConcurrentFetches
+}
+
+// fetch is the Invoker of key for the interceptors, it waits for the call.
+func (b *batchCall) fetch(key string) (interface{}, error) {
+	<-b.done
+	if b.err != nil {
+		return nil, b.err
+	}
+	val, ok := b.fetched[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return val, nil
+}
+
+// batchFetch fetches the missing keys by one BatchFetcher call, stores them
+// as GetOrSet does, and sets their values or defaults to vals. The keys are
+// fetched in the singleflight key-space of the misses, so that the keys
+// being fetched by a concurrent miss are waited for instead, and the value
+// of each key passes the interceptors as OpFetch.
+func (c *cache) batchFetch(missing map[string]string, defaults, vals map[string]interface{}) {
+	b := &batchCall{done: make(chan struct{})}
+	chans := make(map[string]<-chan Result, len(missing))
+	keys := make([]string, 0, len(missing))
+	for key := range missing {
+		ch, called := c.sfg.DoChan(key, c.fetchBatched(key, b))
+		chans[key] = ch
+		if called {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		close(b.done)
+	} else {
+		go func() {
+			defer close(b.done)
+			if b.acquireErr = c.acquireFetch(); b.acquireErr != nil {
+				return
+			}
+			defer c.releaseFetch()
+			b.fetched, b.err = c.opt.BatchFetcher(keys)
+		}()
+	}
+
+	if c.opt.BackgroundFetch {
+		for _, k := range missing {
+			vals[k] = defaults[k]
+		}
+		return
+	}
+	var timeout <-chan time.Time
+	if c.opt.FirstFetchTimeout > 0 {
+		timer := time.NewTimer(c.opt.FirstFetchTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	timedOut := false
+	for key, ch := range chans {
+		k := missing[key]
+		def := defaults[k]
+		var res Result
+		select {
+		case res = <-ch:
+		default:
+			if timedOut {
+				c.ReportError(key, wrapErr("fetch", key, ErrFetchTimeout))
+				vals[k] = def
+				continue
+			}
+			select {
+			case res = <-ch:
+			case <-timeout:
+				timedOut = true
+				c.ReportError(key, wrapErr("fetch", key, ErrFetchTimeout))
+				vals[k] = def
+				continue
+			}
+		}
+		if e, ok := res.Val.(*entry); ok {
+			vals[k] = c.orDefault(key, e, def)
+		} else {
+			vals[k] = def
+		}
+	}
+}
+
+// fetchBatched is fetchMissing of key by the BatchFetcher call b.
+func (c *cache) fetchBatched(key string, b *batchCall) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		v, t, err := c.fetchBy(OpFetch, key, b.fetch)
+		select {
+		case <-b.done:
+			if b.acquireErr != nil {
+				return nil, b.acquireErr
+			}
+		default:
+			// an interceptor returned without waiting for the call
+		}
+		if c.nilDeleted(err) {
+			return nil, wrapErr("fetch", key, ErrNotFound)
+		}
+		ety := c.newEntry()
+		ety.storeTTL(v, wrapErr("fetch", key, err), t)
+		return c.storeNew(key, ety), nil
+	}
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetOrSetMulti(t *testing.T) {
+	var batches [][]string
+	var fail bool
+	c := NewCache(Options{
+		BatchFetcher: func(keys []string) (map[string]interface{}, error) {
+			sort.Strings(keys)
+			batches = append(batches, keys)
+			if fail {
+				return nil, errors.New("fail")
+			}
+			vals := make(map[string]interface{})
+			for _, k := range keys {
+				if k != "absent" {
+					vals[k] = "val-" + k
+				}
+			}
+			return vals, nil
+		},
+		ErrorPolicy: KeepErrorAndReturnDefault,
+	})
+	defer c.Close()
+	c.SetDefault("a", "cached")
+
+	vals := c.GetOrSetMulti(map[string]interface{}{"a": "def", "b": "def", "c": "def", "absent": "def"})
+	DeepEqual(t, vals, map[string]interface{}{"a": "cached", "b": "val-b", "c": "val-c", "absent": "def"})
+	DeepEqual(t, batches, [][]string{{"absent", "b", "c"}})
+	v, _ := c.Get("b")
+	Assert(t, v == "val-b")
+	_, err := c.Get("absent")
+	Assert(t, errors.Is(err, ErrNotFound))
+
+	fail = true
+	vals = c.GetOrSetMulti(map[string]interface{}{"b": "def", "d": "def"})
+	DeepEqual(t, vals, map[string]interface{}{"b": "val-b", "d": "def"})
+	Assert(t, len(batches) == 2)
+	Assert(t, c.Errors()["d"] != nil)
+}
+
+func TestGetOrSetMultiWithoutBatchFetcher(t *testing.T) {
+	c := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return "val-" + key, nil
+		},
+	})
+	defer c.Close()
+	vals := c.GetOrSetMulti(map[string]interface{}{"a": "def", "b": "def"})
+	DeepEqual(t, vals, map[string]interface{}{"a": "val-a", "b": "val-b"})
+}
+
+func TestGetOrSetMultiSharesFetches(t *testing.T) {
+	release := make(chan struct{})
+	var batches [][]string
+	var ops []string
+	var mu sync.Mutex
+	c := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			<-release
+			return "one-" + key, nil
+		},
+		BatchFetcher: func(keys []string) (map[string]interface{}, error) {
+			mu.Lock()
+			batches = append(batches, keys)
+			mu.Unlock()
+			vals := make(map[string]interface{})
+			for _, k := range keys {
+				vals[k] = "batch-" + k
+			}
+			return vals, nil
+		},
+		Interceptors: []Interceptor{func(op Operation, key string, invoker Invoker) (interface{}, error) {
+			if op == OpFetch {
+				mu.Lock()
+				ops = append(ops, key)
+				mu.Unlock()
+			}
+			return invoker(key)
+		}},
+	})
+	defer c.Close()
+
+	// a is being fetched by Get, and is waited for
+	got := make(chan interface{})
+	go func() {
+		v, _ := c.Get("a")
+		got <- v
+	}()
+	for {
+		mu.Lock()
+		n := len(ops)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	vals := c.GetOrSetMulti(map[string]interface{}{"a": "def", "b": "def"})
+	DeepEqual(t, vals, map[string]interface{}{"a": "one-a", "b": "batch-b"})
+	Assert(t, <-got == "one-a")
+	DeepEqual(t, batches, [][]string{{"b"}})
+	sort.Strings(ops)
+	DeepEqual(t, ops, []string{"a", "b"})
+}
+
+func TestGetOrSetMultiTimeout(t *testing.T) {
+	release := make(chan struct{})
+	batch := func(keys []string) (map[string]interface{}, error) {
+		<-release
+		vals := make(map[string]interface{})
+		for _, k := range keys {
+			vals[k] = "val-" + k
+		}
+		return vals, nil
+	}
+	c := NewCache(Options{BatchFetcher: batch, FirstFetchTimeout: 10 * time.Millisecond})
+	defer c.Close()
+	vals := c.GetOrSetMulti(map[string]interface{}{"a": "def", "b": "def"})
+	DeepEqual(t, vals, map[string]interface{}{"a": "def", "b": "def"})
+
+	bg := NewCache(Options{BatchFetcher: batch, BackgroundFetch: true})
+	defer bg.Close()
+	vals = bg.GetOrSetMulti(map[string]interface{}{"a": "def"})
+	DeepEqual(t, vals, map[string]interface{}{"a": "def"})
+
+	// the fetches go on, and the values are cached once done
+	close(release)
+	for _, cc := range []Cache{c, bg} {
+		for cc.Dump()["a"] == nil {
+			time.Sleep(time.Millisecond)
+		}
+		vals = cc.GetOrSetMulti(map[string]interface{}{"a": "def"})
+		DeepEqual(t, vals, map[string]interface{}{"a": "val-a"})
+	}
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+// FetchStrategy is how the results of Options.Fetchers make the fetched value.
+type FetchStrategy int
+
+const (
+	// FirstSuccess calls the fetchers in order until one succeeds.
+	FirstSuccess FetchStrategy = iota
+	// Fastest calls the fetchers concurrently, and takes the first success.
+	Fastest
+	// Quorum calls the fetchers concurrently, and takes the value returned
+	// by more than half of them, compared by IsSame (reflect.DeepEqual if
+	// IsSame is nil). Without such a value the fetch fails with ErrNoQuorum.
+	Quorum
+)
+
+// multiFetch fetches the key by Fetchers with FetchStrategy, it is used as Fetcher.
+func (c *cache) multiFetch(key string) (interface{}, error) {
+	switch c.opt.FetchStrategy {
+	case Fastest:
+		return c.fastestFetch(key)
+	case Quorum:
+		return c.quorumFetch(key)
+	}
+	errs := make([]error, 0, len(c.opt.Fetchers))
+	for _, fetch := range c.opt.Fetchers {
+		val, err := fetch(key)
+		if err == nil {
+			return val, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *cache) fastestFetch(key string) (interface{}, error) {
+	ch := make(chan result, len(c.opt.Fetchers))
+	for _, fetch := range c.opt.Fetchers {
+		go func() {
+			val, err := fetch(key)
+			ch <- result{val: val, err: err}
+		}()
+	}
+	errs := make([]error, 0, len(c.opt.Fetchers))
+	for range c.opt.Fetchers {
+		res := <-ch
+		if res.err == nil {
+			return res.val, nil
+		}
+		errs = append(errs, res.err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *cache) quorumFetch(key string) (interface{}, error) {
+	n := len(c.opt.Fetchers)
+	vals := make([]interface{}, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, fetch := range c.opt.Fetchers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals[i], errs[i] = fetch(key)
+		}()
+	}
+	wg.Wait()
+
+	// votes[i] is the number of the results equal to vals[i], the first of
+	// them, and 0 for the others
+	votes := make([]int, n)
+	best, groups := -1, 0
+	for i := range vals {
+		if errs[i] != nil {
+			continue
+		}
+		j := 0
+		for ; j < i; j++ {
+			if votes[j] > 0 && c.same(key, vals[j], vals[i]) {
+				break
+			}
+		}
+		if j == i {
+			groups++
+		}
+		votes[j]++
+		if best < 0 || votes[j] > votes[best] {
+			best = j
+		}
+	}
+	if (groups != 1 || votes[best] != n) && c.opt.FetchMismatchHandler != nil {
+		c.dispatch(func() { c.opt.FetchMismatchHandler(key, vals, errs) })
+	}
+	if best < 0 || votes[best]*2 <= n {
+		return nil, ErrNoQuorum
+	}
+	return vals[best], nil
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFetchers(t *testing.T) {
+	fail := errors.New("fail")
+	value := func(v interface{}) func(string) (interface{}, error) {
+		return func(string) (interface{}, error) { return v, nil }
+	}
+	failing := func(string) (interface{}, error) { return nil, fail }
+	slow := func(string) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "slow", nil
+	}
+
+	c := NewCache(Options{Fetchers: []func(string) (interface{}, error){failing, value("b"), value("c")}})
+	val, err := c.Get("k")
+	Assert(t, err == nil && val == "b")
+	c.Close()
+
+	c = NewCache(Options{Fetchers: []func(string) (interface{}, error){failing, failing}})
+	_, err = c.Get("k")
+	Assert(t, errors.Is(err, fail))
+	c.Close()
+
+	c = NewCache(Options{Fetchers: []func(string) (interface{}, error){slow, failing, value("fast")}, FetchStrategy: Fastest})
+	val, err = c.Get("k")
+	Assert(t, err == nil && val == "fast")
+	c.Close()
+
+	mismatches := make(chan []interface{}, 2)
+	newQuorum := func(fetchers ...func(string) (interface{}, error)) Cache {
+		return NewCache(Options{
+			Fetchers:      fetchers,
+			FetchStrategy: Quorum,
+			FetchMismatchHandler: func(key string, vals []interface{}, errs []error) {
+				mismatches <- vals
+			},
+		})
+	}
+	c = newQuorum(value("a"), value("a"), value("a"))
+	val, err = c.Get("k")
+	Assert(t, err == nil && val == "a")
+	c.Close()
+	Assert(t, len(mismatches) == 0)
+
+	c = newQuorum(value("a"), value("b"), value("b"))
+	val, err = c.Get("k")
+	Assert(t, err == nil && val == "b")
+	c.Close()
+	DeepEqual(t, <-mismatches, []interface{}{"a", "b", "b"})
+
+	c = newQuorum(value("a"), value("b"), failing, failing)
+	_, err = c.Get("k")
+	Assert(t, errors.Is(err, ErrNoQuorum))
+	c.Close()
+	DeepEqual(t, <-mismatches, []interface{}{"a", "b", nil, nil})
+}
@@ -0,0 +1,181 @@
+// Package peer turns a cluster of caches into a distributed read-through
+// cache, in the manner of groupcache.
+//
+// Keys are consistent-hashed to owner instances. The Fetcher of a non-owner
+// fetches from the owner over HTTP instead of hitting the origin, so each
+// key is fetched from the origin by one instance only.
+package peer
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// DefaultBasePath is the default path the Pool is served at.
+const DefaultBasePath = "/_asynccache/"
+
+// Options controls the behavior of Pool.
+type Options struct {
+	// Self is the base URL of this instance, e.g. "http://10.0.0.1:8080", it MUST be set.
+	Self string
+	// BasePath defaults to DefaultBasePath.
+	BasePath string
+	// Replicas is the number of virtual nodes per peer on the hash ring, it defaults to 50.
+	Replicas int
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// Codec encodes values between peers, it MUST be set.
+	Codec asynccache.Codec
+	// Fetcher fetches the value of an owned key from the origin, it MUST be set.
+	Fetcher func(key string) (interface{}, error)
+}
+
+// Pool picks the owner of keys among peers and serves owned keys to them.
+type Pool struct {
+	opt Options
+
+	mu    sync.RWMutex
+	ring  []uint32
+	nodes map[uint32]string
+	cache asynccache.Cache
+}
+
+// NewPool creates a Pool whose only peer is itself.
+func NewPool(opt Options) *Pool {
+	if opt.Self == "" || opt.Codec == nil || opt.Fetcher == nil {
+		panic("peer: Self, Codec and Fetcher MUST be set")
+	}
+	if opt.BasePath == "" {
+		opt.BasePath = DefaultBasePath
+	}
+	if opt.Replicas == 0 {
+		opt.Replicas = 50
+	}
+	if opt.Client == nil {
+		opt.Client = http.DefaultClient
+	}
+	p := &Pool{opt: opt}
+	p.Set(opt.Self)
+	return p
+}
+
+// Bind sets the cache served to peers, it should be the cache using p.Fetch as Fetcher.
+func (p *Pool) Bind(c asynccache.Cache) {
+	p.mu.Lock()
+	p.cache = c
+	p.mu.Unlock()
+}
+
+// Set updates the base URLs of the peers, including itself.
+func (p *Pool) Set(peers ...string) {
+	ring := make([]uint32, 0, len(peers)*p.opt.Replicas)
+	nodes := make(map[uint32]string, len(peers)*p.opt.Replicas)
+	for _, peer := range peers {
+		for i := 0; i < p.opt.Replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + peer))
+			ring = append(ring, h)
+			nodes[h] = peer
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+
+	p.mu.Lock()
+	p.ring, p.nodes = ring, nodes
+	p.mu.Unlock()
+}
+
+// Owner returns the base URL of the peer owning the key.
+func (p *Pool) Owner(key string) string {
+	h := crc32.ChecksumIEEE([]byte(key))
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.ring) == 0 {
+		return p.opt.Self
+	}
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i] >= h })
+	if i == len(p.ring) {
+		i = 0
+	}
+	return p.nodes[p.ring[i]]
+}
+
+// Fetch is the Fetcher of the cache. It fetches owned keys from the origin,
+// and other keys from their owners. If the owner is unreachable, the key is
+// fetched from the origin as well.
+func (p *Pool) Fetch(key string) (interface{}, error) {
+	owner := p.Owner(key)
+	if owner == p.opt.Self {
+		return p.opt.Fetcher(key)
+	}
+	val, err, fallback := p.fetchPeer(owner, key)
+	if fallback {
+		return p.opt.Fetcher(key)
+	}
+	return val, err
+}
+
+func (p *Pool) fetchPeer(owner, key string) (val interface{}, err error, fallback bool) {
+	resp, err := p.opt.Client.Get(owner + p.opt.BasePath + url.PathEscape(key))
+	if err != nil {
+		return nil, err, true
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err, true
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		val, err = p.opt.Codec.Unmarshal(body)
+		return val, err, false
+	case http.StatusBadGateway:
+		// the owner failed to fetch from the origin
+		return nil, fmt.Errorf("peer: fetch %q from %s: %s", key, owner, strings.TrimSpace(string(body))), false
+	}
+	return nil, fmt.Errorf("peer: unexpected status %d from %s", resp.StatusCode, owner), true
+}
+
+// ServeHTTP serves the owned keys to peers.
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, p.opt.BasePath) {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), p.opt.BasePath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.RLock()
+	c := p.cache
+	p.mu.RUnlock()
+
+	var val interface{}
+	if c != nil && p.Owner(key) == p.opt.Self {
+		val, err = c.Get(key)
+	} else {
+		// the peers disagree on the membership, serve from the origin
+		// directly instead of forwarding again.
+		val, err = p.opt.Fetcher(key)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	data, err := p.opt.Codec.Marshal(val)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,84 @@
+package peer
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestPool(t *testing.T) {
+	var fetches int32
+	origin := func(key string) (interface{}, error) {
+		atomic.AddInt32(&fetches, 1)
+		if key == "bad" {
+			return nil, errors.New("bad key")
+		}
+		return "val-" + key, nil
+	}
+
+	const n = 3
+	pools := make([]*Pool, n)
+	caches := make([]asynccache.Cache, n)
+	urls := make([]string, n)
+	for i := range pools {
+		srv := httptest.NewUnstartedServer(nil)
+		urls[i] = "http://" + srv.Listener.Addr().String()
+		pools[i] = NewPool(Options{Self: urls[i], Codec: asynccache.StringCodec{}, Fetcher: origin})
+		caches[i] = asynccache.NewCache(asynccache.Options{
+			EnableRefresh:   true,
+			RefreshDuration: time.Hour,
+			Fetcher:         pools[i].Fetch,
+		})
+		pools[i].Bind(caches[i])
+		srv.Config.Handler = pools[i]
+		srv.Start()
+		defer srv.Close()
+	}
+	for _, p := range pools {
+		p.Set(urls...)
+	}
+
+	const keys = 20
+	for i := 0; i < keys; i++ {
+		key := strconv.Itoa(i)
+		for _, c := range caches {
+			v, err := c.Get(key)
+			if err != nil || v.(string) != "val-"+key {
+				t.Fatalf("Get(%q) = %v, %v", key, v, err)
+			}
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != keys {
+		t.Fatalf("origin fetches = %d; want %d", got, keys)
+	}
+
+	for _, c := range caches {
+		if _, err := c.Get("bad"); err == nil {
+			t.Fatal("origin error should be returned")
+		}
+	}
+}
+
+func TestOwnerStable(t *testing.T) {
+	p := NewPool(Options{Self: "a", Codec: asynccache.StringCodec{}, Fetcher: func(string) (interface{}, error) { return "", nil }})
+	p.Set("a", "b", "c")
+	owners := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		owners[strconv.Itoa(i)] = p.Owner(strconv.Itoa(i))
+	}
+	p.Set("a", "b", "c", "d")
+	moved := 0
+	for key, owner := range owners {
+		if p.Owner(key) != owner {
+			moved++
+		}
+	}
+	if moved > 50 {
+		t.Fatalf("%d of 100 keys moved after adding a peer", moved)
+	}
+}
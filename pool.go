@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// entryPool recycles the entries which lose the race to be stored, so that
+// writes of cached keys do not allocate entries.
+var entryPool = sync.Pool{
+	New: func() interface{} { return new(entry) },
+}
+
+// freeEntry puts the entry e back to entryPool, e MUST never have been
+// stored to the cache.
+func (c *cache) freeEntry(e *entry) {
+	e.res = atomic.Value{}
+	e.state = 0
+	e.stats = nil
+	e.c = nil
+	e.reset.Store(nil)
+	e.tenant = nil
+	e.dead = 0
+	e.key, e.stored = "", false
+	e.changedAt = 0
+	e.pending = nil
+	entryPool.Put(e)
+}
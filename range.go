@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// rangeEntries calls fn for each entry of the cache until fn returns false.
+func (c *cache) rangeEntries(fn func(key string, e *entry) bool) {
+	c.rangeMap(c.data(), fn)
+}
+
+// rangeMap calls fn for each entry of m until fn returns false. Keys other
+// than strings and values other than entries, which the cache never stores,
+// are deleted and reported by EventInvalidEntry rather than panicking the
+// goroutine ranging over them.
+func (c *cache) rangeMap(m *sync.Map, fn func(key string, e *entry) bool) {
+	m.Range(func(key, value interface{}) bool {
+		k, ok := key.(string)
+		e, _ := value.(*entry)
+		if !ok || e == nil {
+			c.invalidEntry(m, key, value)
+			return true
+		}
+		return fn(k, e)
+	})
+}
+
+// invalidEntry deletes and reports the invalid entry of key in m.
+func (c *cache) invalidEntry(m *sync.Map, key, value interface{}) {
+	if value == nil || reflect.TypeOf(value).Comparable() {
+		m.CompareAndDelete(key, value)
+	} else {
+		m.Delete(key)
+	}
+	err := fmt.Errorf("%w: key %T, value %T", ErrInvalidEntry, key, value)
+	c.opt.ErrLogFunc(fmt.Sprintf("asynccache: deleted %v", err))
+	c.emit(Event{Type: EventInvalidEntry, Key: fmt.Sprint(key), Err: err})
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// adversarial returns an invalid key and value chosen by b.
+func adversarial(b byte, s string) (key, value interface{}) {
+	keys := []interface{}{s, len(s), struct{ s string }{s}, nil, true}
+	values := []interface{}{nil, (*entry)(nil), s, []string{s}, map[string]int{s: 1}, &result{val: s}}
+	key = keys[int(b)%len(keys)]
+	value = values[int(b/8)%len(values)]
+	if _, ok := key.(string); ok {
+		// keep a valid key to an invalid value
+		key = "bad:" + s
+	}
+	return key, value
+}
+
+func FuzzInvalidEntries(f *testing.F) {
+	for i := 0; i < 64; i++ {
+		f.Add(byte(i), "k")
+	}
+	f.Fuzz(func(t *testing.T, b byte, s string) {
+		events := make(chan Event, 100)
+		c := NewCache(Options{
+			EnableRefresh:   true,
+			RefreshDuration: time.Hour,
+			EnableKeyStats:  true,
+			ChangeLogSize:   1,
+			Fetcher: func(key string) (interface{}, error) {
+				return key, nil
+			},
+			EventHandler: func(ev Event) {
+				if ev.Type == EventInvalidEntry {
+					events <- ev
+				}
+			},
+			ErrLogFunc: func(string) {},
+		}).(*cache)
+		defer c.Close()
+
+		ops := []func(){
+			func() { c.Dump() },
+			func() { c.RangeEntries(func(string, interface{}, EntryInfo) bool { return true }) },
+			func() { c.DeleteIf(func(string) bool { return false }) },
+			func() { c.DeleteIfValue(func(string, interface{}) bool { return false }) },
+			func() { c.Errors() },
+			func() { c.DeleteErrored() },
+			func() { c.EstimatedSize() },
+			func() { c.Snapshot() },
+			func() { c.TopKeys(0) },
+			func() { c.Changes(0) },
+			c.expire,
+		}
+		op := ops[int(b)%len(ops)]
+		c.Get("a")
+		c.Set("b", "b")
+		key, value := adversarial(b, s)
+		c.data().Store(key, value)
+		op()
+
+		ev := <-events
+		Assertf(t, errors.Is(ev.Err, ErrInvalidEntry), "event %+v", ev)
+		_, ok := c.data().Load(key)
+		Assert(t, !ok)
+		DeepEqual(t, c.Dump(), map[string]interface{}{"a": "a", "b": "b"})
+	})
+}
+
+func TestReplaceAllInvalidEntries(t *testing.T) {
+	events := make(chan Event, 10)
+	c := NewCache(Options{
+		EventHandler: func(ev Event) {
+			if ev.Type == EventInvalidEntry {
+				events <- ev
+			}
+		},
+		ErrLogFunc: func(string) {},
+	}).(*cache)
+	defer c.Close()
+
+	c.Set("a", "a")
+	c.data().Store(1, []int{1})
+	c.ReplaceAll(map[string]interface{}{"b": "b"})
+	ev := <-events
+	Assert(t, ev.Key == "1" && errors.Is(ev.Err, ErrInvalidEntry))
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b": "b"})
+}
@@ -0,0 +1,31 @@
+package cache
+
+// DeleteReason is the reason of a deletion reported to DeleteHandler.
+type DeleteReason int
+
+const (
+	// ReasonDeleted is a deletion by Delete, DeleteIf and the like, or of a
+	// key removed upstream by KeyLister or SnapshotFetcher.
+	ReasonDeleted DeleteReason = iota + 1
+	// ReasonExpired is an expiration by EnableExpire or HardTTL.
+	ReasonExpired
+	// ReasonEvicted is an eviction by MemoryHighWatermark.
+	ReasonEvicted
+	// ReasonReplaced is a deletion by ReplaceAll.
+	ReasonReplaced
+)
+
+// String implements fmt.Stringer.
+func (r DeleteReason) String() string {
+	switch r {
+	case ReasonDeleted:
+		return "Deleted"
+	case ReasonExpired:
+		return "Expired"
+	case ReasonEvicted:
+		return "Evicted"
+	case ReasonReplaced:
+		return "Replaced"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,190 @@
+// Package redislock elects the instance of a fleet refreshing a Cache by a
+// Redis lock, and replicates its changes to the other instances by Redis
+// pub/sub, so that the origin is loaded once per refresh interval instead
+// of once per instance.
+//
+// Alternatively, instances refresh their shards of keys by
+// Options.RefreshShard, and a Publisher of the same shards publishes the
+// changes of the keys of the instance.
+//
+// Each instance sets a Lock as Options.RefreshLock and a Publisher of the
+// Lock as Options.WAL, and forwards the messages of its subscription to the
+// channel to Publisher.Apply. The instances list the same keys by
+// Options.KeyLister, which RefreshLock requires, so that the instance holding
+// the lock refreshes the keys cached by any of them:
+//
+//	lock := redislock.NewLock(client, "users:refresh")
+//	pub := &redislock.Publisher{Lock: lock, Client: client, Channel: "users:changes", Codec: codec}
+//	c := asynccache.NewCache(asynccache.Options{RefreshLock: lock, KeyLister: listUsers, WAL: pub, ...})
+//	for msg := range sub.Channel() {
+//		pub.Apply(c, []byte(msg.Payload))
+//	}
+//
+// The package does not depend on any Redis client library. Callers adapt
+// their client to the small Client interface.
+package redislock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Client is the subset of a Redis client used by Lock and Publisher.
+type Client interface {
+	// SetNX sets the key to value expiring after ttl if it does not exist,
+	// as SET key value NX PX does, and reports whether it is set.
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	// Eval runs the Lua script, as the EVAL command does, with integer
+	// replies returned as int64.
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+	// Publish posts the message to the channel, as the PUBLISH command does.
+	Publish(channel string, message []byte) error
+}
+
+// extendScript extends the lock if it is held by the instance ARGV[1].
+const extendScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`
+
+// Lock is an asynccache.DistributedLock of a Redis key, whose value is the
+// random ID of the instance holding it.
+type Lock struct {
+	client Client
+	key    string
+	id     string
+	until  atomic.Int64 // unix nano until the lock is held
+}
+
+// NewLock creates a Lock of the key.
+func NewLock(client Client, key string) *Lock {
+	return &Lock{client: client, key: key, id: randomID()}
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ID returns the ID of the instance.
+func (l *Lock) ID() string {
+	return l.id
+}
+
+// TryLock implements asynccache.DistributedLock.
+func (l *Lock) TryLock(ttl time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := l.client.SetNX(l.key, l.id, ttl)
+	if err == nil && !ok {
+		var n interface{}
+		n, err = l.client.Eval(extendScript, []string{l.key}, l.id, ttl.Milliseconds())
+		ok = n == int64(1)
+	}
+	if err != nil || !ok {
+		l.until.Store(0)
+		return false, err
+	}
+	l.until.Store(start.Add(ttl).UnixNano())
+	return true, nil
+}
+
+// Held reports whether the last TryLock acquired the lock, and it has not
+// expired since.
+func (l *Lock) Held() bool {
+	return time.Now().UnixNano() < l.until.Load()
+}
+
+// message is a change published to the channel.
+type message struct {
+	ID    string              `json:"id"`
+	Op    asynccache.ChangeOp `json:"op"`
+	Key   string              `json:"key"`
+	Value []byte              `json:"value,omitempty"`
+}
+
+// Publisher is an asynccache.ChangeAppender publishing the changes of the
+// cache to the channel while the instance holds Lock, or the changes of the
+// keys of its shard by Shard, and applying the changes published by the
+// other instances. Either Lock or Shard MUST be set.
+type Publisher struct {
+	Lock    *Lock
+	Shard   func() (index, count int)
+	Client  Client
+	Channel string
+	Codec   asynccache.Codec
+
+	once sync.Once
+	id   string
+}
+
+// ID returns the ID of the instance, which is the ID of Lock if it is set.
+func (p *Publisher) ID() string {
+	if p.Lock != nil {
+		return p.Lock.ID()
+	}
+	p.once.Do(func() {
+		p.id = randomID()
+	})
+	return p.id
+}
+
+// publishes reports whether the change of key is published by the instance.
+func (p *Publisher) publishes(key string) bool {
+	if p.Lock != nil {
+		return p.Lock.Held()
+	}
+	index, count := p.Shard()
+	return asynccache.ShardOf(key, count) == index
+}
+
+// Append implements asynccache.ChangeAppender. Changes caching errors are
+// not published. The cache calls it from the goroutine draining its WAL
+// queue, so the writes of the cache do not wait for the PUBLISH.
+func (p *Publisher) Append(rec asynccache.ChangeRecord) error {
+	if rec.Err != nil || rec.Op == asynccache.ChangeReset || !p.publishes(rec.Key) {
+		return nil
+	}
+	msg := message{ID: p.ID(), Op: rec.Op, Key: rec.Key}
+	if rec.Op == asynccache.ChangeSet {
+		var err error
+		if msg.Value, err = p.Codec.Marshal(rec.Value); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return p.Client.Publish(p.Channel, b)
+}
+
+// Apply applies a message of the channel to c, the messages published by
+// the instance itself are ignored.
+func (p *Publisher) Apply(c asynccache.Cache, payload []byte) error {
+	var msg message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("redislock: invalid message: %w", err)
+	}
+	if msg.ID == p.ID() {
+		return nil
+	}
+	switch msg.Op {
+	case asynccache.ChangeSet:
+		val, err := p.Codec.Unmarshal(msg.Value)
+		if err != nil {
+			return err
+		}
+		c.Set(msg.Key, val)
+	case asynccache.ChangeDelete:
+		c.Delete(msg.Key)
+	}
+	return nil
+}
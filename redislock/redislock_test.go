@@ -0,0 +1,177 @@
+package redislock
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// fakeRedis is a Client in memory, delivering published messages to subs.
+type fakeRedis struct {
+	mu   sync.Mutex
+	keys map[string]string
+	subs []func(payload []byte)
+}
+
+func (f *fakeRedis) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.keys[key]; ok {
+		return false, nil
+	}
+	f.keys[key] = value
+	return true, nil
+}
+
+func (f *fakeRedis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.keys[keys[0]] == args[0] {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func (f *fakeRedis) subscribe(fn func(payload []byte)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs = append(f.subs, fn)
+}
+
+func (f *fakeRedis) Publish(channel string, message []byte) error {
+	f.mu.Lock()
+	subs := f.subs
+	f.mu.Unlock()
+	for _, sub := range subs {
+		sub(message)
+	}
+	return nil
+}
+
+func TestRefreshLock(t *testing.T) {
+	redis := &fakeRedis{keys: make(map[string]string)}
+	var fetches int32
+	var caches []asynccache.Cache
+	for i := 0; i < 3; i++ {
+		lock := NewLock(redis, "lock")
+		pub := &Publisher{Lock: lock, Client: redis, Channel: "changes", Codec: asynccache.StringCodec{}}
+		c := asynccache.NewCache(asynccache.Options{
+			EnableRefresh:   true,
+			RefreshDuration: 20 * time.Millisecond,
+			Fetcher: func(key string) (interface{}, error) {
+				return "v" + string(rune('0'+atomic.AddInt32(&fetches, 1))), nil
+			},
+			KeyLister: func() ([]string, error) {
+				return []string{"a", "b"}, nil
+			},
+			RefreshLock: lock,
+			WAL:         pub,
+		})
+		defer c.Close()
+		c.SetDefault("a", "old")
+		redis.subscribe(func(payload []byte) {
+			if err := pub.Apply(c, payload); err != nil {
+				t.Error(err)
+			}
+		})
+		caches = append(caches, c)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	// a cycle of the instance holding the lock fetches the 2 keys
+	n := atomic.LoadInt32(&fetches)
+	if n < 2 || n > 6 {
+		t.Fatalf("fetched %d times", n)
+	}
+	// b is cached by no instance, it is listed and fetched by the one
+	// holding the lock for all
+	for _, k := range []string{"a", "b"} {
+		want := caches[0].Dump()[k]
+		for _, c := range caches {
+			if v := c.Dump()[k]; v == nil || v == "old" || v != want {
+				t.Fatalf("value of %s = %v, want %v", k, v, want)
+			}
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	redis := &fakeRedis{keys: make(map[string]string)}
+	l1, l2 := NewLock(redis, "lock"), NewLock(redis, "lock")
+	if ok, err := l1.TryLock(time.Hour); !ok || err != nil || !l1.Held() {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if ok, _ := l1.TryLock(time.Hour); !ok {
+		t.Fatal("the holder fails to extend the lock")
+	}
+	if ok, _ := l2.TryLock(time.Hour); ok || l2.Held() {
+		t.Fatal("the lock is acquired twice")
+	}
+}
+
+func TestShardedRefresh(t *testing.T) {
+	redis := &fakeRedis{keys: make(map[string]string)}
+	var mu sync.Mutex
+	fetchers := make(map[string]map[int]bool)
+	var caches []asynccache.Cache
+	for i := 0; i < 3; i++ {
+		shard := func() (int, int) { return i, 3 }
+		pub := &Publisher{Shard: shard, Client: redis, Channel: "changes", Codec: asynccache.StringCodec{}}
+		c := asynccache.NewCache(asynccache.Options{
+			EnableRefresh:   true,
+			RefreshDuration: 20 * time.Millisecond,
+			Fetcher: func(key string) (interface{}, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if fetchers[key] == nil {
+					fetchers[key] = make(map[int]bool)
+				}
+				fetchers[key][i] = true
+				return "new", nil
+			},
+			RefreshShard: shard,
+			WAL:          pub,
+		})
+		defer c.Close()
+		for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+			c.SetDefault(k, "old")
+		}
+		redis.subscribe(func(payload []byte) {
+			if err := pub.Apply(c, payload); err != nil {
+				t.Error(err)
+			}
+		})
+		caches = append(caches, c)
+	}
+
+	// wait for every shard to refresh and publish, each once at least
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		done := true
+		for _, c := range caches {
+			for _, v := range c.Dump() {
+				done = done && v == "new"
+			}
+		}
+		if done {
+			break
+		}
+	}
+	mu.Lock()
+	for k, by := range fetchers {
+		if len(by) != 1 || !by[asynccache.ShardOf(k, 3)] {
+			t.Errorf("%s fetched by %v", k, by)
+		}
+	}
+	mu.Unlock()
+	for _, c := range caches {
+		for k, v := range c.Dump() {
+			if v != "new" {
+				t.Fatalf("%s = %v", k, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package redissource provides helpers for caching data stored in Redis
+// with asynccache.
+//
+// The package does not depend on any Redis client library. Callers adapt
+// their client to the small Client interface and forward keyspace
+// notifications to Listen.
+package redissource
+
+import (
+	"encoding/json"
+	"strings"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// Client is the subset of a Redis client used by the fetchers.
+type Client interface {
+	// Get returns the value of the key, as the GET command does.
+	Get(key string) ([]byte, error)
+	// HGetAll returns all fields of the hash, as the HGETALL command does.
+	HGetAll(key string) (map[string]string, error)
+}
+
+// Codec decodes the raw reply of Redis into the cached value.
+type Codec func(data []byte) (interface{}, error)
+
+// Raw returns the reply as a string.
+func Raw(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// JSON returns a Codec unmarshalling the reply into the value created by newVal.
+func JSON(newVal func() interface{}) Codec {
+	return func(data []byte) (interface{}, error) {
+		v := newVal()
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// GetFetcher returns a Fetcher loading keys by GET.
+// The Redis key is the cache key with prefix prepended.
+func GetFetcher(client Client, prefix string, codec Codec) func(key string) (interface{}, error) {
+	if codec == nil {
+		codec = Raw
+	}
+	return func(key string) (interface{}, error) {
+		data, err := client.Get(prefix + key)
+		if err != nil {
+			return nil, err
+		}
+		return codec(data)
+	}
+}
+
+// HGetAllFetcher returns a Fetcher loading hashes by HGETALL.
+// If decode is nil, the fields are cached as map[string]string.
+func HGetAllFetcher(client Client, prefix string, decode func(fields map[string]string) (interface{}, error)) func(key string) (interface{}, error) {
+	return func(key string) (interface{}, error) {
+		fields, err := client.HGetAll(prefix + key)
+		if err != nil {
+			return nil, err
+		}
+		if decode == nil {
+			return fields, nil
+		}
+		return decode(fields)
+	}
+}
+
+// Message is a keyspace notification received from a subscription of
+// `__keyspace@<db>__:<prefix>*`, the payload is the name of the event.
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Listen applies keyspace notifications to the cache until msgs is closed.
+// Entries are deleted on del/unlink/expired/evicted events and refreshed on
+// any other event. Keys that are not cached or do not have the prefix are ignored.
+func Listen(c asynccache.Cache, prefix string, msgs <-chan Message) {
+	for msg := range msgs {
+		Apply(c, prefix, msg)
+	}
+}
+
+// Apply applies a single keyspace notification to the cache.
+func Apply(c asynccache.Cache, prefix string, msg Message) {
+	i := strings.Index(msg.Channel, "__:")
+	if i < 0 {
+		return
+	}
+	key := msg.Channel[i+len("__:"):]
+	if !strings.HasPrefix(key, prefix) {
+		return
+	}
+	key = key[len(prefix):]
+
+	switch msg.Payload {
+	case "del", "unlink", "expired", "evicted":
+		c.Delete(key)
+	default:
+		c.Refresh(key)
+	}
+}
@@ -0,0 +1,77 @@
+package redissource
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+type fakeClient struct {
+	strs   map[string]string
+	hashes map[string]map[string]string
+}
+
+func (f *fakeClient) Get(key string) ([]byte, error) {
+	s, ok := f.strs[key]
+	if !ok {
+		return nil, errors.New("redis: nil")
+	}
+	return []byte(s), nil
+}
+
+func (f *fakeClient) HGetAll(key string) (map[string]string, error) {
+	return f.hashes[key], nil
+}
+
+func TestGetFetcher(t *testing.T) {
+	client := &fakeClient{strs: map[string]string{"app:a": `{"n":1}`}}
+
+	v, err := GetFetcher(client, "app:", nil)("a")
+	if err != nil || v.(string) != `{"n":1}` {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+
+	type obj struct{ N int }
+	v, err = GetFetcher(client, "app:", JSON(func() interface{} { return &obj{} }))("a")
+	if err != nil || v.(*obj).N != 1 {
+		t.Fatalf("Get = %v, %v", v, err)
+	}
+
+	if _, err = GetFetcher(client, "app:", nil)("b"); err == nil {
+		t.Fatal("missing key should fail")
+	}
+}
+
+func TestHGetAllFetcher(t *testing.T) {
+	client := &fakeClient{hashes: map[string]map[string]string{"h": {"f": "v"}}}
+	v, err := HGetAllFetcher(client, "", nil)("h")
+	if err != nil || v.(map[string]string)["f"] != "v" {
+		t.Fatalf("HGetAll = %v, %v", v, err)
+	}
+}
+
+func TestListen(t *testing.T) {
+	client := &fakeClient{strs: map[string]string{"app:a": "1", "app:b": "2"}}
+	c := asynccache.NewCache(asynccache.Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher:         GetFetcher(client, "app:", nil),
+	})
+	c.Get("a")
+	c.Get("b")
+
+	client.strs["app:a"] = "3"
+	msgs := make(chan Message, 3)
+	msgs <- Message{Channel: "__keyspace@0__:app:a", Payload: "set"}
+	msgs <- Message{Channel: "__keyspace@0__:app:b", Payload: "del"}
+	msgs <- Message{Channel: "__keyspace@0__:other:a", Payload: "del"}
+	close(msgs)
+	Listen(c, "app:", msgs)
+
+	data := c.Dump()
+	if len(data) != 1 || data["a"].(string) != "3" {
+		t.Fatalf("Dump = %v", data)
+	}
+}
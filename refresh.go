@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// RefreshReport is the outcome of a refresh cycle. Refreshed keys are either
+// Changed or Unchanged, compared by IsSame, or reflect.DeepEqual if IsSame
+// is nil. Skipped keys are carried to the next cycle by RefreshCycleTimeout.
+type RefreshReport struct {
+	Refreshed int
+	Changed   int
+	Unchanged int
+	Failed    int
+	Skipped   int
+	Duration  time.Duration
+}
+
+// FailureRatio returns the ratio of failed keys to the keys attempted.
+func (r RefreshReport) FailureRatio() float64 {
+	if r.Refreshed+r.Failed == 0 {
+		return 0
+	}
+	return float64(r.Failed) / float64(r.Refreshed+r.Failed)
+}
+
+type refreshItem struct {
+	key      string
+	e        *entry
+	priority int
+}
+
+// refreshItems refreshes the items of a cycle in the order of priority until
+// RefreshCycleTimeout, and carries the rest to the next cycle.
+func (c *cache) refreshItems(items []refreshItem) RefreshReport {
+	if len(c.refreshCarry) > 0 {
+		sort.SliceStable(items, func(i, j int) bool {
+			return c.refreshCarry[items[i].key] && !c.refreshCarry[items[j].key]
+		})
+	}
+	if c.opt.PriorityFunc != nil {
+		for i := range items {
+			items[i].priority = c.opt.PriorityFunc(items[i].key)
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].priority > items[j].priority
+		})
+	}
+
+	start := time.Now()
+	var deadline time.Time
+	if c.opt.RefreshCycleTimeout > 0 {
+		deadline = start.Add(c.opt.RefreshCycleTimeout)
+	}
+	c.refreshCarry = nil
+	var report RefreshReport
+	compare := c.opt.RefreshReportHandler != nil
+	for i, it := range items {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			c.refreshCarry = make(map[string]bool, len(items)-i)
+			for _, rest := range items[i:] {
+				c.refreshCarry[rest.key] = true
+			}
+			report.Skipped = len(items) - i
+			break
+		}
+		var oldVal interface{}
+		if compare {
+			oldVal, _ = it.e.Load()
+		}
+		if c.refreshEntry(it.key, it.e) != nil {
+			report.Failed++
+			continue
+		}
+		report.Refreshed++
+		if compare {
+			if newVal, _ := it.e.Load(); sameValue(oldVal, newVal) || c.same(it.key, oldVal, newVal) {
+				report.Unchanged++
+			} else {
+				report.Changed++
+			}
+		}
+	}
+	atomic.StoreInt64(&c.refreshFailed, int64(report.Failed))
+	report.Duration = time.Since(start)
+	if len(c.refreshCarry) > 0 || report.Duration > c.opt.RefreshDuration {
+		c.emit(Event{Type: EventRefreshOverrun, Duration: report.Duration, Count: len(c.refreshCarry)})
+	}
+	return report
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshPriority(t *testing.T) {
+	var mu sync.Mutex
+	var refreshed []string
+	refreshing := false
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if refreshing {
+				refreshed = append(refreshed, key)
+			}
+			time.Sleep(20 * time.Millisecond)
+			return key, nil
+		},
+		PriorityFunc: func(key string) int {
+			p, _ := strconv.Atoi(key)
+			return p
+		},
+		RefreshCycleTimeout: 50 * time.Millisecond,
+	}).(*cache)
+	defer c.Close()
+
+	for _, key := range []string{"1", "5", "3", "4", "2"} {
+		c.Get(key)
+	}
+	mu.Lock()
+	refreshing = true
+	mu.Unlock()
+	c.refresh()
+
+	mu.Lock()
+	defer mu.Unlock()
+	DeepEqual(t, refreshed, []string{"5", "4", "3"})
+}
+
+func TestRefreshCarryOver(t *testing.T) {
+	var mu sync.Mutex
+	var refreshed []string
+	refreshing := false
+	events := make(chan Event, 10)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if refreshing {
+				refreshed = append(refreshed, key)
+			}
+			time.Sleep(20 * time.Millisecond)
+			return key, nil
+		},
+		RefreshCycleTimeout: 50 * time.Millisecond,
+		EventHandler: func(ev Event) {
+			if ev.Type == EventRefreshOverrun {
+				events <- ev
+			}
+		},
+	}).(*cache)
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Get(key)
+	}
+	mu.Lock()
+	refreshing = true
+	mu.Unlock()
+	c.refresh()
+	ev := <-events
+	Assert(t, ev.Type == EventRefreshOverrun && ev.Count == 2 && ev.Duration >= 50*time.Millisecond)
+
+	mu.Lock()
+	carried := make(map[string]bool)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		carried[key] = true
+	}
+	for _, key := range refreshed {
+		delete(carried, key)
+	}
+	refreshed = nil
+	mu.Unlock()
+	c.refresh()
+
+	mu.Lock()
+	defer mu.Unlock()
+	Assert(t, carried[refreshed[0]] && carried[refreshed[1]])
+}
+
+func TestRefreshSkipOverlapping(t *testing.T) {
+	var mu sync.Mutex
+	running, overlapped := 0, false
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: 10 * time.Millisecond,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			running++
+			overlapped = overlapped || running > 1
+			mu.Unlock()
+			time.Sleep(30 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return key, nil
+		},
+	})
+	defer c.Close()
+
+	c.Get("a")
+	time.Sleep(200 * time.Millisecond)
+	Assert(t, c.Stats().RefreshSkipped > 0)
+	mu.Lock()
+	defer mu.Unlock()
+	Assert(t, !overlapped)
+}
+
+func TestRefreshReport(t *testing.T) {
+	var mu sync.Mutex
+	round := 0
+	reports := make(chan RefreshReport, 1)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case round > 0 && key == "bad":
+				return nil, errors.New("failed")
+			case round > 0 && key == "changed":
+				return "new", nil
+			}
+			return key, nil
+		},
+		RefreshReportHandler: func(report RefreshReport) {
+			reports <- report
+		},
+	}).(*cache)
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "changed", "bad"} {
+		c.Get(key)
+	}
+	mu.Lock()
+	round = 1
+	mu.Unlock()
+	c.refresh()
+	report := <-reports
+	Assertf(t, report.Refreshed == 3 && report.Changed == 1 && report.Unchanged == 2 && report.Failed == 1 && report.Skipped == 0,
+		"report %+v", report)
+	Assert(t, report.Duration > 0)
+	Assert(t, report.FailureRatio() == 0.25)
+}
+
+func TestRefreshIndex(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetched[key]++
+			return key, nil
+		},
+	}).(*cache)
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		c.Get(strconv.Itoa(i))
+	}
+	for i := 0; i < 90; i++ {
+		c.Delete(strconv.Itoa(i))
+	}
+	// the deleted entries are the majority, and dropped by the next add
+	c.Get("new")
+	c.index.mu.Lock()
+	Assert(t, len(c.index.items) == 11)
+	c.index.mu.Unlock()
+
+	c.refresh()
+	mu.Lock()
+	Assert(t, fetched["0"] == 1 && fetched["99"] == 2 && fetched["new"] == 2)
+	mu.Unlock()
+	Assert(t, c.Stats().LastRefreshCycle > 0)
+
+	c.ReplaceAll(map[string]interface{}{"a": "a"})
+	c.refresh()
+	mu.Lock()
+	defer mu.Unlock()
+	Assert(t, fetched["a"] == 1 && fetched["99"] == 2)
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// data returns the map of the cached entries.
+func (c *cache) data() *sync.Map {
+	return c.entries.Load()
+}
+
+// ReplaceAll replaces all cached entries with data atomically.
+func (c *cache) ReplaceAll(data map[string]interface{}) {
+	if c.IsClosed() {
+		return
+	}
+	m := &sync.Map{}
+	changed := make(map[string]bool, len(data))
+	for k, v := range data {
+		k = c.key(k)
+		ety := c.newEntry()
+		ety.Store(v)
+		if ts := c.tenantOf(k); ts != nil {
+			ety.tenant = ts
+			atomic.AddInt64(&ts.entries, 1)
+		}
+		ety.key, ety.stored = k, true
+		m.Store(k, ety)
+		changed[k] = true
+	}
+
+	c.writes.Lock()
+	old := c.entries.Swap(m)
+	c.index.reset(m)
+	atomic.AddUint64(&c.writeSeq, 1)
+	c.writes.Unlock()
+	if c.opt.ExpireDeadlines {
+		m.Range(func(_, value interface{}) bool {
+			c.scheduleExpiry(value.(*entry))
+			return true
+		})
+	}
+
+	c.rangeMap(old, func(k string, e *entry) bool {
+		v, ok := m.Load(k)
+		if !ok {
+			changed[k] = true
+			c.removed(k, e, ReasonReplaced)
+			return true
+		}
+		newVal, _ := v.(*entry).loadRaw()
+		if res := e.result(); res != nil && sameValue(res.val, newVal) {
+			// the value is kept by the new entry.
+			atomic.StoreInt32(&res.owned, 0)
+		}
+		c.removed(k, e, 0)
+		return true
+	})
+	for k := range changed {
+		c.logChange(k)
+	}
+}
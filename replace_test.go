@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplaceAll(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	c := NewCache(Options{
+		DeleteHandler: func(key string, oldData interface{}, reason DeleteReason) {
+			mu.Lock()
+			if reason == ReasonReplaced {
+				deleted = append(deleted, key)
+			}
+			mu.Unlock()
+		},
+		ChangeLogSize: 10,
+	})
+	defer c.Close()
+	c.SetDefault("a", 1)
+	c.SetDefault("b", 1)
+
+	c.ReplaceAll(map[string]interface{}{"b": 2, "c": 2})
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b": 2, "c": 2})
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	DeepEqual(t, deleted, []string{"a"})
+	mu.Unlock()
+
+	var keys []string
+	for _, rec := range c.Changes(2) {
+		keys = append(keys, rec.Key)
+	}
+	sort.Strings(keys)
+	DeepEqual(t, keys, []string{"a", "b", "c"})
+}
+
+func TestReplaceAllAtomic(t *testing.T) {
+	c := NewCache(Options{})
+	defer c.Close()
+	gen := func(i int) map[string]interface{} {
+		return map[string]interface{}{"a": i, "b": i}
+	}
+	c.ReplaceAll(gen(0))
+
+	var stop int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; atomic.LoadInt32(&stop) == 0; i++ {
+			c.ReplaceAll(gen(i))
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		s := c.Snapshot()
+		a, _, _ := s.Get("a")
+		b, _, _ := s.Get("b")
+		Assert(t, a == b)
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+}
@@ -0,0 +1,56 @@
+package cache
+
+import "sync"
+
+// RequestScope memoizes the reads of a Cache for the duration of a request,
+// so that the request reads the same value of a key however many times it
+// reads the key, even if the key is refreshed meanwhile. It is safe for
+// concurrent use, the first read of a key wins.
+type RequestScope struct {
+	c    Cache
+	mu   sync.Mutex
+	vals map[string]result
+}
+
+// NewRequestScope creates a RequestScope over c, it should be discarded at
+// the end of the request.
+func NewRequestScope(c Cache) *RequestScope {
+	return &RequestScope{c: c, vals: make(map[string]result)}
+}
+
+// Get is Cache.Get memoized in the scope, errors are memoized too.
+func (s *RequestScope) Get(key string) (interface{}, error) {
+	if res, ok := s.load(key); ok {
+		return res.val, res.err
+	}
+	val, err := s.c.Get(key)
+	res := s.store(key, result{val: val, err: err})
+	return res.val, res.err
+}
+
+// GetOrSet is Cache.GetOrSet memoized in the scope.
+func (s *RequestScope) GetOrSet(key string, def interface{}) interface{} {
+	if res, ok := s.load(key); ok && res.err == nil {
+		return res.val
+	}
+	return s.store(key, result{val: s.c.GetOrSet(key, def)}).val
+}
+
+func (s *RequestScope) load(key string) (result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.vals[key]
+	return res, ok
+}
+
+// store memoizes res for key unless a read of key without error is
+// memoized meanwhile, and returns the memoized one.
+func (s *RequestScope) store(key string, res result) result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.vals[key]; ok && old.err == nil {
+		return old
+	}
+	s.vals[key] = res
+	return res
+}
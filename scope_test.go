@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRequestScope(t *testing.T) {
+	var n int32
+	c := NewCache(Options{
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "bad" {
+				return nil, errors.New("bad")
+			}
+			return atomic.AddInt32(&n, 1), nil
+		},
+	})
+	defer c.Close()
+
+	s := NewRequestScope(c)
+	v, _ := s.Get("a")
+	Assert(t, v.(int32) == 1)
+	c.Set("a", int32(100))
+	v, _ = s.Get("a")
+	Assert(t, v.(int32) == 1)
+	Assert(t, s.GetOrSet("a", 0).(int32) == 1)
+
+	_, err := s.Get("bad")
+	Assert(t, err != nil)
+	Assert(t, s.GetOrSet("bad", 0) == 0)
+	v, err = s.Get("bad")
+	Assert(t, err == nil && v == 0)
+
+	v, _ = NewRequestScope(c).Get("a")
+	Assert(t, v.(int32) == 100)
+}
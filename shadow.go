@@ -0,0 +1,31 @@
+package cache
+
+// shadowFetch calls ShadowFetcher in background, and returns the function
+// comparing its results with those of Fetcher once both are done.
+func (c *cache) shadowFetch(key string) func(val interface{}, err error) {
+	ch := make(chan result, 1)
+	go func() {
+		v, err := c.opt.ShadowFetcher(key)
+		ch <- result{val: v, err: err}
+	}()
+	return func(val interface{}, err error) {
+		go func() {
+			shadow := <-ch
+			if c.shadowMatch(key, val, err, shadow.val, shadow.err) {
+				return
+			}
+			if c.opt.ShadowMismatchHandler != nil {
+				c.dispatch(func() {
+					c.opt.ShadowMismatchHandler(key, val, shadow.val, err, shadow.err)
+				})
+			}
+		}()
+	}
+}
+
+func (c *cache) shadowMatch(key string, val interface{}, err error, shadowVal interface{}, shadowErr error) bool {
+	if err != nil || shadowErr != nil {
+		return (err == nil) == (shadowErr == nil)
+	}
+	return c.same(key, val, shadowVal)
+}
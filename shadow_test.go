@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShadowFetcher(t *testing.T) {
+	type mismatch struct {
+		key            string
+		val, shadowVal interface{}
+		shadowErr      error
+	}
+	mismatches := make(chan mismatch, 10)
+	op := Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return "val", nil
+		},
+		ShadowFetcher: func(key string) (interface{}, error) {
+			switch key {
+			case "diff":
+				return "other", nil
+			case "err":
+				return nil, errors.New("error")
+			}
+			return "val", nil
+		},
+		ShadowMismatchHandler: func(key string, val, shadowVal interface{}, err, shadowErr error) {
+			mismatches <- mismatch{key, val, shadowVal, shadowErr}
+		},
+		EnableRefresh: true,
+	}
+	c := NewCache(op)
+	for _, key := range []string{"same", "diff", "err"} {
+		c.SetDefault(key, "def")
+		Assert(t, c.Refresh(key) == nil)
+	}
+
+	got := make(map[string]mismatch)
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-mismatches:
+			got[m.key] = m
+		case <-time.After(time.Second):
+			t.Fatal("mismatch not reported")
+		}
+	}
+	Assert(t, got["diff"].val == "val" && got["diff"].shadowVal == "other")
+	Assert(t, got["err"].shadowErr != nil)
+	select {
+	case m := <-mismatches:
+		t.Fatalf("unexpected mismatch %v", m)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// shadow results are never stored
+	v, _ := c.Get("diff")
+	Assert(t, v.(string) == "val")
+}
@@ -0,0 +1,44 @@
+package cache
+
+import "hash/fnv"
+
+// ShardOf returns the shard of key among count shards, as RefreshShard
+// partitions keys.
+func ShardOf(key string, count int) int {
+	if count <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// shardFilter returns the filter of the keys of the shard of the instance
+// by RefreshShard this cycle, nil if all keys are refreshed.
+func (c *cache) shardFilter() func(key string) bool {
+	if c.opt.RefreshShard == nil {
+		return nil
+	}
+	index, count := c.opt.RefreshShard()
+	if count <= 1 && index == 0 {
+		return nil
+	}
+	return func(key string) bool {
+		return ShardOf(key, count) == index
+	}
+}
+
+// shardItems returns the items of the keys in the shard, all items if
+// inShard is nil.
+func shardItems(items []refreshItem, inShard func(key string) bool) []refreshItem {
+	if inShard == nil {
+		return items
+	}
+	owned := items[:0]
+	for _, it := range items {
+		if inShard(it.key) {
+			owned = append(owned, it)
+		}
+	}
+	return owned
+}
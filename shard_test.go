@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefreshShard(t *testing.T) {
+	var mu sync.Mutex
+	refreshed := make(map[string]bool)
+	refreshing := false
+	index := 1
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if refreshing {
+				refreshed[key] = true
+			}
+			return key, nil
+		},
+		RefreshShard: func() (int, int) {
+			return index, 3
+		},
+	}).(*cache)
+	defer c.Close()
+
+	for i := 0; i < 30; i++ {
+		c.Get(strconv.Itoa(i))
+	}
+	mu.Lock()
+	refreshing = true
+	mu.Unlock()
+	c.refresh()
+	mu.Lock()
+	Assert(t, len(refreshed) > 0 && len(refreshed) < 30)
+	for k := range refreshed {
+		Assert(t, ShardOf(k, 3) == 1)
+	}
+	refreshed = make(map[string]bool)
+	index = -1
+	mu.Unlock()
+	c.refresh()
+	Assert(t, len(refreshed) == 0)
+}
+
+func TestShardOf(t *testing.T) {
+	counts := make([]int, 4)
+	for i := 0; i < 1000; i++ {
+		counts[ShardOf(strconv.Itoa(i), 4)]++
+	}
+	for _, n := range counts {
+		Assertf(t, n > 150, "counts %v", counts)
+	}
+	Assert(t, ShardOf("a", 0) == 0 && ShardOf("a", 1) == 0)
+}
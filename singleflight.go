@@ -6,7 +6,10 @@
 // mechanism.
 package cache
 
-import "sync"
+import (
+	"errors"
+	"sync"
+)
 
 // call is an in-flight or completed singleflight.Do call
 type call struct {
@@ -90,17 +93,28 @@ func (g *Group) DoChan(key string, fn func() (interface{}, error)) (<-chan Resul
 	return ch, true
 }
 
-// doCall handles the single call for a key.
+// errPanicked is returned to the duplicate callers if the function panicked.
+var errPanicked = errors.New("asynccache: singleflight function panicked")
+
+// doCall handles the single call for a key. If fn panics, the key is
+// released so that later calls are not blocked forever, and the panic goes on.
 func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
-	c.val, c.err = fn()
-	c.wg.Done()
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			c.err = errPanicked
+		}
+		c.wg.Done()
 
-	g.mu.Lock()
-	delete(g.m, key)
-	for _, ch := range c.chans {
-		ch <- Result{c.val, c.err, c.dups > 0}
-	}
-	g.mu.Unlock()
+		g.mu.Lock()
+		delete(g.m, key)
+		for _, ch := range c.chans {
+			ch <- Result{c.val, c.err, c.dups > 0}
+		}
+		g.mu.Unlock()
+	}()
+	c.val, c.err = fn()
+	normalReturn = true
 }
 
 // ForgetUnshared tells the singleflight to forget about a key if it is not
@@ -121,3 +135,38 @@ func (g *Group) ForgetUnshared(key string) bool {
 	}
 	return false
 }
+
+// groupShards is the number of shards of ShardedGroup, a power of 2.
+const groupShards = 64
+
+// ShardedGroup is Group sharded by the hash of keys, so that calls of
+// distinct keys, such as the misses of a cold start, do not contend on a
+// single mutex.
+type ShardedGroup struct {
+	shards [groupShards]Group
+}
+
+// shard returns the Group of key by FNV-1a.
+func (g *ShardedGroup) shard(key string) *Group {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &g.shards[h&(groupShards-1)]
+}
+
+// Do is Group.Do in the shard of key.
+func (g *ShardedGroup) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	return g.shard(key).Do(key, fn)
+}
+
+// DoChan is Group.DoChan in the shard of key.
+func (g *ShardedGroup) DoChan(key string, fn func() (interface{}, error)) (<-chan Result, bool) {
+	return g.shard(key).DoChan(key, fn)
+}
+
+// ForgetUnshared is Group.ForgetUnshared in the shard of key.
+func (g *ShardedGroup) ForgetUnshared(key string) bool {
+	return g.shard(key).ForgetUnshared(key)
+}
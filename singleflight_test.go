@@ -7,6 +7,7 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -85,3 +86,71 @@ func TestDoDupSuppress(t *testing.T) {
 		t.Errorf("number of calls = %d; want over 0 and less than %d", got, n)
 	}
 }
+
+func TestShardedGroup(t *testing.T) {
+	var g ShardedGroup
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		v, err, _ := g.Do(key, func() (interface{}, error) {
+			return key, nil
+		})
+		if v != key || err != nil {
+			t.Errorf("Do = %v, %v; want %v", v, err, key)
+		}
+	}
+	ch, _ := g.DoChan("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if res := <-ch; res.Val != "bar" {
+		t.Errorf("DoChan = %v; want bar", res.Val)
+	}
+	if !g.ForgetUnshared("key") {
+		t.Errorf("ForgetUnshared = false; want true")
+	}
+}
+
+type doer interface {
+	Do(key string, fn func() (interface{}, error)) (interface{}, error, bool)
+}
+
+// benchmarkColdStart does the calls of distinct keys concurrently, as the
+// misses of a cold start do.
+func benchmarkColdStart(b *testing.B, g doer) {
+	var n uint64
+	fn := func() (interface{}, error) {
+		return nil, nil
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			g.Do(strconv.FormatUint(atomic.AddUint64(&n, 1), 10), fn)
+		}
+	})
+}
+
+func BenchmarkGroupColdStart(b *testing.B) {
+	benchmarkColdStart(b, &Group{})
+}
+
+func BenchmarkShardedGroupColdStart(b *testing.B) {
+	benchmarkColdStart(b, &ShardedGroup{})
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Do did not panic")
+			}
+		}()
+		g.Do("key", func() (interface{}, error) {
+			panic("fn")
+		})
+	}()
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do after panic = %v, %v; want bar", v, err)
+	}
+}
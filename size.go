@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// entryOverhead approximates the memory of an entry besides its key and value,
+// including the bookkeeping of sync.Map.
+const entryOverhead = int64(unsafe.Sizeof(entry{})+unsafe.Sizeof(result{})) + 64
+
+// EstimatedSize returns the estimated memory used by the entries in bytes,
+// weighed by Weigher or DefaultWeigher. It visits all entries.
+func (c *cache) EstimatedSize() int64 {
+	_, size := c.weigh()
+	return size
+}
+
+// weigh counts the entries and their estimated memory in a single pass.
+func (c *cache) weigh() (entries, size int64) {
+	weigh := c.opt.Weigher
+	if weigh == nil {
+		weigh = DefaultWeigher
+	}
+	c.rangeEntries(func(key string, e *entry) bool {
+		val, _ := e.loadRaw()
+		entries++
+		size += weigh(key, val) + entryOverhead
+		return true
+	})
+	return entries, size
+}
+
+// DefaultWeigher estimates the memory of a key and its value by heuristics:
+// strings and byte slices are counted by length, other slices and maps by
+// length times element size, pointers by the size of their targets, and
+// other values by their size. Memory referenced deeper is not counted.
+func DefaultWeigher(key string, val interface{}) int64 {
+	size := int64(unsafe.Sizeof(key)) + int64(len(key))
+	switch v := val.(type) {
+	case nil:
+		return size
+	case *compressed:
+		return size + int64(unsafe.Sizeof(*v)) + int64(cap(v.data))
+	case string:
+		return size + int64(unsafe.Sizeof(v)) + int64(len(v))
+	case []byte:
+		return size + int64(unsafe.Sizeof(v)) + int64(cap(v))
+	}
+
+	rv := reflect.ValueOf(val)
+	size += int64(rv.Type().Size())
+	switch rv.Kind() {
+	case reflect.Slice:
+		size += int64(rv.Cap()) * int64(rv.Type().Elem().Size())
+	case reflect.Map:
+		size += int64(rv.Len()) * int64(rv.Type().Key().Size()+rv.Type().Elem().Size())
+	case reflect.Ptr:
+		if !rv.IsNil() {
+			size += int64(rv.Type().Elem().Size())
+		}
+	}
+	return size
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestDefaultWeigher(t *testing.T) {
+	type obj struct {
+		a, b int64
+	}
+	key := int64(unsafe.Sizeof("")) + 3
+	cases := []struct {
+		val  interface{}
+		want int64
+	}{
+		{nil, key},
+		{"value", key + 16 + 5},
+		{make([]byte, 2, 10), key + 24 + 10},
+		{[]int64{1, 2}, key + 24 + 16},
+		{map[int64]int64{1: 1}, key + 8 + 16},
+		{&obj{}, key + 8 + 16},
+		{obj{}, key + 16},
+	}
+	for _, c := range cases {
+		Assertf(t, DefaultWeigher("key", c.val) == c.want, "DefaultWeigher(%T) = %d; want %d", c.val, DefaultWeigher("key", c.val), c.want)
+	}
+}
+
+func TestEstimatedSize(t *testing.T) {
+	c := NewCache(Options{
+		Weigher: func(key string, val interface{}) int64 {
+			return int64(len(val.(string)))
+		},
+	})
+	Assert(t, c.EstimatedSize() == 0)
+	c.SetDefault("a", "1234")
+	c.SetDefault("b", "123456")
+	Assert(t, c.EstimatedSize() == 10+2*entryOverhead)
+	Assert(t, c.Stats().EstimatedSize == c.EstimatedSize())
+}
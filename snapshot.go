@@ -0,0 +1,76 @@
+package cache
+
+// Snapshot is an immutable point-in-time view of a cache. The values are
+// shared with the cache, and MUST NOT be modified.
+type Snapshot struct {
+	entries map[string]result
+}
+
+// NewSnapshot creates a Snapshot of the values and errors by key, it is
+// used by the implementations of Cache.
+func NewSnapshot(data map[string]interface{}, errs map[string]error) *Snapshot {
+	s := &Snapshot{entries: make(map[string]result, len(data))}
+	for k, v := range data {
+		s.entries[k] = result{val: v, err: errs[k]}
+	}
+	for k, err := range errs {
+		if _, ok := data[k]; !ok {
+			s.entries[k] = result{err: err}
+		}
+	}
+	return s
+}
+
+// Snapshot returns a consistent view of all cached entries: writes are
+// blocked while the entries are copied, so no write is partially observed.
+func (c *cache) Snapshot() *Snapshot {
+	c.writes.Lock()
+	defer c.writes.Unlock()
+	s := &Snapshot{entries: make(map[string]result)}
+	c.rangeEntries(func(key string, e *entry) bool {
+		val, err := e.Load()
+		res := result{val: val, err: err}
+		if r := e.result(); r != nil {
+			res.stored, res.soft, res.hard = r.stored, r.soft, r.hard
+		}
+		s.entries[key] = res
+		return true
+	})
+	return s
+}
+
+// Get returns the value and error of the key, ok is false if it is not in the snapshot.
+func (s *Snapshot) Get(key string) (val interface{}, err error, ok bool) {
+	res, ok := s.entries[key]
+	return res.val, res.err, ok
+}
+
+// Lifetime returns the Lifetime of the key, which is zero if it is not in
+// the snapshot or not tracked by the implementation.
+func (s *Snapshot) Lifetime(key string) Lifetime {
+	res := s.entries[key]
+	return res.lifetime()
+}
+
+// Len returns the number of entries.
+func (s *Snapshot) Len() int {
+	return len(s.entries)
+}
+
+// Range calls fn for each entry until fn returns false.
+func (s *Snapshot) Range(fn func(key string, val interface{}, err error) bool) {
+	for k, res := range s.entries {
+		if !fn(k, res.val, res.err) {
+			return
+		}
+	}
+}
+
+// Dump returns the values by key, as Cache.Dump does.
+func (s *Snapshot) Dump() map[string]interface{} {
+	data := make(map[string]interface{}, len(s.entries))
+	for k, res := range s.entries {
+		data[k] = res.val
+	}
+	return data
+}
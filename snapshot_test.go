@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return nil, errors.New("error")
+		},
+	})
+	defer c.Close()
+	c.SetDefault("a", 1)
+	c.Get("bad")
+
+	s := c.Snapshot()
+	c.Set("a", 2)
+	c.Delete("bad")
+	Assert(t, s.Len() == 2)
+	val, err, ok := s.Get("a")
+	Assert(t, ok && err == nil && val == 1)
+	_, err, ok = s.Get("bad")
+	Assert(t, ok && err != nil)
+	_, _, ok = s.Get("missing")
+	Assert(t, !ok)
+	DeepEqual(t, s.Dump(), map[string]interface{}{"a": 1, "bad": nil})
+
+	s = NewSnapshot(map[string]interface{}{"a": 1}, map[string]error{"b": err})
+	n := 0
+	s.Range(func(key string, val interface{}, err error) bool {
+		n++
+		return true
+	})
+	Assert(t, n == 2)
+}
+
+func TestSnapshotConcurrentWrites(t *testing.T) {
+	c := NewCache(Options{})
+	defer c.Close()
+
+	var stop int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; atomic.LoadInt32(&stop) == 0; i++ {
+			c.Set(strconv.Itoa(i%10), i)
+			c.Delete(strconv.Itoa((i + 5) % 10))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		s := c.Snapshot()
+		Assert(t, s.Len() <= 10)
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+}
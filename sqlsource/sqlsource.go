@@ -0,0 +1,102 @@
+// Package sqlsource provides helpers for caching database rows by key
+// with asynccache.
+package sqlsource
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Scan scans the current row into the cached value and returns the key of the row.
+type Scan func(rows *sql.Rows) (key string, val interface{}, err error)
+
+// Placeholder returns the bind variable of the i-th (starting from 1) parameter.
+type Placeholder func(i int) string
+
+// Question is the placeholder used by MySQL and SQLite.
+func Question(int) string { return "?" }
+
+// Dollar is the placeholder used by PostgreSQL.
+func Dollar(i int) string { return "$" + strconv.Itoa(i) }
+
+// Fetcher returns a Fetcher running query with the key as the only argument,
+// e.g. "SELECT id, name FROM users WHERE id = ?".
+// sql.ErrNoRows is returned if query selects nothing.
+func Fetcher(db *sql.DB, query string, scan Scan) func(key string) (interface{}, error) {
+	return func(key string) (interface{}, error) {
+		rows, err := db.Query(query, key)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return nil, err
+			}
+			return nil, sql.ErrNoRows
+		}
+		_, val, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		return val, rows.Close()
+	}
+}
+
+// KeysToken is replaced with the IN-clause placeholders in the queries of
+// BatchFetcher.
+const KeysToken = "{keys}"
+
+// DefaultMaxKeys is the number of keys per query of BatchFetcher by default,
+// under the bind variable limits of common databases.
+const DefaultMaxKeys = 500
+
+// BatchFetcher returns a function fetching many keys by queries of at most
+// maxKeys keys each, DefaultMaxKeys if maxKeys is not positive. KeysToken
+// in query is replaced with the IN-clause placeholders, e.g.
+// "SELECT id, name FROM users WHERE id IN ({keys})". Keys without a
+// matching row are absent in the result.
+func BatchFetcher(db *sql.DB, query string, scan Scan, placeholder Placeholder, maxKeys int) func(keys []string) (map[string]interface{}, error) {
+	if placeholder == nil {
+		placeholder = Question
+	}
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return func(keys []string) (map[string]interface{}, error) {
+		res := make(map[string]interface{}, len(keys))
+		for len(keys) > 0 {
+			n := min(len(keys), maxKeys)
+			if err := queryKeys(db, query, scan, placeholder, keys[:n], res); err != nil {
+				return nil, err
+			}
+			keys = keys[n:]
+		}
+		return res, nil
+	}
+}
+
+// queryKeys runs the query of BatchFetcher for keys, and adds the rows to res.
+func queryKeys(db *sql.DB, query string, scan Scan, placeholder Placeholder, keys []string, res map[string]interface{}) error {
+	marks := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		marks[i] = placeholder(i + 1)
+		args[i] = key
+	}
+
+	rows, err := db.Query(strings.Replace(query, KeysToken, strings.Join(marks, ", "), 1), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key, val, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		res[key] = val
+	}
+	return rows.Err()
+}
@@ -0,0 +1,119 @@
+package sqlsource
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeDriver serves rows of (id, name) whose id is in the query arguments.
+type fakeDriver struct {
+	mu    sync.Mutex
+	table map[string]string
+	query string
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	c.d.query = query
+	c.d.mu.Unlock()
+	return &fakeStmt{c.d}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ d *fakeDriver }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows := &fakeRows{}
+	for _, arg := range args {
+		id := arg.(string)
+		if name, ok := s.d.table[id]; ok {
+			rows.data = append(rows.data, [2]string{id, name})
+		}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	data [][2]string
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "name"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	dest[0], dest[1] = r.data[0][0], r.data[0][1]
+	r.data = r.data[1:]
+	return nil
+}
+
+var drv = &fakeDriver{table: map[string]string{"1": "alice", "2": "bob"}}
+
+func init() {
+	sql.Register("sqlsource-fake", drv)
+}
+
+func scanName(rows *sql.Rows) (string, interface{}, error) {
+	var id, name string
+	err := rows.Scan(&id, &name)
+	return id, name, err
+}
+
+func TestFetcher(t *testing.T) {
+	db, _ := sql.Open("sqlsource-fake", "")
+	defer db.Close()
+	fetch := Fetcher(db, "SELECT id, name FROM users WHERE id = ?", scanName)
+
+	v, err := fetch("1")
+	if err != nil || v.(string) != "alice" {
+		t.Fatalf("fetch = %v, %v", v, err)
+	}
+	if _, err = fetch("3"); err != sql.ErrNoRows {
+		t.Fatalf("fetch error = %v; want ErrNoRows", err)
+	}
+}
+
+func TestBatchFetcher(t *testing.T) {
+	db, _ := sql.Open("sqlsource-fake", "")
+	defer db.Close()
+	fetch := BatchFetcher(db, "SELECT id, name FROM users WHERE name NOT LIKE '%s' AND id IN ({keys})", scanName, Dollar, 0)
+
+	res, err := fetch([]string{"1", "2", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res["1"] != "alice" || res["2"] != "bob" {
+		t.Fatalf("fetch = %v", res)
+	}
+	if want := "SELECT id, name FROM users WHERE name NOT LIKE '%s' AND id IN ($1, $2, $3)"; drv.query != want {
+		t.Fatalf("query = %q; want %q", drv.query, want)
+	}
+
+	// chunked by maxKeys
+	fetch = BatchFetcher(db, "SELECT id, name FROM users WHERE id IN ({keys})", scanName, Dollar, 2)
+	res, err = fetch([]string{"1", "3", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res["1"] != "alice" || res["2"] != "bob" {
+		t.Fatalf("fetch = %v", res)
+	}
+	if want := "SELECT id, name FROM users WHERE id IN ($1)"; drv.query != want {
+		t.Fatalf("query = %q; want %q", drv.query, want)
+	}
+}
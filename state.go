@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EntryState is the lifecycle state of an entry.
+type EntryState int32
+
+const (
+	// StateEmpty is the state of an entry without a value stored yet.
+	StateEmpty EntryState = iota
+	// StateFetching is the state of an entry being refreshed.
+	StateFetching
+	// StateFresh is the state of an entry whose value was fetched or set
+	// successfully, and has not passed its SoftTTL.
+	StateFresh
+	// StateStale is the state of an entry serving its value past SoftTTL,
+	// or after the last refresh of it failed.
+	StateStale
+	// StateErrored is the state of an entry whose error is cached.
+	StateErrored
+	// StateExpiring is the state of an entry not accessed since the last
+	// expire cycle, which will be deleted by the next one.
+	StateExpiring
+)
+
+// String implements fmt.Stringer.
+func (s EntryState) String() string {
+	switch s {
+	case StateEmpty:
+		return "Empty"
+	case StateFetching:
+		return "Fetching"
+	case StateFresh:
+		return "Fresh"
+	case StateStale:
+		return "Stale"
+	case StateErrored:
+		return "Errored"
+	case StateExpiring:
+		return "Expiring"
+	}
+	return "Unknown"
+}
+
+// expiringBit is set in entry.state while the entry is expiring, it is kept
+// across the other transitions so that refreshes do not keep unaccessed
+// entries alive.
+const expiringBit = 1 << 30
+
+// loadState returns the current state of e, where StateFresh past SoftTTL is
+// reported as StateStale.
+func (e *entry) loadState() EntryState {
+	s := atomic.LoadInt32(&e.state)
+	if s&expiringBit != 0 {
+		return StateExpiring
+	}
+	if EntryState(s) == StateFresh {
+		if res := e.result(); res != nil && res.soft > 0 && time.Now().UnixNano() >= res.soft {
+			return StateStale
+		}
+	}
+	return EntryState(s)
+}
+
+// transit moves e to state s, and returns the previous state.
+func (e *entry) transit(s EntryState) EntryState {
+	for {
+		old := atomic.LoadInt32(&e.state)
+		if atomic.CompareAndSwapInt32(&e.state, old, old&expiringBit|int32(s)) {
+			return EntryState(old &^ expiringBit)
+		}
+	}
+}
+
+// markExpiring marks e expiring, and reports false if it is expiring already.
+func (e *entry) markExpiring() bool {
+	for {
+		old := atomic.LoadInt32(&e.state)
+		if old&expiringBit != 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&e.state, old, old|expiringBit) {
+			return true
+		}
+	}
+}
+
+// unmarkExpiring clears the expiring mark of e.
+func (e *entry) unmarkExpiring() {
+	for {
+		old := atomic.LoadInt32(&e.state)
+		if old&expiringBit == 0 || atomic.CompareAndSwapInt32(&e.state, old, old&^expiringBit) {
+			return
+		}
+	}
+}
+
+// stateChanged emits EventStateChanged.
+func (c *cache) stateChanged(key string, from, to EntryState) {
+	if from != to && c.opt.EventHandler != nil {
+		c.emit(Event{Type: EventStateChanged, Key: key, From: from, State: to})
+	}
+}
+
+// settled returns the state of e by its stored result.
+func (e *entry) settled() EntryState {
+	res := e.result()
+	switch {
+	case res == nil:
+		return StateEmpty
+	case res.err != nil:
+		return StateErrored
+	}
+	return StateFresh
+}
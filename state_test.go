@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEntryState(t *testing.T) {
+	fail := false
+	events := make(chan Event, 16)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		EnableExpire:    true,
+		ExpireDuration:  time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			if fail {
+				return nil, errors.New("fail")
+			}
+			return key, nil
+		},
+		EventHandler: func(ev Event) {
+			if ev.Type == EventStateChanged {
+				events <- ev
+			}
+		},
+	}).(*cache)
+	defer c.Close()
+	state := func(key string) EntryState {
+		var s EntryState
+		c.RangeEntries(func(k string, val interface{}, meta EntryInfo) bool {
+			if k == key {
+				s = meta.State
+			}
+			return true
+		})
+		return s
+	}
+	next := func(from, to EntryState) {
+		t.Helper()
+		ev := <-events
+		Assertf(t, ev.Key == "a" && ev.From == from && ev.State == to, "%v: %v -> %v", ev.Key, ev.From, ev.State)
+	}
+
+	c.Get("a")
+	Assert(t, state("a") == StateFresh)
+
+	fail = true
+	c.refresh()
+	next(StateFresh, StateFetching)
+	next(StateFetching, StateStale)
+	Assert(t, state("a") == StateStale)
+	fail = false
+	c.refresh()
+	next(StateStale, StateFetching)
+	next(StateFetching, StateFresh)
+
+	c.expire()
+	next(StateFresh, StateExpiring)
+	// refreshes do not keep the entry alive
+	c.refresh()
+	Assert(t, state("a") == StateExpiring)
+	c.Get("a")
+	Assert(t, state("a") == StateFresh)
+
+	c.Set("b", "b")
+	Assert(t, state("b") == StateFresh)
+	Assert(t, StateErrored.String() == "Errored")
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected %v -> %v", ev.From, ev.State)
+	default:
+	}
+}
+
+func TestUnmarkExpiringRacingTransit(t *testing.T) {
+	e := &entry{}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				e.transit(StateFetching)
+				e.transit(StateFresh)
+			}
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		e.markExpiring()
+		e.unmarkExpiring()
+		Assertf(t, atomic.LoadInt32(&e.state)&expiringBit == 0, "touch %d lost", i)
+	}
+	close(stop)
+	<-done
+}
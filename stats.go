@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"math/rand/v2"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is the statistics of a cache.
+type Stats struct {
+	// Hits and Misses are counted if EnableStats is true.
+	Hits   uint64
+	Misses uint64
+	// RefreshSkipped is the number of refresh cycles skipped because the
+	// previous cycle was still running.
+	RefreshSkipped uint64
+	// LastRefreshCycle is the time taken by the last refresh cycle.
+	LastRefreshCycle time.Duration
+	// Entries is the number of cached entries.
+	Entries int64
+	// EstimatedSize is the estimated memory used by the entries in bytes.
+	EstimatedSize int64
+	// DroppedEvents is the number of handler calls dropped, see HandlerQueueSize.
+	DroppedEvents uint64
+}
+
+// HitRatio returns the ratio of hits to all accesses.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// KeyStat is the access statistics of a key.
+type KeyStat struct {
+	Key        string
+	Hits       uint64
+	LastAccess time.Time
+}
+
+type keyStats struct {
+	hits       uint64
+	lastAccess int64 // unix nano
+}
+
+func (c *cache) newEntry() *entry {
+	e := entryPool.Get().(*entry)
+	e.c = c
+	if c.opt.EnableKeyStats {
+		e.stats = &keyStats{lastAccess: time.Now().UnixNano()}
+	}
+	return e
+}
+
+// sample reports whether to record the access, and the weight of it.
+func (c *cache) sample() (uint64, bool) {
+	if c.opt.StatsSampleRate <= 1 {
+		return 1, true
+	}
+	return uint64(c.opt.StatsSampleRate), rand.Uint32N(uint32(c.opt.StatsSampleRate)) == 0
+}
+
+// access records a hit of e.
+func (c *cache) access(e *entry) {
+	e.Touch()
+	if e.tenant != nil {
+		atomic.AddUint64(&e.tenant.hits, 1)
+	}
+	if !c.opt.EnableStats && e.stats == nil {
+		return
+	}
+	weight, ok := c.sample()
+	if !ok {
+		return
+	}
+	if c.opt.EnableStats {
+		atomic.AddUint64(&c.hits, weight)
+	}
+	if e.stats != nil {
+		atomic.AddUint64(&e.stats.hits, weight)
+		atomic.StoreInt64(&e.stats.lastAccess, time.Now().UnixNano())
+	}
+}
+
+// miss records a miss.
+func (c *cache) miss(key string) {
+	if ts := c.tenantOf(key); ts != nil {
+		atomic.AddUint64(&ts.misses, 1)
+	}
+	if !c.opt.EnableStats {
+		return
+	}
+	if weight, ok := c.sample(); ok {
+		atomic.AddUint64(&c.misses, weight)
+	}
+}
+
+// Stats returns the statistics of the cache.
+func (c *cache) Stats() Stats {
+	entries, size := c.weigh()
+	return Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+
+		RefreshSkipped:   atomic.LoadUint64(&c.refreshSkipped),
+		LastRefreshCycle: time.Duration(atomic.LoadInt64(&c.refreshCycle)),
+		DroppedEvents:    c.handlers.droppedEvents(),
+
+		Entries:       entries,
+		EstimatedSize: size,
+	}
+}
+
+// TopKeys returns the statistics of the n most hit keys.
+func (c *cache) TopKeys(n int) []KeyStat {
+	if !c.opt.EnableKeyStats {
+		return nil
+	}
+	var stats []KeyStat
+	c.rangeEntries(func(key string, e *entry) bool {
+		if e.stats == nil {
+			return true
+		}
+		stats = append(stats, KeyStat{
+			Key:        key,
+			Hits:       atomic.LoadUint64(&e.stats.hits),
+			LastAccess: time.Unix(0, atomic.LoadInt64(&e.stats.lastAccess)),
+		})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Hits != stats[j].Hits {
+			return stats[i].Hits > stats[j].Hits
+		}
+		return stats[i].Key < stats[j].Key
+	})
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
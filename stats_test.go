@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTopKeys(t *testing.T) {
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		EnableKeyStats: true,
+	}
+	c := NewCache(op)
+	for i, key := range []string{"a", "b", "c"} {
+		for j := 0; j <= i; j++ {
+			c.Get(key)
+		}
+	}
+	c.SetDefault("d", "d")
+
+	stats := c.TopKeys(2)
+	Assert(t, len(stats) == 2)
+	Assert(t, stats[0].Key == "c" && stats[0].Hits == 2)
+	Assert(t, stats[1].Key == "b" && stats[1].Hits == 1)
+	stats = c.TopKeys(0)
+	Assert(t, len(stats) == 4)
+	Assert(t, stats[3].Key == "d" && stats[3].Hits == 0 && !stats[3].LastAccess.IsZero())
+
+	w := httptest.NewRecorder()
+	NewAdminHandler(c).ServeHTTP(w, httptest.NewRequest("GET", "/topkeys?n=1", nil))
+	var got []KeyStat
+	Assert(t, json.Unmarshal(w.Body.Bytes(), &got) == nil)
+	Assert(t, len(got) == 1 && got[0].Key == "c")
+
+	Assert(t, NewCache(Options{}).TopKeys(1) == nil)
+}
+
+func TestStats(t *testing.T) {
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		EnableStats: true,
+	}
+	c := NewCache(op)
+	c.Get("a")
+	c.Get("a")
+	c.GetOrSet("a", "def")
+	c.GetOrSet("b", "def")
+	s := c.Stats()
+	Assert(t, s.Hits == 2 && s.Misses == 2)
+	Assert(t, s.HitRatio() == 0.5)
+
+	Assert(t, NewCache(Options{}).Stats().HitRatio() == 0)
+}
+
+func TestStatsSampling(t *testing.T) {
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		EnableStats:     true,
+		EnableKeyStats:  true,
+		StatsSampleRate: 10,
+	}
+	c := NewCache(op)
+	const n = 100000
+	for i := 0; i < n; i++ {
+		c.Get("key")
+	}
+	s := c.Stats()
+	Assertf(t, s.Hits > n*8/10 && s.Hits < n*12/10, "estimated hits %d of %d", s.Hits, n)
+	Assert(t, s.Hits%10 == 0)
+	hits := c.TopKeys(1)[0].Hits
+	Assertf(t, hits > n*8/10 && hits < n*12/10, "estimated key hits %d of %d", hits, n)
+}
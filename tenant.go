@@ -0,0 +1,397 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TenantStats is the statistics of a tenant, tracked if TenantFunc is set.
+type TenantStats struct {
+	Entries int64
+	Hits    uint64
+	Misses  uint64
+}
+
+type tenantStats struct {
+	entries int64
+	hits    uint64
+	misses  uint64
+}
+
+// TenantPrefix is a TenantFunc taking the first part of keys built by K as
+// the tenant, as keys of ForTenant are: the part before the first unescaped
+// KeySeparator, unescaped.
+func TenantPrefix(key string) string {
+	if id, _, ok := cutKeyPart(key); ok {
+		return id
+	}
+	return ""
+}
+
+// tenantOf returns the statistics of the tenant of key, or nil if it is not tracked.
+func (c *cache) tenantOf(key string) *tenantStats {
+	if c.opt.TenantFunc == nil {
+		return nil
+	}
+	id := c.opt.TenantFunc(key)
+	if id == "" {
+		return nil
+	}
+	if ts, ok := c.tenants.Load(id); ok {
+		return ts.(*tenantStats)
+	}
+	ts, _ := c.tenants.LoadOrStore(id, &tenantStats{})
+	return ts.(*tenantStats)
+}
+
+// loadOrStore stores ety as the entry of key unless the key is cached, or
+// its tenant is over TenantQuota. It returns the entry of the key, which is
+// ety if it is not stored for the quota, and whether ety is stored.
+func (c *cache) loadOrStore(key string, ety *entry) (actual *entry, loaded, stored bool) {
+	ts := c.tenantOf(key)
+	if ts != nil {
+		if v, ok := c.data().Load(key); ok {
+			return v.(*entry), true, false
+		}
+		if n := atomic.AddInt64(&ts.entries, 1); c.opt.TenantQuota > 0 && n > int64(c.opt.TenantQuota) {
+			atomic.AddInt64(&ts.entries, -1)
+			return ety, false, false
+		}
+		ety.tenant = ts
+	}
+	ety.key, ety.stored = key, true
+	c.beginWrite()
+	v, loaded := c.data().LoadOrStore(key, ety)
+	if !loaded {
+		c.index.add(key, ety)
+	}
+	c.endWrite()
+	if !loaded {
+		c.scheduleExpiry(ety)
+	}
+	if loaded && ts != nil {
+		atomic.AddInt64(&ts.entries, -1)
+	}
+	if !loaded {
+		c.logChange(key)
+	}
+	return v.(*entry), loaded, !loaded
+}
+
+// remove deletes the entry of key if it is still value, see removed.
+func (c *cache) remove(key string, value interface{}, reason DeleteReason) bool {
+	c.beginWrite()
+	deleted := c.data().CompareAndDelete(key, value)
+	c.endWrite()
+	if !deleted {
+		return false
+	}
+	c.logChange(key)
+	c.removed(key, value.(*entry), reason)
+	return true
+}
+
+// TenantStats returns the statistics of the tenant.
+func (c *cache) TenantStats(id string) TenantStats {
+	v, ok := c.tenants.Load(id)
+	if !ok {
+		return TenantStats{}
+	}
+	ts := v.(*tenantStats)
+	return TenantStats{
+		Entries: atomic.LoadInt64(&ts.entries),
+		Hits:    atomic.LoadUint64(&ts.hits),
+		Misses:  atomic.LoadUint64(&ts.misses),
+	}
+}
+
+// PurgeTenant deletes the entries of the tenant.
+func (c *cache) PurgeTenant(id string) int {
+	if c.opt.TenantFunc == nil {
+		return 0
+	}
+	return c.DeleteIfValue(func(key string, _ interface{}) bool {
+		return c.opt.TenantFunc(key) == id
+	})
+}
+
+// ForTenant returns a Cache of the tenant over c, which prefixes the keys
+// with K(id) and KeySeparator, and only sees the keys of the tenant. Its
+// Stats are the TenantStats of the tenant, which are tracked if TenantFunc
+// of c is TenantPrefix. Close of the returned Cache does nothing, c is
+// closed by its owner.
+//
+// The methods acting on the whole cache are scoped to the tenant as well:
+// ReplaceAll, Snapshot, Changes, EstimatedSize, TenantStats and
+// PurgeTenant. Flush and Healthy act on c, whose write queue and health are
+// shared by the tenants.
+func ForTenant(c Cache, id string) Cache {
+	return &tenantCache{c: c, id: id, prefix: K(id) + string(KeySeparator)}
+}
+
+// tenantCache implements every method of Cache rather than embedding it, so
+// that methods added to Cache do not reach the keys of other tenants.
+type tenantCache struct {
+	c      Cache
+	id     string
+	prefix string
+}
+
+func (t *tenantCache) key(key string) string {
+	return t.prefix + key
+}
+
+func (t *tenantCache) own(key string) (string, bool) {
+	if !strings.HasPrefix(key, t.prefix) {
+		return "", false
+	}
+	return key[len(t.prefix):], true
+}
+
+func (t *tenantCache) SetDefault(key string, val interface{}) bool {
+	return t.c.SetDefault(t.key(key), val)
+}
+
+func (t *tenantCache) Set(key string, val interface{}) {
+	t.c.Set(t.key(key), val)
+}
+
+func (t *tenantCache) Lease(key string, ttl time.Duration) (LeaseToken, error) {
+	return t.c.Lease(t.key(key), ttl)
+}
+
+func (t *tenantCache) SetWithLease(key string, val interface{}, token LeaseToken) error {
+	return t.c.SetWithLease(t.key(key), val, token)
+}
+
+func (t *tenantCache) Put(key string, val interface{}) error {
+	return t.c.Put(t.key(key), val)
+}
+
+func (t *tenantCache) PutAsync(key string, val interface{}) error {
+	return t.c.PutAsync(t.key(key), val)
+}
+
+// Flush flushes the write queue of c, which holds the writes of all tenants.
+func (t *tenantCache) Flush(ctx context.Context) error {
+	return t.c.Flush(ctx)
+}
+
+// ReplaceAll sets the entries of data and deletes the other entries of the
+// tenant. Unlike ReplaceAll of c, readers may see a mix of the old entries
+// and the new ones while it runs.
+func (t *tenantCache) ReplaceAll(data map[string]interface{}) {
+	for k, v := range data {
+		t.c.Set(t.key(k), v)
+	}
+	t.DeleteIf(func(key string) bool {
+		_, ok := data[key]
+		return !ok
+	})
+}
+
+func (t *tenantCache) Get(key string) (interface{}, error) {
+	return t.c.Get(t.key(key))
+}
+
+func (t *tenantCache) GetWithTimeout(key string, timeout time.Duration) (interface{}, error) {
+	return t.c.GetWithTimeout(t.key(key), timeout)
+}
+
+func (t *tenantCache) Acquire(key string) (Handle, error) {
+	return t.c.Acquire(t.key(key))
+}
+
+func (t *tenantCache) GetOrSet(key string, def interface{}) interface{} {
+	return t.c.GetOrSet(t.key(key), def)
+}
+
+func (t *tenantCache) GetOrSetWithTimeout(key string, def interface{}, timeout time.Duration) interface{} {
+	return t.c.GetOrSetWithTimeout(t.key(key), def, timeout)
+}
+
+func (t *tenantCache) GetOrSetMulti(defaults map[string]interface{}) map[string]interface{} {
+	own := make(map[string]interface{}, len(defaults))
+	for k, def := range defaults {
+		own[t.key(k)] = def
+	}
+	vals := make(map[string]interface{}, len(defaults))
+	for k, v := range t.c.GetOrSetMulti(own) {
+		if k, ok := t.own(k); ok {
+			vals[k] = v
+		}
+	}
+	return vals
+}
+
+func (t *tenantCache) GetAll(keys ...string) (map[string]interface{}, uint64, error) {
+	own := make([]string, len(keys))
+	for i, k := range keys {
+		own[i] = t.key(k)
+	}
+	vals, seq, err := t.c.GetAll(own...)
+	res := make(map[string]interface{}, len(vals))
+	for k, v := range vals {
+		if k, ok := t.own(k); ok {
+			res[k] = v
+		}
+	}
+	return res, seq, err
+}
+
+func (t *tenantCache) GetOrReset(key string, resetVal interface{}) interface{} {
+	return t.c.GetOrReset(t.key(key), resetVal)
+}
+
+func (t *tenantCache) GetOrResetWithTTL(key string, resetVal interface{}, ttl time.Duration) interface{} {
+	return t.c.GetOrResetWithTTL(t.key(key), resetVal, ttl)
+}
+
+func (t *tenantCache) Dump() map[string]interface{} {
+	data := make(map[string]interface{})
+	t.RangeEntries(func(key string, val interface{}, meta EntryInfo) bool {
+		data[key] = val
+		return true
+	})
+	return data
+}
+
+// Snapshot returns the entries of the tenant in a snapshot of c.
+func (t *tenantCache) Snapshot() *Snapshot {
+	all := t.c.Snapshot()
+	s := &Snapshot{entries: make(map[string]result)}
+	for key, res := range all.entries {
+		if k, ok := t.own(key); ok {
+			s.entries[k] = res
+		}
+	}
+	return s
+}
+
+func (t *tenantCache) RangeEntries(fn func(key string, val interface{}, meta EntryInfo) bool) {
+	t.c.RangeEntries(func(key string, val interface{}, meta EntryInfo) bool {
+		if k, ok := t.own(key); ok {
+			return fn(k, val, meta)
+		}
+		return true
+	})
+}
+
+func (t *tenantCache) DeleteIf(shouldDelete func(key string) bool) {
+	t.c.DeleteIf(func(key string) bool {
+		k, ok := t.own(key)
+		return ok && shouldDelete(k)
+	})
+}
+
+func (t *tenantCache) DeleteIfValue(shouldDelete func(key string, val interface{}) bool) int {
+	return t.c.DeleteIfValue(func(key string, val interface{}) bool {
+		k, ok := t.own(key)
+		return ok && shouldDelete(k, val)
+	})
+}
+
+func (t *tenantCache) Delete(key string) {
+	t.c.Delete(t.key(key))
+}
+
+func (t *tenantCache) Errors() map[string]error {
+	errs := make(map[string]error)
+	for key, err := range t.c.Errors() {
+		if k, ok := t.own(key); ok {
+			errs[k] = err
+		}
+	}
+	return errs
+}
+
+func (t *tenantCache) DeleteErrored() {
+	errs := t.c.Errors()
+	t.c.DeleteIfValue(func(key string, val interface{}) bool {
+		_, ok := t.own(key)
+		return ok && errs[key] != nil
+	})
+}
+
+// Changes returns the changes of the keys of the tenant in the changes of
+// c, ChangeReset records included.
+func (t *tenantCache) Changes(sinceSeq uint64) []ChangeRecord {
+	var recs []ChangeRecord
+	for _, rec := range t.c.Changes(sinceSeq) {
+		if rec.Op != ChangeReset {
+			k, ok := t.own(rec.Key)
+			if !ok {
+				continue
+			}
+			rec.Key = k
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func (t *tenantCache) TopKeys(n int) []KeyStat {
+	var stats []KeyStat
+	for _, st := range t.c.TopKeys(0) {
+		if k, ok := t.own(st.Key); ok {
+			st.Key = k
+			stats = append(stats, st)
+			if len(stats) == n {
+				break
+			}
+		}
+	}
+	return stats
+}
+
+// TenantStats returns the Stats of the tenant if id is its id, the keys of
+// a tenant belong to no other tenant.
+func (t *tenantCache) TenantStats(id string) TenantStats {
+	if id != t.id {
+		return TenantStats{}
+	}
+	return t.c.TenantStats(t.id)
+}
+
+// PurgeTenant deletes the entries of the tenant if id is its id.
+func (t *tenantCache) PurgeTenant(id string) int {
+	if id != t.id {
+		return 0
+	}
+	return t.DeleteIfValue(func(string, interface{}) bool { return true })
+}
+
+// Healthy returns the problems of c, which the tenants share.
+func (t *tenantCache) Healthy() error {
+	return t.c.Healthy()
+}
+
+func (t *tenantCache) Stats() Stats {
+	st := t.c.TenantStats(t.id)
+	return Stats{Hits: st.Hits, Misses: st.Misses, Entries: st.Entries}
+}
+
+// EstimatedSize returns the estimated memory used by the entries of the
+// tenant, weighed by DefaultWeigher.
+func (t *tenantCache) EstimatedSize() int64 {
+	var size int64
+	t.c.RangeEntries(func(key string, val interface{}, _ EntryInfo) bool {
+		if _, ok := t.own(key); ok {
+			size += DefaultWeigher(key, val) + entryOverhead
+		}
+		return true
+	})
+	return size
+}
+
+func (t *tenantCache) Refresh(key string) error {
+	return t.c.Refresh(t.key(key))
+}
+
+func (t *tenantCache) Close() {}
+
+func (t *tenantCache) IsClosed() bool {
+	return t.c.IsClosed()
+}
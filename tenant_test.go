@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTenants(t *testing.T) {
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		TenantFunc:  TenantPrefix,
+		TenantQuota: 2,
+	})
+	defer c.Close()
+	a, b := ForTenant(c, "a"), ForTenant(c, "b")
+
+	for _, key := range []string{"1", "2", "3"} {
+		val, err := a.Get(key)
+		Assert(t, err == nil && val == "a:"+key)
+	}
+	a.Get("1")
+	Assert(t, !a.SetDefault("4", "v"))
+	b.Set("1", "b1")
+
+	DeepEqual(t, a.Dump(), map[string]interface{}{"1": "a:1", "2": "a:2"})
+	DeepEqual(t, b.Dump(), map[string]interface{}{"1": "b1"})
+	DeepEqual(t, c.TenantStats("a"), TenantStats{Entries: 2, Hits: 1, Misses: 3})
+	Assert(t, a.Stats().Hits == 1)
+
+	a.Delete("1")
+	Assert(t, c.TenantStats("a").Entries == 1)
+	a.Get("3")
+	DeepEqual(t, a.Dump(), map[string]interface{}{"2": "a:2", "3": "a:3"})
+
+	Assert(t, c.PurgeTenant("a") == 2)
+	Assert(t, c.TenantStats("a").Entries == 0)
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b:1": "b1"})
+	a.Close()
+	Assert(t, !c.IsClosed())
+}
+
+func TestTenantSeparatorInID(t *testing.T) {
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		TenantFunc: TenantPrefix,
+	})
+	defer c.Close()
+	a, ab := ForTenant(c, "a"), ForTenant(c, "a:b")
+
+	ab.Set("secret", 1)
+	a.Set("b:secret", 2)
+	DeepEqual(t, a.Dump(), map[string]interface{}{"b:secret": 2})
+	DeepEqual(t, ab.Dump(), map[string]interface{}{"secret": 1})
+	Assert(t, c.TenantStats("a").Entries == 1)
+	Assert(t, c.TenantStats("a:b").Entries == 1)
+	Assert(t, TenantPrefix(K("a:b", "secret")) == "a:b")
+
+	Assert(t, c.PurgeTenant("a") == 1)
+	DeepEqual(t, ab.Dump(), map[string]interface{}{"secret": 1})
+}
+
+func TestTenantWholeCacheMethods(t *testing.T) {
+	c := NewCache(Options{
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+		TenantFunc:    TenantPrefix,
+		ChangeLogSize: 100,
+	})
+	defer c.Close()
+	a, b := ForTenant(c, "a"), ForTenant(c, "b")
+	a.Set("1", 1)
+	a.Set("2", 2)
+	b.Set("1", 1)
+
+	a.ReplaceAll(map[string]interface{}{"2": 20, "mine": 3})
+	DeepEqual(t, a.Dump(), map[string]interface{}{"2": 20, "mine": 3})
+	DeepEqual(t, b.Dump(), map[string]interface{}{"1": 1})
+	Assert(t, c.Dump()["mine"] == nil)
+
+	s := a.Snapshot()
+	Assert(t, s.Len() == 2)
+	val, _, ok := s.Get("mine")
+	Assert(t, ok && val == 3)
+
+	for _, rec := range a.Changes(0) {
+		Assertf(t, rec.Key == "1" || rec.Key == "2" || rec.Key == "mine", "change of %q", rec.Key)
+	}
+	last := b.Changes(0)
+	Assert(t, len(last) == 1 && last[0].Key == "1" && last[0].Value == 1)
+
+	Assert(t, a.EstimatedSize() > 0 && a.EstimatedSize() < c.EstimatedSize())
+	Assert(t, a.TenantStats("b") == TenantStats{})
+	Assert(t, a.PurgeTenant("b") == 0)
+	Assert(t, a.PurgeTenant("a") == 2)
+	DeepEqual(t, c.Dump(), map[string]interface{}{"b:1": 1})
+}
@@ -0,0 +1,173 @@
+// Package tokencache provides a cache of expiring credentials, such as OAuth
+// access tokens, built on asynccache.
+//
+// Each token is renewed in background once a configured fraction of its
+// lifetime has elapsed, and an expired token is never returned to callers.
+package tokencache
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+// ErrExpired is returned when the token is expired and cannot be renewed.
+var ErrExpired = errors.New("tokencache: token expired")
+
+// ErrNoExpiry is returned when Fetcher returns a token without Expiry.
+var ErrNoExpiry = errors.New("tokencache: token without expiry")
+
+// Token is a credential with its expiry.
+type Token struct {
+	Value  string
+	Expiry time.Time
+}
+
+// Options controls the behavior of Cache.
+type Options struct {
+	// Fetcher obtains a new token of the key, it MUST be set.
+	Fetcher func(key string) (Token, error)
+
+	// RenewFraction is the fraction of the token lifetime after which the
+	// token is renewed, it defaults to 0.8.
+	RenewFraction float64
+	// RetryInterval is the delay before retrying a failed renewal, it
+	// defaults to 5 seconds and is capped to half of the remaining lifetime.
+	RetryInterval time.Duration
+	// MinInterval is the minimum delay between two fetches of a key, so that
+	// expired tokens or failures do not poll Fetcher in a tight loop, it
+	// defaults to 1 second.
+	MinInterval time.Duration
+
+	ErrorHandler func(key string, err error)
+}
+
+// Cache caches tokens by key.
+type Cache struct {
+	opt Options
+	c   asynccache.Cache
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	expiry map[string]time.Time
+	last   map[string]time.Time // the start of the last fetch
+	closed bool
+}
+
+// New creates a Cache.
+func New(opt Options) *Cache {
+	if opt.Fetcher == nil {
+		panic("tokencache: invalid Fetcher")
+	}
+	if opt.RenewFraction <= 0 || opt.RenewFraction >= 1 {
+		opt.RenewFraction = 0.8
+	}
+	if opt.RetryInterval == 0 {
+		opt.RetryInterval = 5 * time.Second
+	}
+	if opt.MinInterval <= 0 {
+		opt.MinInterval = time.Second
+	}
+	t := &Cache{
+		opt:    opt,
+		timers: make(map[string]*time.Timer),
+		expiry: make(map[string]time.Time),
+		last:   make(map[string]time.Time),
+	}
+	t.c = asynccache.NewCache(asynccache.Options{
+		Fetcher:      t.fetch,
+		ErrorHandler: opt.ErrorHandler,
+	})
+	return t
+}
+
+// Token returns an unexpired token of the key.
+func (t *Cache) Token(key string) (Token, error) {
+	v, err := t.c.Get(key)
+	if err != nil {
+		return Token{}, err
+	}
+	tok := v.(Token)
+	if time.Now().Before(tok.Expiry) {
+		return tok, nil
+	}
+
+	// renewal is late, fetch synchronously unless fetched just now.
+	t.mu.Lock()
+	recent := time.Since(t.last[key]) < t.opt.MinInterval
+	t.mu.Unlock()
+	if recent {
+		return Token{}, ErrExpired
+	}
+	if err = t.c.Refresh(key); err != nil {
+		return Token{}, err
+	}
+	v, err = t.c.Get(key)
+	if err != nil {
+		return Token{}, err
+	}
+	tok = v.(Token)
+	if !time.Now().Before(tok.Expiry) {
+		return Token{}, ErrExpired
+	}
+	return tok, nil
+}
+
+// Close stops renewing tokens and closes the underlying cache.
+func (t *Cache) Close() {
+	t.mu.Lock()
+	t.closed = true
+	for key, timer := range t.timers {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+	t.mu.Unlock()
+	t.c.Close()
+}
+
+func (t *Cache) fetch(key string) (interface{}, error) {
+	start := time.Now()
+	t.mu.Lock()
+	t.last[key] = start
+	t.mu.Unlock()
+	tok, err := t.opt.Fetcher(key)
+	if err == nil && tok.Expiry.IsZero() {
+		err = ErrNoExpiry
+	}
+	if err != nil {
+		t.mu.Lock()
+		retry := t.opt.RetryInterval
+		if expiry, ok := t.expiry[key]; ok {
+			if remain := expiry.Sub(start) / 2; remain < retry {
+				retry = remain
+			}
+		}
+		t.schedule(key, retry)
+		t.mu.Unlock()
+		return nil, err
+	}
+	t.mu.Lock()
+	t.expiry[key] = tok.Expiry
+	t.schedule(key, time.Duration(float64(tok.Expiry.Sub(start))*t.opt.RenewFraction))
+	t.mu.Unlock()
+	return tok, nil
+}
+
+// schedule must be called with t.mu held. Delays shorter than MinInterval,
+// such as the ones of expired tokens, are raised to it.
+func (t *Cache) schedule(key string, d time.Duration) {
+	if t.closed {
+		return
+	}
+	if d < t.opt.MinInterval {
+		d = t.opt.MinInterval
+	}
+	if timer, ok := t.timers[key]; ok {
+		timer.Stop()
+	}
+	t.timers[key] = time.AfterFunc(d, func() {
+		t.c.Refresh(key)
+	})
+}
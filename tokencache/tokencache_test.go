@@ -0,0 +1,100 @@
+package tokencache
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenew(t *testing.T) {
+	var cnt int32
+	c := New(Options{
+		Fetcher: func(key string) (Token, error) {
+			n := atomic.AddInt32(&cnt, 1)
+			return Token{Value: strconv.Itoa(int(n)), Expiry: time.Now().Add(100 * time.Millisecond)}, nil
+		},
+		RenewFraction: 0.5,
+		MinInterval:   10 * time.Millisecond,
+	})
+	defer c.Close()
+
+	tok, err := c.Token("key")
+	if err != nil || tok.Value != "1" {
+		t.Fatalf("Token = %v, %v", tok, err)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	tok, err = c.Token("key")
+	if err != nil || tok.Value != "2" {
+		t.Fatalf("Token = %v, %v; want renewed", tok, err)
+	}
+	if !time.Now().Before(tok.Expiry) {
+		t.Fatal("expired token returned")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	var fail int32
+	c := New(Options{
+		Fetcher: func(key string) (Token, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return Token{}, errors.New("unavailable")
+			}
+			return Token{Value: "v", Expiry: time.Now().Add(50 * time.Millisecond)}, nil
+		},
+		RetryInterval: time.Hour,
+	})
+	defer c.Close()
+
+	if _, err := c.Token("key"); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Token("key"); err == nil {
+		t.Fatal("expired token returned")
+	}
+}
+
+func TestExpiredByFetcher(t *testing.T) {
+	var cnt int32
+	c := New(Options{
+		Fetcher: func(key string) (Token, error) {
+			atomic.AddInt32(&cnt, 1)
+			return Token{Value: "v", Expiry: time.Now().Add(-time.Second)}, nil
+		},
+		MinInterval: 20 * time.Millisecond,
+	})
+	defer c.Close()
+
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; time.Sleep(time.Millisecond) {
+		if _, err := c.Token("key"); err == nil {
+			t.Fatal("expired token returned")
+		}
+	}
+	if n := atomic.LoadInt32(&cnt); n > 10 {
+		t.Fatalf("fetched %d times; want at most 10", n)
+	}
+}
+
+func TestNoExpiry(t *testing.T) {
+	var cnt int32
+	c := New(Options{
+		Fetcher: func(key string) (Token, error) {
+			atomic.AddInt32(&cnt, 1)
+			return Token{Value: "v"}, nil
+		},
+		MinInterval: 20 * time.Millisecond,
+	})
+	defer c.Close()
+
+	if _, err := c.Token("key"); !errors.Is(err, ErrNoExpiry) {
+		t.Fatalf("Token error = %v; want ErrNoExpiry", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&cnt); n > 2 {
+		t.Fatalf("fetched %d times; want at most 2", n)
+	}
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ttl is the SoftTTL and HardTTL of a value.
+type ttl struct {
+	soft, hard time.Duration
+	at         int64 // unix nano time the TTLs count from, 0 for now
+}
+
+type ttlValue struct {
+	val  interface{}
+	ttl  ttl
+	life *Lifetime // set by WithLifetime instead of ttl
+}
+
+// WithTTL wraps the value returned by Fetcher to override SoftTTL and
+// HardTTL for it, a TTL not greater than 0 never expires.
+func WithTTL(val interface{}, soft, hard time.Duration) interface{} {
+	return &ttlValue{val: val, ttl: ttl{soft: soft, hard: hard}}
+}
+
+// Lifetime is when a value was stored, and when it is refreshed by SoftTTL
+// and expires by HardTTL. A zero time is none.
+type Lifetime struct {
+	Stored     time.Time
+	SoftExpiry time.Time
+	HardExpiry time.Time
+}
+
+// WithLifetime wraps the value returned by Fetcher or passed to Set and
+// SetDefault to keep the schedule it had when stored before, e.g. in a
+// snapshot restored after a restart. The SoftTTL and HardTTL of a zero
+// expiry count from Stored, and a zero Stored is now.
+func WithLifetime(val interface{}, lt Lifetime) interface{} {
+	return &ttlValue{val: val, life: &lt}
+}
+
+// unwrapTTL returns the value wrapped by WithTTL or WithLifetime and its
+// ttl, which is nil if val is not wrapped.
+func (c *cache) unwrapTTL(val interface{}) (interface{}, *ttl) {
+	tv, ok := val.(*ttlValue)
+	if !ok {
+		return val, nil
+	}
+	if tv.life == nil {
+		return tv.val, &tv.ttl
+	}
+	lt := *tv.life
+	t := &ttl{soft: c.opt.SoftTTL, hard: c.opt.HardTTL}
+	stored := lt.Stored
+	if stored.IsZero() {
+		stored = time.Now()
+	}
+	t.at = stored.UnixNano()
+	if !lt.SoftExpiry.IsZero() {
+		t.soft = time.Duration(max(lt.SoftExpiry.UnixNano()-t.at, 1))
+	}
+	if !lt.HardExpiry.IsZero() {
+		t.hard = time.Duration(max(lt.HardExpiry.UnixNano()-t.at, 1))
+	}
+	return tv.val, t
+}
+
+// deadlines sets the stored time and the deadlines of res stored now.
+func (t *ttl) deadlines(res *result) {
+	now := t.at
+	if now == 0 {
+		now = time.Now().UnixNano()
+	}
+	res.stored = now
+	if t.soft > 0 {
+		res.soft = now + int64(t.soft)
+	}
+	if t.hard > 0 {
+		res.hard = now + int64(t.hard)
+	}
+}
+
+// lifetime returns the Lifetime of res, which may be nil.
+func (res *result) lifetime() Lifetime {
+	var lt Lifetime
+	if res == nil {
+		return lt
+	}
+	for _, f := range []struct {
+		t  *time.Time
+		ns int64
+	}{{&lt.Stored, res.stored}, {&lt.SoftExpiry, res.soft}, {&lt.HardExpiry, res.hard}} {
+		if f.ns != 0 {
+			*f.t = time.Unix(0, f.ns)
+		}
+	}
+	return lt
+}
+
+// fresh reports whether the entry e of key can be served. If its HardTTL
+// has passed, e is deleted and false is returned. If its SoftTTL has passed,
+// e is refreshed in background.
+func (c *cache) fresh(key string, e *entry) bool {
+	res, _ := e.res.Load().(*result)
+	if res == nil || res.soft == 0 && res.hard == 0 {
+		return true
+	}
+	now := time.Now().UnixNano()
+	if res.hard > 0 && now >= res.hard {
+		c.remove(key, e, ReasonExpired)
+		return false
+	}
+	if res.soft > 0 && now >= res.soft && !c.IsClosed() &&
+		(c.opt.Fetcher != nil || e.reset.Load() != nil) &&
+		atomic.CompareAndSwapInt32(&res.refreshing, 0, 1) {
+		c.goLabeled("refresher", func() {
+			if c.refreshEntry(key, e) != nil {
+				atomic.StoreInt32(&res.refreshing, 0)
+			}
+		})
+	}
+	return true
+}
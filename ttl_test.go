@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSoftTTL(t *testing.T) {
+	var n int32
+	c := NewCache(Options{
+		SoftTTL: 20 * time.Millisecond,
+		Fetcher: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&n, 1), nil
+		},
+	})
+	defer c.Close()
+	v, _ := c.Get("a")
+	Assert(t, v.(int32) == 1)
+	time.Sleep(30 * time.Millisecond)
+	v, _ = c.Get("a")
+	Assert(t, v.(int32) == 1)
+	time.Sleep(10 * time.Millisecond)
+	v, _ = c.Get("a")
+	Assert(t, v.(int32) == 2)
+	Assert(t, atomic.LoadInt32(&n) == 2)
+}
+
+func TestHardTTL(t *testing.T) {
+	var n int32
+	fail := errors.New("fail")
+	var failing int32
+	c := NewCache(Options{
+		HardTTL: 20 * time.Millisecond,
+		Fetcher: func(key string) (interface{}, error) {
+			if atomic.LoadInt32(&failing) == 1 {
+				return nil, fail
+			}
+			i := atomic.AddInt32(&n, 1)
+			if key == "long" {
+				return WithTTL(i, 0, time.Hour), nil
+			}
+			return i, nil
+		},
+	})
+	defer c.Close()
+	v, _ := c.Get("a")
+	Assert(t, v.(int32) == 1)
+	v, _ = c.Get("long")
+	Assert(t, v.(int32) == 2)
+	time.Sleep(30 * time.Millisecond)
+	v, _ = c.Get("a")
+	Assert(t, v.(int32) == 3)
+	v, _ = c.Get("long")
+	Assert(t, v.(int32) == 2)
+
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(30 * time.Millisecond)
+	_, err := c.Get("a")
+	Assert(t, errors.Is(err, fail))
+	Assert(t, c.GetOrSet("b", 0) == 0)
+}
+
+func TestWithLifetime(t *testing.T) {
+	var n int32
+	c := NewCache(Options{
+		HardTTL: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&n, 1), nil
+		},
+	})
+	defer c.Close()
+	now := time.Now()
+	c.Set("old", WithLifetime("v", Lifetime{Stored: now.Add(-2 * time.Hour)}))
+	c.Set("new", WithLifetime("v", Lifetime{Stored: now.Add(-time.Minute)}))
+	Assert(t, c.SetDefault("new", "other"))
+	c.SetDefault("soon", WithLifetime("v", Lifetime{HardExpiry: now.Add(20 * time.Millisecond)}))
+
+	s := c.Snapshot()
+	lt := s.Lifetime("new")
+	Assertf(t, lt.Stored.Equal(now.Add(-time.Minute)), "stored %v", lt.Stored)
+	Assertf(t, lt.HardExpiry.Equal(now.Add(59*time.Minute)), "hard expiry %v", lt.HardExpiry)
+	Assert(t, lt.SoftExpiry.IsZero())
+	Assert(t, s.Lifetime("soon").HardExpiry.Equal(now.Add(20*time.Millisecond)))
+
+	v, _ := c.Get("old")
+	Assert(t, v.(int32) == 1)
+	v, _ = c.Get("new")
+	Assert(t, v == "v")
+	time.Sleep(30 * time.Millisecond)
+	v, _ = c.Get("soon")
+	Assert(t, v.(int32) == 2)
+
+	c.RangeEntries(func(key string, val interface{}, meta EntryInfo) bool {
+		if key == "soon" {
+			Assert(t, !meta.Lifetime.Stored.Before(now.Add(30*time.Millisecond)))
+			Assert(t, meta.Lifetime.HardExpiry.Equal(meta.Lifetime.Stored.Add(time.Hour)))
+		}
+		return true
+	})
+}
+
+func TestExpireDeadlines(t *testing.T) {
+	deleted := make(chan string, 10)
+	c := NewCache(Options{
+		HardTTL:         50 * time.Millisecond,
+		ExpireDeadlines: true,
+		Fetcher: func(key string) (interface{}, error) {
+			if key == "long" {
+				return WithTTL(key, 0, time.Hour), nil
+			}
+			return key, nil
+		},
+		DeleteHandler: func(key string, oldData interface{}, reason DeleteReason) {
+			if reason == ReasonExpired {
+				deleted <- key
+			}
+		},
+	}).(*cache)
+	defer c.Close()
+
+	c.Set("b", WithTTL("b", 0, time.Hour))
+	c.ReplaceAll(map[string]interface{}{"a": "a"})
+	c.Get("long")
+	c.Set("b", WithTTL("b", 0, 10*time.Millisecond))
+
+	// the entries expire without access, in the order of their deadlines
+	first, second := <-deleted, <-deleted
+	Assertf(t, first == "b" && second == "a", "deleted %q, %q", first, second)
+	select {
+	case key := <-deleted:
+		t.Fatalf("%q deleted", key)
+	case <-time.After(100 * time.Millisecond):
+	}
+	DeepEqual(t, c.Dump(), map[string]interface{}{"long": "long"})
+
+	// a replaced value is deleted by its own deadline
+	c.Set("c", WithTTL("c", 0, 10*time.Millisecond))
+	c.Set("c", WithTTL("c2", 0, time.Hour))
+	time.Sleep(50 * time.Millisecond)
+	val, _ := c.Get("c")
+	Assert(t, val == "c2")
+
+	// an entry is in the heap once however often it is replaced, and leaves
+	// it once deleted
+	for i := 0; i < 50; i++ {
+		c.Set("c", WithTTL("c", 0, time.Hour))
+	}
+	c.deadlines.mu.Lock()
+	n := len(c.deadlines.h)
+	c.deadlines.mu.Unlock()
+	Assertf(t, n == 2, "%d deadlines", n)
+	c.Delete("c")
+	c.deadlines.mu.Lock()
+	n = len(c.deadlines.h)
+	c.deadlines.mu.Unlock()
+	Assertf(t, n == 1, "%d deadlines", n)
+}
+
+// BenchmarkExpireMostlyFresh expires 100k entries none of which is due, by
+// the deadlines of ExpireDeadlines and by an expire cycle.
+func BenchmarkExpireMostlyFresh(b *testing.B) {
+	const n = 100000
+	newCache := func(opt Options) *cache {
+		opt.Fetcher = func(key string) (interface{}, error) {
+			return key, nil
+		}
+		c := NewCache(opt).(*cache)
+		for i := 0; i < n; i++ {
+			c.Get(strconv.Itoa(i))
+		}
+		return c
+	}
+	b.Run("deadlines", func(b *testing.B) {
+		c := newCache(Options{HardTTL: time.Hour, ExpireDeadlines: true})
+		defer c.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c.expireDue()
+		}
+	})
+	b.Run("sweep", func(b *testing.B) {
+		c := newCache(Options{EnableExpire: true, ExpireDuration: time.Hour})
+		defer c.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c.expire()
+			b.StopTimer()
+			// the entries are read between the cycles
+			c.rangeEntries(func(_ string, e *entry) bool {
+				e.unmarkExpiring()
+				return true
+			})
+			b.StartTimer()
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package cache
+
+// maxFetchRetries is the number of times VerdictRetryNow is followed in a
+// refresh, to not retry forever.
+const maxFetchRetries = 3
+
+// ErrorVerdict is the handling of a refresh failure decided by OnFetchError.
+type ErrorVerdict int
+
+const (
+	// VerdictDefault keeps the cached value, and caches the error only if an
+	// error is cached already.
+	VerdictDefault ErrorVerdict = iota
+	// VerdictRetryNow fetches again at once, up to 3 times in a row.
+	VerdictRetryNow
+	// VerdictRetryNextCycle caches the error along with the stale value, so
+	// that Get reports it until the next refresh cycle succeeds.
+	VerdictRetryNextCycle
+	// VerdictDelete deletes the entry, so that the next Get fetches it again.
+	VerdictDelete
+	// VerdictKeepStale keeps the cached value and error untouched.
+	VerdictKeepStale
+)
+
+// verdict returns the verdict of OnFetchError on the refresh failure of key
+// after the number of retries.
+func (c *cache) verdict(key string, err error, retries int) ErrorVerdict {
+	if c.opt.OnFetchError == nil {
+		return VerdictDefault
+	}
+	v := c.opt.OnFetchError(key, err)
+	if v == VerdictRetryNow && (retries >= maxFetchRetries || c.IsClosed()) {
+		return VerdictDefault
+	}
+	return v
+}
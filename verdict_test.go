@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnFetchError(t *testing.T) {
+	errTransient := errors.New("transient")
+	errGone := errors.New("gone")
+	var fetches int32
+	var fail atomic.Value
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			atomic.AddInt32(&fetches, 1)
+			if err, _ := fail.Load().(error); err != nil {
+				return nil, err
+			}
+			return key, nil
+		},
+		OnFetchError: func(key string, err error) ErrorVerdict {
+			switch {
+			case errors.Is(err, errTransient):
+				return VerdictRetryNow
+			case errors.Is(err, errGone):
+				return VerdictDelete
+			}
+			return VerdictRetryNextCycle
+		},
+	}).(*cache)
+	defer c.Close()
+	c.Get("a")
+
+	fail.Store(errTransient)
+	atomic.StoreInt32(&fetches, 0)
+	Assert(t, c.Refresh("a") != nil)
+	Assert(t, atomic.LoadInt32(&fetches) == 1+maxFetchRetries)
+	v, err := c.Get("a")
+	Assert(t, v == "a" && err == nil)
+
+	fail.Store(errors.New("other"))
+	c.Refresh("a")
+	v, err = c.Get("a")
+	Assert(t, v == "a" && err != nil)
+
+	fail.Store(errGone)
+	c.Refresh("a")
+	_, ok := c.data().Load("a")
+	Assert(t, !ok)
+}
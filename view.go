@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypedView is a view over a Cache with values of type T.
+type TypedView[T any] struct {
+	c Cache
+}
+
+// View wraps c with type-checked access to values of type T, so that the
+// users sharing c can not break each other by caching values of other types.
+// Values of other types are reported by TypeMismatchError, nil values are
+// read as the zero value of T.
+func View[T any](c Cache) TypedView[T] {
+	return TypedView[T]{c: c}
+}
+
+// Cache returns the backing cache.
+func (v TypedView[T]) Cache() Cache {
+	return v.c
+}
+
+// Get is Cache.Get of values of type T.
+func (v TypedView[T]) Get(key string) (T, error) {
+	val, err := v.c.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.assert(key, val)
+}
+
+// GetOrSet is Cache.GetOrSet of values of type T, it returns def with the
+// error if the cached value is of another type.
+func (v TypedView[T]) GetOrSet(key string, def T) (T, error) {
+	val, err := v.assert(key, v.c.GetOrSet(key, def))
+	if err != nil {
+		return def, err
+	}
+	return val, nil
+}
+
+// SetDefault is Cache.SetDefault of values of type T.
+func (v TypedView[T]) SetDefault(key string, val T) bool {
+	return v.c.SetDefault(key, val)
+}
+
+// Set is Cache.Set of values of type T.
+func (v TypedView[T]) Set(key string, val T) {
+	v.c.Set(key, val)
+}
+
+func (v TypedView[T]) assert(key string, val interface{}) (T, error) {
+	if t, ok := val.(T); ok {
+		return t, nil
+	}
+	var zero T
+	if val == nil {
+		return zero, nil
+	}
+	return zero, &TypeMismatchError{
+		Key:  key,
+		Want: reflect.TypeOf((*T)(nil)).Elem(),
+		Got:  reflect.TypeOf(val),
+	}
+}
+
+// GetAs gets the value of key from c and stores it in the value pointed to
+// by out, which MUST be a non-nil pointer. It returns TypeMismatchError
+// instead of panicking if the value is not assignable to it, nil values
+// are stored as the zero value.
+func GetAs(c Reader, key string, out interface{}) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("asynccache: GetAs into non-pointer %T", out)
+	}
+	val, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+	return assign(ptr.Elem(), key, val)
+}
+
+// assign sets dst to val of key, or returns TypeMismatchError.
+func assign(dst reflect.Value, key string, val interface{}) error {
+	if val == nil {
+		dst.SetZero()
+		return nil
+	}
+	v := reflect.ValueOf(val)
+	if !v.Type().AssignableTo(dst.Type()) {
+		return &TypeMismatchError{Key: key, Want: dst.Type(), Got: v.Type()}
+	}
+	dst.Set(v)
+	return nil
+}
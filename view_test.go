@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	c := NewCache(Options{})
+	ints := View[int](c)
+	strs := View[string](c)
+
+	ints.Set("a", 1)
+	Assert(t, !strs.SetDefault("b", "b"))
+
+	n, err := ints.Get("a")
+	Assert(t, err == nil && n == 1)
+	s, err := strs.GetOrSet("b", "def")
+	Assert(t, err == nil && s == "b")
+
+	_, err = strs.Get("a")
+	Assert(t, errors.Is(err, ErrTypeMismatch))
+	Assert(t, err.Error() == `asynccache: type mismatch of "a": want string, got int`)
+	n, err = ints.GetOrSet("b", 2)
+	Assert(t, errors.Is(err, ErrTypeMismatch) && n == 2)
+
+	_, err = ints.Get("missing")
+	Assert(t, err == ErrNoFetcher)
+	Assert(t, ints.Cache() == c)
+}
+
+func TestGetAs(t *testing.T) {
+	c := NewCache(Options{})
+	c.Set("n", 1)
+	c.Set("nil", nil)
+
+	var n int
+	Assert(t, GetAs(c, "n", &n) == nil && n == 1)
+	var any interface{}
+	Assert(t, GetAs(c, "n", &any) == nil && any == 1)
+	n = 3
+	Assert(t, GetAs(c, "nil", &n) == nil && n == 0)
+
+	var s string
+	err := GetAs(c, "n", &s)
+	var mismatch *TypeMismatchError
+	Assert(t, errors.As(err, &mismatch) && mismatch.Want.Kind() == reflect.String && mismatch.Got.Kind() == reflect.Int)
+	Assert(t, GetAs(c, "n", s) != nil)
+	Assert(t, GetAs(c, "missing", &n) == ErrNoFetcher)
+}
+
+// getter mocks the Get of Reader only.
+type getter struct {
+	Reader
+	val interface{}
+}
+
+func (g getter) Get(key string) (interface{}, error) {
+	return g.val, nil
+}
+
+func TestGetAsReader(t *testing.T) {
+	var n int
+	Assert(t, GetAs(getter{val: 7}, "n", &n) == nil && n == 7)
+	var v struct{ A int }
+	Assert(t, GetJSON(getter{val: `{"A":1}`}, "j", &v) == nil && v.A == 1)
+}
@@ -0,0 +1,320 @@
+// Package wal keeps a write-ahead log of the changes of a Cache in an
+// append-only file, for audits and for fast recovery of large caches.
+//
+// A Log is set as Options.WAL to append every change: values set, fetched
+// and refreshed are recorded as ChangeSet, and deleted keys as ChangeDelete.
+// Replay restores a cache from the file on startup, and Compact rewrites the
+// file with only the current entries.
+//
+// A record is framed by the uvarint length of the payload and followed by
+// its CRC-32 (IEEE), so a record torn by a crash is detected and dropped.
+// The payload is the op, the unix nano time, the unix nano times the value
+// was stored and expires by SoftTTL and HardTTL (0 if none), the key, and
+// the value encoded by the Codec or the error text. Replayed values keep
+// their Lifetime, and the values past HardExpiry are deleted.
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+const (
+	kindNone byte = iota
+	kindValue
+	kindErr
+)
+
+// Log is a write-ahead log file.
+type Log struct {
+	mu        sync.Mutex
+	path      string
+	codec     asynccache.Codec
+	f         *os.File
+	w         *bufio.Writer
+	replaying atomic.Bool
+	buf       bytes.Buffer
+}
+
+// Open opens the log file at path, which is created if it does not exist.
+func Open(path string, codec asynccache.Codec) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, codec: codec, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Append implements asynccache.ChangeAppender, the record is written to the
+// file before Append returns. The cache appends its changes in background,
+// Flush of the cache waits for them. Changes made by Replay are not appended.
+func (l *Log) Append(rec asynccache.ChangeRecord) error {
+	if l.replaying.Load() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.write(rec, time.Now()); err != nil {
+		return err
+	}
+	return l.w.Flush()
+}
+
+func (l *Log) write(rec asynccache.ChangeRecord, now time.Time) error {
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	b := &l.buf
+	b.Reset()
+	b.WriteByte(byte(rec.Op))
+	b.Write(binary.AppendVarint(nil, now.UnixNano()))
+	for _, t := range []time.Time{rec.Lifetime.Stored, rec.Lifetime.SoftExpiry, rec.Lifetime.HardExpiry} {
+		var ns int64
+		if !t.IsZero() {
+			ns = t.UnixNano()
+		}
+		b.Write(binary.AppendVarint(nil, ns))
+	}
+	writeBytes(b, []byte(rec.Key))
+	switch {
+	case rec.Err != nil:
+		b.WriteByte(kindErr)
+		writeBytes(b, []byte(rec.Err.Error()))
+	case rec.Op == asynccache.ChangeSet && rec.Value != nil:
+		data, err := l.codec.Marshal(rec.Value)
+		if err != nil {
+			return err
+		}
+		b.WriteByte(kindValue)
+		writeBytes(b, data)
+	default:
+		b.WriteByte(kindNone)
+	}
+	l.w.Write(binary.AppendUvarint(nil, uint64(b.Len())))
+	l.w.Write(b.Bytes())
+	_, err := l.w.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(b.Bytes())))
+	return err
+}
+
+func writeBytes(b *bytes.Buffer, data []byte) {
+	b.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	b.Write(data)
+}
+
+// Replay applies the records of the file to c in order, and truncates a
+// record torn at the end of the file. It returns the number of records, and
+// should be called before c is used, as changes made meanwhile are not
+// appended.
+func (l *Log) Replay(c asynccache.Cache) (int, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	l.replaying.Store(true)
+	defer l.replaying.Store(false)
+	// the changes of the replay are appended by c in background, they are
+	// skipped before replaying is cleared.
+	defer c.Flush(context.Background())
+
+	r := &countingReader{r: bufio.NewReader(f)}
+	n := 0
+	for {
+		good := r.n
+		rec, err := l.read(r)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			if errors.Is(err, errCorrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+				// torn by a crash while appending
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				return n, l.f.Truncate(good)
+			}
+			return n, err
+		}
+		n++
+		hard := rec.Lifetime.HardExpiry
+		switch {
+		case rec.Op == asynccache.ChangeDelete, !hard.IsZero() && !hard.After(time.Now()):
+			c.Delete(rec.Key)
+		case rec.Op == asynccache.ChangeSet && rec.Err == nil:
+			c.Set(rec.Key, asynccache.WithLifetime(rec.Value, rec.Lifetime))
+		}
+	}
+}
+
+var errCorrupt = errors.New("wal: corrupt record")
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (l *Log) read(r *countingReader) (asynccache.ChangeRecord, error) {
+	var rec asynccache.ChangeRecord
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return rec, err
+	}
+	frame := make([]byte, size+4)
+	if _, err = io.ReadFull(r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return rec, err
+	}
+	payload := frame[:size]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(frame[size:]) {
+		return rec, errCorrupt
+	}
+	p := bytes.NewReader(payload)
+	op, _ := p.ReadByte()
+	rec.Op = asynccache.ChangeOp(op)
+	if _, err = binary.ReadVarint(p); err != nil {
+		return rec, errCorrupt
+	}
+	for _, t := range []*time.Time{&rec.Lifetime.Stored, &rec.Lifetime.SoftExpiry, &rec.Lifetime.HardExpiry} {
+		ns, err := binary.ReadVarint(p)
+		if err != nil {
+			return rec, errCorrupt
+		}
+		if ns != 0 {
+			*t = time.Unix(0, ns)
+		}
+	}
+	key, err := readBytes(p)
+	if err != nil {
+		return rec, err
+	}
+	rec.Key = string(key)
+	kind, err := p.ReadByte()
+	if err != nil {
+		return rec, errCorrupt
+	}
+	if kind == kindNone {
+		return rec, nil
+	}
+	data, err := readBytes(p)
+	if err != nil {
+		return rec, err
+	}
+	if kind == kindErr {
+		rec.Err = errors.New(string(data))
+		return rec, nil
+	}
+	if rec.Value, err = l.codec.Unmarshal(data); err != nil {
+		return rec, fmt.Errorf("wal: decode %q: %w", rec.Key, err)
+	}
+	return rec, nil
+}
+
+func readBytes(p *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(p)
+	if err != nil || n > uint64(p.Len()) {
+		return nil, errCorrupt
+	}
+	b := make([]byte, n)
+	p.Read(b)
+	return b, nil
+}
+
+// Compact rewrites the file with a record per entry of c caching a value,
+// and replaces the file atomically. Appends wait meanwhile.
+func (l *Log) Compact(c asynccache.Cache) error {
+	// the changes queued by c are covered by the rewrite, they are appended
+	// first rather than after it.
+	if err := c.Flush(context.Background()); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tmp := l.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	old, oldW := l.f, l.w
+	l.f, l.w = f, bufio.NewWriter(f)
+	now := time.Now()
+	s := c.Snapshot()
+	s.Range(func(key string, val interface{}, ferr error) bool {
+		if ferr == nil {
+			rec := asynccache.ChangeRecord{Op: asynccache.ChangeSet, Key: key, Value: val, Lifetime: s.Lifetime(key)}
+			err = l.write(rec, now)
+		}
+		return err == nil
+	})
+	if err == nil {
+		err = l.w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmp, l.path)
+	}
+	if err != nil {
+		l.f, l.w = old, oldW
+		return err
+	}
+	old.Close()
+	l.f, err = os.OpenFile(l.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		l.f = nil
+		return err
+	}
+	l.w = bufio.NewWriter(l.f)
+	return nil
+}
+
+// Sync commits the file to stable storage.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	return l.f.Sync()
+}
+
+// Close closes the file, the cache using the Log should be closed first.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
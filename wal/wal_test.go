@@ -0,0 +1,94 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	asynccache "github.com/MinoGump/go-asynccache"
+)
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	l, err := Open(path, asynccache.StringCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := asynccache.NewCache(asynccache.Options{WAL: l})
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("a", "3")
+	c.Delete("b")
+	c.Set("c", "4")
+	stored := c.Snapshot().Lifetime("c").Stored
+	c.Flush(context.Background())
+	l.Append(asynccache.ChangeRecord{Op: asynccache.ChangeSet, Key: "e", Err: errors.New("failed")})
+	c.Close()
+	l.Close()
+
+	// tear the last record
+	fi, _ := os.Stat(path)
+	os.Truncate(path, fi.Size()-2)
+
+	l, err = Open(path, asynccache.StringCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c = asynccache.NewCache(asynccache.Options{WAL: l})
+	defer c.Close()
+	n, err := l.Replay(c)
+	if err != nil || n != 5 {
+		t.Fatalf("Replay = %v, %v", n, err)
+	}
+	if data := c.Dump(); len(data) != 2 || data["a"] != "3" || data["c"] != "4" {
+		t.Fatalf("Dump = %v", data)
+	}
+	if lt := c.Snapshot().Lifetime("c"); !lt.Stored.Equal(stored) {
+		t.Fatalf("Lifetime = %+v, stored %v", lt, stored)
+	}
+	if fi2, _ := os.Stat(path); fi2.Size() >= fi.Size()-2 {
+		t.Fatalf("torn record is not truncated, size %d", fi2.Size())
+	}
+
+	c.Set("d", "5")
+	c.Flush(context.Background())
+	c2 := asynccache.NewCache(asynccache.Options{})
+	defer c2.Close()
+	if n, err := l.Replay(c2); err != nil || n != 6 || c2.Dump()["d"] != "5" {
+		t.Fatalf("Replay after append = %v, %v, %v", n, err, c2.Dump())
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	l, err := Open(path, asynccache.StringCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c := asynccache.NewCache(asynccache.Options{WAL: l})
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		c.Set("a", "v")
+		c.Set("b", "v")
+		c.Delete("b")
+	}
+	if err := l.Compact(c); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("c", "v")
+	c.Flush(context.Background())
+
+	c2 := asynccache.NewCache(asynccache.Options{})
+	defer c2.Close()
+	n, err := l.Replay(c2)
+	if err != nil || n != 2 {
+		t.Fatalf("Replay = %v, %v", n, err)
+	}
+	if data := c2.Dump(); len(data) != 2 || data["a"] != "v" || data["c"] != "v" {
+		t.Fatalf("Dump = %v", data)
+	}
+}
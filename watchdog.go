@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// loop is a background goroutine of the cache.
+type loop struct {
+	name  string
+	run   func()
+	alive int32
+}
+
+// startLoop starts run as a background goroutine watched by the watchdog.
+func (c *cache) startLoop(name string, run func()) {
+	l := &loop{name: name, run: run}
+	c.loops = append(c.loops, l)
+	c.goLoop(l)
+}
+
+func (c *cache) goLoop(l *loop) {
+	atomic.StoreInt32(&l.alive, 1)
+	c.goLabeled(l.name, func() {
+		defer atomic.StoreInt32(&l.alive, 0)
+		if c.opt.EnableWatchdog {
+			defer func() {
+				if r := recover(); r != nil {
+					c.opt.ErrLogFunc(fmt.Sprintf("asynccache: %s panicked: %v", l.name, r))
+				}
+			}()
+		}
+		l.run()
+	})
+}
+
+// goLabeled runs fn in a goroutine labeled with the Name of the cache and
+// the name of the goroutine, so that profiles attribute its time to the cache.
+// The goroutines started by fn inherit the labels.
+func (c *cache) goLabeled(name string, fn func()) {
+	labels := pprof.Labels("asynccache.name", c.opt.Name, "asynccache.goroutine", name)
+	go pprof.Do(context.Background(), labels, func(context.Context) {
+		fn()
+	})
+}
+
+// watchdog restarts the dead loops until the cache is closed.
+func (c *cache) watchdog() {
+	ticker := time.NewTicker(c.opt.WatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, l := range c.loops {
+				if atomic.LoadInt32(&l.alive) == 0 && !c.IsClosed() {
+					c.goLoop(l)
+					c.emit(Event{Type: EventLoopRestarted, Key: l.name})
+				}
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	var cnt int32
+	events := make(chan Event, 10)
+	c := NewCache(Options{
+		EnableRefresh:   true,
+		RefreshDuration: 10 * time.Millisecond,
+		Fetcher: func(key string) (interface{}, error) {
+			if atomic.AddInt32(&cnt, 1) == 2 {
+				panic("refresh")
+			}
+			return key, nil
+		},
+		EnableWatchdog:   true,
+		WatchdogInterval: 20 * time.Millisecond,
+		EventHandler: func(ev Event) {
+			if ev.Type == EventLoopRestarted {
+				events <- ev
+			}
+		},
+		ErrLogFunc: func(string) {},
+	})
+	defer c.Close()
+
+	c.Get("a")
+	ev := <-events
+	Assert(t, ev.Type == EventLoopRestarted && ev.Key == "refresher")
+	time.Sleep(50 * time.Millisecond)
+	Assert(t, atomic.LoadInt32(&cnt) > 2)
+}
+
+func TestGoroutineLabels(t *testing.T) {
+	c := NewCache(Options{
+		Name:            "users",
+		EnableRefresh:   true,
+		RefreshDuration: time.Hour,
+		Fetcher: func(key string) (interface{}, error) {
+			return key, nil
+		},
+	})
+	defer c.Close()
+	time.Sleep(10 * time.Millisecond)
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	profile := buf.String()
+	Assert(t, strings.Contains(profile, `"asynccache.goroutine":"refresher"`))
+	Assert(t, strings.Contains(profile, `"asynccache.goroutine":"dispatcher"`))
+	Assert(t, strings.Contains(profile, `"asynccache.name":"users"`))
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type writeBehind struct {
+	c *cache
+
+	mu      sync.Mutex
+	pending map[string]interface{}
+	order   []string
+
+	flushMu sync.Mutex // serializes flushes
+	notify  chan struct{}
+	stop    chan struct{}
+}
+
+func newWriteBehind(c *cache) *writeBehind {
+	if c.opt.Writer == nil && c.opt.BatchWriter == nil {
+		panic("asynccache: invalid Writer")
+	}
+	if c.opt.WriteBehindInterval == 0 {
+		c.opt.WriteBehindInterval = time.Second
+	}
+	if c.opt.WriteBehindBatchSize <= 0 {
+		c.opt.WriteBehindBatchSize = 100
+	}
+	return &writeBehind{
+		c:       c,
+		pending: make(map[string]interface{}),
+		notify:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// PutAsync sets the value of given key and enqueues it to be written by the flusher.
+func (c *cache) PutAsync(key string, val interface{}) error {
+	key = c.key(key)
+	if c.IsClosed() {
+		return ErrClosed
+	}
+	if c.wb == nil {
+		return ErrNoWriteBehind
+	}
+	c.Set(key, val)
+	c.wb.enqueue(key, val)
+	return nil
+}
+
+// Flush writes all values enqueued by PutAsync, and waits for the changes
+// queued for WAL.
+func (c *cache) Flush(ctx context.Context) error {
+	if err := c.flushWAL(ctx); err != nil {
+		return err
+	}
+	if c.wb == nil {
+		return nil
+	}
+	return c.wb.flush(ctx)
+}
+
+func (w *writeBehind) enqueue(key string, val interface{}) {
+	w.mu.Lock()
+	if _, ok := w.pending[key]; !ok {
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = val
+	full := len(w.order) >= w.c.opt.WriteBehindBatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *writeBehind) flusher() {
+	ticker := time.NewTicker(w.c.opt.WriteBehindInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.notify:
+		case <-w.stop:
+			return
+		}
+		w.flush(context.Background())
+	}
+}
+
+// take dequeues a batch of pending values.
+func (w *writeBehind) take() map[string]interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(w.order)
+	if n > w.c.opt.WriteBehindBatchSize {
+		n = w.c.opt.WriteBehindBatchSize
+	}
+	batch := make(map[string]interface{}, n)
+	for _, key := range w.order[:n] {
+		batch[key] = w.pending[key]
+		delete(w.pending, key)
+	}
+	w.order = w.order[n:]
+	return batch
+}
+
+// superseded reports whether a newer value of the key is pending.
+func (w *writeBehind) superseded(key string) bool {
+	w.mu.Lock()
+	_, ok := w.pending[key]
+	w.mu.Unlock()
+	return ok
+}
+
+// flush writes pending values batch by batch, and returns the errors of the
+// values failed after all retries.
+func (w *writeBehind) flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	var errs []error
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		batch := w.take()
+		if len(batch) == 0 {
+			return errors.Join(errs...)
+		}
+		failed := w.write(batch)
+		for i := 0; i < w.c.opt.WriteBehindRetries && len(failed) > 0; i++ {
+			select {
+			case <-time.After(w.c.opt.WriteBehindRetryBackoff):
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			retry := make(map[string]interface{}, len(failed))
+			for key := range failed {
+				if !w.superseded(key) {
+					retry[key] = batch[key]
+				}
+			}
+			failed = w.write(retry)
+		}
+		for key, err := range failed {
+			if w.c.opt.ErrorHandler != nil {
+				w.c.dispatch(func() { w.c.opt.ErrorHandler(key, err) })
+			}
+			errs = append(errs, err)
+		}
+	}
+}
+
+// write writes the batch and returns the errors by key.
+func (w *writeBehind) write(batch map[string]interface{}) map[string]error {
+	if len(batch) == 0 {
+		return nil
+	}
+	failed := make(map[string]error)
+	if w.c.opt.BatchWriter != nil {
+		if err := w.c.opt.BatchWriter(batch); err != nil {
+			for key := range batch {
+				failed[key] = wrapErr("write", key, err)
+			}
+		}
+		return failed
+	}
+	for key, val := range batch {
+		if err := w.c.opt.Writer(key, val); err != nil {
+			failed[key] = wrapErr("write", key, err)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPutAsync(t *testing.T) {
+	var mu sync.Mutex
+	store := map[string]interface{}{}
+	var batches int32
+	op := Options{
+		Fetcher: func(key string) (interface{}, error) {
+			return nil, errors.New("error")
+		},
+		EnableWriteBehind:    true,
+		WriteBehindInterval:  time.Hour,
+		WriteBehindBatchSize: 2,
+		BatchWriter: func(vals map[string]interface{}) error {
+			atomic.AddInt32(&batches, 1)
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range vals {
+				store[k] = v
+			}
+			return nil
+		},
+	}
+	c := NewCache(op)
+
+	Assert(t, c.PutAsync("k1", "v1") == nil)
+	Assert(t, c.PutAsync("k1", "v2") == nil)
+	v, err := c.Get("k1")
+	Assert(t, err == nil)
+	Assert(t, v.(string) == "v2")
+
+	// reaching the batch size triggers the flusher
+	Assert(t, c.PutAsync("k2", "v3") == nil)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	Assert(t, store["k1"] == "v2" && store["k2"] == "v3")
+	mu.Unlock()
+	Assert(t, atomic.LoadInt32(&batches) == 1)
+
+	Assert(t, c.PutAsync("k3", "v4") == nil)
+	Assert(t, c.Flush(context.Background()) == nil)
+	mu.Lock()
+	Assert(t, store["k3"] == "v4")
+	mu.Unlock()
+}
+
+func TestPutAsyncRetry(t *testing.T) {
+	var calls int32
+	var failed int32
+	op := Options{
+		EnableWriteBehind:       true,
+		WriteBehindInterval:     time.Hour,
+		WriteBehindRetries:      2,
+		WriteBehindRetryBackoff: time.Millisecond,
+		Writer: func(key string, val interface{}) error {
+			if atomic.AddInt32(&calls, 1) < 3 || key == "bad" {
+				return errors.New("error")
+			}
+			return nil
+		},
+		ErrorHandler: func(key string, err error) {
+			atomic.AddInt32(&failed, 1)
+		},
+	}
+	c := NewCache(op)
+
+	c.PutAsync("key", "val")
+	Assert(t, c.Flush(context.Background()) == nil)
+	Assert(t, atomic.LoadInt32(&calls) == 3)
+
+	c.PutAsync("bad", "val")
+	Assert(t, c.Flush(context.Background()) != nil)
+	c.Close()
+	Assert(t, atomic.LoadInt32(&failed) == 1)
+
+	c = NewCache(Options{})
+	Assert(t, c.PutAsync("key", "val") != nil)
+}